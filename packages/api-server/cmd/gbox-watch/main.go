@@ -0,0 +1,247 @@
+//go:build linux
+
+// gbox-watch reports the changes to a directory as JSON lines on stdout, using inotify.
+// The API server copies it into boxes to serve file watches; it prints {"type":"ready"}
+// once the watches are in place and exits when stdin or stdout is closed.
+//
+// Usage: gbox-watch [-r] PATH
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// exitUnsupported tells the server inotify is unavailable so it falls back to polling
+const exitUnsupported = 3
+
+const watchMask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_DELETE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+type event struct {
+	Type    string `json:"type"`
+	Path    string `json:"path,omitempty"`
+	OldPath string `json:"oldPath,omitempty"`
+	IsDir   bool   `json:"isDir,omitempty"`
+}
+
+// pendingMove is the first half of a rename, matched with its second half by cookie
+type pendingMove struct {
+	cookie uint32
+	path   string
+	isDir  bool
+}
+
+type watcher struct {
+	fd        int
+	root      string
+	recursive bool
+	paths     map[int32]string
+	out       *bufio.Writer
+	enc       *json.Encoder
+}
+
+func main() {
+	recursive := flag.Bool("r", false, "watch subdirectories too")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: gbox-watch [-r] PATH")
+		os.Exit(2)
+	}
+
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "inotify unavailable: %v\n", err)
+		os.Exit(exitUnsupported)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	w := &watcher{
+		fd:        fd,
+		root:      filepath.Clean(flag.Arg(0)),
+		recursive: *recursive,
+		paths:     make(map[int32]string),
+		out:       out,
+		enc:       json.NewEncoder(out),
+	}
+	if err := w.add(w.root, false); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to watch %s: %v\n", w.root, err)
+		if err == syscall.ENOSPC || err == syscall.EMFILE {
+			os.Exit(exitUnsupported)
+		}
+		os.Exit(1)
+	}
+	w.emit(event{Type: "ready"})
+	w.flush()
+
+	// The server closes stdin when the client goes away
+	go func() {
+		io.Copy(io.Discard, os.Stdin)
+		os.Exit(0)
+	}()
+
+	if err := w.run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// add watches a directory, and its subdirectories if the watch is recursive. Entries
+// found in directories created after the watch started are reported as created, as
+// they may have been created before the directory was watched.
+func (w *watcher) add(dir string, report bool) error {
+	wd, err := syscall.InotifyAddWatch(w.fd, dir, watchMask)
+	if err != nil {
+		return err
+	}
+	w.paths[int32(wd)] = dir
+	if !w.recursive {
+		return nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		// Gone already or unreadable, its own events tell
+		return nil
+	}
+	for _, entry := range entries {
+		p := filepath.Join(dir, entry.Name())
+		if report {
+			w.emit(event{Type: "create", Path: p, IsDir: entry.IsDir()})
+		}
+		if entry.IsDir() {
+			// Running out of watches is fatal, directories that are gone already are not
+			if err := w.add(p, report); err == syscall.ENOSPC {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rename updates the paths of the watches under a renamed directory
+func (w *watcher) rename(oldPath, newPath string) {
+	for wd, p := range w.paths {
+		if p == oldPath || strings.HasPrefix(p, oldPath+"/") {
+			w.paths[wd] = newPath + strings.TrimPrefix(p, oldPath)
+		}
+	}
+}
+
+// remove stops watching a directory moved out of the watched tree
+func (w *watcher) remove(dir string) {
+	for wd, p := range w.paths {
+		if p == dir || strings.HasPrefix(p, dir+"/") {
+			syscall.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.paths, wd)
+		}
+	}
+}
+
+func (w *watcher) run() error {
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := syscall.Read(w.fd, buf)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read inotify events: %w", err)
+		}
+
+		var moves []pendingMove
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(raw.Len)]
+			offset += syscall.SizeofInotifyEvent + int(raw.Len)
+
+			if raw.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				fmt.Fprintln(os.Stderr, "inotify queue overflow, events were lost")
+				continue
+			}
+			if raw.Mask&syscall.IN_IGNORED != 0 {
+				delete(w.paths, raw.Wd)
+				continue
+			}
+			dir, ok := w.paths[raw.Wd]
+			if !ok {
+				continue
+			}
+			if raw.Mask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF) != 0 {
+				if dir == w.root {
+					w.emit(event{Type: "delete", Path: w.root, IsDir: true})
+					w.flush()
+					return nil
+				}
+				continue
+			}
+
+			p := filepath.Join(dir, string(bytes.TrimRight(nameBytes, "\x00")))
+			isDir := raw.Mask&syscall.IN_ISDIR != 0
+			switch {
+			case raw.Mask&syscall.IN_CREATE != 0:
+				w.emit(event{Type: "create", Path: p, IsDir: isDir})
+				if isDir && w.recursive {
+					w.add(p, true)
+				}
+			case raw.Mask&syscall.IN_MODIFY != 0:
+				w.emit(event{Type: "modify", Path: p, IsDir: isDir})
+			case raw.Mask&syscall.IN_DELETE != 0:
+				w.emit(event{Type: "delete", Path: p, IsDir: isDir})
+			case raw.Mask&syscall.IN_MOVED_FROM != 0:
+				moves = append(moves, pendingMove{cookie: raw.Cookie, path: p, isDir: isDir})
+			case raw.Mask&syscall.IN_MOVED_TO != 0:
+				matched := false
+				for i, move := range moves {
+					if move.cookie == raw.Cookie {
+						w.emit(event{Type: "rename", Path: p, OldPath: move.path, IsDir: isDir})
+						if isDir {
+							w.rename(move.path, p)
+						}
+						moves = append(moves[:i], moves[i+1:]...)
+						matched = true
+						break
+					}
+				}
+				if !matched {
+					// Moved in from outside of the watched tree
+					w.emit(event{Type: "create", Path: p, IsDir: isDir})
+					if isDir && w.recursive {
+						w.add(p, true)
+					}
+				}
+			}
+		}
+
+		// Moved out of the watched tree
+		for _, move := range moves {
+			w.emit(event{Type: "delete", Path: move.path, IsDir: move.isDir})
+			if move.isDir {
+				w.remove(move.path)
+			}
+		}
+		w.flush()
+	}
+}
+
+func (w *watcher) emit(e event) {
+	if err := w.enc.Encode(e); err != nil {
+		os.Exit(0)
+	}
+}
+
+func (w *watcher) flush() {
+	if err := w.out.Flush(); err != nil {
+		// The server went away
+		os.Exit(0)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// gbox-watch runs inside boxes, which are Linux containers
+func main() {
+	fmt.Fprintln(os.Stderr, "gbox-watch only runs on Linux")
+	os.Exit(3)
+}
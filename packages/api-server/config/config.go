@@ -27,6 +27,9 @@ type Config struct {
 	File    FileConfig
 	Cluster ClusterConfig
 	Browser BrowserConfig
+	Exec    ExecConfig
+	RunCode RunCodeConfig `mapstructure:"run_code"`
+	Git     GitConfig
 }
 
 // ServerConfig represents server configuration
@@ -44,6 +47,32 @@ type FileConfig struct {
 	Home      string `mapstructure:"home"`
 	Share     string `mapstructure:"share"`
 	HostShare string `mapstructure:"host_share"`
+	// MaxReadBytes caps the bytes returned by a single file read
+	MaxReadBytes int64 `mapstructure:"max_read_bytes"`
+	// WatchHelper is the gbox-watch binary copied into boxes to watch files with inotify,
+	// defaults to gbox-watch next to the server executable
+	WatchHelper string `mapstructure:"watch_helper"`
+	// ShareSecret signs the URLs of shared files; a random secret is used if it is empty,
+	// so URLs stop working when the server restarts
+	ShareSecret string `mapstructure:"share_secret"`
+	// ShareURLTTL is how long the URL of a shared file is valid by default
+	ShareURLTTL time.Duration `mapstructure:"share_url_ttl"`
+	// ShareQuota caps the bytes the server writes to the share directory of a box, 0 disables it
+	ShareQuota int64 `mapstructure:"share_quota"`
+	// ShareReclaimAge is the age after which files are removed from the share directory
+	ShareReclaimAge time.Duration `mapstructure:"share_reclaim_age"`
+	// ShareReclaimSchedule is the cron schedule of the share directory reclamation
+	ShareReclaimSchedule string `mapstructure:"share_reclaim_schedule"`
+	// ShareReclaimDryRun only reports the files the reclamation would remove
+	ShareReclaimDryRun bool `mapstructure:"share_reclaim_dry_run"`
+	// DownloadPolicy decides who fetches URLs downloaded into boxes: server, box, or auto,
+	// where the server fetches public addresses and boxes fetch the others themselves
+	DownloadPolicy string `mapstructure:"download_policy"`
+	// DownloadMaxSize caps the bytes of a download that does not set its own limit
+	DownloadMaxSize int64 `mapstructure:"download_max_size"`
+	// ChangesExclude are globs of paths left out of the changes of boxes, such as
+	// temporary files and caches, along with everything under them
+	ChangesExclude []string `mapstructure:"changes_exclude"`
 }
 
 // ClusterConfig represents cluster configuration
@@ -70,6 +99,55 @@ type K8sConfig struct {
 type BrowserConfig struct {
 	Host         string `yaml:"host"`
 	InternalPort int    `yaml:"internal_port"`
+	// CdpPort is the port of the Chrome DevTools endpoint of the box browser, 0 if the box
+	// image exposes none
+	CdpPort int `yaml:"cdp_port" mapstructure:"cdp_port"`
+	// ConnectURLTTL is how long browser connect URLs accept new connections, 0 for URLs
+	// without a token that never expire
+	ConnectURLTTL time.Duration `yaml:"connect_url_ttl" mapstructure:"connect_url_ttl"`
+}
+
+// ExecConfig represents command execution configuration
+type ExecConfig struct {
+	// MaxOutputBytes caps the stdout and stderr kept per command, 0 disables the cap
+	MaxOutputBytes int64 `yaml:"max_output_bytes" mapstructure:"max_output_bytes"`
+}
+
+// RunCodeConfig represents run-code configuration
+type RunCodeConfig struct {
+	// Languages adds run-code languages, or replaces the built-in ones with the same name
+	Languages []LanguageConfig `yaml:"languages" mapstructure:"languages"`
+}
+
+// GitConfig represents git configuration
+type GitConfig struct {
+	// Credentials authenticate clones of private repositories over http(s), so tokens
+	// never appear in URLs or requests
+	Credentials []GitCredentialConfig `yaml:"credentials" mapstructure:"credentials"`
+}
+
+// GitCredentialConfig represents a token used to clone repositories
+type GitCredentialConfig struct {
+	// Name identifies the credential in clone requests
+	Name string `yaml:"name" mapstructure:"name"`
+	// Host is the host whose clones use the credential when requests name none, such as
+	// github.com; the credential is never sent to other hosts
+	Host string `yaml:"host" mapstructure:"host"`
+	// Username defaults to git, as GitHub and GitLab accept any username with a token
+	Username string `yaml:"username" mapstructure:"username"`
+	Token    string `yaml:"token" mapstructure:"token"`
+	// TokenEnv names an environment variable holding the token, keeping it out of the config file
+	TokenEnv string `yaml:"token_env" mapstructure:"token_env"`
+}
+
+// LanguageConfig represents a run-code language runtime
+type LanguageConfig struct {
+	Name      string   `yaml:"name" mapstructure:"name"`
+	Aliases   []string `yaml:"aliases" mapstructure:"aliases"`
+	Extension string   `yaml:"extension" mapstructure:"extension"`
+	Command   []string `yaml:"command" mapstructure:"command"` // May contain {file} or {code}
+	Mode      string   `yaml:"mode" mapstructure:"mode"`       // stdin, file or arg
+	Requires  []string `yaml:"requires" mapstructure:"requires"`
 }
 
 func init() {
@@ -88,9 +166,22 @@ func init() {
 	v.BindEnv("file.home", "GBOX_HOME")
 	v.BindEnv("file.share", "GBOX_SHARE")
 	v.BindEnv("file.host_share", "GBOX_HOST_SHARE")
+	v.BindEnv("file.max_read_bytes", "GBOX_FILE_MAX_READ_BYTES")
+	v.BindEnv("file.watch_helper", "GBOX_FILE_WATCH_HELPER")
+	v.BindEnv("file.share_secret", "GBOX_SHARE_SECRET")
+	v.BindEnv("file.share_url_ttl", "GBOX_SHARE_URL_TTL")
+	v.BindEnv("file.share_quota", "GBOX_SHARE_QUOTA")
+	v.BindEnv("file.share_reclaim_age", "GBOX_SHARE_RECLAIM_AGE")
+	v.BindEnv("file.share_reclaim_schedule", "GBOX_SHARE_RECLAIM_SCHEDULE")
+	v.BindEnv("file.share_reclaim_dry_run", "GBOX_SHARE_RECLAIM_DRY_RUN")
+	v.BindEnv("file.download_policy", "GBOX_DOWNLOAD_POLICY")
+	v.BindEnv("file.download_max_size", "GBOX_DOWNLOAD_MAX_SIZE")
 	v.BindEnv("cluster.namespace", "GBOX_NAMESPACE")
 	v.BindEnv("browser.host", "GBOX_BROWSER_HOST")
 	v.BindEnv("browser.internalport", "GBOX_BROWSER_INTERNAL_PORT")
+	v.BindEnv("browser.cdp_port", "GBOX_BROWSER_CDP_PORT")
+	v.BindEnv("browser.connect_url_ttl", "GBOX_BROWSER_CONNECT_URL_TTL")
+	v.BindEnv("exec.max_output_bytes", "GBOX_EXEC_MAX_OUTPUT_BYTES")
 
 	// Image environment variables (bound to dynamically generated keys)
 	v.BindEnv("gbox.python.img.tag", "PY_IMG_TAG")
@@ -266,9 +357,17 @@ func New() (*Config, error) {
 			Port: 28081,
 		},
 		File: FileConfig{
-			Home:      filepath.Join(os.Getenv("HOME"), ".gbox"),
-			Share:     filepath.Join(os.Getenv("HOME"), ".gbox", "share"), // Default based on container's HOME
-			HostShare: filepath.Join(os.Getenv("HOME"), ".gbox", "share"), // Default based on container's HOME
+			Home:                 filepath.Join(os.Getenv("HOME"), ".gbox"),
+			Share:                filepath.Join(os.Getenv("HOME"), ".gbox", "share"), // Default based on container's HOME
+			HostShare:            filepath.Join(os.Getenv("HOME"), ".gbox", "share"), // Default based on container's HOME
+			MaxReadBytes:         10 << 20,                                           // 10 MiB
+			ShareURLTTL:          24 * time.Hour,
+			ShareQuota:           1 << 30, // 1 GiB
+			ShareReclaimAge:      14 * 24 * time.Hour,
+			ShareReclaimSchedule: "0 0 * * *", // Daily at midnight
+			DownloadPolicy:       "auto",
+			DownloadMaxSize:      1 << 30, // 1 GiB
+			ChangesExclude:       []string{"/tmp", "/var/tmp", "/run", "/var/cache", "/root/.cache", "/home/*/.cache", "**/__pycache__"},
 		},
 		Cluster: ClusterConfig{
 			Mode:                   "docker",
@@ -283,8 +382,12 @@ func New() (*Config, error) {
 			},
 		},
 		Browser: BrowserConfig{
-			Host:         "localhost",
-			InternalPort: 3000,
+			Host:          "localhost",
+			InternalPort:  3000,
+			ConnectURLTTL: 10 * time.Minute,
+		},
+		Exec: ExecConfig{
+			MaxOutputBytes: 1 << 20, // 1 MiB
 		},
 	}
 
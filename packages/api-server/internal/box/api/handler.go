@@ -1,8 +1,11 @@
 package api
 
 import (
+	"bufio"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -26,6 +29,9 @@ const (
 	mediaTypeMultiplexedStream = "application/vnd.gbox.multiplexed-stream"
 )
 
+// watchKeepAliveInterval is how often idle file watch event streams send a comment
+const watchKeepAliveInterval = 15 * time.Second
+
 // Configure the WebSocket upgrader
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
@@ -461,11 +467,14 @@ func (h *BoxHandler) ExecBox(req *restful.Request, resp *restful.Response) {
 	// Execute command using simplified service method
 	result, err := h.service.Exec(req.Request.Context(), boxID, &execReq)
 	if err != nil {
-		if err == service.ErrBoxNotFound {
+		switch {
+		case err == service.ErrBoxNotFound:
 			writeError(resp, http.StatusNotFound, "BoxNotFound", err.Error())
-			return
+		case errors.Is(err, service.ErrInvalidRequest):
+			writeError(resp, http.StatusBadRequest, "InvalidRequest", err.Error())
+		default:
+			writeError(resp, http.StatusInternalServerError, "ExecBoxError", err.Error())
 		}
-		writeError(resp, http.StatusInternalServerError, "ExecBoxError", err.Error())
 		return
 	}
 
@@ -556,16 +565,87 @@ func (h *BoxHandler) RunBox(req *restful.Request, resp *restful.Response) {
 	}
 
 	result, err := h.service.RunCode(req.Request.Context(), boxID, &runReq)
+	if err != nil {
+		switch {
+		case err == service.ErrBoxNotFound:
+			writeError(resp, http.StatusNotFound, "BoxNotFound", err.Error())
+		case errors.Is(err, service.ErrInvalidRequest):
+			writeError(resp, http.StatusBadRequest, "InvalidRequest", err.Error())
+		default:
+			writeError(resp, http.StatusInternalServerError, "RunBoxError", err.Error())
+		}
+		return
+	}
+
+	// Write the internal model.BoxRunResult directly
+	resp.WriteEntity(result)
+}
+
+// ListRunCodeLanguages lists the languages run-code supports, optionally checked against a box
+func (h *BoxHandler) ListRunCodeLanguages(req *restful.Request, resp *restful.Response) {
+	params := &model.RunCodeLanguageListParams{
+		BoxID: req.QueryParameter("boxId"),
+	}
+
+	result, err := h.service.RunCodeLanguages(req.Request.Context(), params)
 	if err != nil {
 		if err == service.ErrBoxNotFound {
 			writeError(resp, http.StatusNotFound, "BoxNotFound", err.Error())
 			return
 		}
-		writeError(resp, http.StatusInternalServerError, "RunBoxError", err.Error())
+		writeError(resp, http.StatusInternalServerError, "ListLanguagesError", err.Error())
 		return
 	}
 
-	// Write the internal model.BoxRunResult directly
+	resp.WriteEntity(result)
+}
+
+// ListKernels lists the kernels of a box
+func (h *BoxHandler) ListKernels(req *restful.Request, resp *restful.Response) {
+	boxID := req.PathParameter("id")
+	result, err := h.service.ListKernels(req.Request.Context(), boxID)
+	if err != nil {
+		if err == service.ErrBoxNotFound {
+			writeError(resp, http.StatusNotFound, "BoxNotFound", err.Error())
+			return
+		}
+		writeError(resp, http.StatusInternalServerError, "ListKernelsError", err.Error())
+		return
+	}
+	resp.WriteEntity(result)
+}
+
+// InterruptKernel interrupts the code a kernel is running
+func (h *BoxHandler) InterruptKernel(req *restful.Request, resp *restful.Response) {
+	h.controlKernel(req, resp, h.service.InterruptKernel, "InterruptKernelError")
+}
+
+// RestartKernel restarts a kernel with a fresh state
+func (h *BoxHandler) RestartKernel(req *restful.Request, resp *restful.Response) {
+	h.controlKernel(req, resp, h.service.RestartKernel, "RestartKernelError")
+}
+
+// controlKernel applies a kernel operation and maps its errors
+func (h *BoxHandler) controlKernel(
+	req *restful.Request,
+	resp *restful.Response,
+	operation func(ctx context.Context, id, kernelID string) (*model.BoxKernel, error),
+	errorCode string,
+) {
+	boxID := req.PathParameter("id")
+	kernelID := req.PathParameter("kernelId")
+	result, err := operation(req.Request.Context(), boxID, kernelID)
+	if err != nil {
+		switch {
+		case err == service.ErrBoxNotFound:
+			writeError(resp, http.StatusNotFound, "BoxNotFound", err.Error())
+		case errors.Is(err, service.ErrKernelNotFound):
+			writeError(resp, http.StatusNotFound, "KernelNotFound", err.Error())
+		default:
+			writeError(resp, http.StatusInternalServerError, errorCode, err.Error())
+		}
+		return
+	}
 	resp.WriteEntity(result)
 }
 
@@ -605,6 +685,11 @@ func (h *BoxHandler) StopBox(req *restful.Request, resp *restful.Response) {
 func (h *BoxHandler) GetArchive(req *restful.Request, resp *restful.Response) {
 	boxID := req.PathParameter("id")
 	path := req.QueryParameter("path")
+	if path == "" {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", "path is required")
+		return
+	}
+	compress := req.QueryParameter("gzip") == "true"
 
 	archiveReq := &model.BoxArchiveGetParams{
 		Path: path,
@@ -612,34 +697,31 @@ func (h *BoxHandler) GetArchive(req *restful.Request, resp *restful.Response) {
 
 	archiveResp, archive, err := h.service.GetArchive(req.Request.Context(), boxID, archiveReq)
 	if err != nil {
-		if err == service.ErrBoxNotFound {
-			writeError(resp, http.StatusNotFound, "BoxNotFound", err.Error())
-			return
-		}
-		writeError(resp, http.StatusInternalServerError, "GetArchiveError", err.Error())
+		writeArchiveError(resp, "GetArchiveError", err)
 		return
 	}
 	defer archive.Close()
 
-	// Convert actual archiveResp to JSON string
-	statJSON, err := json.Marshal(archiveResp) // Use actual archiveResp
-	if err != nil {
-		writeError(resp, http.StatusInternalServerError, "GetArchiveError", fmt.Sprintf("Failed to marshal stat: %v", err))
+	if err := setPathStatHeaders(resp, archiveResp.Name, archiveResp.Size, archiveResp.Mode, archiveResp.Mtime); err != nil {
+		writeError(resp, http.StatusInternalServerError, "GetArchiveError", err.Error())
 		return
 	}
 
-	// Set response headers
-	resp.Header().Set("Content-Type", "application/x-tar")
-	resp.Header().Set("X-Gbox-Path-Stat", string(statJSON))
-	resp.Header().Set("Last-Modified", archiveResp.Mtime) // Use actual Mtime
-
-	// Copy the archive to response
-	_, err = io.Copy(resp.ResponseWriter, archive)
+	// Stream the archive, never holding it in memory
+	var dst io.Writer = resp.ResponseWriter
+	if compress {
+		resp.Header().Set("Content-Type", "application/gzip")
+		gz := gzip.NewWriter(resp.ResponseWriter)
+		defer gz.Close()
+		dst = gz
+	} else {
+		resp.Header().Set("Content-Type", "application/x-tar")
+	}
+	resp.WriteHeader(http.StatusOK)
 
-	if err != nil {
-		// Log the error, but don't try to writeError as headers might have been sent
+	if _, err := io.Copy(dst, archive); err != nil {
+		// Log the error, but don't try to writeError as headers have been sent
 		log.Errorf("Failed to copy archive to response for box %s, path %s: %v", boxID, path, err)
-		return
 	}
 }
 
@@ -647,6 +729,10 @@ func (h *BoxHandler) GetArchive(req *restful.Request, resp *restful.Response) {
 func (h *BoxHandler) HeadArchive(req *restful.Request, resp *restful.Response) {
 	boxID := req.PathParameter("id")
 	path := req.QueryParameter("path")
+	if path == "" {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", "path is required")
+		return
+	}
 
 	headReq := &model.BoxArchiveHeadParams{
 		Path: path,
@@ -654,24 +740,15 @@ func (h *BoxHandler) HeadArchive(req *restful.Request, resp *restful.Response) {
 
 	stat, err := h.service.HeadArchive(req.Request.Context(), boxID, headReq)
 	if err != nil {
-		if err == service.ErrBoxNotFound {
-			writeError(resp, http.StatusNotFound, "BoxNotFound", err.Error())
-			return
-		}
-		writeError(resp, http.StatusInternalServerError, "HeadArchiveError", err.Error())
+		writeArchiveError(resp, "HeadArchiveError", err)
 		return
 	}
 
-	// Convert actual stat to JSON string
-	statJSON, err := json.Marshal(stat) // Use actual stat
-	if err != nil {
-		writeError(resp, http.StatusInternalServerError, "HeadArchiveError", fmt.Sprintf("Failed to marshal stat: %v", err))
+	if err := setPathStatHeaders(resp, stat.Name, stat.Size, stat.Mode, stat.Mtime); err != nil {
+		writeError(resp, http.StatusInternalServerError, "HeadArchiveError", err.Error())
 		return
 	}
-
-	// Set response headers
 	resp.Header().Set("Content-Type", "application/json")
-	resp.Header().Set("X-Gbox-Path-Stat", string(statJSON))
 	resp.WriteHeader(http.StatusOK)
 }
 
@@ -679,30 +756,121 @@ func (h *BoxHandler) HeadArchive(req *restful.Request, resp *restful.Response) {
 func (h *BoxHandler) ExtractArchive(req *restful.Request, resp *restful.Response) {
 	boxID := req.PathParameter("id")
 	path := req.QueryParameter("path")
-
-	// Read request body
-	content, err := io.ReadAll(req.Request.Body)
-	if err != nil {
-		writeError(resp, http.StatusBadRequest, "InvalidRequest", "Failed to read request body")
+	if path == "" {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", "path is required")
 		return
 	}
 
-	// Use actual params
+	// Accept gzip-compressed archives, announced or not
+	body := bufio.NewReader(req.Request.Body)
+	var archive io.Reader = body
+	if magic, err := body.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			writeError(resp, http.StatusBadRequest, "InvalidRequest", fmt.Sprintf("Invalid gzip archive: %v", err))
+			return
+		}
+		defer gz.Close()
+		archive = gz
+	}
+
 	extractParams := &model.BoxArchiveExtractParams{
-		Path:    path,
-		Content: content,
+		Path:                 path,
+		NoOverwriteDirNonDir: req.QueryParameter("noOverwriteDirNonDir") == "true",
+		CopyUIDGID:           req.QueryParameter("copyUIDGID") == "true",
+		Reader:               archive,
 	}
 
-	// Call actual service method
 	if err := h.service.ExtractArchive(req.Request.Context(), boxID, extractParams); err != nil {
-		if err == service.ErrBoxNotFound {
-			writeError(resp, http.StatusNotFound, "BoxNotFound", err.Error())
+		writeArchiveError(resp, "ExtractArchiveError", err)
+		return
+	}
+	resp.WriteHeader(http.StatusOK)
+}
+
+// Changes lists the paths added, modified and deleted in a box since it was created, or
+// exports the added and modified ones as a tar archive if format is tar
+func (h *BoxHandler) Changes(req *restful.Request, resp *restful.Response) {
+	boxID := req.PathParameter("id")
+	format := req.QueryParameter("format")
+	if format != "" && format != "json" && format != "tar" {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", "Invalid format parameter, expected json or tar")
+		return
+	}
+
+	changesParams := &model.BoxChangesParams{
+		Exclude:           splitListParameter(req.QueryParameters("exclude")),
+		NoDefaultExcludes: req.QueryParameter("noDefaultExcludes") == "true",
+	}
+	if _, err := service.ChangesExcludes(changesParams); err != nil {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", err.Error())
+		return
+	}
+
+	if format != "tar" {
+		result, err := h.service.Changes(req.Request.Context(), boxID, changesParams)
+		if err != nil {
+			writeFileOperationError(resp, "ChangesError", err)
 			return
 		}
-		writeError(resp, http.StatusInternalServerError, "ExtractArchiveError", err.Error())
+		resp.WriteHeaderAndEntity(http.StatusOK, result)
 		return
 	}
+
+	_, archive, err := h.service.ExportChanges(req.Request.Context(), boxID, changesParams)
+	if err != nil {
+		writeFileOperationError(resp, "ExportChangesError", err)
+		return
+	}
+	defer archive.Close()
+
+	// Stream the archive, never holding it in memory
+	var dst io.Writer = resp.ResponseWriter
+	if req.QueryParameter("gzip") == "true" {
+		resp.Header().Set("Content-Type", "application/gzip")
+		gz := gzip.NewWriter(resp.ResponseWriter)
+		defer gz.Close()
+		dst = gz
+	} else {
+		resp.Header().Set("Content-Type", "application/x-tar")
+	}
 	resp.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(dst, archive); err != nil {
+		// Log the error, but don't try to writeError as headers have been sent
+		log.Errorf("Failed to copy changes archive to response for box %s: %v", boxID, err)
+	}
+}
+
+// setPathStatHeaders sets the X-Gbox-Path-Stat and Last-Modified headers of an archive response
+func setPathStatHeaders(resp *restful.Response, name string, size int64, mode uint32, mtime string) error {
+	statJSON, err := json.Marshal(model.BoxArchiveHeadResult{
+		Name:  name,
+		Size:  size,
+		Mode:  mode,
+		Mtime: mtime,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal stat: %v", err)
+	}
+
+	resp.Header().Set("X-Gbox-Path-Stat", string(statJSON))
+	if t, err := time.Parse(time.RFC3339, mtime); err == nil {
+		resp.Header().Set("Last-Modified", t.UTC().Format(http.TimeFormat))
+	}
+	return nil
+}
+
+// writeArchiveError maps the errors of archive operations to HTTP responses
+func writeArchiveError(resp *restful.Response, code string, err error) {
+	switch {
+	case err == service.ErrBoxNotFound:
+		writeError(resp, http.StatusNotFound, "BoxNotFound", err.Error())
+	case errors.Is(err, service.ErrPathNotFound):
+		writeError(resp, http.StatusNotFound, "PathNotFound", err.Error())
+	default:
+		writeError(resp, http.StatusInternalServerError, code, err.Error())
+	}
 }
 
 // ListFiles lists files in a directory
@@ -730,15 +898,33 @@ func (h *BoxHandler) ListFiles(req *restful.Request, resp *restful.Response) {
 	listParams := &model.BoxFileListParams{
 		Path:  path,
 		Depth: depth,
+		Sort:  req.QueryParameter("sort"),
+		Desc:  req.QueryParameter("desc") == "true",
+	}
+	switch listParams.Sort {
+	case "", model.FileSortPath, model.FileSortName, model.FileSortSize, model.FileSortLastModified, model.FileSortType:
+	default:
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", fmt.Sprintf("Invalid sort parameter: %s", listParams.Sort))
+		return
+	}
+
+	for name, target := range map[string]*int{
+		"offset": &listParams.Offset,
+		"limit":  &listParams.Limit,
+	} {
+		if value := req.QueryParameter(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				writeError(resp, http.StatusBadRequest, "InvalidRequest", fmt.Sprintf("Invalid %s parameter", name))
+				return
+			}
+			*target = n
+		}
 	}
 
 	result, err := h.service.ListFiles(req.Request.Context(), boxID, listParams)
 	if err != nil {
-		if err == service.ErrBoxNotFound {
-			writeError(resp, http.StatusNotFound, "BoxNotFound", err.Error())
-			return
-		}
-		writeError(resp, http.StatusInternalServerError, "ListFilesError", err.Error())
+		writeFileOperationError(resp, "ListFilesError", err)
 		return
 	}
 
@@ -756,16 +942,84 @@ func (h *BoxHandler) ReadFile(req *restful.Request, resp *restful.Response) {
 	}
 
 	readParams := &model.BoxFileReadParams{
-		Path: path,
+		Path:     path,
+		Encoding: req.QueryParameter("encoding"),
+		Format:   req.QueryParameter("format"),
+	}
+	if readParams.Encoding != "" && readParams.Encoding != model.FileEncodingUTF8 && readParams.Encoding != model.FileEncodingBase64 {
+		writeError(resp, http.StatusBadRequest, "InvalidEncoding", "encoding must be utf8 or base64")
+		return
+	}
+	if readParams.Format != "" && readParams.Format != model.FileReadFormatRaw && readParams.Format != model.FileReadFormatAuto {
+		writeError(resp, http.StatusBadRequest, "InvalidFormat", "format must be raw or auto")
+		return
+	}
+
+	for name, target := range map[string]*int64{
+		"offset":  &readParams.Offset,
+		"length":  &readParams.Length,
+		"maxSize": &readParams.MaxSize,
+	} {
+		if value := req.QueryParameter(name); value != "" {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 0 {
+				writeError(resp, http.StatusBadRequest, "InvalidRequest", fmt.Sprintf("Invalid %s parameter", name))
+				return
+			}
+			*target = n
+		}
+	}
+	for name, target := range map[string]*int{
+		"startLine":    &readParams.StartLine,
+		"endLine":      &readParams.EndLine,
+		"maxDimension": &readParams.MaxDimension,
+		"maxRows":      &readParams.MaxRows,
+		"maxPages":     &readParams.MaxPages,
+	} {
+		if value := req.QueryParameter(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				writeError(resp, http.StatusBadRequest, "InvalidRequest", fmt.Sprintf("Invalid %s parameter", name))
+				return
+			}
+			*target = n
+		}
+	}
+
+	lineRange := readParams.StartLine > 0 || readParams.EndLine > 0
+	if lineRange && (readParams.Offset > 0 || readParams.Length > 0) {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", "Byte and line ranges cannot be combined")
+		return
+	}
+	if readParams.Format == model.FileReadFormatAuto && (lineRange || readParams.Offset > 0 || readParams.Length > 0) {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", "The auto format reads whole files and cannot be combined with ranges")
+		return
+	}
+	if readParams.EndLine > 0 && readParams.EndLine < readParams.StartLine {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", "endLine must not be before startLine")
+		return
+	}
+	if readParams.Format == model.FileReadFormatAuto && (lineRange || readParams.Offset > 0 || readParams.Length > 0) {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", "The auto format reads whole files and cannot be combined with ranges")
+		return
 	}
 
 	result, err := h.service.ReadFile(req.Request.Context(), boxID, readParams)
 	if err != nil {
-		if err == service.ErrBoxNotFound {
+		switch {
+		case errors.Is(err, service.ErrBoxNotFound):
 			writeError(resp, http.StatusNotFound, "BoxNotFound", err.Error())
-			return
+		case errors.Is(err, service.ErrPathNotFound):
+			writeError(resp, http.StatusNotFound, "PathNotFound", err.Error())
+		case errors.Is(err, service.ErrNotAFile):
+			writeError(resp, http.StatusBadRequest, "NotAFile", err.Error())
+		case errors.Is(err, service.ErrFileTooLarge):
+			writeError(resp, http.StatusRequestEntityTooLarge, "FileTooLarge", err.Error())
+		case errors.Is(err, service.ErrInvalidContent):
+			writeError(resp, http.StatusUnprocessableEntity, "InvalidContent", err.Error())
+		default:
+			writeError(resp, http.StatusInternalServerError, "ReadFileError", err.Error())
 		}
-		writeError(resp, http.StatusInternalServerError, "ReadFileError", err.Error())
 		return
 	}
 
@@ -787,20 +1041,603 @@ func (h *BoxHandler) WriteFile(req *restful.Request, resp *restful.Response) {
 		writeError(resp, http.StatusBadRequest, "InvalidRequest", "Path parameter is required")
 		return
 	}
+	if writeParams.Encoding != "" && writeParams.Encoding != model.FileEncodingUTF8 && writeParams.Encoding != model.FileEncodingBase64 {
+		writeError(resp, http.StatusBadRequest, "InvalidEncoding", "encoding must be utf8 or base64")
+		return
+	}
+	if writeParams.Mode != "" && !validFileMode(writeParams.Mode) {
+		writeError(resp, http.StatusBadRequest, "InvalidMode", "mode must be an octal permission such as 0644")
+		return
+	}
 
 	result, err := h.service.WriteFile(req.Request.Context(), boxID, &writeParams)
 	if err != nil {
-		if err == service.ErrBoxNotFound {
+		switch {
+		case errors.Is(err, service.ErrBoxNotFound):
+			writeError(resp, http.StatusNotFound, "BoxNotFound", err.Error())
+		case errors.Is(err, service.ErrPathNotFound):
+			writeError(resp, http.StatusNotFound, "PathNotFound", err.Error())
+		case errors.Is(err, service.ErrNotAFile):
+			writeError(resp, http.StatusBadRequest, "NotAFile", err.Error())
+		case errors.Is(err, service.ErrUnknownOwner):
+			writeError(resp, http.StatusBadRequest, "UnknownOwner", err.Error())
+		case errors.Is(err, service.ErrInvalidEncoding):
+			writeError(resp, http.StatusBadRequest, "InvalidEncoding", err.Error())
+		case errors.Is(err, service.ErrFileExists):
+			writeError(resp, http.StatusConflict, "FileExists", err.Error())
+		case errors.Is(err, service.ErrChecksumMismatch):
+			writeError(resp, http.StatusPreconditionFailed, "ChecksumMismatch", err.Error())
+		default:
+			writeError(resp, http.StatusInternalServerError, "WriteFileError", err.Error())
+		}
+		return
+	}
+
+	resp.WriteHeaderAndEntity(http.StatusOK, result)
+}
+
+// EditFile applies edits to a file
+func (h *BoxHandler) EditFile(req *restful.Request, resp *restful.Response) {
+	boxID := req.PathParameter("id")
+
+	var editParams model.BoxFileEditParams
+	if err := req.ReadEntity(&editParams); err != nil {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", err.Error())
+		return
+	}
+
+	if editParams.Path == "" {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", "Path parameter is required")
+		return
+	}
+	if len(editParams.Edits) == 0 {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", "At least one edit is required")
+		return
+	}
+
+	result, err := h.service.EditFile(req.Request.Context(), boxID, &editParams)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrBoxNotFound):
+			writeError(resp, http.StatusNotFound, "BoxNotFound", err.Error())
+		case errors.Is(err, service.ErrPathNotFound):
+			writeError(resp, http.StatusNotFound, "PathNotFound", err.Error())
+		case errors.Is(err, service.ErrNotAFile):
+			writeError(resp, http.StatusBadRequest, "NotAFile", err.Error())
+		case errors.Is(err, service.ErrInvalidEdit):
+			writeError(resp, http.StatusBadRequest, "InvalidEdit", err.Error())
+		case errors.Is(err, service.ErrEditNoMatch):
+			writeError(resp, http.StatusUnprocessableEntity, "NoMatch", err.Error())
+		case errors.Is(err, service.ErrEditAmbiguous):
+			writeError(resp, http.StatusUnprocessableEntity, "AmbiguousMatch", err.Error())
+		case errors.Is(err, service.ErrChecksumMismatch):
+			writeError(resp, http.StatusConflict, "FileChanged", err.Error())
+		case errors.Is(err, service.ErrFileTooLarge):
+			writeError(resp, http.StatusRequestEntityTooLarge, "FileTooLarge", err.Error())
+		default:
+			writeError(resp, http.StatusInternalServerError, "EditFileError", err.Error())
+		}
+		return
+	}
+
+	resp.WriteHeaderAndEntity(http.StatusOK, result)
+}
+
+// SearchFiles searches file names and contents
+func (h *BoxHandler) SearchFiles(req *restful.Request, resp *restful.Response) {
+	boxID := req.PathParameter("id")
+
+	searchParams := &model.BoxFileSearchParams{
+		Path:       req.QueryParameter("path"),
+		Pattern:    req.QueryParameter("pattern"),
+		Query:      req.QueryParameter("query"),
+		IgnoreCase: req.QueryParameter("ignoreCase") == "true",
+		Include:    splitListParameter(req.QueryParameters("include")),
+		Exclude:    splitListParameter(req.QueryParameters("exclude")),
+		NoIgnore:   req.QueryParameter("noIgnore") == "true",
+	}
+	if searchParams.Pattern == "" && searchParams.Query == "" {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", "pattern or query parameter is required")
+		return
+	}
+
+	for name, target := range map[string]*int{
+		"maxResults":   &searchParams.MaxResults,
+		"contextLines": &searchParams.ContextLines,
+	} {
+		if value := req.QueryParameter(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				writeError(resp, http.StatusBadRequest, "InvalidRequest", fmt.Sprintf("Invalid %s parameter", name))
+				return
+			}
+			*target = n
+		}
+	}
+
+	result, err := h.service.SearchFiles(req.Request.Context(), boxID, searchParams)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrBoxNotFound):
+			writeError(resp, http.StatusNotFound, "BoxNotFound", err.Error())
+		case errors.Is(err, service.ErrPathNotFound):
+			writeError(resp, http.StatusNotFound, "PathNotFound", err.Error())
+		case errors.Is(err, service.ErrInvalidSearch):
+			writeError(resp, http.StatusBadRequest, "InvalidSearch", err.Error())
+		default:
+			writeError(resp, http.StatusInternalServerError, "SearchFilesError", err.Error())
+		}
+		return
+	}
+
+	resp.WriteHeaderAndEntity(http.StatusOK, result)
+}
+
+// StatFile describes a file
+func (h *BoxHandler) StatFile(req *restful.Request, resp *restful.Response) {
+	boxID := req.PathParameter("id")
+
+	statParams := &model.BoxFileStatParams{Path: req.QueryParameter("path")}
+	if statParams.Path == "" {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", "path parameter is required")
+		return
+	}
+
+	result, err := h.service.StatFile(req.Request.Context(), boxID, statParams)
+	if err != nil {
+		writeFileOperationError(resp, "StatFileError", err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, result)
+}
+
+// FileManifest describes every file under a directory with the hash of its content
+func (h *BoxHandler) FileManifest(req *restful.Request, resp *restful.Response) {
+	boxID := req.PathParameter("id")
+
+	var manifestParams model.BoxFileManifestParams
+	if err := req.ReadEntity(&manifestParams); err != nil {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", err.Error())
+		return
+	}
+	if manifestParams.Path == "" {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", "Path parameter is required")
+		return
+	}
+
+	result, err := h.service.FileManifest(req.Request.Context(), boxID, &manifestParams)
+	if err != nil {
+		writeFileOperationError(resp, "FileManifestError", err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, result)
+}
+
+// MakeDir creates a directory
+func (h *BoxHandler) MakeDir(req *restful.Request, resp *restful.Response) {
+	boxID := req.PathParameter("id")
+
+	var mkdirParams model.BoxFileMkdirParams
+	if err := req.ReadEntity(&mkdirParams); err != nil {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", err.Error())
+		return
+	}
+	if mkdirParams.Path == "" {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", "Path parameter is required")
+		return
+	}
+	if mkdirParams.Mode != "" && !validFileMode(mkdirParams.Mode) {
+		writeError(resp, http.StatusBadRequest, "InvalidMode", "mode must be an octal permission such as 0755")
+		return
+	}
+
+	result, err := h.service.MakeDir(req.Request.Context(), boxID, &mkdirParams)
+	if err != nil {
+		writeFileOperationError(resp, "MakeDirError", err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, result)
+}
+
+// RemoveFile removes a file or directory
+func (h *BoxHandler) RemoveFile(req *restful.Request, resp *restful.Response) {
+	boxID := req.PathParameter("id")
+
+	var removeParams model.BoxFileRemoveParams
+	if err := req.ReadEntity(&removeParams); err != nil {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", err.Error())
+		return
+	}
+	if removeParams.Path == "" {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", "Path parameter is required")
+		return
+	}
+	if service.ResolveBoxPath(removeParams.Path) == "/" {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", "The root directory cannot be removed")
+		return
+	}
+
+	result, err := h.service.RemoveFile(req.Request.Context(), boxID, &removeParams)
+	if err != nil {
+		writeFileOperationError(resp, "RemoveFileError", err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, result)
+}
+
+// MoveFile moves a file or directory
+func (h *BoxHandler) MoveFile(req *restful.Request, resp *restful.Response) {
+	boxID := req.PathParameter("id")
+
+	var moveParams model.BoxFileMoveParams
+	if err := req.ReadEntity(&moveParams); err != nil {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", err.Error())
+		return
+	}
+	if moveParams.Source == "" || moveParams.Destination == "" {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", "Source and destination parameters are required")
+		return
+	}
+
+	result, err := h.service.MoveFile(req.Request.Context(), boxID, &moveParams)
+	if err != nil {
+		writeFileOperationError(resp, "MoveFileError", err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, result)
+}
+
+// CopyFile copies a file or directory
+func (h *BoxHandler) CopyFile(req *restful.Request, resp *restful.Response) {
+	boxID := req.PathParameter("id")
+
+	var copyParams model.BoxFileCopyParams
+	if err := req.ReadEntity(&copyParams); err != nil {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", err.Error())
+		return
+	}
+	if copyParams.Source == "" || copyParams.Destination == "" {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", "Source and destination parameters are required")
+		return
+	}
+
+	result, err := h.service.CopyFile(req.Request.Context(), boxID, &copyParams)
+	if err != nil {
+		writeFileOperationError(resp, "CopyFileError", err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, result)
+}
+
+// ChmodFile changes the permission of a file or directory
+func (h *BoxHandler) ChmodFile(req *restful.Request, resp *restful.Response) {
+	boxID := req.PathParameter("id")
+
+	var chmodParams model.BoxFileChmodParams
+	if err := req.ReadEntity(&chmodParams); err != nil {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", err.Error())
+		return
+	}
+	if chmodParams.Path == "" {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", "Path parameter is required")
+		return
+	}
+	if !validFileMode(chmodParams.Mode) {
+		writeError(resp, http.StatusBadRequest, "InvalidMode", "mode must be an octal permission such as 0644")
+		return
+	}
+
+	result, err := h.service.ChmodFile(req.Request.Context(), boxID, &chmodParams)
+	if err != nil {
+		writeFileOperationError(resp, "ChmodFileError", err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, result)
+}
+
+// DownloadFile downloads a URL into a box, streaming the progress as JSON lines followed
+// by the result if the client accepts application/json-stream
+func (h *BoxHandler) DownloadFile(req *restful.Request, resp *restful.Response) {
+	boxID := req.PathParameter("id")
+
+	var downloadParams model.BoxFileDownloadParams
+	if err := req.ReadEntity(&downloadParams); err != nil {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", err.Error())
+		return
+	}
+	if downloadParams.URL == "" || downloadParams.Path == "" {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", "url and path parameters are required")
+		return
+	}
+	if downloadParams.MaxSize < 0 {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", "maxSize must not be negative")
+		return
+	}
+	if _, _, err := service.ValidateDownload(&downloadParams); err != nil {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", err.Error())
+		return
+	}
+
+	if req.HeaderParameter("Accept") == "application/json-stream" {
+		downloadServiceCall := func(ctx context.Context, p interface{}, progressWriter io.Writer) (interface{}, error) {
+			params, ok := p.(*model.BoxFileDownloadParams)
+			if !ok {
+				return nil, fmt.Errorf("internal error: invalid params type for DownloadFile service call")
+			}
+			return h.service.DownloadFile(ctx, boxID, params, progressWriter)
+		}
+		h.streamServiceOperation(req, resp, &downloadParams, downloadServiceCall, false)
+		return
+	}
+
+	result, err := h.service.DownloadFile(req.Request.Context(), boxID, &downloadParams, nil)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrDownloadFailed):
+			writeError(resp, http.StatusBadGateway, "DownloadFailed", err.Error())
+		case errors.Is(err, service.ErrFileTooLarge):
+			writeError(resp, http.StatusRequestEntityTooLarge, "FileTooLarge", err.Error())
+		case errors.Is(err, service.ErrChecksumMismatch):
+			writeError(resp, http.StatusUnprocessableEntity, "ChecksumMismatch", err.Error())
+		default:
+			writeFileOperationError(resp, "DownloadFileError", err)
+		}
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, result)
+}
+
+// validFileMode reports whether mode is an octal permission such as 0644
+func validFileMode(mode string) bool {
+	n, err := strconv.ParseUint(mode, 8, 32)
+	return err == nil && n <= 07777
+}
+
+// writeFileOperationError writes the typed error of a file operation, or an internal
+// error with the given code
+func writeFileOperationError(resp *restful.Response, code string, err error) {
+	switch {
+	case errors.Is(err, service.ErrBoxNotFound):
+		writeError(resp, http.StatusNotFound, "BoxNotFound", err.Error())
+	case errors.Is(err, service.ErrPathNotFound):
+		writeError(resp, http.StatusNotFound, "PathNotFound", err.Error())
+	case errors.Is(err, service.ErrFileExists):
+		writeError(resp, http.StatusConflict, "FileExists", err.Error())
+	case errors.Is(err, service.ErrDirectoryNotEmpty):
+		writeError(resp, http.StatusConflict, "DirectoryNotEmpty", err.Error())
+	case errors.Is(err, service.ErrNotADirectory):
+		writeError(resp, http.StatusBadRequest, "NotADirectory", err.Error())
+	case errors.Is(err, service.ErrNotAFile):
+		writeError(resp, http.StatusBadRequest, "NotAFile", err.Error())
+	case errors.Is(err, service.ErrPermissionDenied):
+		writeError(resp, http.StatusForbidden, "PermissionDenied", err.Error())
+	case errors.Is(err, service.ErrBoxNotRunning):
+		writeError(resp, http.StatusConflict, "BoxNotRunning", err.Error())
+	default:
+		writeError(resp, http.StatusInternalServerError, code, err.Error())
+	}
+}
+
+// WatchFiles streams the changes to a directory, as server-sent events if the client
+// accepts text/event-stream and as a JSON stream otherwise
+func (h *BoxHandler) WatchFiles(req *restful.Request, resp *restful.Response) {
+	boxID := req.PathParameter("id")
+
+	watchParams := &model.BoxFileWatchParams{
+		Path:      req.QueryParameter("path"),
+		Recursive: req.QueryParameter("recursive") == "true",
+		Debounce:  service.DefaultWatchDebounce,
+	}
+	if value := req.QueryParameter("debounce"); value != "" {
+		debounce, err := time.ParseDuration(value)
+		if err != nil || debounce < 0 || debounce > service.MaxWatchDebounce {
+			writeError(resp, http.StatusBadRequest, "InvalidRequest",
+				fmt.Sprintf("Invalid debounce parameter, expected a duration of at most %s", service.MaxWatchDebounce))
+			return
+		}
+		watchParams.Debounce = debounce
+	}
+
+	events, err := h.service.WatchFiles(req.Request.Context(), boxID, watchParams)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrBoxNotFound):
 			writeError(resp, http.StatusNotFound, "BoxNotFound", err.Error())
+		case errors.Is(err, service.ErrPathNotFound):
+			writeError(resp, http.StatusNotFound, "PathNotFound", err.Error())
+		case errors.Is(err, service.ErrNotADirectory):
+			writeError(resp, http.StatusBadRequest, "NotADirectory", err.Error())
+		default:
+			writeError(resp, http.StatusInternalServerError, "WatchFilesError", err.Error())
+		}
+		return
+	}
+
+	sse := strings.Contains(req.HeaderParameter("Accept"), "text/event-stream")
+	if sse {
+		resp.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		resp.Header().Set("Content-Type", "application/json-stream")
+	}
+	resp.Header().Set("X-Content-Type-Options", "nosniff")
+	resp.Header().Set("Cache-Control", "no-cache")
+	resp.Header().Set("Connection", "keep-alive")
+	resp.WriteHeader(http.StatusOK)
+
+	flusher, _ := resp.ResponseWriter.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	flush()
+
+	// Comments keep idle event streams from being closed by proxies
+	keepAlive := time.NewTicker(watchKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Errorf("Failed to encode file event: %v", err)
+				continue
+			}
+			if sse {
+				_, err = fmt.Fprintf(resp, "event: %s\ndata: %s\n\n", event.Type, data)
+			} else {
+				_, err = fmt.Fprintf(resp, "%s\n", data)
+			}
+			if err != nil {
+				// The client went away, the service stops with the request context
+				return
+			}
+			flush()
+		case <-keepAlive.C:
+			if sse {
+				if _, err := fmt.Fprint(resp, ": keep-alive\n\n"); err != nil {
+					return
+				}
+				flush()
+			}
+		}
+	}
+}
+
+// splitListParameter flattens repeated and comma-separated query parameter values
+func splitListParameter(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// GitClone clones a repository into a box, with the credential configured on the server
+// for its host or named by the request
+func (h *BoxHandler) GitClone(req *restful.Request, resp *restful.Response) {
+	boxID := req.PathParameter("id")
+
+	var cloneParams model.BoxGitCloneParams
+	if err := req.ReadEntity(&cloneParams); err != nil {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", err.Error())
+		return
+	}
+	if err := service.ValidateGitClone(&cloneParams); err != nil {
+		if errors.Is(err, service.ErrUnknownCredential) {
+			writeError(resp, http.StatusBadRequest, "UnknownCredential", err.Error())
 			return
 		}
-		writeError(resp, http.StatusInternalServerError, "WriteFileError", err.Error())
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", err.Error())
 		return
 	}
 
+	result, err := h.service.GitClone(req.Request.Context(), boxID, &cloneParams)
+	if err != nil {
+		writeGitError(resp, "GitCloneError", err)
+		return
+	}
 	resp.WriteHeaderAndEntity(http.StatusOK, result)
 }
 
+// GitStatus describes the branch and changed files of a repository in a box
+func (h *BoxHandler) GitStatus(req *restful.Request, resp *restful.Response) {
+	boxID := req.PathParameter("id")
+
+	statusParams := &model.BoxGitStatusParams{Path: req.QueryParameter("path")}
+	result, err := h.service.GitStatus(req.Request.Context(), boxID, statusParams)
+	if err != nil {
+		writeGitError(resp, "GitStatusError", err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, result)
+}
+
+// GitDiff returns the changes of a repository in a box as files and hunks, along with
+// the patch they were parsed from
+func (h *BoxHandler) GitDiff(req *restful.Request, resp *restful.Response) {
+	boxID := req.PathParameter("id")
+
+	diffParams := &model.BoxGitDiffParams{
+		Path:      req.QueryParameter("path"),
+		Staged:    req.QueryParameter("staged") == "true",
+		Ref:       req.QueryParameter("ref"),
+		Files:     req.QueryParameters("file"),
+		Context:   service.DefaultGitDiffContext,
+		Untracked: req.QueryParameter("untracked") == "true",
+	}
+	if err := service.ValidateGitRef(diffParams.Ref); err != nil {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", err.Error())
+		return
+	}
+	if value := req.QueryParameter("context"); value != "" {
+		context, err := strconv.Atoi(value)
+		if err != nil || context < 0 {
+			writeError(resp, http.StatusBadRequest, "InvalidRequest", "Invalid context parameter, expected a non-negative number of lines")
+			return
+		}
+		diffParams.Context = context
+	}
+
+	result, err := h.service.GitDiff(req.Request.Context(), boxID, diffParams)
+	if err != nil {
+		writeGitError(resp, "GitDiffError", err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, result)
+}
+
+// GitCommit stages and commits changes of a repository in a box
+func (h *BoxHandler) GitCommit(req *restful.Request, resp *restful.Response) {
+	boxID := req.PathParameter("id")
+
+	var commitParams model.BoxGitCommitParams
+	if err := req.ReadEntity(&commitParams); err != nil {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", err.Error())
+		return
+	}
+	if strings.TrimSpace(commitParams.Message) == "" {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", "Message parameter is required")
+		return
+	}
+	if commitParams.All && len(commitParams.Files) > 0 {
+		writeError(resp, http.StatusBadRequest, "InvalidRequest", "Files and all parameters are mutually exclusive")
+		return
+	}
+
+	result, err := h.service.GitCommit(req.Request.Context(), boxID, &commitParams)
+	if err != nil {
+		writeGitError(resp, "GitCommitError", err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusCreated, result)
+}
+
+// writeGitError writes the typed error of a git operation, or an internal error with the
+// given code
+func writeGitError(resp *restful.Response, code string, err error) {
+	switch {
+	case errors.Is(err, service.ErrNotARepository):
+		writeError(resp, http.StatusBadRequest, "NotARepository", err.Error())
+	case errors.Is(err, service.ErrNothingToCommit):
+		writeError(resp, http.StatusConflict, "NothingToCommit", err.Error())
+	case errors.Is(err, service.ErrGitFailed):
+		writeError(resp, http.StatusUnprocessableEntity, "GitFailed", err.Error())
+	case errors.Is(err, service.ErrUnknownCredential):
+		writeError(resp, http.StatusBadRequest, "UnknownCredential", err.Error())
+	default:
+		writeFileOperationError(resp, code, err)
+	}
+}
+
 // UpdateBoxImage updates docker images used for boxes, pulling latest and removing outdated versions
 func (h *BoxHandler) UpdateBoxImage(req *restful.Request, resp *restful.Response) {
 	// parse query parameters
@@ -0,0 +1,285 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/emicklei/go-restful/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/babelcloud/gbox/packages/api-server/internal/box/service"
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+// fakeBoxService implements the archive operations of a box service over a single file,
+// and command execution and file writes that fail with preset errors
+type fakeBoxService struct {
+	service.BoxService
+
+	path    string
+	content []byte
+	stat    model.BoxArchiveHeadResult
+
+	extracted []byte
+	execErr   error
+	writeErr  error
+}
+
+func (f *fakeBoxService) Get(ctx context.Context, id string) (*model.Box, error) {
+	return &model.Box{ID: id, Status: "running"}, nil
+}
+
+func (f *fakeBoxService) Exec(ctx context.Context, id string, req *model.BoxExecParams) (*model.BoxExecResult, error) {
+	return nil, f.execErr
+}
+
+func (f *fakeBoxService) WriteFile(ctx context.Context, id string, req *model.BoxFileWriteParams) (*model.BoxFileWriteResult, error) {
+	return nil, f.writeErr
+}
+
+func (f *fakeBoxService) RunCode(ctx context.Context, id string, req *model.BoxRunCodeParams) (*model.BoxRunCodeResult, error) {
+	return nil, f.execErr
+}
+
+func (f *fakeBoxService) HeadArchive(ctx context.Context, id string, req *model.BoxArchiveHeadParams) (*model.BoxArchiveHeadResult, error) {
+	if req.Path != f.path {
+		return nil, fmt.Errorf("%w: %s", service.ErrPathNotFound, req.Path)
+	}
+	return &f.stat, nil
+}
+
+func (f *fakeBoxService) GetArchive(ctx context.Context, id string, req *model.BoxArchiveGetParams) (*model.BoxArchiveResult, io.ReadCloser, error) {
+	if req.Path != f.path {
+		return nil, nil, fmt.Errorf("%w: %s", service.ErrPathNotFound, req.Path)
+	}
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: f.stat.Name, Mode: int64(f.stat.Mode), Size: int64(len(f.content))}); err != nil {
+		return nil, nil, err
+	}
+	if _, err := tw.Write(f.content); err != nil {
+		return nil, nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, nil, err
+	}
+	result := model.BoxArchiveResult(f.stat)
+	return &result, io.NopCloser(&buf), nil
+}
+
+func (f *fakeBoxService) ExtractArchive(ctx context.Context, id string, req *model.BoxArchiveExtractParams) error {
+	data, err := io.ReadAll(req.Reader)
+	if err != nil {
+		return err
+	}
+	f.extracted = data
+	return nil
+}
+
+// newArchiveTestServer serves the box routes over a fake service holding /data/hello.txt
+func newArchiveTestServer(t *testing.T) (*httptest.Server, *fakeBoxService) {
+	fake := &fakeBoxService{
+		path:    "/data/hello.txt",
+		content: []byte("hello world\n"),
+		stat: model.BoxArchiveHeadResult{
+			Name:  "hello.txt",
+			Size:  12,
+			Mode:  0644,
+			Mtime: "2024-05-01T10:20:30Z",
+		},
+	}
+	ws := new(restful.WebService)
+	ws.Path("/api/v1").Consumes(restful.MIME_JSON).Produces(restful.MIME_JSON)
+	RegisterRoutes(ws, NewBoxHandler(fake))
+	container := restful.NewContainer()
+	container.Add(ws)
+
+	server := httptest.NewServer(container)
+	t.Cleanup(server.Close)
+	return server, fake
+}
+
+// readArchiveFile returns the name and content of the single file of a tar archive
+func readArchiveFile(t *testing.T, r io.Reader) (string, string) {
+	tr := tar.NewReader(r)
+	header, err := tr.Next()
+	require.NoError(t, err)
+	content, err := io.ReadAll(tr)
+	require.NoError(t, err)
+	_, err = tr.Next()
+	assert.Equal(t, io.EOF, err)
+	return header.Name, string(content)
+}
+
+// assertPathStatHeaders checks the stat headers of an archive response
+func assertPathStatHeaders(t *testing.T, resp *http.Response, want model.BoxArchiveHeadResult) {
+	var stat model.BoxArchiveHeadResult
+	require.NoError(t, json.Unmarshal([]byte(resp.Header.Get("X-Gbox-Path-Stat")), &stat))
+	assert.Equal(t, want, stat)
+	assert.Equal(t, "Wed, 01 May 2024 10:20:30 GMT", resp.Header.Get("Last-Modified"))
+}
+
+func TestHeadArchive(t *testing.T) {
+	server, fake := newArchiveTestServer(t)
+
+	resp, err := http.Head(server.URL + "/api/v1/boxes/box/archive?path=/data/hello.txt")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assertPathStatHeaders(t, resp, fake.stat)
+
+	resp, err = http.Head(server.URL + "/api/v1/boxes/box/archive?path=/data/missing.txt")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestGetArchive(t *testing.T) {
+	server, fake := newArchiveTestServer(t)
+
+	resp, err := http.Get(server.URL + "/api/v1/boxes/box/archive?path=/data/hello.txt")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/x-tar", resp.Header.Get("Content-Type"))
+	assertPathStatHeaders(t, resp, fake.stat)
+	name, content := readArchiveFile(t, resp.Body)
+	assert.Equal(t, "hello.txt", name)
+	assert.Equal(t, "hello world\n", content)
+
+	// The transport would transparently decompress a gzip Content-Encoding, the
+	// archive is compressed as a whole instead
+	resp, err = http.Get(server.URL + "/api/v1/boxes/box/archive?path=/data/hello.txt&gzip=true")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/gzip", resp.Header.Get("Content-Type"))
+	gz, err := gzip.NewReader(resp.Body)
+	require.NoError(t, err)
+	name, content = readArchiveFile(t, gz)
+	assert.Equal(t, "hello.txt", name)
+	assert.Equal(t, "hello world\n", content)
+
+	missing, err := http.Get(server.URL + "/api/v1/boxes/box/archive?path=/data/missing.txt")
+	require.NoError(t, err)
+	defer missing.Body.Close()
+	assert.Equal(t, http.StatusNotFound, missing.StatusCode)
+	var boxErr model.BoxError
+	require.NoError(t, json.NewDecoder(missing.Body).Decode(&boxErr))
+	assert.Equal(t, "PathNotFound", boxErr.Code)
+}
+
+func TestExtractArchive(t *testing.T) {
+	server, fake := newArchiveTestServer(t)
+
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "a.txt", Mode: 0644, Size: 1}))
+	_, err := tw.Write([]byte("a"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	_, err = gz.Write(archive.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	// Gzip archives are detected by their magic number, whatever the content type
+	for name, body := range map[string][]byte{"tar": archive.Bytes(), "gzip": compressed.Bytes()} {
+		t.Run(name, func(t *testing.T) {
+			fake.extracted = nil
+			req, err := http.NewRequest(http.MethodPut, server.URL+"/api/v1/boxes/box/archive?path=/data", bytes.NewReader(body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/x-tar")
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, archive.Bytes(), fake.extracted)
+		})
+	}
+
+	// A gzip header that is cut short is rejected
+	req, err := http.NewRequest(http.MethodPut, server.URL+"/api/v1/boxes/box/archive?path=/data", bytes.NewReader(compressed.Bytes()[:4]))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/gzip")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestExecErrors(t *testing.T) {
+	server, fake := newArchiveTestServer(t)
+
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{fmt.Errorf("%w: unsupported stdin encoding: hex", service.ErrInvalidRequest), http.StatusBadRequest, "InvalidRequest"},
+		{fmt.Errorf("%w: output limits must not be negative", service.ErrInvalidRequest), http.StatusBadRequest, "InvalidRequest"},
+		{fmt.Errorf("%w: unsupported output retention mode: middle", service.ErrInvalidRequest), http.StatusBadRequest, "InvalidRequest"},
+		{service.ErrBoxNotFound, http.StatusNotFound, "BoxNotFound"},
+		{fmt.Errorf("docker is down"), http.StatusInternalServerError, ""},
+	}
+	for _, route := range []struct{ path, code string }{{"commands", "ExecBoxError"}, {"run-code", "RunBoxError"}} {
+		for _, tt := range tests {
+			t.Run(route.path+"/"+tt.err.Error(), func(t *testing.T) {
+				fake.execErr = tt.err
+				resp, err := http.Post(server.URL+"/api/v1/boxes/box/"+route.path, restful.MIME_JSON, strings.NewReader(`{}`))
+				require.NoError(t, err)
+				defer resp.Body.Close()
+				assert.Equal(t, tt.status, resp.StatusCode)
+
+				var body struct {
+					Code string `json:"code"`
+				}
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+				code := tt.code
+				if code == "" {
+					code = route.code
+				}
+				assert.Equal(t, code, body.Code)
+			})
+		}
+	}
+}
+
+func TestReadFileAutoRange(t *testing.T) {
+	server, _ := newArchiveTestServer(t)
+
+	// The auto format converts whole files, so ranges are rejected before reading
+	for _, query := range []string{"offset=10", "length=10", "startLine=2"} {
+		resp, err := http.Get(server.URL + "/api/v1/boxes/box/fs/read?path=/data/a.pdf&format=auto&" + query)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+	}
+}
+
+func TestWriteFileInvalidEncoding(t *testing.T) {
+	server, fake := newArchiveTestServer(t)
+	fake.writeErr = fmt.Errorf("%w: invalid base64 content", service.ErrInvalidEncoding)
+
+	resp, err := http.Post(server.URL+"/api/v1/boxes/box/fs/write", restful.MIME_JSON,
+		strings.NewReader(`{"path": "/data/a.bin", "content": "not base64!", "encoding": "base64"}`))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	var body model.BoxError
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, "InvalidEncoding", body.Code)
+}
@@ -91,6 +91,36 @@ func RegisterRoutes(ws *restful.WebService, boxHandler *BoxHandler) {
 		Returns(404, "Not Found", model.BoxError{}).
 		Returns(500, "Internal Server Error", model.BoxError{}))
 
+	ws.Route(ws.GET("/boxes/{id}/kernels").To(boxHandler.ListKernels).
+		Doc("list the run-code kernels of a box").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Returns(200, "OK", model.BoxKernelListResult{}).
+		Returns(404, "Not Found", model.BoxError{}).
+		Returns(500, "Internal Server Error", model.BoxError{}))
+
+	ws.Route(ws.POST("/boxes/{id}/kernels/{kernelId}/interrupt").To(boxHandler.InterruptKernel).
+		Doc("interrupt the code a kernel is running").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Param(ws.PathParameter("kernelId", "identifier of the kernel").DataType("string")).
+		Returns(200, "OK", model.BoxKernel{}).
+		Returns(404, "Not Found", model.BoxError{}).
+		Returns(500, "Internal Server Error", model.BoxError{}))
+
+	ws.Route(ws.POST("/boxes/{id}/kernels/{kernelId}/restart").To(boxHandler.RestartKernel).
+		Doc("restart a kernel, discarding its state").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Param(ws.PathParameter("kernelId", "identifier of the kernel").DataType("string")).
+		Returns(200, "OK", model.BoxKernel{}).
+		Returns(404, "Not Found", model.BoxError{}).
+		Returns(500, "Internal Server Error", model.BoxError{}))
+
+	ws.Route(ws.GET("/run-code/languages").To(boxHandler.ListRunCodeLanguages).
+		Doc("list the languages supported by run-code").
+		Param(ws.QueryParameter("boxId", "box whose image is checked for the required executables").DataType("string").Required(false)).
+		Returns(200, "OK", model.RunCodeLanguageListResult{}).
+		Returns(404, "Not Found", model.BoxError{}).
+		Returns(500, "Internal Server Error", model.BoxError{}))
+
 	ws.Route(ws.POST("/boxes/{id}/start").To(boxHandler.StartBox).
 		Doc("start a stopped box").
 		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
@@ -115,35 +145,51 @@ func RegisterRoutes(ws *restful.WebService, boxHandler *BoxHandler) {
 	// 	Returns(404, "Not Found", model.BoxError{}).
 	// 	Returns(500, "Internal Server Error", model.BoxError{})) // e.g., upgrade failed
 
-	// // Box Archive Operations
-	// ws.Route(ws.HEAD("/boxes/{id}/archive").To(boxHandler.HeadArchive).
-	// 	Doc("get metadata about files in box").
-	// 	Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
-	// 	Param(ws.QueryParameter("path", "path to get metadata from").DataType("string").Required(true)).
-	// 	Returns(200, "OK", nil).
-	// 	Returns(400, "Bad Request", model.BoxError{}).
-	// 	Returns(404, "Not Found", model.BoxError{}).
-	// 	Returns(500, "Internal Server Error", model.BoxError{}))
+	// Box Archive Operations
+	ws.Route(ws.HEAD("/boxes/{id}/archive").To(boxHandler.HeadArchive).
+		Doc("get metadata about files in box, returned in the X-Gbox-Path-Stat header").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Param(ws.QueryParameter("path", "path to get metadata from").DataType("string").Required(true)).
+		Returns(200, "OK", nil).
+		Returns(400, "Bad Request", model.BoxError{}).
+		Returns(404, "Not Found", model.BoxError{}).
+		Returns(500, "Internal Server Error", model.BoxError{}))
 
-	// ws.Route(ws.GET("/boxes/{id}/archive").To(boxHandler.GetArchive).
-	// 	Doc("get files from box as tar archive").
-	// 	Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
-	// 	Param(ws.QueryParameter("path", "path to get files from").DataType("string").Required(true)).
-	// 	Produces("application/x-tar").
-	// 	Returns(200, "OK", nil).
-	// 	Returns(400, "Bad Request", model.BoxError{}).
-	// 	Returns(404, "Not Found", model.BoxError{}).
-	// 	Returns(500, "Internal Server Error", model.BoxError{}))
+	ws.Route(ws.GET("/boxes/{id}/archive").To(boxHandler.GetArchive).
+		Doc("get files from box as tar archive").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Param(ws.QueryParameter("path", "path to get files from").DataType("string").Required(true)).
+		Param(ws.QueryParameter("gzip", "if true, the archive is gzip-compressed").DataType("boolean").Required(false)).
+		Produces("application/x-tar", "application/gzip", "application/json").
+		Returns(200, "OK", nil).
+		Returns(400, "Bad Request", model.BoxError{}).
+		Returns(404, "Not Found", model.BoxError{}).
+		Returns(500, "Internal Server Error", model.BoxError{}))
 
-	// ws.Route(ws.PUT("/boxes/{id}/archive").To(boxHandler.ExtractArchive).
-	// 	Doc("extract tar archive to box").
-	// 	Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
-	// 	Param(ws.QueryParameter("path", "path to extract files to").DataType("string").Required(true)).
-	// 	Consumes("application/x-tar").
-	// 	Returns(200, "OK", nil).
-	// 	Returns(400, "Bad Request", model.BoxError{}).
-	// 	Returns(404, "Not Found", model.BoxError{}).
-	// 	Returns(500, "Internal Server Error", model.BoxError{}))
+	ws.Route(ws.PUT("/boxes/{id}/archive").To(boxHandler.ExtractArchive).
+		Doc("extract tar archive to box, the archive may be gzip-compressed").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Param(ws.QueryParameter("path", "path to extract files to").DataType("string").Required(true)).
+		Param(ws.QueryParameter("noOverwriteDirNonDir", "if true, fail instead of replacing a directory with a non-directory and vice versa").DataType("boolean").Required(false)).
+		Param(ws.QueryParameter("copyUIDGID", "if true, keep the UID/GID of the archive entries").DataType("boolean").Required(false)).
+		Consumes("application/x-tar", "application/gzip", "application/octet-stream").
+		Returns(200, "OK", nil).
+		Returns(400, "Bad Request", model.BoxError{}).
+		Returns(404, "Not Found", model.BoxError{}).
+		Returns(500, "Internal Server Error", model.BoxError{}))
+
+	ws.Route(ws.GET("/boxes/{id}/changes").To(boxHandler.Changes).
+		Doc("list the paths added, modified and deleted since the box was created, or export the added and modified ones as a tar archive relative to /").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Param(ws.QueryParameter("exclude", "leave out paths matching this glob and everything under them, matched against names if it has no slash; repeated or comma-separated").DataType("string").AllowMultiple(true).Required(false)).
+		Param(ws.QueryParameter("noDefaultExcludes", "also report the paths the server excludes by default, such as /tmp and caches").DataType("boolean").Required(false)).
+		Param(ws.QueryParameter("format", "json to list the changes, tar to export them, defaults to json").DataType("string").Required(false)).
+		Param(ws.QueryParameter("gzip", "if true, the exported archive is gzip-compressed").DataType("boolean").Required(false)).
+		Produces("application/json", "application/x-tar", "application/gzip").
+		Returns(200, "OK", model.BoxChanges{}).
+		Returns(400, "Bad Request", model.BoxError{}).
+		Returns(404, "Not Found", model.BoxError{}).
+		Returns(500, "Internal Server Error", model.BoxError{}))
 
 	// Box Filesystem Operations
 	ws.Route(ws.GET("/boxes/{id}/fs/list").To(boxHandler.ListFiles).
@@ -151,20 +197,38 @@ func RegisterRoutes(ws *restful.WebService, boxHandler *BoxHandler) {
 		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
 		Param(ws.QueryParameter("path", "path to list files from").DataType("string").Required(false)).
 		Param(ws.QueryParameter("depth", "depth of directory listing").DataType("number").Required(false)).
+		Param(ws.QueryParameter("sort", "sort key: path, name, size, lastModified or type (directories first)").DataType("string").Required(false)).
+		Param(ws.QueryParameter("desc", "sort in descending order").DataType("boolean").Required(false)).
+		Param(ws.QueryParameter("offset", "number of sorted files to skip").DataType("integer").Required(false)).
+		Param(ws.QueryParameter("limit", "maximum number of files to return, all if 0").DataType("integer").Required(false)).
 		Produces("application/json").
 		Returns(200, "OK", model.BoxFileListResult{}).
 		Returns(400, "Bad Request", model.BoxError{}).
+		Returns(403, "Forbidden", model.BoxError{}).
 		Returns(404, "Not Found", model.BoxError{}).
+		Returns(409, "Conflict", model.BoxError{}).
 		Returns(500, "Internal Server Error", model.BoxError{}))
 
 	ws.Route(ws.GET("/boxes/{id}/fs/read").To(boxHandler.ReadFile).
 		Doc("read file content").
 		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
 		Param(ws.QueryParameter("path", "path to file to read").DataType("string").Required(true)).
+		Param(ws.QueryParameter("encoding", "encoding of the returned content: utf8 or base64").DataType("string").Required(false)).
+		Param(ws.QueryParameter("offset", "byte offset to start reading at").DataType("integer").Required(false)).
+		Param(ws.QueryParameter("length", "number of bytes to read").DataType("integer").Required(false)).
+		Param(ws.QueryParameter("startLine", "first line to read, 1-based").DataType("integer").Required(false)).
+		Param(ws.QueryParameter("endLine", "last line to read, inclusive").DataType("integer").Required(false)).
+		Param(ws.QueryParameter("maxSize", "maximum number of bytes to read").DataType("integer").Required(false)).
+		Param(ws.QueryParameter("format", "raw (default) or auto to convert whole images, documents, CSV and JSON by their type, without ranges").DataType("string").Required(false)).
+		Param(ws.QueryParameter("maxDimension", "largest width or height of images in auto format, downscaled if larger").DataType("integer").Required(false)).
+		Param(ws.QueryParameter("maxRows", "maximum number of CSV rows or JSON items in auto format").DataType("integer").Required(false)).
+		Param(ws.QueryParameter("maxPages", "maximum number of document pages in auto format").DataType("integer").Required(false)).
 		Produces("application/json").
 		Returns(200, "OK", model.BoxFileReadResult{}).
 		Returns(400, "Bad Request", model.BoxError{}).
 		Returns(404, "Not Found", model.BoxError{}).
+		Returns(413, "Request Entity Too Large", model.BoxError{}).
+		Returns(422, "Unprocessable Entity", model.BoxError{}).
 		Returns(500, "Internal Server Error", model.BoxError{}))
 
 	ws.Route(ws.POST("/boxes/{id}/fs/write").To(boxHandler.WriteFile).
@@ -175,6 +239,201 @@ func RegisterRoutes(ws *restful.WebService, boxHandler *BoxHandler) {
 		Returns(200, "OK", model.BoxFileWriteResult{}).
 		Returns(400, "Bad Request", model.BoxError{}).
 		Returns(404, "Not Found", model.BoxError{}).
+		Returns(409, "Conflict", model.BoxError{}).
+		Returns(412, "Precondition Failed", model.BoxError{}).
+		Returns(500, "Internal Server Error", model.BoxError{}))
+
+	ws.Route(ws.POST("/boxes/{id}/fs/edit").To(boxHandler.EditFile).
+		Doc("edit a file with search/replace, line range, insert or unified diff edits").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Reads(model.BoxFileEditParams{}).
+		Produces("application/json").
+		Returns(200, "OK", model.BoxFileEditResult{}).
+		Returns(400, "Bad Request", model.BoxError{}).
+		Returns(404, "Not Found", model.BoxError{}).
+		Returns(409, "Conflict", model.BoxError{}).
+		Returns(413, "Request Entity Too Large", model.BoxError{}).
+		Returns(422, "Unprocessable Entity", model.BoxError{}).
+		Returns(500, "Internal Server Error", model.BoxError{}))
+
+	ws.Route(ws.GET("/boxes/{id}/fs/search").To(boxHandler.SearchFiles).
+		Doc("search file names and contents").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Param(ws.QueryParameter("path", "directory to search, defaults to the working directory").DataType("string").Required(false)).
+		Param(ws.QueryParameter("pattern", "glob matched against file names, or relative paths if it contains a slash").DataType("string").Required(false)).
+		Param(ws.QueryParameter("query", "regular expression searched for in file contents").DataType("string").Required(false)).
+		Param(ws.QueryParameter("ignoreCase", "match the query case-insensitively").DataType("boolean").Required(false)).
+		Param(ws.QueryParameter("include", "globs of the files to search, repeated or comma-separated").DataType("string").Required(false)).
+		Param(ws.QueryParameter("exclude", "globs of the files to skip, repeated or comma-separated").DataType("string").Required(false)).
+		Param(ws.QueryParameter("maxResults", "maximum number of matches, defaults to 100").DataType("integer").Required(false)).
+		Param(ws.QueryParameter("contextLines", "number of lines returned around content matches").DataType("integer").Required(false)).
+		Param(ws.QueryParameter("noIgnore", "also search files excluded by .gitignore, .git and node_modules").DataType("boolean").Required(false)).
+		Produces("application/json").
+		Returns(200, "OK", model.BoxFileSearchResult{}).
+		Returns(400, "Bad Request", model.BoxError{}).
+		Returns(404, "Not Found", model.BoxError{}).
+		Returns(500, "Internal Server Error", model.BoxError{}))
+
+	ws.Route(ws.GET("/boxes/{id}/fs/stat").To(boxHandler.StatFile).
+		Doc("describe a file, directory or symlink").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Param(ws.QueryParameter("path", "path of the file").DataType("string").Required(true)).
+		Produces("application/json").
+		Returns(200, "OK", model.BoxFile{}).
+		Returns(400, "Bad Request", model.BoxError{}).
+		Returns(403, "Forbidden", model.BoxError{}).
+		Returns(404, "Not Found", model.BoxError{}).
+		Returns(500, "Internal Server Error", model.BoxError{}))
+
+	ws.Route(ws.POST("/boxes/{id}/fs/manifest").To(boxHandler.FileManifest).
+		Doc("describe every file under a directory with the SHA-256 hash of its content, reading only the files changed since they were known").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Reads(model.BoxFileManifestParams{}).
+		Produces("application/json").
+		Returns(200, "OK", model.BoxFileManifest{}).
+		Returns(400, "Bad Request", model.BoxError{}).
+		Returns(403, "Forbidden", model.BoxError{}).
+		Returns(404, "Not Found", model.BoxError{}).
+		Returns(500, "Internal Server Error", model.BoxError{}))
+
+	ws.Route(ws.POST("/boxes/{id}/fs/download").To(boxHandler.DownloadFile).
+		Doc("download a URL into a file, fetched by the server or the box depending on the download policy; progress is streamed as JSON lines for Accept: application/json-stream").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Reads(model.BoxFileDownloadParams{}).
+		Produces("application/json", "application/json-stream").
+		Returns(200, "OK", model.BoxFileDownloadResult{}).
+		Returns(400, "Bad Request", model.BoxError{}).
+		Returns(403, "Forbidden", model.BoxError{}).
+		Returns(404, "Not Found", model.BoxError{}).
+		Returns(409, "Conflict", model.BoxError{}).
+		Returns(413, "Request Entity Too Large", model.BoxError{}).
+		Returns(422, "Unprocessable Entity", model.BoxError{}).
+		Returns(500, "Internal Server Error", model.BoxError{}).
+		Returns(502, "Bad Gateway", model.BoxError{}))
+
+	ws.Route(ws.POST("/boxes/{id}/fs/mkdir").To(boxHandler.MakeDir).
+		Doc("create a directory").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Reads(model.BoxFileMkdirParams{}).
+		Produces("application/json").
+		Returns(200, "OK", model.BoxFile{}).
+		Returns(400, "Bad Request", model.BoxError{}).
+		Returns(403, "Forbidden", model.BoxError{}).
+		Returns(404, "Not Found", model.BoxError{}).
+		Returns(409, "Conflict", model.BoxError{}).
+		Returns(500, "Internal Server Error", model.BoxError{}))
+
+	ws.Route(ws.POST("/boxes/{id}/fs/remove").To(boxHandler.RemoveFile).
+		Doc("remove a file or directory").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Reads(model.BoxFileRemoveParams{}).
+		Produces("application/json").
+		Returns(200, "OK", model.BoxFileRemoveResult{}).
+		Returns(400, "Bad Request", model.BoxError{}).
+		Returns(403, "Forbidden", model.BoxError{}).
+		Returns(404, "Not Found", model.BoxError{}).
+		Returns(409, "Conflict", model.BoxError{}).
+		Returns(500, "Internal Server Error", model.BoxError{}))
+
+	ws.Route(ws.POST("/boxes/{id}/fs/move").To(boxHandler.MoveFile).
+		Doc("move or rename a file or directory").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Reads(model.BoxFileMoveParams{}).
+		Produces("application/json").
+		Returns(200, "OK", model.BoxFile{}).
+		Returns(400, "Bad Request", model.BoxError{}).
+		Returns(403, "Forbidden", model.BoxError{}).
+		Returns(404, "Not Found", model.BoxError{}).
+		Returns(409, "Conflict", model.BoxError{}).
+		Returns(500, "Internal Server Error", model.BoxError{}))
+
+	ws.Route(ws.POST("/boxes/{id}/fs/copy").To(boxHandler.CopyFile).
+		Doc("copy a file or directory").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Reads(model.BoxFileCopyParams{}).
+		Produces("application/json").
+		Returns(200, "OK", model.BoxFile{}).
+		Returns(400, "Bad Request", model.BoxError{}).
+		Returns(403, "Forbidden", model.BoxError{}).
+		Returns(404, "Not Found", model.BoxError{}).
+		Returns(409, "Conflict", model.BoxError{}).
+		Returns(500, "Internal Server Error", model.BoxError{}))
+
+	ws.Route(ws.POST("/boxes/{id}/fs/chmod").To(boxHandler.ChmodFile).
+		Doc("change the permission of a file or directory").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Reads(model.BoxFileChmodParams{}).
+		Produces("application/json").
+		Returns(200, "OK", model.BoxFile{}).
+		Returns(400, "Bad Request", model.BoxError{}).
+		Returns(403, "Forbidden", model.BoxError{}).
+		Returns(404, "Not Found", model.BoxError{}).
+		Returns(409, "Conflict", model.BoxError{}).
+		Returns(500, "Internal Server Error", model.BoxError{}))
+
+	ws.Route(ws.GET("/boxes/{id}/fs/watch").To(boxHandler.WatchFiles).
+		Doc("stream the changes to a directory as server-sent events or a JSON stream").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Param(ws.QueryParameter("path", "directory to watch, defaults to the working directory").DataType("string").Required(false)).
+		Param(ws.QueryParameter("recursive", "also watch the subdirectories").DataType("boolean").Required(false)).
+		Param(ws.QueryParameter("debounce", "how long changes are coalesced before they are sent, e.g. 500ms, defaults to 200ms").DataType("string").Required(false)).
+		Produces("application/json", "text/event-stream", "application/json-stream").
+		Returns(200, "OK", model.BoxFileEvent{}).
+		Returns(400, "Bad Request", model.BoxError{}).
+		Returns(404, "Not Found", model.BoxError{}).
+		Returns(500, "Internal Server Error", model.BoxError{}))
+
+	// Git operations
+	ws.Route(ws.POST("/boxes/{id}/git/clone").To(boxHandler.GitClone).
+		Doc("clone a repository, with the credential configured on the server for its host or named by the request").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Reads(model.BoxGitCloneParams{}).
+		Produces("application/json").
+		Returns(200, "OK", model.BoxGitCloneResult{}).
+		Returns(400, "Bad Request", model.BoxError{}).
+		Returns(403, "Forbidden", model.BoxError{}).
+		Returns(404, "Not Found", model.BoxError{}).
+		Returns(409, "Conflict", model.BoxError{}).
+		Returns(422, "Unprocessable Entity", model.BoxError{}).
+		Returns(500, "Internal Server Error", model.BoxError{}))
+
+	ws.Route(ws.GET("/boxes/{id}/git/status").To(boxHandler.GitStatus).
+		Doc("describe the branch and changed files of a repository").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Param(ws.QueryParameter("path", "directory of the repository, defaults to the working directory").DataType("string").Required(false)).
+		Produces("application/json").
+		Returns(200, "OK", model.BoxGitStatus{}).
+		Returns(400, "Bad Request", model.BoxError{}).
+		Returns(404, "Not Found", model.BoxError{}).
+		Returns(422, "Unprocessable Entity", model.BoxError{}).
+		Returns(500, "Internal Server Error", model.BoxError{}))
+
+	ws.Route(ws.GET("/boxes/{id}/git/diff").To(boxHandler.GitDiff).
+		Doc("diff a repository into files and hunks").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Param(ws.QueryParameter("path", "directory of the repository, defaults to the working directory").DataType("string").Required(false)).
+		Param(ws.QueryParameter("staged", "diff the index instead of the working tree").DataType("boolean").Required(false)).
+		Param(ws.QueryParameter("ref", "commit compared with, defaults to the index for the working tree and HEAD for the index").DataType("string").Required(false)).
+		Param(ws.QueryParameter("file", "limit the diff to this path relative to the repository; may be repeated").DataType("string").AllowMultiple(true).Required(false)).
+		Param(ws.QueryParameter("context", "number of unchanged lines around changes, defaults to 3").DataType("integer").Required(false)).
+		Param(ws.QueryParameter("untracked", "also diff untracked files as added, unless staged is set").DataType("boolean").Required(false)).
+		Produces("application/json").
+		Returns(200, "OK", model.BoxGitDiff{}).
+		Returns(400, "Bad Request", model.BoxError{}).
+		Returns(404, "Not Found", model.BoxError{}).
+		Returns(422, "Unprocessable Entity", model.BoxError{}).
+		Returns(500, "Internal Server Error", model.BoxError{}))
+
+	ws.Route(ws.POST("/boxes/{id}/git/commit").To(boxHandler.GitCommit).
+		Doc("stage and commit changes of a repository").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Reads(model.BoxGitCommitParams{}).
+		Produces("application/json").
+		Returns(201, "Created", model.BoxGitCommitResult{}).
+		Returns(400, "Bad Request", model.BoxError{}).
+		Returns(404, "Not Found", model.BoxError{}).
+		Returns(409, "Conflict", model.BoxError{}).
+		Returns(422, "Unprocessable Entity", model.BoxError{}).
 		Returns(500, "Internal Server Error", model.BoxError{}))
 
 	// Image management operations
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/babelcloud/gbox/packages/api-server/config"
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+// ChangesExcludes returns the globs the changes of a box are filtered with: the ones
+// configured on the server, unless the request disables them, and those of the request
+func ChangesExcludes(params *model.BoxChangesParams) ([]string, error) {
+	for _, glob := range params.Exclude {
+		for _, segment := range strings.Split(glob, "/") {
+			if _, err := path.Match(segment, ""); err != nil {
+				return nil, fmt.Errorf("malformed exclude glob %q", glob)
+			}
+		}
+	}
+
+	var globs []string
+	if !params.NoDefaultExcludes {
+		globs = append(globs, config.GetInstance().File.ChangesExclude...)
+	}
+	return append(globs, params.Exclude...), nil
+}
+
+// NewBoxChanges sorts the changes of a box and leaves out the excluded ones. Modified
+// directories are left out too when changes under them are reported, even excluded ones,
+// as they are only modified by the entries added to or removed from them.
+func NewBoxChanges(changes []model.BoxChange, excludes []string) *model.BoxChanges {
+	parents := make(map[string]bool)
+	for _, change := range changes {
+		for dir := path.Dir(change.Path); dir != "/" && dir != "."; dir = path.Dir(dir) {
+			parents[dir] = true
+		}
+	}
+
+	result := &model.BoxChanges{Changes: []model.BoxChange{}}
+	for _, change := range changes {
+		if change.Kind == model.BoxChangeModified && parents[change.Path] {
+			continue
+		}
+		if excludedChange(excludes, change.Path) {
+			result.Excluded++
+			continue
+		}
+		switch change.Kind {
+		case model.BoxChangeAdded:
+			result.Added++
+		case model.BoxChangeModified:
+			result.Modified++
+		case model.BoxChangeDeleted:
+			result.Deleted++
+		}
+		result.Changes = append(result.Changes, change)
+	}
+	sort.Slice(result.Changes, func(i, j int) bool {
+		return result.Changes[i].Path < result.Changes[j].Path
+	})
+	return result
+}
+
+// excludedChange reports whether a path or one of its parents matches an exclude glob.
+// Globs without a slash match names, others absolute paths.
+func excludedChange(excludes []string, p string) bool {
+	for ; p != "/" && p != "."; p = path.Dir(p) {
+		for _, glob := range excludes {
+			if !strings.Contains(glob, "/") {
+				if ok, _ := path.Match(glob, path.Base(p)); ok {
+					return true
+				}
+			} else if MatchGlob(glob, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
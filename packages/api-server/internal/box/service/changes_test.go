@@ -0,0 +1,56 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+func TestNewBoxChanges(t *testing.T) {
+	changes := []model.BoxChange{
+		{Path: "/var", Kind: model.BoxChangeModified},
+		{Path: "/var/gbox", Kind: model.BoxChangeAdded},
+		{Path: "/var/gbox/main.py", Kind: model.BoxChangeAdded},
+		{Path: "/var/gbox/__pycache__", Kind: model.BoxChangeAdded},
+		{Path: "/var/gbox/__pycache__/main.pyc", Kind: model.BoxChangeAdded},
+		{Path: "/etc", Kind: model.BoxChangeModified},
+		{Path: "/etc/motd", Kind: model.BoxChangeDeleted},
+		{Path: "/etc/hosts.allow", Kind: model.BoxChangeModified},
+		{Path: "/root", Kind: model.BoxChangeModified},
+		{Path: "/root/.cache", Kind: model.BoxChangeAdded},
+		{Path: "/root/.cache/pip/http", Kind: model.BoxChangeAdded},
+		{Path: "/tmp", Kind: model.BoxChangeModified},
+		{Path: "/tmp/build.log", Kind: model.BoxChangeAdded},
+		{Path: "/usr/bin/tool", Kind: model.BoxChangeModified},
+	}
+
+	result := NewBoxChanges(changes, []string{"/tmp", "/root/.cache", "**/__pycache__", "*.log"})
+	assert.Equal(t, []model.BoxChange{
+		{Path: "/etc/hosts.allow", Kind: model.BoxChangeModified},
+		{Path: "/etc/motd", Kind: model.BoxChangeDeleted},
+		{Path: "/usr/bin/tool", Kind: model.BoxChangeModified},
+		{Path: "/var/gbox", Kind: model.BoxChangeAdded},
+		{Path: "/var/gbox/main.py", Kind: model.BoxChangeAdded},
+	}, result.Changes)
+	assert.Equal(t, 2, result.Added)
+	assert.Equal(t, 2, result.Modified)
+	assert.Equal(t, 1, result.Deleted)
+	assert.Equal(t, 5, result.Excluded)
+
+	// Directories only modified by their entries are left out even without excludes
+	result = NewBoxChanges(changes, nil)
+	assert.Len(t, result.Changes, 10)
+	assert.Zero(t, result.Excluded)
+}
+
+func TestChangesExcludes(t *testing.T) {
+	excludes, err := ChangesExcludes(&model.BoxChangesParams{Exclude: []string{"/data"}, NoDefaultExcludes: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/data"}, excludes)
+
+	_, err = ChangesExcludes(&model.BoxChangesParams{Exclude: []string{"/data/[a"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,372 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/api-server/config"
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+// Download policies of the file.download_policy setting
+const (
+	// DownloadPolicyAuto has the server fetch public addresses and boxes fetch the others,
+	// so boxes cannot reach the network of the server through it
+	DownloadPolicyAuto = "auto"
+	// DownloadPolicyServer has the server fetch every URL
+	DownloadPolicyServer = "server"
+	// DownloadPolicyBox has boxes fetch every URL with curl or wget
+	DownloadPolicyBox = "box"
+)
+
+// downloadProgressInterval is the least time between two progress updates of a download
+const downloadProgressInterval = 500 * time.Millisecond
+
+// boxDownloadProgressInterval is the time between two checks of the progress of a download
+// fetched by a box, each of which runs a command in the box
+const boxDownloadProgressInterval = time.Second
+
+// ValidateDownload checks the URL of a download and returns it parsed along with the
+// checksum normalized to lower-case hex
+func ValidateDownload(params *model.BoxFileDownloadParams) (*url.URL, string, error) {
+	u, err := url.Parse(params.URL)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid url: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, "", fmt.Errorf("invalid url %q: only http and https URLs can be downloaded", params.URL)
+	}
+
+	checksum := strings.ToLower(strings.TrimPrefix(params.Checksum, "sha256:"))
+	if checksum != "" {
+		if decoded, err := hex.DecodeString(checksum); err != nil || len(decoded) != sha256.Size {
+			return nil, "", fmt.Errorf("invalid checksum %q: expected a hex SHA-256", params.Checksum)
+		}
+	}
+	return u, checksum, nil
+}
+
+// DownloadLimit returns the size limit of a download, which may lower the configured
+// limit but not raise it; 0 means unlimited
+func DownloadLimit(params *model.BoxFileDownloadParams) int64 {
+	limit := config.GetInstance().File.DownloadMaxSize
+	if params.MaxSize > 0 && (limit <= 0 || params.MaxSize < limit) {
+		return params.MaxSize
+	}
+	return limit
+}
+
+// DownloadVia decides whether the server or the box fetches u under the given policy.
+// With the auto policy, hosts that do not resolve to public addresses on the server are
+// left to the box, which may reach networks the server does not, and the other way round.
+func DownloadVia(ctx context.Context, policy string, u *url.URL) (string, error) {
+	switch policy {
+	case DownloadPolicyServer:
+		return model.DownloadViaServer, nil
+	case DownloadPolicyBox:
+		return model.DownloadViaBox, nil
+	case "", DownloadPolicyAuto:
+	default:
+		return "", fmt.Errorf("unknown download policy: %s", policy)
+	}
+
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if publicIP(ip) {
+			return model.DownloadViaServer, nil
+		}
+		return model.DownloadViaBox, nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return model.DownloadViaBox, nil
+	}
+	for _, addr := range addrs {
+		if !publicIP(addr.IP) {
+			return model.DownloadViaBox, nil
+		}
+	}
+	return model.DownloadViaServer, nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, which is not routable on the internet
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// publicIP reports whether ip is an address routable on the internet
+func publicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() && !sharedAddressSpace.Contains(ip)
+}
+
+// Downloader fetches the content of URLs on the server
+type Downloader struct {
+	client *http.Client
+}
+
+// NewDownloader returns a downloader. With publicOnly it refuses to connect to addresses
+// that are not public, whatever the names resolve to and wherever redirects lead.
+func NewDownloader(publicOnly bool) *Downloader {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if publicOnly {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return fmt.Errorf("refusing to connect to non-public address %s", host)
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	if publicOnly {
+		// A proxy would connect on behalf of the server, past the checks
+		transport.Proxy = nil
+	}
+	return &Downloader{client: &http.Client{Transport: transport}}
+}
+
+// Download writes the content of the URL of params to w and returns its size, hash and
+// type. Content beyond maxSize, if positive, fails with ErrFileTooLarge, and content
+// without the expected checksum with ErrChecksumMismatch. Progress is written to
+// progressWriter as JSON encoded model.ProgressUpdate values if it is not nil.
+func (d *Downloader) Download(ctx context.Context, params *model.BoxFileDownloadParams, maxSize int64, checksum string, w io.Writer, progressWriter io.Writer) (*model.BoxFileDownloadResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, params.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	for name, value := range params.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDownloadFailed, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%w: %s returned %s", ErrDownloadFailed, params.URL, resp.Status)
+	}
+	if maxSize > 0 && resp.ContentLength > maxSize {
+		return nil, fmt.Errorf("%w: %s has %d bytes, the limit is %d", ErrFileTooLarge, params.URL, resp.ContentLength, maxSize)
+	}
+
+	progress := &downloadProgress{encoder: progressEncoder(progressWriter), total: resp.ContentLength}
+	body := io.Reader(resp.Body)
+	if maxSize > 0 {
+		// Read one byte more than allowed to tell content of exactly maxSize from larger
+		body = io.LimitReader(body, maxSize+1)
+	}
+	sum := sha256.New()
+	size, err := io.Copy(io.MultiWriter(w, sum, progress), body)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("%w: %v", ErrDownloadFailed, err)
+	}
+	if maxSize > 0 && size > maxSize {
+		return nil, fmt.Errorf("%w: %s exceeds the limit of %d bytes", ErrFileTooLarge, params.URL, maxSize)
+	}
+	progress.report(true)
+
+	hash := hex.EncodeToString(sum.Sum(nil))
+	if checksum != "" && hash != checksum {
+		return nil, fmt.Errorf("%w: %s has sha256 %s, expected %s", ErrChecksumMismatch, params.URL, hash, checksum)
+	}
+	return &model.BoxFileDownloadResult{
+		Size:        size,
+		SHA256:      hash,
+		ContentType: resp.Header.Get("Content-Type"),
+		Via:         model.DownloadViaServer,
+	}, nil
+}
+
+// progressEncoder returns an encoder writing to progressWriter, nil if there is none.
+// Progress is informational, so callers ignore encoding errors: a client that stopped
+// reading fails the download anyway.
+func progressEncoder(progressWriter io.Writer) *json.Encoder {
+	if progressWriter == nil {
+		return nil
+	}
+	return json.NewEncoder(progressWriter)
+}
+
+// WriteDownloadProgress writes a progress update of a download to progressWriter, if any
+func WriteDownloadProgress(progressWriter io.Writer, status model.ProgressStatus, message string) {
+	if encoder := progressEncoder(progressWriter); encoder != nil {
+		encoder.Encode(model.ProgressUpdate{Status: status, Message: message})
+	}
+}
+
+// downloadProgress counts the bytes written to it and reports them at most every
+// downloadProgressInterval
+type downloadProgress struct {
+	encoder  *json.Encoder
+	total    int64
+	current  int64
+	reported time.Time
+}
+
+// Write implements io.Writer
+func (p *downloadProgress) Write(b []byte) (int, error) {
+	p.current += int64(len(b))
+	p.report(false)
+	return len(b), nil
+}
+
+func (p *downloadProgress) report(final bool) {
+	if p.encoder == nil || (!final && time.Since(p.reported) < downloadProgressInterval) {
+		return
+	}
+	p.reported = time.Now()
+	update := model.ProgressUpdate{Status: model.ProgressStatusDownloading, Current: p.current}
+	if p.total > 0 {
+		update.Total = p.total
+	}
+	p.encoder.Encode(update)
+}
+
+// DownloadTempPath returns the temporary file next to the target at p that the download
+// with token is fetched to, see DownloadOperation
+func DownloadTempPath(p, token string) string {
+	p = ResolveBoxPath(p)
+	return path.Join(path.Dir(p), "."+path.Base(p)+".gbox-download-"+token)
+}
+
+// DownloadOperation has the box fetch the URL of a download with curl or wget. The
+// content is checked against maxSize, if positive, and the checksum in the temporary file
+// given by DownloadTempPath for token, which replaces the target once it passes. The
+// script prints the size and SHA-256 of the content.
+func DownloadOperation(params *model.BoxFileDownloadParams, maxSize int64, checksum, token string) *FileOperation {
+	p := ResolveBoxPath(params.Path)
+	args := []string{params.URL, p, strconv.FormatInt(maxSize, 10), checksum, flag(params.Overwrite == nil || *params.Overwrite), DownloadTempPath(p, token)}
+	for name, value := range params.Headers {
+		args = append(args, name+": "+value)
+	}
+	return &FileOperation{
+		name: "download",
+		script: `
+url=$1 target=$2 max=$3 sum=$4 tmp=$6
+if exists "$target"; then
+	isdir "$target" && fail 15 "$target: is a directory"
+	[ "$5" = 1 ] || fail 11 "$target: file exists"
+fi
+run mkdir -p "$(dirname "$target")"
+parent "$target"
+trap 'rm -f "$tmp"' EXIT
+shift 6
+n=$#
+if command -v curl >/dev/null 2>&1; then
+	for h do set -- "$@" -H "$h"; done
+	shift $n
+	[ "$max" -gt 0 ] && set -- "$@" --max-filesize "$max"
+	out=$(curl -fsSL -o "$tmp" "$@" "$url" 2>&1)
+	case $? in
+	0) ;;
+	63) fail 17 "$url exceeds the limit of $max bytes" ;;
+	*) fail 16 "curl: $out" ;;
+	esac
+elif command -v wget >/dev/null 2>&1; then
+	for h do set -- "$@" --header "$h"; done
+	shift $n
+	out=$(wget -q -O "$tmp" "$@" "$url" 2>&1) || fail 16 "wget: $out"
+else
+	fail 16 "neither curl nor wget is available in the box"
+fi
+size=$(wc -c < "$tmp" | tr -d ' ')
+[ "$max" -gt 0 ] && [ "$size" -gt "$max" ] && fail 17 "$url exceeds the limit of $max bytes"
+hash=$(sha256sum < "$tmp") || fail 1 "sha256sum failed"
+hash=${hash%% *}
+[ -z "$sum" ] || [ "$hash" = "$sum" ] || fail 18 "$url has sha256 $hash, expected $sum"
+run mv -f "$tmp" "$target"
+echo "$size $hash"`,
+		args: args,
+	}
+}
+
+// downloadSizeOperation prints the size of the temporary file of a download, nothing
+// before it is created
+func downloadSizeOperation(tmp string) *FileOperation {
+	return &FileOperation{
+		name: "download-size",
+		script: `
+[ -f "$1" ] && wc -c < "$1" | tr -d ' '
+exit 0`,
+		args: []string{tmp},
+	}
+}
+
+// WatchDownloadProgress reports the bytes a box has fetched to the temporary file tmp of a
+// download to progressWriter, checking them with run every boxDownloadProgressInterval
+// until the returned stop function is called. It does nothing without progressWriter.
+func WatchDownloadProgress(ctx context.Context, tmp string, progressWriter io.Writer, run func(ctx context.Context, op *FileOperation) (string, error)) (stop func()) {
+	encoder := progressEncoder(progressWriter)
+	if encoder == nil {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		op := downloadSizeOperation(tmp)
+		ticker := time.NewTicker(boxDownloadProgressInterval)
+		defer ticker.Stop()
+		reported := int64(-1)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			output, err := run(ctx, op)
+			if err != nil {
+				continue
+			}
+			size, err := strconv.ParseInt(strings.TrimSpace(output), 10, 64)
+			if err != nil || size == reported || ctx.Err() != nil {
+				continue
+			}
+			reported = size
+			encoder.Encode(model.ProgressUpdate{Status: model.ProgressStatusDownloading, Current: size})
+		}
+	}()
+	// Updates are not written once stop returns, so the caller can write to progressWriter again
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// ParseDownloadOutput parses the output of DownloadOperation for the target at p
+func ParseDownloadOutput(p, output string) (*model.BoxFileDownloadResult, error) {
+	fields := strings.Fields(output)
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("unexpected download output: %q", output)
+	}
+	size, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected download size: %q", fields[0])
+	}
+	return &model.BoxFileDownloadResult{
+		Path:   ResolveBoxPath(p),
+		Size:   size,
+		SHA256: fields[1],
+		Via:    model.DownloadViaBox,
+	}, nil
+}
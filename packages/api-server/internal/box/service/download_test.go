@@ -0,0 +1,218 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+const downloadContent = "downloaded content"
+
+func downloadChecksum() string {
+	sum := sha256.Sum256([]byte(downloadContent))
+	return hex.EncodeToString(sum[:])
+}
+
+// newDownloadTestServer serves downloadContent at /file, only to requests with the
+// X-Token header, and 404 elsewhere
+func newDownloadTestServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/file" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("X-Token") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(downloadContent))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestValidateDownload(t *testing.T) {
+	u, checksum, err := ValidateDownload(&model.BoxFileDownloadParams{URL: "https://example.com/a.tgz", Checksum: "sha256:" + strings.ToUpper(downloadChecksum())})
+	require.NoError(t, err)
+	assert.Equal(t, "example.com", u.Host)
+	assert.Equal(t, downloadChecksum(), checksum)
+
+	for _, params := range []model.BoxFileDownloadParams{
+		{URL: "file:///etc/passwd"},
+		{URL: "ftp://example.com/a"},
+		{URL: "https://"},
+		{URL: "https://example.com/a", Checksum: "md5:abc"},
+		{URL: "https://example.com/a", Checksum: "abcd"},
+	} {
+		_, _, err := ValidateDownload(&params)
+		assert.Error(t, err, params)
+	}
+}
+
+func TestDownloadVia(t *testing.T) {
+	ctx := context.Background()
+	via := func(policy, rawURL string) string {
+		u, err := url.Parse(rawURL)
+		require.NoError(t, err)
+		v, err := DownloadVia(ctx, policy, u)
+		require.NoError(t, err)
+		return v
+	}
+
+	assert.Equal(t, model.DownloadViaServer, via(DownloadPolicyAuto, "https://8.8.8.8/a"))
+	assert.Equal(t, model.DownloadViaServer, via(DownloadPolicyAuto, "https://[2001:4860:4860::8888]/a"))
+	for _, internal := range []string{"127.0.0.1", "10.1.2.3", "192.168.1.1", "169.254.169.254", "100.64.0.1", "[::1]", "[fd00::1]", "localhost"} {
+		assert.Equal(t, model.DownloadViaBox, via(DownloadPolicyAuto, "http://"+internal+"/a"), internal)
+	}
+	assert.Equal(t, model.DownloadViaServer, via(DownloadPolicyServer, "http://127.0.0.1/a"))
+	assert.Equal(t, model.DownloadViaBox, via(DownloadPolicyBox, "https://8.8.8.8/a"))
+
+	_, err := DownloadVia(ctx, "proxy", &url.URL{Scheme: "https", Host: "example.com"})
+	assert.Error(t, err)
+}
+
+func TestDownloader(t *testing.T) {
+	server := newDownloadTestServer(t)
+	headers := map[string]string{"X-Token": "secret"}
+	download := func(params *model.BoxFileDownloadParams, maxSize int64, checksum string) (string, *model.BoxFileDownloadResult, []model.ProgressUpdate, error) {
+		var content, progress bytes.Buffer
+		result, err := NewDownloader(false).Download(context.Background(), params, maxSize, checksum, &content, &progress)
+		var updates []model.ProgressUpdate
+		decoder := json.NewDecoder(&progress)
+		for decoder.More() {
+			var update model.ProgressUpdate
+			require.NoError(t, decoder.Decode(&update))
+			updates = append(updates, update)
+		}
+		return content.String(), result, updates, err
+	}
+
+	content, result, updates, err := download(&model.BoxFileDownloadParams{URL: server.URL + "/file", Headers: headers}, 0, downloadChecksum())
+	require.NoError(t, err)
+	assert.Equal(t, downloadContent, content)
+	assert.Equal(t, int64(len(downloadContent)), result.Size)
+	assert.Equal(t, downloadChecksum(), result.SHA256)
+	assert.Equal(t, "text/plain", result.ContentType)
+	assert.Equal(t, model.DownloadViaServer, result.Via)
+	require.NotEmpty(t, updates)
+	last := updates[len(updates)-1]
+	assert.Equal(t, model.ProgressStatusDownloading, last.Status)
+	assert.Equal(t, int64(len(downloadContent)), last.Current)
+	assert.Equal(t, int64(len(downloadContent)), last.Total)
+
+	// A limit of exactly the size passes
+	_, _, _, err = download(&model.BoxFileDownloadParams{URL: server.URL + "/file", Headers: headers}, int64(len(downloadContent)), "")
+	assert.NoError(t, err)
+
+	_, _, _, err = download(&model.BoxFileDownloadParams{URL: server.URL + "/file", Headers: headers}, 4, "")
+	assert.True(t, errors.Is(err, ErrFileTooLarge), "got %v", err)
+
+	_, _, _, err = download(&model.BoxFileDownloadParams{URL: server.URL + "/file", Headers: headers}, 0, strings.Repeat("0", 64))
+	assert.True(t, errors.Is(err, ErrChecksumMismatch), "got %v", err)
+
+	_, _, _, err = download(&model.BoxFileDownloadParams{URL: server.URL + "/file"}, 0, "")
+	assert.True(t, errors.Is(err, ErrDownloadFailed), "got %v", err)
+	assert.Contains(t, err.Error(), "401")
+
+	_, _, _, err = download(&model.BoxFileDownloadParams{URL: server.URL + "/missing", Headers: headers}, 0, "")
+	assert.True(t, errors.Is(err, ErrDownloadFailed), "got %v", err)
+
+	// Downloaders limited to public addresses cannot reach the loopback server
+	_, err = NewDownloader(true).Download(context.Background(), &model.BoxFileDownloadParams{URL: server.URL + "/file", Headers: headers}, 0, "", &bytes.Buffer{}, nil)
+	assert.True(t, errors.Is(err, ErrDownloadFailed), "got %v", err)
+	assert.Contains(t, err.Error(), "non-public address")
+}
+
+func TestDownloadOperation(t *testing.T) {
+	for _, tool := range []string{"sh", "curl", "sha256sum"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is not available", tool)
+		}
+	}
+	t.Setenv("no_proxy", "*")
+	server := newDownloadTestServer(t)
+	dir := t.TempDir()
+	target := filepath.Join(dir, "sub", "file.txt")
+	headers := map[string]string{"X-Token": "secret"}
+
+	run := func(params *model.BoxFileDownloadParams, maxSize int64, checksum string) (*model.BoxFileDownloadResult, error) {
+		op := DownloadOperation(params, maxSize, checksum, "test")
+		output, err := op.Output(execFileOperation(t, op))
+		if err != nil {
+			return nil, err
+		}
+		return ParseDownloadOutput(params.Path, output)
+	}
+
+	result, err := run(&model.BoxFileDownloadParams{URL: server.URL + "/file", Path: target, Headers: headers}, 1<<20, downloadChecksum())
+	require.NoError(t, err)
+	assert.Equal(t, target, result.Path)
+	assert.Equal(t, int64(len(downloadContent)), result.Size)
+	assert.Equal(t, downloadChecksum(), result.SHA256)
+	assert.Equal(t, model.DownloadViaBox, result.Via)
+	content, err := os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, downloadContent, string(content))
+
+	noOverwrite := false
+	_, err = run(&model.BoxFileDownloadParams{URL: server.URL + "/file", Path: target, Headers: headers, Overwrite: &noOverwrite}, 0, "")
+	assert.True(t, errors.Is(err, ErrFileExists), "got %v", err)
+
+	_, err = run(&model.BoxFileDownloadParams{URL: server.URL + "/file", Path: target, Headers: headers}, 4, "")
+	assert.True(t, errors.Is(err, ErrFileTooLarge), "got %v", err)
+
+	_, err = run(&model.BoxFileDownloadParams{URL: server.URL + "/file", Path: target, Headers: headers}, 0, strings.Repeat("0", 64))
+	assert.True(t, errors.Is(err, ErrChecksumMismatch), "got %v", err)
+
+	_, err = run(&model.BoxFileDownloadParams{URL: server.URL + "/file", Path: target}, 0, "")
+	assert.True(t, errors.Is(err, ErrDownloadFailed), "got %v", err)
+
+	_, err = run(&model.BoxFileDownloadParams{URL: server.URL + "/file", Path: dir, Headers: headers}, 0, "")
+	assert.True(t, errors.Is(err, ErrNotAFile), "got %v", err)
+
+	// Failed downloads leave the target and no temporary files behind
+	entries, err := os.ReadDir(filepath.Dir(target))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	content, err = os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, downloadContent, string(content))
+}
+
+func TestWatchDownloadProgress(t *testing.T) {
+	tmp := DownloadTempPath(filepath.Join(t.TempDir(), "file.txt"), "test")
+	assert.Equal(t, ".file.txt.gbox-download-test", filepath.Base(tmp))
+
+	pr, pw := io.Pipe()
+	stop := WatchDownloadProgress(context.Background(), tmp, pw, func(ctx context.Context, op *FileOperation) (string, error) {
+		return op.Output(execFileOperation(t, op))
+	})
+	defer stop()
+
+	// The size is reported once the box has created the file
+	require.NoError(t, os.WriteFile(tmp, []byte("12345"), 0644))
+	var update model.ProgressUpdate
+	require.NoError(t, json.NewDecoder(pr).Decode(&update))
+	assert.Equal(t, model.ProgressUpdate{Status: model.ProgressStatusDownloading, Current: 5}, update)
+
+	stop()
+	assert.NotPanics(t, stop, "stopping twice")
+}
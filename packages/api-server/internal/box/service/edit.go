@@ -0,0 +1,324 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pmezard/go-difflib/difflib"
+
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+// noNewlineMarker follows the last line of a unified diff side that has no newline
+const noNewlineMarker = `\ No newline at end of file`
+
+var hunkHeaderPattern = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// EditFileContent applies the edits of params to the original content of a file and
+// returns the edited content along with the result reported to the client
+func EditFileContent(original []byte, params *model.BoxFileEditParams) (string, *model.BoxFileEditResult, error) {
+	if !utf8.Valid(original) {
+		return "", nil, fmt.Errorf("%w: %s is not a UTF-8 text file", ErrInvalidEdit, params.Path)
+	}
+
+	edited, err := ApplyFileEdits(string(original), params.Edits)
+	if err != nil {
+		return "", nil, err
+	}
+	diff, err := UnifiedDiff(params.Path, string(original), edited)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to diff %s: %w", params.Path, err)
+	}
+
+	sum := sha256.Sum256([]byte(edited))
+	return edited, &model.BoxFileEditResult{
+		Diff:    diff,
+		Changed: edited != string(original),
+		Size:    int64(len(edited)),
+		SHA256:  hex.EncodeToString(sum[:]),
+	}, nil
+}
+
+// ApplyFileEdits applies edits to the content of a file in order
+func ApplyFileEdits(content string, edits []model.BoxFileEdit) (string, error) {
+	if len(edits) == 0 {
+		return "", fmt.Errorf("%w: no edits given", ErrInvalidEdit)
+	}
+
+	for i, edit := range edits {
+		var err error
+		switch edit.Type {
+		case model.FileEditReplace:
+			content, err = applyReplace(content, edit)
+		case model.FileEditReplaceLines:
+			content, err = applyReplaceLines(content, edit)
+		case model.FileEditInsert:
+			content, err = applyInsert(content, edit)
+		case model.FileEditPatch:
+			content, err = applyPatch(content, edit.Patch)
+		default:
+			err = fmt.Errorf("%w: unknown edit type %q", ErrInvalidEdit, edit.Type)
+		}
+		if err != nil {
+			return "", fmt.Errorf("edit %d: %w", i+1, err)
+		}
+	}
+	return content, nil
+}
+
+// UnifiedDiff returns the unified diff between the old and new content of a file
+func UnifiedDiff(path, oldContent, newContent string) (string, error) {
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        diffLines(oldContent),
+		B:        diffLines(newContent),
+		FromFile: "a" + path,
+		ToFile:   "b" + path,
+		Context:  3,
+	})
+}
+
+// diffLines splits content into the lines of a unified diff, marking a missing final newline
+func diffLines(content string) []string {
+	lines := splitLines(content)
+	if n := len(lines); n > 0 && !strings.HasSuffix(lines[n-1], "\n") {
+		lines[n-1] += "\n" + noNewlineMarker + "\n"
+	}
+	return lines
+}
+
+// splitLines splits content into lines that keep their line endings
+func splitLines(content string) []string {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func applyReplace(content string, edit model.BoxFileEdit) (string, error) {
+	if edit.OldText == "" {
+		return "", fmt.Errorf("%w: oldText is required", ErrInvalidEdit)
+	}
+
+	count := strings.Count(content, edit.OldText)
+	if count == 0 {
+		return "", fmt.Errorf("%w: oldText does not occur in the file", ErrEditNoMatch)
+	}
+
+	expected := edit.ExpectedCount
+	if edit.ReplaceAll && expected == 0 {
+		expected = count
+	} else if expected == 0 {
+		expected = 1
+	}
+	switch {
+	case count > expected:
+		return "", fmt.Errorf("%w: oldText occurs %d times, at lines %s, but %d expected; include more context, or set expectedCount or replaceAll",
+			ErrEditAmbiguous, count, occurrenceLines(content, edit.OldText), expected)
+	case count < expected:
+		return "", fmt.Errorf("%w: oldText occurs %d times, at lines %s, but %d expected",
+			ErrEditNoMatch, count, occurrenceLines(content, edit.OldText), expected)
+	}
+
+	return strings.ReplaceAll(content, edit.OldText, edit.NewText), nil
+}
+
+// occurrenceLines lists the lines on which the occurrences of text start
+func occurrenceLines(content, text string) string {
+	var lines []string
+	offset := 0
+	for {
+		idx := strings.Index(content[offset:], text)
+		if idx < 0 {
+			break
+		}
+		offset += idx
+		lines = append(lines, strconv.Itoa(strings.Count(content[:offset], "\n")+1))
+		offset += len(text)
+	}
+	return strings.Join(lines, ", ")
+}
+
+func applyReplaceLines(content string, edit model.BoxFileEdit) (string, error) {
+	lines := splitLines(content)
+	if edit.StartLine < 1 || edit.EndLine < edit.StartLine || edit.EndLine > len(lines) {
+		return "", fmt.Errorf("%w: lines %d-%d are out of range, the file has %d lines",
+			ErrInvalidEdit, edit.StartLine, edit.EndLine, len(lines))
+	}
+
+	replacement := edit.NewText
+	if replacement != "" && !strings.HasSuffix(replacement, "\n") && strings.HasSuffix(lines[edit.EndLine-1], "\n") {
+		replacement += "\n"
+	}
+	return strings.Join(lines[:edit.StartLine-1], "") + replacement + strings.Join(lines[edit.EndLine:], ""), nil
+}
+
+func applyInsert(content string, edit model.BoxFileEdit) (string, error) {
+	lines := splitLines(content)
+	if edit.Line < 1 || edit.Line > len(lines)+1 {
+		return "", fmt.Errorf("%w: line %d is out of range, the file has %d lines", ErrInvalidEdit, edit.Line, len(lines))
+	}
+	if edit.NewText == "" {
+		return "", fmt.Errorf("%w: newText is required", ErrInvalidEdit)
+	}
+
+	text := edit.NewText
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	if n := len(lines); edit.Line == n+1 && n > 0 && !strings.HasSuffix(lines[n-1], "\n") {
+		lines[n-1] += "\n"
+	}
+	return strings.Join(lines[:edit.Line-1], "") + text + strings.Join(lines[edit.Line-1:], ""), nil
+}
+
+// patchHunk is a hunk of a unified diff, with lines stripped of their prefix and newline
+type patchHunk struct {
+	header   string
+	oldStart int
+	oldLines []string
+	newLines []string
+	// oldNoEOL and newNoEOL mark sides that end without a newline
+	oldNoEOL bool
+	newNoEOL bool
+}
+
+// parsePatch parses the hunks of a unified diff of a single file
+func parsePatch(patch string) ([]patchHunk, error) {
+	lines := strings.Split(patch, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var hunks []patchHunk
+	var last byte
+	for i, line := range lines {
+		if strings.HasPrefix(line, "@@") {
+			m := hunkHeaderPattern.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("%w: malformed hunk header %q", ErrInvalidEdit, line)
+			}
+			oldStart, _ := strconv.Atoi(m[1])
+			hunks = append(hunks, patchHunk{header: line, oldStart: oldStart})
+			last = 0
+			continue
+		}
+		if len(hunks) == 0 {
+			// File headers before the first hunk
+			continue
+		}
+
+		hunk := &hunks[len(hunks)-1]
+		prefix, text := byte(' '), ""
+		if line != "" {
+			// Empty lines are context lines whose trailing space was stripped
+			prefix, text = line[0], line[1:]
+		}
+		switch prefix {
+		case ' ':
+			hunk.oldLines = append(hunk.oldLines, text)
+			hunk.newLines = append(hunk.newLines, text)
+		case '-':
+			if strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ") {
+				return nil, fmt.Errorf("%w: patches must only change a single file", ErrInvalidEdit)
+			}
+			hunk.oldLines = append(hunk.oldLines, text)
+		case '+':
+			hunk.newLines = append(hunk.newLines, text)
+		case '\\':
+			hunk.oldNoEOL = hunk.oldNoEOL || last != '+'
+			hunk.newNoEOL = hunk.newNoEOL || last != '-'
+		default:
+			return nil, fmt.Errorf("%w: malformed patch line %q", ErrInvalidEdit, line)
+		}
+		last = prefix
+	}
+
+	if len(hunks) == 0 {
+		return nil, fmt.Errorf("%w: patch has no hunks", ErrInvalidEdit)
+	}
+	return hunks, nil
+}
+
+// applyPatch applies a unified diff. Hunks that no longer start at their line are
+// applied at the nearest place their context and removed lines match.
+func applyPatch(content, patch string) (string, error) {
+	hunks, err := parsePatch(patch)
+	if err != nil {
+		return "", err
+	}
+
+	finalNewline := content == "" || strings.HasSuffix(content, "\n")
+	var lines []string
+	if content != "" {
+		lines = strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	}
+
+	delta, minPos := 0, 0
+	for i, hunk := range hunks {
+		// A hunk that removes nothing inserts after its start line
+		base := hunk.oldStart - 1
+		if len(hunk.oldLines) == 0 {
+			base = hunk.oldStart
+		}
+
+		at := findHunk(lines, hunk.oldLines, base+delta, minPos)
+		if at < 0 {
+			return "", fmt.Errorf("%w: hunk %d (%s) does not apply", ErrEditNoMatch, i+1, hunk.header)
+		}
+
+		patched := make([]string, 0, len(lines)-len(hunk.oldLines)+len(hunk.newLines))
+		patched = append(patched, lines[:at]...)
+		patched = append(patched, hunk.newLines...)
+		patched = append(patched, lines[at+len(hunk.oldLines):]...)
+		lines = patched
+
+		delta = at - base + len(hunk.newLines) - len(hunk.oldLines)
+		minPos = at + len(hunk.newLines)
+
+		switch {
+		case hunk.newNoEOL:
+			finalNewline = false
+		case hunk.oldNoEOL:
+			finalNewline = true
+		}
+	}
+
+	result := strings.Join(lines, "\n")
+	if finalNewline && len(lines) > 0 {
+		result += "\n"
+	}
+	return result, nil
+}
+
+// findHunk returns the index nearest to want, and not before minPos, at which lines
+// contains old, or -1 if it does not
+func findHunk(lines, old []string, want, minPos int) int {
+	maxPos := len(lines) - len(old)
+	matches := func(at int) bool {
+		if at < minPos || at > maxPos {
+			return false
+		}
+		for i, line := range old {
+			if lines[at+i] != line {
+				return false
+			}
+		}
+		return true
+	}
+
+	for dist := 0; want-dist >= minPos || want+dist <= maxPos; dist++ {
+		if matches(want - dist) {
+			return want - dist
+		}
+		if matches(want + dist) {
+			return want + dist
+		}
+	}
+	return -1
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+const editTestFile = "package main\n\nfunc main() {\n\tprintln(\"hello\")\n\tprintln(\"hello\")\n}\n"
+
+func TestApplyFileEdits(t *testing.T) {
+	tests := []struct {
+		name  string
+		edits []model.BoxFileEdit
+		want  string
+		err   error
+	}{
+		{
+			name:  "replace unique text",
+			edits: []model.BoxFileEdit{{Type: model.FileEditReplace, OldText: "package main", NewText: "package app"}},
+			want:  "package app\n\nfunc main() {\n\tprintln(\"hello\")\n\tprintln(\"hello\")\n}\n",
+		},
+		{
+			name:  "replace ambiguous text",
+			edits: []model.BoxFileEdit{{Type: model.FileEditReplace, OldText: "hello", NewText: "bye"}},
+			err:   ErrEditAmbiguous,
+		},
+		{
+			name:  "replace expected count",
+			edits: []model.BoxFileEdit{{Type: model.FileEditReplace, OldText: "hello", NewText: "bye", ExpectedCount: 2}},
+			want:  "package main\n\nfunc main() {\n\tprintln(\"bye\")\n\tprintln(\"bye\")\n}\n",
+		},
+		{
+			name:  "replace fewer than expected",
+			edits: []model.BoxFileEdit{{Type: model.FileEditReplace, OldText: "hello", NewText: "bye", ExpectedCount: 3}},
+			err:   ErrEditNoMatch,
+		},
+		{
+			name:  "replace all",
+			edits: []model.BoxFileEdit{{Type: model.FileEditReplace, OldText: "println", NewText: "print", ReplaceAll: true}},
+			want:  "package main\n\nfunc main() {\n\tprint(\"hello\")\n\tprint(\"hello\")\n}\n",
+		},
+		{
+			name:  "replace missing text",
+			edits: []model.BoxFileEdit{{Type: model.FileEditReplace, OldText: "goodbye", NewText: "bye"}},
+			err:   ErrEditNoMatch,
+		},
+		{
+			name:  "replace lines",
+			edits: []model.BoxFileEdit{{Type: model.FileEditReplaceLines, StartLine: 4, EndLine: 5, NewText: "\tprintln(\"hi\")"}},
+			want:  "package main\n\nfunc main() {\n\tprintln(\"hi\")\n}\n",
+		},
+		{
+			name:  "delete lines",
+			edits: []model.BoxFileEdit{{Type: model.FileEditReplaceLines, StartLine: 1, EndLine: 2}},
+			want:  "func main() {\n\tprintln(\"hello\")\n\tprintln(\"hello\")\n}\n",
+		},
+		{
+			name:  "replace lines out of range",
+			edits: []model.BoxFileEdit{{Type: model.FileEditReplaceLines, StartLine: 6, EndLine: 7}},
+			err:   ErrInvalidEdit,
+		},
+		{
+			name:  "insert and append",
+			edits: []model.BoxFileEdit{{Type: model.FileEditInsert, Line: 2, NewText: "// comment"}, {Type: model.FileEditInsert, Line: 8, NewText: "// end\n"}},
+			want:  "package main\n// comment\n\nfunc main() {\n\tprintln(\"hello\")\n\tprintln(\"hello\")\n}\n// end\n",
+		},
+		{
+			name:  "unknown type",
+			edits: []model.BoxFileEdit{{Type: "rewrite"}},
+			err:   ErrInvalidEdit,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ApplyFileEdits(editTestFile, tt.edits)
+			if tt.err != nil {
+				assert.True(t, errors.Is(err, tt.err), "got error %v", err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	original := "a\nb\nc\nd\ne\nf\ng\nh\n"
+
+	t.Run("applies at its line", func(t *testing.T) {
+		patch := "--- a/file\n+++ b/file\n@@ -2,3 +2,3 @@\n b\n-c\n+C\n d\n@@ -7,2 +7,3 @@\n g\n h\n+i\n"
+		got, err := applyPatch(original, patch)
+		assert.NoError(t, err)
+		assert.Equal(t, "a\nb\nC\nd\ne\nf\ng\nh\ni\n", got)
+	})
+
+	t.Run("applies at an offset", func(t *testing.T) {
+		got, err := applyPatch("x\ny\n"+original, "@@ -2,3 +2,3 @@\n b\n-c\n+C\n d\n")
+		assert.NoError(t, err)
+		assert.Equal(t, "x\ny\na\nb\nC\nd\ne\nf\ng\nh\n", got)
+	})
+
+	t.Run("pure insertion", func(t *testing.T) {
+		got, err := applyPatch("a\nb\n", "@@ -1,0 +2 @@\n+inserted\n")
+		assert.NoError(t, err)
+		assert.Equal(t, "a\ninserted\nb\n", got)
+	})
+
+	t.Run("missing newline at end of file", func(t *testing.T) {
+		got, err := applyPatch("a\nb", "@@ -2 +2,2 @@\n-b\n\\ No newline at end of file\n+b\n+c\n")
+		assert.NoError(t, err)
+		assert.Equal(t, "a\nb\nc\n", got)
+	})
+
+	t.Run("removed line that looks like a header", func(t *testing.T) {
+		got, err := applyPatch("select 1;\n-- comment\n", "@@ -1,2 +1 @@\n select 1;\n--- comment\n")
+		assert.NoError(t, err)
+		assert.Equal(t, "select 1;\n", got)
+	})
+
+	t.Run("does not apply", func(t *testing.T) {
+		_, err := applyPatch(original, "@@ -2,3 +2,3 @@\n b\n-x\n+X\n d\n")
+		assert.True(t, errors.Is(err, ErrEditNoMatch))
+	})
+
+	t.Run("no hunks", func(t *testing.T) {
+		_, err := applyPatch(original, "just text")
+		assert.True(t, errors.Is(err, ErrInvalidEdit))
+	})
+}
+
+func TestEditFileContent(t *testing.T) {
+	params := &model.BoxFileEditParams{
+		Path:  "/app/main.txt",
+		Edits: []model.BoxFileEdit{{Type: model.FileEditReplace, OldText: "two", NewText: "2"}},
+	}
+
+	edited, result, err := EditFileContent([]byte("one\ntwo\nthree"), params)
+	assert.NoError(t, err)
+	assert.Equal(t, "one\n2\nthree", edited)
+	assert.True(t, result.Changed)
+	assert.Equal(t, int64(len(edited)), result.Size)
+	assert.Equal(t, "--- a/app/main.txt\n+++ b/app/main.txt\n@@ -1,3 +1,3 @@\n one\n-two\n+2\n three\n\\ No newline at end of file\n", result.Diff)
+
+	_, _, err = EditFileContent([]byte{0xff, 0xfe}, params)
+	assert.True(t, errors.Is(err, ErrInvalidEdit))
+}
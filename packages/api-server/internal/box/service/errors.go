@@ -14,4 +14,70 @@ var (
 
 	// ErrBoxNotRunning is returned when trying to execute a command in a box that is not running
 	ErrBoxNotRunning = errors.New("box is not running")
+
+	// ErrPathNotFound is returned when a path does not exist in a box
+	ErrPathNotFound = errors.New("path not found")
+
+	// ErrNotAFile is returned when a file operation targets a directory or another non-regular file
+	ErrNotAFile = errors.New("not a regular file")
+
+	// ErrNotADirectory is returned when a directory operation targets a file
+	ErrNotADirectory = errors.New("not a directory")
+
+	// ErrDirectoryNotEmpty is returned when removing a directory that is not empty without recursion
+	ErrDirectoryNotEmpty = errors.New("directory not empty")
+
+	// ErrPermissionDenied is returned when the box user may not access or change a path
+	ErrPermissionDenied = errors.New("permission denied")
+
+	// ErrFileTooLarge is returned when a file exceeds the size that can be read at once
+	ErrFileTooLarge = errors.New("file too large")
+
+	// ErrInvalidContent is returned when a file cannot be converted as the type it was detected as
+	ErrInvalidContent = errors.New("invalid file content")
+
+	// ErrInvalidEncoding is returned when written content cannot be decoded with its encoding
+	ErrInvalidEncoding = errors.New("invalid encoding")
+
+	// ErrFileExists is returned when a write must not overwrite an existing file
+	ErrFileExists = errors.New("file already exists")
+
+	// ErrChecksumMismatch is returned when a file does not have the checksum a write expects
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+
+	// ErrDownloadFailed is returned when the content of a URL cannot be fetched
+	ErrDownloadFailed = errors.New("download failed")
+
+	// ErrNotARepository is returned when a git operation targets a directory outside any repository
+	ErrNotARepository = errors.New("not a git repository")
+
+	// ErrGitFailed is returned when a git command fails, such as a clone of a missing repository
+	ErrGitFailed = errors.New("git command failed")
+
+	// ErrNothingToCommit is returned when committing without staged changes
+	ErrNothingToCommit = errors.New("nothing to commit")
+
+	// ErrUnknownCredential is returned when a clone names a credential the server does not have
+	ErrUnknownCredential = errors.New("unknown credential")
+
+	// ErrUnknownOwner is returned when a user or group does not exist in a box
+	ErrUnknownOwner = errors.New("unknown owner")
+
+	// ErrInvalidEdit is returned when a file edit is malformed or out of range
+	ErrInvalidEdit = errors.New("invalid edit")
+
+	// ErrEditNoMatch is returned when the text or patch hunk an edit targets is not in the file
+	ErrEditNoMatch = errors.New("edit target not found")
+
+	// ErrEditAmbiguous is returned when the text an edit targets occurs more often than expected
+	ErrEditAmbiguous = errors.New("edit target is ambiguous")
+
+	// ErrInvalidSearch is returned when a file search has an invalid pattern or query
+	ErrInvalidSearch = errors.New("invalid search")
+
+	// ErrInvalidRequest is returned when exec or run-code parameters are malformed
+	ErrInvalidRequest = errors.New("invalid request")
+
+	// ErrKernelNotFound is returned when a kernel does not exist or is not running
+	ErrKernelNotFound = errors.New("kernel not found")
 )
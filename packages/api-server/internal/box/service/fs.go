@@ -0,0 +1,537 @@
+package service
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/api-server/internal/common"
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+// maxHashBatchArgs bounds the length of the paths passed to one hash operation of a manifest
+const maxHashBatchArgs = 64 << 10
+
+// Exit codes the file operation scripts use to report typed errors
+const (
+	fileOpNotFound         = 10
+	fileOpExists           = 11
+	fileOpNotADirectory    = 12
+	fileOpPermissionDenied = 13
+	fileOpNotEmpty         = 14
+	fileOpIsADirectory     = 15
+	fileOpDownloadFailed   = 16
+	fileOpTooLarge         = 17
+	fileOpChecksumMismatch = 18
+	fileOpNotARepository   = 19
+	fileOpGitFailed        = 20
+	fileOpNothingToCommit  = 21
+)
+
+// fileOpPrelude defines the shell functions shared by the file operation scripts. The
+// checks run before each command give typed errors whatever the language and
+// implementation (coreutils or BusyBox) of the tools in the box, and run maps the error
+// messages of the commands themselves for what the checks cannot tell, such as races.
+const fileOpPrelude = `
+fail() { echo "$2" >&2; exit "$1"; }
+exists() { [ -e "$1" ] || [ -L "$1" ]; }
+need() { exists "$1" || fail 10 "$1: no such file or directory"; }
+isdir() { [ -d "$1" ] && [ ! -L "$1" ]; }
+parent() {
+	d=$(dirname "$1")
+	[ -d "$d" ] || { exists "$d" && fail 12 "$d: not a directory"; fail 10 "$d: no such file or directory"; }
+	[ -w "$d" ] || fail 13 "$d: permission denied"
+}
+run() {
+	out=$("$@" 2>&1) && return 0
+	case "$out" in
+	*"ermission denied"*|*"peration not permitted"*|*"ead-only file system"*) fail 13 "$out" ;;
+	*"ot a directory"*) fail 12 "$out" ;;
+	*"ot empty"*) fail 14 "$out" ;;
+	*"xists"*) fail 11 "$out" ;;
+	*"o such file"*) fail 10 "$out" ;;
+	esac
+	fail 1 "$out"
+}
+describe() {
+	stat -c '%f %s %Y %u %g %U %G' "$1" || exit 1
+	[ -L "$1" ] && readlink "$1"
+	exit 0
+}
+`
+
+// FileOperation is a file operation run as a shell script inside a box, which prints
+// the stat of the file it leaves behind, if any
+type FileOperation struct {
+	name   string
+	script string
+	args   []string
+	// target is the path whose stat the script prints, empty if it prints none
+	target string
+	// stdin is fed to the script, for secrets that must not show in its arguments
+	stdin string
+}
+
+// Command returns the command that runs the operation
+func (op *FileOperation) Command() []string {
+	return append([]string{"sh", "-c", fileOpPrelude + op.script, "gbox-" + op.name}, op.args...)
+}
+
+// Stdin returns the input of the command, empty if it reads none
+func (op *FileOperation) Stdin() string {
+	return op.stdin
+}
+
+// Output returns the output of the command, or the typed error it failed with
+func (op *FileOperation) Output(exitCode int, stdout, stderr string) (string, error) {
+	message := strings.TrimSpace(stderr)
+	var typed error
+	switch exitCode {
+	case 0:
+		return stdout, nil
+	case fileOpNotFound:
+		typed = ErrPathNotFound
+	case fileOpExists:
+		typed = ErrFileExists
+	case fileOpNotADirectory:
+		typed = ErrNotADirectory
+	case fileOpPermissionDenied:
+		typed = ErrPermissionDenied
+	case fileOpNotEmpty:
+		typed = ErrDirectoryNotEmpty
+	case fileOpIsADirectory:
+		typed = ErrNotAFile
+	case fileOpDownloadFailed:
+		typed = ErrDownloadFailed
+	case fileOpTooLarge:
+		typed = ErrFileTooLarge
+	case fileOpChecksumMismatch:
+		typed = ErrChecksumMismatch
+	case fileOpNotARepository:
+		typed = ErrNotARepository
+	case fileOpGitFailed:
+		typed = ErrGitFailed
+	case fileOpNothingToCommit:
+		typed = ErrNothingToCommit
+	default:
+		return "", fmt.Errorf("%s failed with exit code %d: %s", op.name, exitCode, message)
+	}
+	return "", fmt.Errorf("%w: %s", typed, message)
+}
+
+// Result maps the outcome of the command to the description of the target or a typed error
+func (op *FileOperation) Result(exitCode int, stdout, stderr string) (*model.BoxFile, error) {
+	output, err := op.Output(exitCode, stdout, stderr)
+	if err != nil || op.target == "" {
+		return nil, err
+	}
+	return ParseFileStat(op.target, output)
+}
+
+// ResolveBoxPath resolves a path inside a box against the default working directory
+func ResolveBoxPath(p string) string {
+	if path.IsAbs(p) {
+		return path.Clean(p)
+	}
+	return path.Join(common.DefaultWorkDirPath, p)
+}
+
+// flag passes a boolean to the file operation scripts
+func flag(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// StatOperation describes a file
+func StatOperation(params *model.BoxFileStatParams) *FileOperation {
+	p := ResolveBoxPath(params.Path)
+	return &FileOperation{
+		name:   "stat",
+		script: `need "$1"; describe "$1"`,
+		args:   []string{p},
+		target: p,
+	}
+}
+
+// MkdirOperation creates a directory
+func MkdirOperation(params *model.BoxFileMkdirParams) *FileOperation {
+	p := ResolveBoxPath(params.Path)
+	return &FileOperation{
+		name: "mkdir",
+		script: `
+if exists "$1"; then
+	isdir "$1" && [ "$2" = 1 ] || fail 11 "$1: file exists"
+elif [ "$2" = 1 ]; then
+	run mkdir -p "$1"
+else
+	parent "$1"; run mkdir "$1"
+fi
+[ -z "$3" ] || run chmod "$3" "$1"
+describe "$1"`,
+		args:   []string{p, flag(params.Parents), params.Mode},
+		target: p,
+	}
+}
+
+// RemoveOperation removes a file, or a directory if it is empty or the removal recursive
+func RemoveOperation(params *model.BoxFileRemoveParams) *FileOperation {
+	p := ResolveBoxPath(params.Path)
+	return &FileOperation{
+		name: "remove",
+		script: `
+need "$1"; parent "$1"
+if ! isdir "$1"; then run rm -f "$1"
+elif [ "$2" = 1 ]; then run rm -rf "$1"
+else run rmdir "$1"
+fi`,
+		args: []string{p, flag(params.Recursive)},
+	}
+}
+
+// MoveOperation renames a file or directory to its destination path. An existing
+// destination is replaced only if overwriting, and only if it is a file or empty directory.
+func MoveOperation(params *model.BoxFileMoveParams) *FileOperation {
+	src, dst := ResolveBoxPath(params.Source), ResolveBoxPath(params.Destination)
+	return &FileOperation{
+		name: "move",
+		script: `
+need "$1"; parent "$1"; parent "$2"
+if exists "$2"; then
+	[ "$3" = 1 ] || fail 11 "$2: file exists"
+	if isdir "$2"; then run rmdir "$2"
+	elif isdir "$1"; then run rm -f "$2"
+	fi
+fi
+run mv -f "$1" "$2"
+describe "$2"`,
+		args:   []string{src, dst, flag(params.Overwrite)},
+		target: dst,
+	}
+}
+
+// CopyOperation copies a file, or a directory if the copy is recursive, to its
+// destination path, keeping modes and times
+func CopyOperation(params *model.BoxFileCopyParams) *FileOperation {
+	src, dst := ResolveBoxPath(params.Source), ResolveBoxPath(params.Destination)
+	return &FileOperation{
+		name: "copy",
+		script: `
+need "$1"
+isdir "$1" && [ "$3" != 1 ] && fail 15 "$1: is a directory, copy it recursively"
+parent "$2"
+if exists "$2"; then
+	[ "$4" = 1 ] || fail 11 "$2: file exists"
+	if isdir "$2" || isdir "$1"; then run rm -rf "$2"; fi
+fi
+run cp -a "$1" "$2"
+describe "$2"`,
+		args:   []string{src, dst, flag(params.Recursive), flag(params.Overwrite)},
+		target: dst,
+	}
+}
+
+// ChmodOperation changes the permission of a file, and of the contents of a directory
+// if the change is recursive
+func ChmodOperation(params *model.BoxFileChmodParams) *FileOperation {
+	p := ResolveBoxPath(params.Path)
+	return &FileOperation{
+		name: "chmod",
+		script: `
+need "$1"
+if [ "$3" = 1 ]; then run chmod -R "$2" "$1"; else run chmod "$2" "$1"; fi
+describe "$1"`,
+		args:   []string{p, params.Mode, flag(params.Recursive)},
+		target: p,
+	}
+}
+
+// ListOperation lists the files under a directory down to the depth of params. Each
+// file is printed as its path and its description, both terminated by NUL, so any
+// file name can be told apart.
+func ListOperation(params *model.BoxFileListParams) *FileOperation {
+	p := ResolveBoxPath(params.Path)
+	depth := max(1, int(params.Depth))
+	return &FileOperation{
+		name: "list",
+		script: `
+need "$1"
+[ -d "$1" ] || fail 12 "$1: not a directory"
+find "$1/" -mindepth 1 -maxdepth "$2" -exec sh -c '
+for f do
+	printf "%s\0" "$f"
+	stat -c "%f %s %Y %u %g %U %G" "$f" && { [ ! -L "$f" ] || readlink "$f"; }
+	printf "\0"
+done' gbox-list {} +
+exit 0`,
+		args: []string{p, strconv.Itoa(depth)},
+	}
+}
+
+// ParseFileList parses the output of ListOperation. Files that vanished while they
+// were listed have no description and are skipped.
+func ParseFileList(output string) ([]model.BoxFile, error) {
+	fields := strings.Split(output, "\x00")
+	files := []model.BoxFile{}
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i+1] == "" {
+			continue
+		}
+		// find prints the paths under "dir/", which keeps the root's own symlink followed
+		file, err := ParseFileStat(path.Clean(fields[i]), fields[i+1])
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, *file)
+	}
+	return files, nil
+}
+
+// ManifestOperation lists every file under a directory. Each file is printed as its path
+// relative to the directory and its description, both terminated by NUL. Excluded names
+// are pruned by find, only directories for those with a trailing slash.
+func ManifestOperation(params *model.BoxFileManifestParams) *FileOperation {
+	p := ResolveBoxPath(params.Path)
+	args := []string{p}
+	if len(params.Exclude) > 0 {
+		args = append(args, "(")
+		for i, pattern := range params.Exclude {
+			if i > 0 {
+				args = append(args, "-o")
+			}
+			if name, ok := strings.CutSuffix(pattern, "/"); ok {
+				args = append(args, "-type", "d", "-name", name)
+			} else {
+				args = append(args, "-name", pattern)
+			}
+		}
+		args = append(args, ")", "-prune", "-o")
+	}
+	return &FileOperation{
+		name: "manifest",
+		script: `
+need "$1"
+[ -d "$1" ] || fail 12 "$1: not a directory"
+cd "$1" || fail 13 "$1: permission denied"
+shift
+find . -mindepth 1 "$@" -exec sh -c '
+for f do
+	printf "%s\0" "${f#./}"
+	stat -c "%f %s %Y %u %g %U %G" "$f" && { [ ! -L "$f" ] || readlink "$f"; }
+	printf "\0"
+done' gbox-manifest {} +
+exit 0`,
+		args: args,
+	}
+}
+
+// hashOperation prints the SHA-256 hash of files of the directory dir, given by their
+// paths relative to it, as the path and the hash both terminated by NUL. Files that
+// cannot be read are left out.
+func hashOperation(dir string, rels []string) *FileOperation {
+	return &FileOperation{
+		name: "manifest-hash",
+		script: `
+cd "$1" || fail 13 "$1: permission denied"
+shift
+for f do
+	h=$(sha256sum < "$f") && printf "%s\0%s\0" "$f" "${h%% *}"
+done
+exit 0`,
+		args: append([]string{dir}, rels...),
+	}
+}
+
+// ParseFileManifest parses the output of ManifestOperation for the directory at p, without
+// hashes. Files that vanished while they were described are skipped.
+func ParseFileManifest(p, output string) (*model.BoxFileManifest, error) {
+	fields := strings.Split(output, "\x00")
+	manifest := &model.BoxFileManifest{
+		Path:  ResolveBoxPath(p),
+		Files: map[string]model.BoxFileManifestEntry{},
+	}
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i+1] == "" {
+			continue
+		}
+		file, err := ParseFileStat(fields[i], fields[i+1])
+		if err != nil {
+			return nil, err
+		}
+		manifest.Files[fields[i]] = model.BoxFileManifestEntry{
+			Type:         file.Type,
+			Size:         file.Size,
+			Mode:         file.Mode,
+			LastModified: file.LastModified,
+			LinkTarget:   file.LinkTarget,
+		}
+	}
+	return manifest, nil
+}
+
+// RunFileManifest describes every file under a directory with the hash of regular files,
+// running the operations with run. Files known to the caller whose size and modification
+// time are unchanged keep their known hash, only the others are read.
+func RunFileManifest(params *model.BoxFileManifestParams, run func(op *FileOperation) (string, error)) (*model.BoxFileManifest, error) {
+	output, err := run(ManifestOperation(params))
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := ParseFileManifest(params.Path, output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse file manifest: %w", err)
+	}
+
+	var batch []string
+	var batches [][]string
+	batchArgs := 0
+	for _, rel := range slices.Sorted(maps.Keys(manifest.Files)) {
+		entry := manifest.Files[rel]
+		if entry.Type != model.FileTypeFile {
+			continue
+		}
+		if known, ok := params.Known[rel]; ok && known.Hash != "" && known.Size == entry.Size && known.LastModified.Equal(entry.LastModified) {
+			entry.Hash = known.Hash
+			manifest.Files[rel] = entry
+			continue
+		}
+		if len(batch) > 0 && batchArgs+len(rel) > maxHashBatchArgs {
+			batches = append(batches, batch)
+			batch, batchArgs = nil, 0
+		}
+		batch = append(batch, rel)
+		batchArgs += len(rel) + 1
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+
+	for _, batch := range batches {
+		output, err := run(hashOperation(manifest.Path, batch))
+		if err != nil {
+			return nil, err
+		}
+		fields := strings.Split(output, "\x00")
+		for i := 0; i+1 < len(fields); i += 2 {
+			if entry, ok := manifest.Files[fields[i]]; ok {
+				entry.Hash = fields[i+1]
+				manifest.Files[fields[i]] = entry
+			}
+		}
+	}
+	return manifest, nil
+}
+
+// SortFiles sorts files by the key and order of params
+func SortFiles(files []model.BoxFile, params *model.BoxFileListParams) error {
+	var less func(a, b *model.BoxFile) bool
+	switch params.Sort {
+	case "", model.FileSortPath:
+		less = func(a, b *model.BoxFile) bool { return a.Path < b.Path }
+	case model.FileSortName:
+		less = func(a, b *model.BoxFile) bool { return a.Name < b.Name }
+	case model.FileSortSize:
+		less = func(a, b *model.BoxFile) bool { return a.Size < b.Size }
+	case model.FileSortLastModified:
+		less = func(a, b *model.BoxFile) bool { return a.LastModified.Before(b.LastModified) }
+	case model.FileSortType:
+		less = func(a, b *model.BoxFile) bool {
+			aDir, bDir := a.Type == model.FileTypeDirectory, b.Type == model.FileTypeDirectory
+			return aDir && !bDir
+		}
+	default:
+		return fmt.Errorf("unknown sort key %q", params.Sort)
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := &files[i], &files[j]
+		if params.Desc {
+			a, b = b, a
+		}
+		if less(a, b) {
+			return true
+		}
+		if less(b, a) {
+			return false
+		}
+		// Ties are listed by path, whatever the order
+		return files[i].Path < files[j].Path
+	})
+	return nil
+}
+
+// ListFilesResult sorts the files of a directory and returns the page params selects
+func ListFilesResult(files []model.BoxFile, params *model.BoxFileListParams) (*model.BoxFileListResult, error) {
+	if err := SortFiles(files, params); err != nil {
+		return nil, err
+	}
+
+	result := &model.BoxFileListResult{Total: len(files)}
+	start := min(max(0, params.Offset), len(files))
+	end := len(files)
+	if params.Limit > 0 && start+params.Limit < end {
+		end = start + params.Limit
+		result.HasMore = true
+	}
+	result.Data = files[start:end]
+	return result, nil
+}
+
+// ParseFileStat parses the description of a file printed by the file operation scripts:
+// a line of stat fields, followed by the target of a symlink
+func ParseFileStat(p, output string) (*model.BoxFile, error) {
+	statLine, linkTarget, _ := strings.Cut(output, "\n")
+	fields := strings.Fields(statLine)
+	if len(fields) != 7 {
+		return nil, fmt.Errorf("invalid stat output: %q", output)
+	}
+
+	mode, err := strconv.ParseUint(fields[0], 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stat mode: %q", fields[0])
+	}
+	size, err1 := strconv.ParseInt(fields[1], 10, 64)
+	mtime, err2 := strconv.ParseInt(fields[2], 10, 64)
+	uid, err3 := strconv.Atoi(fields[3])
+	gid, err4 := strconv.Atoi(fields[4])
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return nil, fmt.Errorf("invalid stat output: %q", output)
+	}
+
+	stat := &model.BoxFile{
+		Name:         path.Base(p),
+		Path:         p,
+		Type:         fileTypeOfMode(mode),
+		Size:         size,
+		Mode:         fmt.Sprintf("%04o", mode&07777),
+		LastModified: time.Unix(mtime, 0).UTC(),
+		Owner:        fields[5],
+		Group:        fields[6],
+		UID:          uid,
+		GID:          gid,
+		Hidden:       strings.HasPrefix(path.Base(p), "."),
+	}
+	if stat.Type == model.FileTypeSymlink {
+		stat.LinkTarget = strings.TrimSuffix(linkTarget, "\n")
+	}
+	return stat, nil
+}
+
+// fileTypeOfMode returns the file type of a raw stat mode
+func fileTypeOfMode(mode uint64) string {
+	switch mode & 0170000 {
+	case 0100000:
+		return model.FileTypeFile
+	case 0040000:
+		return model.FileTypeDirectory
+	case 0120000:
+		return model.FileTypeSymlink
+	}
+	return model.FileTypeOther
+}
@@ -0,0 +1,342 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+// runFileOperation runs a file operation with the local shell, as a box would
+func runFileOperation(t *testing.T, op *FileOperation) (*model.BoxFile, error) {
+	t.Helper()
+	exitCode, stdout, stderr := execFileOperation(t, op)
+	return op.Result(exitCode, stdout, stderr)
+}
+
+func execFileOperation(t *testing.T, op *FileOperation) (int, string, string) {
+	t.Helper()
+	command := op.Command()
+	cmd := exec.Command(command[0], command[1:]...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	exitCode := 0
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		require.True(t, errors.As(err, &exitErr), "failed to run %s: %v", op.name, err)
+		exitCode = exitErr.ExitCode()
+	}
+	return exitCode, stdout.String(), stderr.String()
+}
+
+func TestFileOperations(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file.txt")
+	require.NoError(t, os.WriteFile(file, []byte("hello"), 0644))
+
+	t.Run("stat", func(t *testing.T) {
+		stat, err := runFileOperation(t, StatOperation(&model.BoxFileStatParams{Path: file}))
+		require.NoError(t, err)
+		assert.Equal(t, "file.txt", stat.Name)
+		assert.Equal(t, model.FileTypeFile, stat.Type)
+		assert.Equal(t, int64(5), stat.Size)
+		assert.Equal(t, "0644", stat.Mode)
+
+		require.NoError(t, os.Symlink("file.txt", filepath.Join(dir, "link")))
+		stat, err = runFileOperation(t, StatOperation(&model.BoxFileStatParams{Path: filepath.Join(dir, "link")}))
+		require.NoError(t, err)
+		assert.Equal(t, model.FileTypeSymlink, stat.Type)
+		assert.Equal(t, "file.txt", stat.LinkTarget)
+
+		_, err = runFileOperation(t, StatOperation(&model.BoxFileStatParams{Path: filepath.Join(dir, "missing")}))
+		assert.True(t, errors.Is(err, ErrPathNotFound), "got %v", err)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		list := filepath.Join(dir, "list")
+		require.NoError(t, os.MkdirAll(filepath.Join(list, "sub dir"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(list, "sub dir", "line\nbreak"), []byte("abc"), 0600))
+		require.NoError(t, os.WriteFile(filepath.Join(list, ".hidden"), nil, 0644))
+		require.NoError(t, os.Symlink("sub dir", filepath.Join(list, "link")))
+
+		listFiles := func(params *model.BoxFileListParams) ([]model.BoxFile, error) {
+			op := ListOperation(params)
+			output, err := op.Output(execFileOperation(t, op))
+			if err != nil {
+				return nil, err
+			}
+			return ParseFileList(output)
+		}
+
+		files, err := listFiles(&model.BoxFileListParams{Path: list})
+		require.NoError(t, err)
+		require.NoError(t, SortFiles(files, &model.BoxFileListParams{}))
+		require.Len(t, files, 3)
+		assert.Equal(t, filepath.Join(list, ".hidden"), files[0].Path)
+		assert.True(t, files[0].Hidden)
+		assert.Equal(t, "link", files[1].Name)
+		assert.Equal(t, model.FileTypeSymlink, files[1].Type)
+		assert.Equal(t, "sub dir", files[1].LinkTarget)
+		assert.Equal(t, model.FileTypeDirectory, files[2].Type)
+
+		files, err = listFiles(&model.BoxFileListParams{Path: list, Depth: 2})
+		require.NoError(t, err)
+		require.NoError(t, SortFiles(files, &model.BoxFileListParams{}))
+		require.Len(t, files, 4)
+		assert.Equal(t, "line\nbreak", files[3].Name)
+		assert.Equal(t, int64(3), files[3].Size)
+		assert.Equal(t, "0600", files[3].Mode)
+
+		_, err = listFiles(&model.BoxFileListParams{Path: filepath.Join(dir, "missing")})
+		assert.True(t, errors.Is(err, ErrPathNotFound), "got %v", err)
+		_, err = listFiles(&model.BoxFileListParams{Path: file})
+		assert.True(t, errors.Is(err, ErrNotADirectory), "got %v", err)
+	})
+
+	t.Run("manifest", func(t *testing.T) {
+		tree := filepath.Join(dir, "manifest")
+		require.NoError(t, os.MkdirAll(filepath.Join(tree, "src"), 0755))
+		require.NoError(t, os.MkdirAll(filepath.Join(tree, "node_modules", "pkg"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(tree, "src", "main.go"), []byte("hello"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(tree, "node_modules", "pkg", "index.js"), nil, 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(tree, "debug.log"), nil, 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(tree, "src", "node_modules"), nil, 0644))
+		require.NoError(t, os.Symlink("src/main.go", filepath.Join(tree, "link")))
+
+		var hashed []string
+		manifestOf := func(params *model.BoxFileManifestParams) (*model.BoxFileManifest, error) {
+			hashed = nil
+			return RunFileManifest(params, func(op *FileOperation) (string, error) {
+				if op.name == "manifest-hash" {
+					hashed = append(hashed, op.args[1:]...)
+				}
+				return op.Output(execFileOperation(t, op))
+			})
+		}
+
+		manifest, err := manifestOf(&model.BoxFileManifestParams{Path: tree})
+		require.NoError(t, err)
+		assert.Equal(t, tree, manifest.Path)
+		assert.Len(t, manifest.Files, 8)
+		main := manifest.Files["src/main.go"]
+		assert.Equal(t, model.FileTypeFile, main.Type)
+		assert.Equal(t, int64(5), main.Size)
+		assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", main.Hash)
+		assert.Equal(t, model.FileTypeDirectory, manifest.Files["src"].Type)
+		assert.Empty(t, manifest.Files["src"].Hash)
+		assert.Equal(t, "src/main.go", manifest.Files["link"].LinkTarget)
+		assert.Empty(t, manifest.Files["link"].Hash)
+		assert.Len(t, hashed, 4)
+
+		// Known files are only read again once their size or modification time changed
+		known := map[string]model.BoxFileManifestKnown{
+			"src/main.go": {Size: main.Size, LastModified: main.LastModified, Hash: "cached"},
+			"debug.log":   {Size: 1, LastModified: manifest.Files["debug.log"].LastModified, Hash: "stale"},
+		}
+		manifest, err = manifestOf(&model.BoxFileManifestParams{Path: tree, Known: known})
+		require.NoError(t, err)
+		assert.Equal(t, "cached", manifest.Files["src/main.go"].Hash)
+		assert.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", manifest.Files["debug.log"].Hash)
+		assert.ElementsMatch(t, []string{"debug.log", "node_modules/pkg/index.js", "src/node_modules"}, hashed)
+
+		manifest, err = manifestOf(&model.BoxFileManifestParams{Path: tree, Exclude: []string{"node_modules/", "*.log"}})
+		require.NoError(t, err)
+		assert.Len(t, manifest.Files, 4)
+		assert.Contains(t, manifest.Files, "src/node_modules")
+		assert.NotContains(t, manifest.Files, "node_modules")
+		assert.NotContains(t, manifest.Files, "debug.log")
+
+		_, err = manifestOf(&model.BoxFileManifestParams{Path: file})
+		assert.True(t, errors.Is(err, ErrNotADirectory), "got %v", err)
+	})
+
+	t.Run("mkdir", func(t *testing.T) {
+		stat, err := runFileOperation(t, MkdirOperation(&model.BoxFileMkdirParams{Path: filepath.Join(dir, "a b"), Mode: "0700"}))
+		require.NoError(t, err)
+		assert.Equal(t, model.FileTypeDirectory, stat.Type)
+		assert.Equal(t, "0700", stat.Mode)
+
+		_, err = runFileOperation(t, MkdirOperation(&model.BoxFileMkdirParams{Path: filepath.Join(dir, "a b")}))
+		assert.True(t, errors.Is(err, ErrFileExists), "got %v", err)
+		_, err = runFileOperation(t, MkdirOperation(&model.BoxFileMkdirParams{Path: filepath.Join(dir, "a b"), Parents: true}))
+		assert.NoError(t, err)
+
+		_, err = runFileOperation(t, MkdirOperation(&model.BoxFileMkdirParams{Path: filepath.Join(dir, "x", "y")}))
+		assert.True(t, errors.Is(err, ErrPathNotFound), "got %v", err)
+		_, err = runFileOperation(t, MkdirOperation(&model.BoxFileMkdirParams{Path: filepath.Join(file, "y")}))
+		assert.True(t, errors.Is(err, ErrNotADirectory), "got %v", err)
+		_, err = runFileOperation(t, MkdirOperation(&model.BoxFileMkdirParams{Path: filepath.Join(dir, "x", "y"), Parents: true}))
+		assert.NoError(t, err)
+	})
+
+	t.Run("copy and move", func(t *testing.T) {
+		src := filepath.Join(dir, "src")
+		require.NoError(t, os.MkdirAll(filepath.Join(src, "sub"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(src, "sub", "f"), []byte("x"), 0600))
+
+		_, err := runFileOperation(t, CopyOperation(&model.BoxFileCopyParams{Source: src, Destination: filepath.Join(dir, "dst")}))
+		assert.True(t, errors.Is(err, ErrNotAFile), "got %v", err)
+		_, err = runFileOperation(t, CopyOperation(&model.BoxFileCopyParams{Source: src, Destination: filepath.Join(dir, "dst"), Recursive: true}))
+		require.NoError(t, err)
+		assert.FileExists(t, filepath.Join(dir, "dst", "sub", "f"))
+
+		_, err = runFileOperation(t, CopyOperation(&model.BoxFileCopyParams{Source: file, Destination: filepath.Join(dir, "dst")}))
+		assert.True(t, errors.Is(err, ErrFileExists), "got %v", err)
+		stat, err := runFileOperation(t, CopyOperation(&model.BoxFileCopyParams{Source: file, Destination: filepath.Join(dir, "dst"), Overwrite: true}))
+		require.NoError(t, err)
+		assert.Equal(t, model.FileTypeFile, stat.Type)
+
+		stat, err = runFileOperation(t, MoveOperation(&model.BoxFileMoveParams{Source: src, Destination: filepath.Join(dir, "moved")}))
+		require.NoError(t, err)
+		assert.Equal(t, model.FileTypeDirectory, stat.Type)
+		assert.NoDirExists(t, src)
+
+		_, err = runFileOperation(t, MoveOperation(&model.BoxFileMoveParams{Source: filepath.Join(dir, "dst"), Destination: file}))
+		assert.True(t, errors.Is(err, ErrFileExists), "got %v", err)
+		_, err = runFileOperation(t, MoveOperation(&model.BoxFileMoveParams{Source: file, Destination: filepath.Join(dir, "moved"), Overwrite: true}))
+		assert.True(t, errors.Is(err, ErrDirectoryNotEmpty), "got %v", err)
+		_, err = runFileOperation(t, MoveOperation(&model.BoxFileMoveParams{Source: filepath.Join(dir, "missing"), Destination: file}))
+		assert.True(t, errors.Is(err, ErrPathNotFound), "got %v", err)
+	})
+
+	t.Run("chmod and remove", func(t *testing.T) {
+		stat, err := runFileOperation(t, ChmodOperation(&model.BoxFileChmodParams{Path: filepath.Join(dir, "moved"), Mode: "0750", Recursive: true}))
+		require.NoError(t, err)
+		assert.Equal(t, "0750", stat.Mode)
+		info, err := os.Stat(filepath.Join(dir, "moved", "sub", "f"))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0750), info.Mode().Perm())
+
+		_, err = runFileOperation(t, RemoveOperation(&model.BoxFileRemoveParams{Path: filepath.Join(dir, "moved")}))
+		assert.True(t, errors.Is(err, ErrDirectoryNotEmpty), "got %v", err)
+		_, err = runFileOperation(t, RemoveOperation(&model.BoxFileRemoveParams{Path: filepath.Join(dir, "moved"), Recursive: true}))
+		assert.NoError(t, err)
+		assert.NoDirExists(t, filepath.Join(dir, "moved"))
+		_, err = runFileOperation(t, RemoveOperation(&model.BoxFileRemoveParams{Path: filepath.Join(dir, "moved")}))
+		assert.True(t, errors.Is(err, ErrPathNotFound), "got %v", err)
+	})
+}
+
+func TestFileOperationResult(t *testing.T) {
+	op := StatOperation(&model.BoxFileStatParams{Path: "/app"})
+	_, err := op.Result(fileOpPermissionDenied, "", "/: permission denied\n")
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+	assert.Equal(t, "permission denied: /: permission denied", err.Error())
+
+	_, err = op.Result(1, "", "boom")
+	assert.EqualError(t, err, "stat failed with exit code 1: boom")
+}
+
+func TestListFilesResult(t *testing.T) {
+	files := func() []model.BoxFile {
+		return []model.BoxFile{
+			{Name: "b.txt", Path: "/app/b.txt", Type: model.FileTypeFile, Size: 30, LastModified: time.Unix(3, 0)},
+			{Name: "src", Path: "/app/src", Type: model.FileTypeDirectory, Size: 4096, LastModified: time.Unix(1, 0)},
+			{Name: "a.txt", Path: "/app/src/a.txt", Type: model.FileTypeFile, Size: 10, LastModified: time.Unix(2, 0)},
+			{Name: "c.txt", Path: "/app/c.txt", Type: model.FileTypeFile, Size: 10, LastModified: time.Unix(2, 0)},
+		}
+	}
+	paths := func(result *model.BoxFileListResult) []string {
+		var paths []string
+		for _, file := range result.Data {
+			paths = append(paths, file.Path)
+		}
+		return paths
+	}
+
+	tests := []struct {
+		name    string
+		params  model.BoxFileListParams
+		want    []string
+		hasMore bool
+	}{
+		{
+			name:   "path by default",
+			params: model.BoxFileListParams{},
+			want:   []string{"/app/b.txt", "/app/c.txt", "/app/src", "/app/src/a.txt"},
+		},
+		{
+			name:   "name",
+			params: model.BoxFileListParams{Sort: model.FileSortName},
+			want:   []string{"/app/src/a.txt", "/app/b.txt", "/app/c.txt", "/app/src"},
+		},
+		{
+			name:   "size descending keeps ties by path",
+			params: model.BoxFileListParams{Sort: model.FileSortSize, Desc: true},
+			want:   []string{"/app/src", "/app/b.txt", "/app/c.txt", "/app/src/a.txt"},
+		},
+		{
+			name:   "last modified",
+			params: model.BoxFileListParams{Sort: model.FileSortLastModified},
+			want:   []string{"/app/src", "/app/c.txt", "/app/src/a.txt", "/app/b.txt"},
+		},
+		{
+			name:   "directories first",
+			params: model.BoxFileListParams{Sort: model.FileSortType},
+			want:   []string{"/app/src", "/app/b.txt", "/app/c.txt", "/app/src/a.txt"},
+		},
+		{
+			name:    "page",
+			params:  model.BoxFileListParams{Offset: 1, Limit: 2},
+			want:    []string{"/app/c.txt", "/app/src"},
+			hasMore: true,
+		},
+		{
+			name:   "last page",
+			params: model.BoxFileListParams{Offset: 2, Limit: 2},
+			want:   []string{"/app/src", "/app/src/a.txt"},
+		},
+		{
+			name:   "past the end",
+			params: model.BoxFileListParams{Offset: 10},
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ListFilesResult(files(), &tt.params)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, paths(result))
+			assert.Equal(t, 4, result.Total)
+			assert.Equal(t, tt.hasMore, result.HasMore)
+		})
+	}
+
+	_, err := ListFilesResult(files(), &model.BoxFileListParams{Sort: "owner"})
+	assert.Error(t, err)
+}
+
+func TestParseFileStat(t *testing.T) {
+	stat, err := ParseFileStat("/app/bin", "a1ff 7 1700000000 1000 1000 gbox UNKNOWN\n/usr/bin\n")
+	require.NoError(t, err)
+	assert.Equal(t, &model.BoxFile{
+		Name:         "bin",
+		Path:         "/app/bin",
+		Type:         model.FileTypeSymlink,
+		Size:         7,
+		Mode:         "0777",
+		LastModified: stat.LastModified,
+		Owner:        "gbox",
+		Group:        "UNKNOWN",
+		UID:          1000,
+		GID:          1000,
+		LinkTarget:   "/usr/bin",
+	}, stat)
+	assert.Equal(t, int64(1700000000), stat.LastModified.Unix())
+
+	_, err = ParseFileStat("/app", "garbage")
+	assert.Error(t, err)
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"path"
+	"strings"
+)
+
+// MatchGlob reports whether a slash-separated path matches a glob, where "**" matches
+// any number of directories and the other segments follow path.Match
+func MatchGlob(glob, p string) bool {
+	return matchGlobSegments(strings.Split(strings.Trim(glob, "/"), "/"), strings.Split(strings.Trim(p, "/"), "/"))
+}
+
+// matchGlobSegments matches path segments against glob segments
+func matchGlobSegments(glob, segments []string) bool {
+	if len(glob) == 0 {
+		return len(segments) == 0
+	}
+	if glob[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchGlobSegments(glob[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(glob[0], segments[0]); !ok {
+		return false
+	}
+	return matchGlobSegments(glob[1:], segments[1:])
+}
@@ -0,0 +1,142 @@
+package docker
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+// accountingTrailerPrefix starts the line the accounting wrapper appends to stderr
+const accountingTrailerPrefix = "gbox-accounting:"
+
+// accountingScript runs "$@" and reports its resource usage. $1 is the exec marker,
+// which is echoed back in the trailer so it cannot be confused with command output.
+//
+// CPU time is the children time of the wrapper once the command has been reaped, which
+// covers every waited-for descendant. Peak RSS is the largest VmHWM sampled across the
+// command's process tree while it runs. The sampler runs in a subshell that reports the
+// CPU time it used, sleeps included, so the wrapper can subtract it. The tree is built
+// from one snapshot of parent PIDs, so descendants with a lower PID are found too.
+const accountingScript = `
+sample() {
+	peak=0
+	while { read -r stat < "/proc/$1/stat"; } 2>/dev/null; do
+		set -- "$1" ${stat##*) }
+		[ "$2" = Z ] && break
+		pairs=
+		for file in /proc/[0-9]*/stat; do
+			read -r stat 2>/dev/null < "$file" || continue
+			set -- "$1" ${stat##*) }
+			pairs="$pairs ${stat%% *}:$3"
+		done
+		tree=" $1 "
+		added=1
+		while [ -n "$added" ]; do
+			added=
+			for pair in $pairs; do
+				case "$tree" in *" ${pair%:*} "*) continue ;; esac
+				case "$tree" in *" ${pair#*:} "*) tree="$tree${pair%:*} "; added=1 ;; esac
+			done
+		done
+		for p in $tree; do
+			while read -r key value _; do
+				[ "$key" = "VmHWM:" ] && [ "$value" -gt "$peak" ] && peak=$value
+			done 2>/dev/null < "/proc/$p/status"
+		done
+		sleep 0.05 2>/dev/null || sleep 1
+	done
+	read -r stat < /proc/self/stat
+	set -- ${stat##*) }
+	echo "$peak $((${12} + ${13} + ${14} + ${15}))"
+}
+marker=$1; shift
+exec 3<&0
+"$@" 0<&3 3<&- &
+pid=$!
+exec 3<&-
+sample=$(sample "$pid")
+[ -n "$sample" ] || sample="0 0"
+wait "$pid"
+rc=$?
+read -r stat < /proc/$$/stat
+set -- ${stat##*) }
+ticks=$((${14} + ${15} - ${sample#* }))
+[ "$ticks" -lt 0 ] && ticks=0
+hz=$(getconf CLK_TCK 2>/dev/null) || hz=100
+printf '\n` + accountingTrailerPrefix + `%s cpu_ticks=%s clk_tck=%s peak_rss_kb=%s\n' "$marker" "$ticks" "$hz" "${sample%% *}" >&2
+exit $rc
+`
+
+// wrapWithAccounting wraps a command so that its resource usage is reported on stderr
+func wrapWithAccounting(cmd []string, marker string) []string {
+	wrapped := []string{"sh", "-c", accountingScript, "gbox-accounting", execMarkerEnv + "=" + marker}
+	return append(wrapped, cmd...)
+}
+
+// accountingFilter forwards stderr to dst while holding back the bytes that may belong
+// to the accounting trailer; finish strips and parses the trailer
+type accountingFilter struct {
+	dst     io.Writer
+	token   []byte
+	pending []byte
+}
+
+// maxTrailerFieldsLen bounds the length of the trailer after its token
+const maxTrailerFieldsLen = 128
+
+func newAccountingFilter(dst io.Writer, marker string) *accountingFilter {
+	return &accountingFilter{
+		dst:   dst,
+		token: []byte("\n" + accountingTrailerPrefix + execMarkerEnv + "=" + marker),
+	}
+}
+
+// Write implements io.Writer
+func (f *accountingFilter) Write(p []byte) (int, error) {
+	f.pending = append(f.pending, p...)
+	hold := len(f.token) + maxTrailerFieldsLen
+	if len(f.pending) > hold {
+		flush := len(f.pending) - hold
+		if _, err := f.dst.Write(f.pending[:flush]); err != nil {
+			return 0, err
+		}
+		f.pending = append(f.pending[:0], f.pending[flush:]...)
+	}
+	return len(p), nil
+}
+
+// finish flushes the held back output and returns the parsed usage, if the trailer was found
+func (f *accountingFilter) finish() (*model.BoxExecUsage, error) {
+	idx := bytes.LastIndex(f.pending, f.token)
+	if idx < 0 {
+		_, err := f.dst.Write(f.pending)
+		return nil, err
+	}
+
+	if _, err := f.dst.Write(f.pending[:idx]); err != nil {
+		return nil, err
+	}
+
+	fields := strings.Fields(string(f.pending[idx+len(f.token):]))
+	values := make(map[string]int64, len(fields))
+	for _, field := range fields {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			values[key] = n
+		}
+	}
+
+	usage := &model.BoxExecUsage{
+		PeakRSSBytes: values["peak_rss_kb"] * 1024,
+	}
+	if hz := values["clk_tck"]; hz > 0 {
+		usage.CPUTimeMs = values["cpu_ticks"] * 1000 / hz
+	}
+	return usage, nil
+}
@@ -0,0 +1,93 @@
+package docker
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+func TestAccountingFilter(t *testing.T) {
+	t.Run("strips trailer", func(t *testing.T) {
+		var dst bytes.Buffer
+		filter := newAccountingFilter(&dst, "m1")
+
+		output := strings.Repeat("warning\n", 100)
+		stream := output + "\ngbox-accounting:GBOX_EXEC_ID=m1 cpu_ticks=150 clk_tck=100 peak_rss_kb=2048\n"
+		// Split the trailer across writes
+		for _, chunk := range []string{stream[:len(stream)-40], stream[len(stream)-40:]} {
+			n, err := filter.Write([]byte(chunk))
+			assert.NoError(t, err)
+			assert.Equal(t, len(chunk), n)
+		}
+
+		usage, err := filter.finish()
+		assert.NoError(t, err)
+		assert.Equal(t, output, dst.String())
+		if assert.NotNil(t, usage) {
+			assert.Equal(t, int64(1500), usage.CPUTimeMs)
+			assert.Equal(t, int64(2048*1024), usage.PeakRSSBytes)
+		}
+	})
+
+	t.Run("no trailer", func(t *testing.T) {
+		var dst bytes.Buffer
+		filter := newAccountingFilter(&dst, "m1")
+
+		_, err := filter.Write([]byte("killed\ngbox-accounting:GBOX_EXEC_ID=other cpu_ticks=1\n"))
+		assert.NoError(t, err)
+
+		usage, err := filter.finish()
+		assert.NoError(t, err)
+		assert.Nil(t, usage)
+		assert.Equal(t, "killed\ngbox-accounting:GBOX_EXEC_ID=other cpu_ticks=1\n", dst.String())
+	})
+}
+
+// runAccounted runs a shell command locally under the accounting wrapper
+func runAccounted(t *testing.T, script string) (string, string, int, *model.BoxExecUsage) {
+	wrapped := wrapWithAccounting([]string{"sh", "-c", script}, "m1")
+	var stdout, stderr bytes.Buffer
+	filter := newAccountingFilter(&stderr, "m1")
+	cmd := exec.Command(wrapped[0], wrapped[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = filter
+
+	exitCode := 0
+	var exitErr *exec.ExitError
+	if err := cmd.Run(); errors.As(err, &exitErr) {
+		exitCode = exitErr.ExitCode()
+	} else {
+		require.NoError(t, err)
+	}
+	usage, err := filter.finish()
+	require.NoError(t, err)
+	require.NotNil(t, usage, "the trailer is found")
+	return stdout.String(), stderr.String(), exitCode, usage
+}
+
+func TestAccountingScript(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the accounting script reads /proc")
+	}
+
+	// CPU time of descendants is counted, the output and exit code pass through
+	stdout, stderr, exitCode, usage := runAccounted(t, `echo out; echo err >&2; sh -c 'i=0; while [ $i -lt 300000 ]; do i=$((i+1)); done'; exit 3`)
+	assert.Equal(t, "out\n", stdout)
+	assert.Equal(t, "err\n", stderr)
+	assert.Equal(t, 3, exitCode)
+	assert.Greater(t, usage.CPUTimeMs, int64(0))
+	assert.Greater(t, usage.PeakRSSBytes, int64(0))
+
+	// The sampler does not count towards an idle command
+	_, _, _, usage = runAccounted(t, "sleep 1")
+	assert.Less(t, usage.CPUTimeMs, int64(50))
+	assert.Greater(t, usage.PeakRSSBytes, int64(0))
+}
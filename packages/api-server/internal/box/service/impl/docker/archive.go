@@ -1,14 +1,19 @@
 package docker
 
 import (
+	"archive/tar"
 	"bytes"
 	"context"
 	"fmt"
 	"io"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/babelcloud/gbox/packages/api-server/internal/box/service"
 	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/errdefs"
 )
 
 // GetArchive implements Service.GetArchive
@@ -23,7 +28,7 @@ func (s *Service) GetArchive(ctx context.Context, id string, req *model.BoxArchi
 
 	reader, stat, err := s.client.CopyFromContainer(ctx, containerInfo.ID, req.Path)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to copy from container: %w", err)
+		return nil, nil, archiveError("failed to copy from container", req.Path, err)
 	}
 
 	response := &model.BoxArchiveResult{
@@ -48,7 +53,7 @@ func (s *Service) HeadArchive(ctx context.Context, id string, req *model.BoxArch
 
 	stat, err := s.client.ContainerStatPath(ctx, containerInfo.ID, req.Path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to stat path: %w", err)
+		return nil, archiveError("failed to stat path", req.Path, err)
 	}
 
 	response := &model.BoxArchiveHeadResult{
@@ -71,11 +76,54 @@ func (s *Service) ExtractArchive(ctx context.Context, id string, req *model.BoxA
 		return err
 	}
 
-	reader := bytes.NewReader(req.Content)
-	err = s.client.CopyToContainer(ctx, containerInfo.ID, req.Path, reader, types.CopyToContainerOptions{})
+	err = s.client.CopyToContainer(ctx, containerInfo.ID, req.Path, req.Reader, types.CopyToContainerOptions{
+		AllowOverwriteDirWithFile: !req.NoOverwriteDirNonDir,
+		CopyUIDGID:                req.CopyUIDGID,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to copy to container: %w", err)
+		return archiveError("failed to copy to container", req.Path, err)
 	}
 
 	return nil
 }
+
+// archiveError wraps a Docker archive error, mapping missing paths to service.ErrPathNotFound
+func archiveError(msg, path string, err error) error {
+	if errdefs.IsNotFound(err) {
+		return fmt.Errorf("%s: %w: %s", msg, service.ErrPathNotFound, path)
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// buildTarArchive builds an in-memory tar archive from absolute file paths and their contents.
+// Entries are stored relative to the root so the archive can be extracted at "/".
+func buildTarArchive(files map[string][]byte) (io.Reader, error) {
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	now := time.Now()
+	for _, p := range paths {
+		content := files[p]
+		header := &tar.Header{
+			Name:    strings.TrimPrefix(p, "/"),
+			Mode:    0644,
+			Size:    int64(len(content)),
+			ModTime: now,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(content); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
@@ -0,0 +1,191 @@
+package docker
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+
+	"github.com/babelcloud/gbox/packages/api-server/config"
+	"github.com/babelcloud/gbox/packages/api-server/internal/box/service"
+	"github.com/babelcloud/gbox/packages/api-server/internal/common"
+	fileService "github.com/babelcloud/gbox/packages/api-server/internal/file/service"
+	"github.com/babelcloud/gbox/packages/api-server/internal/file/share"
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+const (
+	// maxArtifacts bounds the number of files collected from a single command
+	maxArtifacts = 100
+	// artifactScanTimeout bounds the execs that mark and scan the working directory
+	artifactScanTimeout = 30 * time.Second
+)
+
+// artifactScan finds the files a command created or modified under its working directory
+type artifactScan struct {
+	workingDir string
+	reference  string // File touched before the command, newer files are candidates
+	globs      []string
+	scanned    bool // Whether the scan ran, which removes the reference file
+}
+
+// startArtifactScan touches a reference file in the box before a command runs.
+// The box clock is used on both sides so host/VM clock skew doesn't matter.
+func (s *Service) startArtifactScan(ctx context.Context, containerID, workingDir, marker string, globs []string) (*artifactScan, error) {
+	for _, glob := range globs {
+		if _, err := path.Match(strings.ReplaceAll(glob, "**", "*"), ""); err != nil {
+			return nil, fmt.Errorf("invalid artifact pattern %q: %w", glob, err)
+		}
+	}
+
+	scan := &artifactScan{
+		workingDir: workingDir,
+		reference:  fmt.Sprintf("/tmp/gbox-artifacts-%s", marker),
+		globs:      globs,
+	}
+	if err := s.runHelperExec(ctx, containerID, "touch", scan.reference); err != nil {
+		return nil, fmt.Errorf("failed to prepare artifact collection: %w", err)
+	}
+	return scan, nil
+}
+
+// collectArtifacts copies the matching new or modified files to the box share directory
+func (s *Service) collectArtifacts(ctx context.Context, boxID, containerID string, scan *artifactScan) ([]model.BoxArtifact, error) {
+	outcome, err := s.runExec(ctx, containerID, execHelperConfig("sh", "-c",
+		`find "$1" -path "$2" -prune -o -type f -newer "$0" -print0; rm -f "$0"`,
+		scan.reference, scan.workingDir, common.DefaultShareDirPath,
+	), execOptions{timeout: artifactScanTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan for artifacts: %w", err)
+	}
+	scan.scanned = !outcome.timedOut
+
+	prefix := fmt.Sprintf("exec_%s", strings.ReplaceAll(time.Now().Format("20060102_150405.000000"), ".", "_"))
+	artifacts := []model.BoxArtifact{}
+	// Paths are NUL-separated, as file names may contain newlines
+	for _, boxPath := range strings.Split(outcome.stdout, "\x00") {
+		if boxPath == "" || !matchArtifact(scan.globs, scan.workingDir, boxPath) {
+			continue
+		}
+		if len(artifacts) == maxArtifacts {
+			s.logger.Warn("Box %s produced more than %d artifacts, ignoring the rest", boxID, maxArtifacts)
+			break
+		}
+
+		artifact, err := s.copyArtifact(ctx, boxID, containerID, prefix, scan.workingDir, boxPath)
+		if err != nil {
+			// The file may be gone already, don't fail the whole command for it
+			s.logger.Error("Error collecting artifact %s: %v", boxPath, err)
+			continue
+		}
+		artifacts = append(artifacts, *artifact)
+	}
+	return artifacts, nil
+}
+
+// copyArtifact copies a file from the box to <share>/<boxID>/artifacts/<prefix>
+func (s *Service) copyArtifact(ctx context.Context, boxID, containerID, prefix, workingDir, boxPath string) (*model.BoxArtifact, error) {
+	reader, _, err := s.client.CopyFromContainer(ctx, containerID, boxPath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	tr := tar.NewReader(reader)
+	header, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	if header.Typeflag != tar.TypeReg {
+		return nil, fmt.Errorf("not a regular file")
+	}
+	if err := share.CheckQuota(boxID, header.Size); err != nil {
+		return nil, err
+	}
+
+	rel := strings.TrimPrefix(artifactRelPath(workingDir, boxPath), "/")
+	relDir := path.Join(boxID, "artifacts", prefix)
+	hostPath := filepath.Join(config.GetInstance().File.Share, filepath.FromSlash(relDir), filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(hostPath), 0755); err != nil {
+		return nil, err
+	}
+
+	file, err := os.Create(hostPath)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(file, tr); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(hostPath)
+	if err != nil {
+		return nil, err
+	}
+
+	url, _ := share.SignURL(path.Join(relDir, rel))
+	return &model.BoxArtifact{
+		Path:     boxPath,
+		Size:     info.Size(),
+		MimeType: fileService.GetMimeType(hostPath, info),
+		URL:      url,
+	}, nil
+}
+
+// artifactRelPath returns the path of a file relative to the working directory,
+// or its absolute path when it lies outside of it
+func artifactRelPath(workingDir, boxPath string) string {
+	if rel := strings.TrimPrefix(boxPath, strings.TrimSuffix(workingDir, "/")+"/"); rel != boxPath {
+		return rel
+	}
+	return boxPath
+}
+
+// matchArtifact reports whether a file matches one of the globs. Relative globs are
+// matched against the path relative to the working directory; "**" matches any
+// number of directories.
+func matchArtifact(globs []string, workingDir, boxPath string) bool {
+	rel := artifactRelPath(workingDir, boxPath)
+	for _, glob := range globs {
+		target := rel
+		if path.IsAbs(glob) {
+			target = boxPath
+		}
+		if service.MatchGlob(glob, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// execHelperConfig creates the exec configuration of an internal helper command
+func execHelperConfig(cmd ...string) types.ExecConfig {
+	return types.ExecConfig{
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd:          cmd,
+	}
+}
+
+// runHelperExec runs an internal helper command and fails unless it succeeds
+func (s *Service) runHelperExec(ctx context.Context, containerID string, cmd ...string) error {
+	outcome, err := s.runExec(ctx, containerID, execHelperConfig(cmd...), execOptions{timeout: artifactScanTimeout})
+	if err != nil {
+		return err
+	}
+	if outcome.exitCode != 0 || outcome.timedOut {
+		return fmt.Errorf("%s exited with code %d: %s", cmd[0], outcome.exitCode, strings.TrimSpace(outcome.stderr))
+	}
+	return nil
+}
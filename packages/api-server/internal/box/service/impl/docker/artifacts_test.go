@@ -0,0 +1,66 @@
+package docker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchArtifact(t *testing.T) {
+	tests := []struct {
+		glob string
+		path string
+		want bool
+	}{
+		{"*.png", "/var/gbox/plot.png", true},
+		{"*.png", "/var/gbox/out/plot.png", false},
+		{"**/*.png", "/var/gbox/plot.png", true},
+		{"**/*.png", "/var/gbox/out/a/plot.png", true},
+		{"out/**", "/var/gbox/out/a/b.csv", true},
+		{"out/*.csv", "/var/gbox/other/b.csv", false},
+		{"/tmp/*.log", "/tmp/run.log", true},
+		{"*.log", "/tmp/run.log", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.glob+" "+tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.want, matchArtifact([]string{tt.glob}, "/var/gbox", tt.path))
+		})
+	}
+}
+
+func TestArtifactReferenceCleanup(t *testing.T) {
+	commands := func(execs []types.ExecConfig) []string {
+		var names []string
+		for _, config := range execs {
+			names = append(names, config.Cmd[0])
+		}
+		return names
+	}
+	opts := execOptions{boxID: "box", workingDir: "/var/gbox", collectArtifacts: []string{"*.png"}}
+
+	// The scan removes the reference file itself
+	s, daemon := newExecTestService(t)
+	daemon.reply = func(types.ExecConfig) string { return "" }
+	_, err := s.runExec(context.Background(), "box", types.ExecConfig{Cmd: []string{"true"}}, opts)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"touch", "true", "sh"}, commands(daemon.execs))
+
+	// A cancelled command leaves it to a cleanup that outlives the request
+	s, daemon = newExecTestService(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	daemon.reply = func(config types.ExecConfig) string {
+		if config.Cmd[0] == "true" {
+			cancel()
+		}
+		return ""
+	}
+	_, err = s.runExec(ctx, "box", types.ExecConfig{Cmd: []string{"true"}}, opts)
+	require.Error(t, err)
+	last := daemon.execs[len(daemon.execs)-1]
+	assert.Equal(t, []string{"rm", "-f", daemon.execs[0].Cmd[1]}, last.Cmd)
+}
@@ -0,0 +1,173 @@
+package docker
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/errdefs"
+
+	"github.com/babelcloud/gbox/packages/api-server/internal/box/service"
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+// Changes implements Service.Changes
+func (s *Service) Changes(ctx context.Context, id string, params *model.BoxChangesParams) (*model.BoxChanges, error) {
+	// Update access time when reading changes
+	s.accessTracker.Update(id)
+
+	containerInfo, err := s.getContainerByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.containerChanges(ctx, containerInfo.ID, params)
+}
+
+// ExportChanges implements Service.ExportChanges
+func (s *Service) ExportChanges(ctx context.Context, id string, params *model.BoxChangesParams) (*model.BoxChanges, io.ReadCloser, error) {
+	// Update access time when exporting changes
+	s.accessTracker.Update(id)
+
+	containerInfo, err := s.getContainerByID(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	changes, err := s.containerChanges(ctx, containerInfo.ID, params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(s.writeChangesArchive(ctx, containerInfo.ID, changes.Changes, pw))
+	}()
+	return changes, pr, nil
+}
+
+// containerChanges lists the changes of a container relative to its image with the diff
+// API of Docker, which works on stopped containers too
+func (s *Service) containerChanges(ctx context.Context, containerID string, params *model.BoxChangesParams) (*model.BoxChanges, error) {
+	excludes, err := service.ChangesExcludes(params)
+	if err != nil {
+		return nil, err
+	}
+
+	diff, err := s.client.ContainerDiff(ctx, containerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff container: %w", err)
+	}
+	changes := make([]model.BoxChange, 0, len(diff))
+	for _, change := range diff {
+		kind := model.BoxChangeModified
+		switch change.Kind {
+		case container.ChangeAdd:
+			kind = model.BoxChangeAdded
+		case container.ChangeDelete:
+			kind = model.BoxChangeDeleted
+		}
+		changes = append(changes, model.BoxChange{Path: change.Path, Kind: kind})
+	}
+	return service.NewBoxChanges(changes, excludes), nil
+}
+
+// writeChangesArchive writes the added and modified paths of a container to a tar archive.
+// An added directory is copied from the container at once with the entries under it, which
+// are all added, while other paths are copied one at a time. Paths removed since the diff
+// was taken are skipped.
+func (s *Service) writeChangesArchive(ctx context.Context, containerID string, changes []model.BoxChange, w io.Writer) error {
+	exported := make(map[string]bool)
+	parents := make(map[string]bool)
+	for _, change := range changes {
+		if change.Kind != model.BoxChangeDeleted {
+			exported[change.Path] = true
+			parents[path.Dir(change.Path)] = true
+		}
+	}
+	// Added directories with exported entries are copied whole
+	whole := make(map[string]bool)
+	for _, change := range changes {
+		if change.Kind == model.BoxChangeAdded && parents[change.Path] {
+			whole[change.Path] = true
+		}
+	}
+
+	tw := tar.NewWriter(w)
+	for _, change := range changes {
+		if !exported[change.Path] || underAny(whole, change.Path) {
+			continue
+		}
+		if err := s.copyChangedPath(ctx, containerID, change.Path, whole[change.Path], exported, tw); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// underAny reports whether one of the parent directories of p is in dirs
+func underAny(dirs map[string]bool, p string) bool {
+	for dir := path.Dir(p); dir != "/" && dir != "."; dir = path.Dir(dir) {
+		if dirs[dir] {
+			return true
+		}
+	}
+	return false
+}
+
+// copyChangedPath copies a container path to tw, with the exported entries under it if
+// whole is set
+func (s *Service) copyChangedPath(ctx context.Context, containerID, p string, whole bool, exported map[string]bool, tw *tar.Writer) error {
+	reader, _, err := s.client.CopyFromContainer(ctx, containerID, p)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to copy %s from container: %w", p, err)
+	}
+	defer reader.Close()
+
+	if err := copyChangedEntries(tar.NewReader(reader), path.Dir(p), whole, exported, tw); err != nil {
+		return fmt.Errorf("failed to archive %s: %w", p, err)
+	}
+	return nil
+}
+
+// copyChangedEntries copies the entries of the archive of a path of the directory dir to
+// tw, named by their path relative to "/": the first entry, which is the path itself, and
+// if whole is set the exported entries after it
+func copyChangedEntries(tr *tar.Reader, dir string, whole bool, exported map[string]bool, tw *tar.Writer) error {
+	for first := true; first || whole; first = false {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		p := path.Join(dir, header.Name)
+		if !first && !exported[p] {
+			continue
+		}
+
+		header.Name = strings.TrimPrefix(p, "/")
+		if header.Typeflag == tar.TypeDir {
+			header.Name += "/"
+		}
+		if header.Typeflag == tar.TypeLink {
+			// Hard links name entries of the same archive
+			header.Linkname = strings.TrimPrefix(path.Join(dir, header.Linkname), "/")
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeReg {
+			if _, err := io.Copy(tw, tr); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// changesTestArchive is the archive of /srv/app as the container copy API returns it
+func changesTestArchive(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, header := range []*tar.Header{
+		{Name: "app/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "app/main.go", Typeflag: tar.TypeReg, Mode: 0644, Size: 4},
+		{Name: "app/link.go", Typeflag: tar.TypeLink, Linkname: "app/main.go"},
+		{Name: "app/cache/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "app/cache/x", Typeflag: tar.TypeReg, Mode: 0644, Size: 4},
+	} {
+		require.NoError(t, tw.WriteHeader(header))
+		if header.Size > 0 {
+			_, err := tw.Write([]byte("data"))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, tw.Close())
+	return &buf
+}
+
+func TestCopyChangedEntries(t *testing.T) {
+	exported := map[string]bool{"/srv/app": true, "/srv/app/main.go": true, "/srv/app/link.go": true}
+	copyEntries := func(whole bool) map[string]string {
+		var out bytes.Buffer
+		tw := tar.NewWriter(&out)
+		require.NoError(t, copyChangedEntries(tar.NewReader(changesTestArchive(t)), "/srv", whole, exported, tw))
+		require.NoError(t, tw.Close())
+
+		entries := map[string]string{}
+		tr := tar.NewReader(&out)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				return entries
+			}
+			require.NoError(t, err)
+			content, err := io.ReadAll(tr)
+			require.NoError(t, err)
+			entries[header.Name] = string(content) + header.Linkname
+		}
+	}
+
+	// Entries that are not exported, such as excluded ones, are left out of whole copies
+	assert.Equal(t, map[string]string{
+		"srv/app/":        "",
+		"srv/app/main.go": "data",
+		"srv/app/link.go": "srv/app/main.go",
+	}, copyEntries(true))
+	assert.Equal(t, map[string]string{"srv/app/": ""}, copyEntries(false))
+}
+
+func TestUnderAny(t *testing.T) {
+	dirs := map[string]bool{"/srv/app": true}
+	assert.True(t, underAny(dirs, "/srv/app/main.go"))
+	assert.True(t, underAny(dirs, "/srv/app/a/b"))
+	assert.False(t, underAny(dirs, "/srv/app"))
+	assert.False(t, underAny(dirs, "/srv/application"))
+}
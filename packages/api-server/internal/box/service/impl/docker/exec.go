@@ -1,20 +1,82 @@
 package docker
 
 import (
-	"bufio"
 	"context"
+	"encoding/base64"
 	"encoding/binary"
 	"fmt"
 	"io"
+	"path"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/docker/docker/api/types"
+	"github.com/google/uuid"
 
+	"github.com/babelcloud/gbox/packages/api-server/internal/box/service"
 	"github.com/babelcloud/gbox/packages/api-server/internal/common"
 	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
 )
 
+const (
+	// execMarkerEnv is the environment variable used to tag the processes of an exec
+	execMarkerEnv = "GBOX_EXEC_ID"
+	// execKillGracePeriod is how long processes get between SIGTERM and SIGKILL
+	execKillGracePeriod = 2 * time.Second
+	// execCleanupTimeout bounds how long we wait for a terminated exec to wind down
+	execCleanupTimeout = 5 * time.Second
+	// languageProbeTimeout bounds the lookup of the executables run-code languages require
+	languageProbeTimeout = 10 * time.Second
+)
+
+// killProcessTreeScript terminates every process whose environment contains the
+// marker given as $1, their descendants and their process groups. Descendants are
+// found by parent PID, so children that dropped the marker (e.g. started through
+// env -i) are covered as long as their parent is alive. It sends SIGTERM, waits
+// $2 seconds and then sends SIGKILL to whatever is left.
+const killProcessTreeScript = `
+find_pids() {
+	pids=" "
+	for dir in /proc/[0-9]*; do
+		pid=${dir#/proc/}
+		[ "$pid" = "$$" ] && continue
+		if tr '\0' '\n' 2>/dev/null < "$dir/environ" | grep -qxF "$1"; then
+			pids="$pids$pid "
+		fi
+	done
+	[ "$pids" = " " ] && return
+	added=1
+	while [ -n "$added" ]; do
+		added=
+		for dir in /proc/[0-9]*; do
+			pid=${dir#/proc/}
+			case "$pids" in *" $pid "*) continue ;; esac
+			{ read -r stat < "$dir/stat"; } 2>/dev/null || continue
+			stat=${stat##*) }
+			ppid=${stat#* }
+			ppid=${ppid%% *}
+			case "$pids" in *" $ppid "*) pids="$pids$pid "; added=1 ;; esac
+		done
+	done
+	echo $pids
+}
+signal_all() {
+	sig=$1; shift
+	for pid in "$@"; do
+		kill -"$sig" -- "-$pid" 2>/dev/null
+		kill -"$sig" "$pid" 2>/dev/null
+	done
+}
+pids=$(find_pids "$1")
+[ -z "$pids" ] && exit 0
+signal_all TERM $pids
+sleep "$2"
+# Children of processes that died on SIGTERM were reparented, keep the first list
+signal_all KILL $pids $(find_pids "$1")
+exit 0
+`
+
 // Exec implements Service.Exec
 func (s *Service) Exec(ctx context.Context, id string, req *model.BoxExecParams) (*model.BoxExecResult, error) {
 	// Update access time on exec
@@ -30,19 +92,17 @@ func (s *Service) Exec(ctx context.Context, id string, req *model.BoxExecParams)
 		return nil, fmt.Errorf("box %s is not running (current state: %s)", id, containerInfo.State)
 	}
 
-	// Apply timeout if specified
-	if req.Timeout != "" {
-		if duration, err := time.ParseDuration(req.Timeout); err == nil {
-			var cancel context.CancelFunc
-			ctx, cancel = context.WithTimeout(ctx, duration)
-			defer cancel()
-		}
+	// Set working directory
+	workingDir := resolveWorkingDir(req.WorkingDir)
+
+	stdin, err := decodeStdin(req.Stdin, req.StdinEncoding)
+	if err != nil {
+		return nil, err
 	}
 
-	// Set working directory
-	workingDir := common.DefaultWorkDirPath
-	if req.WorkingDir != "" {
-		workingDir = req.WorkingDir
+	// Write input files before the command starts
+	if err := s.writeInputFiles(ctx, containerInfo.ID, workingDir, req.InputFiles); err != nil {
+		return nil, err
 	}
 
 	// Convert envs to []string
@@ -53,10 +113,10 @@ func (s *Service) Exec(ctx context.Context, id string, req *model.BoxExecParams)
 
 	// Create exec configuration (non-interactive)
 	execConfig := types.ExecConfig{
-		User:         "", // Use default user
+		User:         req.User, // Empty means the default user
 		Privileged:   false,
 		Tty:          false, // Non-interactive
-		AttachStdin:  false, // No stdin for non-interactive
+		AttachStdin:  stdin != "",
 		AttachStdout: true,
 		AttachStderr: true,
 		Detach:       false,
@@ -66,14 +126,127 @@ func (s *Service) Exec(ctx context.Context, id string, req *model.BoxExecParams)
 		Cmd:          req.Commands,
 	}
 
+	limits, err := resolveOutputLimits(req.MaxOutputBytes, req.MaxOutputLines, req.OutputRetention)
+	if err != nil {
+		return nil, err
+	}
+
+	outcome, err := s.runExec(ctx, containerInfo.ID, execConfig, execOptions{
+		boxID:       id,
+		stdin:       stdin,
+		timeout:     parseExecTimeout(req.Timeout),
+		limits:      limits,
+		spillOutput: req.SpillOutput,
+		reportUsage: req.ReportUsage,
+
+		workingDir:       workingDir,
+		collectArtifacts: req.CollectArtifacts,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.BoxExecResult{
+		ExitCode:        outcome.exitCode,
+		Stdout:          outcome.stdout,
+		Stderr:          outcome.stderr,
+		TimedOut:        outcome.timedOut,
+		StdoutTruncated: outcome.stdoutTruncated,
+		StderrTruncated: outcome.stderrTruncated,
+		StdoutBytes:     outcome.stdoutBytes,
+		StderrBytes:     outcome.stderrBytes,
+		StdoutURL:       outcome.stdoutURL,
+		StderrURL:       outcome.stderrURL,
+		Usage:           outcome.usage,
+		Artifacts:       outcome.artifacts,
+	}, nil
+}
+
+// execOptions holds the per-request settings of a non-interactive exec
+type execOptions struct {
+	boxID       string
+	stdin       string
+	timeout     time.Duration
+	limits      outputLimits
+	spillOutput bool
+	// Whether to run the command under the accounting wrapper and report its usage
+	reportUsage bool
+
+	// Files created or modified under workingDir that match these globs are
+	// copied to the share directory once the command finishes
+	workingDir       string
+	collectArtifacts []string
+}
+
+// execOutcome holds the outcome of a non-interactive exec
+type execOutcome struct {
+	exitCode int
+	stdout   string
+	stderr   string
+	timedOut bool
+
+	stdoutTruncated bool
+	stderrTruncated bool
+	stdoutBytes     int64
+	stderrBytes     int64
+	stdoutURL       string
+	stderrURL       string
+
+	usage     *model.BoxExecUsage
+	artifacts []model.BoxArtifact
+}
+
+// runExec creates and attaches to an exec instance, feeds stdin and collects its output.
+// If the timeout elapses or ctx is cancelled (e.g. the client disconnected), the processes
+// started by the exec are terminated inside the box. On timeout the partial output is
+// returned with timedOut set; on cancellation ctx.Err() is returned.
+func (s *Service) runExec(ctx context.Context, containerID string, execConfig types.ExecConfig, opts execOptions) (*execOutcome, error) {
+	execCtx := ctx
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		execCtx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+	}
+
+	// Optionally keep the full output in the box share directory
+	var spill *outputSpill
+	if opts.spillOutput {
+		var err error
+		if spill, err = newOutputSpill(opts.boxID); err != nil {
+			return nil, err
+		}
+		defer spill.Close()
+	}
+
+	// Tag the exec so its process tree can be found inside the box later
+	marker := uuid.NewString()
+	execConfig.Env = append(execConfig.Env, fmt.Sprintf("%s=%s", execMarkerEnv, marker))
+	if opts.reportUsage {
+		execConfig.Cmd = wrapWithAccounting(execConfig.Cmd, marker)
+	}
+
+	var scan *artifactScan
+	if len(opts.collectArtifacts) > 0 {
+		var err error
+		if scan, err = s.startArtifactScan(ctx, containerID, opts.workingDir, marker, opts.collectArtifacts); err != nil {
+			return nil, err
+		}
+		// A command that fails or is cancelled never gets to the scan
+		defer func() {
+			if !scan.scanned {
+				s.removeTempFile(containerID, scan.reference)
+			}
+		}()
+	}
+
 	// Create exec instance
-	execResp, err := s.client.ContainerExecCreate(ctx, containerInfo.ID, execConfig)
+	execResp, err := s.client.ContainerExecCreate(execCtx, containerID, execConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create exec: %w", err)
 	}
 
 	// Attach to exec instance
-	attachResp, err := s.client.ContainerExecAttach(ctx, execResp.ID, types.ExecStartCheck{
+	attachResp, err := s.client.ContainerExecAttach(execCtx, execResp.ID, types.ExecStartCheck{
 		Detach: false,
 		Tty:    false,
 	})
@@ -81,27 +254,182 @@ func (s *Service) Exec(ctx context.Context, id string, req *model.BoxExecParams)
 		return nil, fmt.Errorf("failed to attach to exec: %w", err)
 	}
 	defer attachResp.Close()
+	startedAt := time.Now()
+
+	// Feed stdin concurrently so a command that produces output before
+	// consuming its input cannot deadlock against us
+	if opts.stdin != "" {
+		go func() {
+			if err := s.writeStdin(attachResp.Conn, opts.stdin); err != nil && !isConnectionClosed(err) {
+				s.logger.Error("Error writing stdin: %v", err)
+			}
+		}()
+	}
+
+	var stdoutSpill, stderrSpill io.Writer
+	if spill != nil {
+		stdoutSpill, stderrSpill = spill.stdout, spill.stderr
+	}
+	stdout := newLimitedBuffer(opts.limits, stdoutSpill)
+	stderr := newLimitedBuffer(opts.limits, stderrSpill)
+	var stderrWriter io.Writer = stderr
+	var accounting *accountingFilter
+	if opts.reportUsage {
+		accounting = newAccountingFilter(stderr, marker)
+		stderrWriter = accounting
+	}
 
-	// Collect output
-	stdout, stderr := s.collectOutput(attachResp.Reader, -1, -1)
+	done := make(chan struct{})
+	var wallTime time.Duration
+	go func() {
+		defer close(done)
+		s.collectOutput(attachResp.Reader, stdout, stderrWriter)
+		wallTime = time.Since(startedAt)
+	}()
 
-	// Get exit code
-	inspectResp, err := s.client.ContainerExecInspect(ctx, execResp.ID)
+	newOutcome := func(exitCode int, timedOut bool) *execOutcome {
+		var usage *model.BoxExecUsage
+		if accounting != nil {
+			var err error
+			if usage, err = accounting.finish(); err != nil {
+				s.logger.Error("Error flushing stderr: %v", err)
+			}
+			if usage == nil {
+				// The wrapper was killed before reporting, only the wall time is known
+				usage = &model.BoxExecUsage{}
+			}
+			usage.WallTimeMs = wallTime.Milliseconds()
+		}
+
+		outcome := &execOutcome{
+			exitCode:    exitCode,
+			timedOut:    timedOut,
+			stdoutBytes: stdout.total,
+			stderrBytes: stderr.total,
+			usage:       usage,
+		}
+		outcome.stdout, outcome.stdoutTruncated = stdout.result()
+		outcome.stderr, outcome.stderrTruncated = stderr.result()
+		if spill != nil {
+			// A spill file that could not be written in full is not handed out
+			if stdout.spillErr != nil {
+				s.logger.Error("Error spilling stdout of box %s: %v", opts.boxID, stdout.spillErr)
+			} else {
+				outcome.stdoutURL = spill.stdoutURL
+			}
+			if stderr.spillErr != nil {
+				s.logger.Error("Error spilling stderr of box %s: %v", opts.boxID, stderr.spillErr)
+			} else {
+				outcome.stderrURL = spill.stderrURL
+			}
+		}
+		return outcome
+	}
+
+	var outcome *execOutcome
+	select {
+	case <-done:
+		// Get exit code
+		inspectResp, err := s.client.ContainerExecInspect(execCtx, execResp.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect exec: %w", err)
+		}
+		outcome = newOutcome(inspectResp.ExitCode, false)
+
+	case <-execCtx.Done():
+		// The request context is done, so use a fresh one for cleanup
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), execKillGracePeriod+execCleanupTimeout)
+		defer cancel()
+
+		s.terminateExec(cleanupCtx, containerID, execResp.ID, marker)
+
+		// Killing the processes closes the stream; don't wait forever if it doesn't
+		select {
+		case <-done:
+		case <-time.After(execCleanupTimeout):
+			attachResp.Close()
+			<-done
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		exitCode := -1
+		if inspectResp, err := s.client.ContainerExecInspect(cleanupCtx, execResp.ID); err == nil && !inspectResp.Running {
+			exitCode = inspectResp.ExitCode
+		}
+		outcome = newOutcome(exitCode, true)
+	}
+
+	// Whatever a timed-out command managed to write is collected as well
+	if scan != nil {
+		if outcome.artifacts, err = s.collectArtifacts(ctx, opts.boxID, containerID, scan); err != nil {
+			return nil, err
+		}
+	}
+	return outcome, nil
+}
+
+// terminateExec stops the processes started by an exec instance. The PID reported by
+// ContainerExecInspect lives in the host PID namespace and cannot be signalled from
+// inside the box, so the processes are located by the marker in their environment and
+// by parent PID. They receive SIGTERM (including their process group), then SIGKILL
+// after a grace period. A process that both dropped the marker and was reparented to
+// the box init, such as a daemon started through env -i, is not found.
+func (s *Service) terminateExec(ctx context.Context, containerID, execID, marker string) {
+	inspectResp, err := s.client.ContainerExecInspect(ctx, execID)
+	if err == nil && !inspectResp.Running {
+		return
+	}
+	if err == nil {
+		s.logger.Info("Terminating exec %s (host pid %d) in container %s", execID, inspectResp.Pid, containerID)
+	}
+
+	killConfig := types.ExecConfig{
+		User:         "root",
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd: []string{
+			"sh", "-c", killProcessTreeScript,
+			"gbox-kill",
+			fmt.Sprintf("%s=%s", execMarkerEnv, marker),
+			strconv.Itoa(int(execKillGracePeriod / time.Second)),
+		},
+	}
+
+	killResp, err := s.client.ContainerExecCreate(ctx, containerID, killConfig)
+	if err != nil {
+		s.logger.Error("Failed to create kill exec for %s: %v", execID, err)
+		return
+	}
+	attachResp, err := s.client.ContainerExecAttach(ctx, killResp.ID, types.ExecStartCheck{})
 	if err != nil {
-		return nil, fmt.Errorf("failed to inspect exec: %w", err)
+		s.logger.Error("Failed to attach kill exec for %s: %v", execID, err)
+		return
 	}
+	defer attachResp.Close()
 
-	return &model.BoxExecResult{
-		ExitCode: inspectResp.ExitCode,
-		Stdout:   stdout,
-		Stderr:   stderr,
-	}, nil
+	if _, err := io.Copy(io.Discard, attachResp.Reader); err != nil && !isConnectionClosed(err) {
+		s.logger.Error("Error waiting for kill exec for %s: %v", execID, err)
+	}
+}
+
+// parseExecTimeout parses the timeout of an exec request, ignoring invalid values
+func parseExecTimeout(timeout string) time.Duration {
+	if timeout == "" {
+		return 0
+	}
+	duration, err := time.ParseDuration(timeout)
+	if err != nil {
+		return 0
+	}
+	return duration
 }
 
-// readDockerStream reads from a Docker stream and returns stdout and stderr content
-func readDockerStream(reader io.Reader) (string, string, error) {
+// readDockerStream demultiplexes a Docker stream into the stdout and stderr writers
+func readDockerStream(reader io.Reader, stdout, stderr io.Writer) error {
 	header := make([]byte, 8)
-	var stdout, stderr strings.Builder
 
 	for {
 		// Read header
@@ -110,7 +438,7 @@ func readDockerStream(reader io.Reader) (string, string, error) {
 			break
 		}
 		if err != nil {
-			return "", "", fmt.Errorf("error reading stream header: %w", err)
+			return fmt.Errorf("error reading stream header: %w", err)
 		}
 
 		// Parse header
@@ -118,54 +446,28 @@ func readDockerStream(reader io.Reader) (string, string, error) {
 		// Skip 3 bytes reserved for future use
 		size := binary.BigEndian.Uint32(header[4:])
 
-		// Read payload
-		payload := make([]byte, size)
-		_, err = io.ReadFull(reader, payload)
-		if err != nil {
-			return "", "", fmt.Errorf("error reading stream payload: %w", err)
-		}
-
-		// Write to appropriate output based on stream type
+		// Write payload to appropriate output based on stream type
+		var dst io.Writer = io.Discard
 		switch streamType {
 		case 1: // stdout
-			stdout.Write(payload)
+			dst = stdout
 		case 2: // stderr
-			stderr.Write(payload)
+			dst = stderr
+		}
+		if _, err := io.CopyN(dst, reader, int64(size)); err != nil {
+			return fmt.Errorf("error reading stream payload: %w", err)
 		}
 	}
 
-	return stdout.String(), stderr.String(), nil
+	return nil
 }
 
-// collectOutput collects output from a reader with line limit
-func (s *Service) collectOutput(reader io.Reader, stdoutLimit, stderrLimit int) (string, string) {
-	stdout, stderr, err := readDockerStream(reader)
-	if err != nil {
+// collectOutput demultiplexes the output of an exec into the given writers.
+// Whatever was read before an error is kept, e.g. when a timed-out exec is killed.
+func (s *Service) collectOutput(reader io.Reader, stdout, stderr io.Writer) {
+	if err := readDockerStream(reader, stdout, stderr); err != nil && !isConnectionClosed(err) {
 		s.logger.Error("Error reading Docker stream: %v", err)
-		return "", ""
 	}
-
-	// Process stdout with line limit
-	var stdoutLines []string
-	if stdoutLimit >= 0 {
-		scanner := bufio.NewScanner(strings.NewReader(stdout))
-		for scanner.Scan() && len(stdoutLines) < stdoutLimit {
-			stdoutLines = append(stdoutLines, scanner.Text())
-		}
-		stdout = strings.Join(stdoutLines, "\n")
-	}
-
-	// Process stderr with line limit
-	var stderrLines []string
-	if stderrLimit >= 0 {
-		scanner := bufio.NewScanner(strings.NewReader(stderr))
-		for scanner.Scan() && len(stderrLines) < stderrLimit {
-			stderrLines = append(stderrLines, scanner.Text())
-		}
-		stderr = strings.Join(stderrLines, "\n")
-	}
-
-	return stdout, stderr
 }
 
 // RunCode implements Service.RunCode
@@ -183,76 +485,164 @@ func (s *Service) RunCode(ctx context.Context, id string, req *model.BoxRunCodeP
 		return nil, fmt.Errorf("box %s is not running (current state: %s)", id, containerInfo.State)
 	}
 
+	if req.KernelID != "" {
+		return s.runInKernel(ctx, id, containerInfo.ID, req)
+	}
+
+	userStdin, err := decodeStdin(req.Stdin, req.StdinEncoding)
+	if err != nil {
+		return nil, err
+	}
+
 	// Prepare command and stdin
-	cmd, stdin, err := s.prepareRunCodeCommand(req)
+	cmd, stdin, inputFiles, err := s.prepareRunCodeCommand(req, userStdin)
 	if err != nil {
 		return nil, err
 	}
 
+	// Write input files before the code starts
+	if err := s.writeInputFiles(ctx, containerInfo.ID, resolveWorkingDir(req.WorkingDir), inputFiles); err != nil {
+		return nil, err
+	}
+
 	// Execute the command
-	return s.executeRunCode(ctx, containerInfo.ID, cmd, stdin, req)
+	return s.executeRunCode(ctx, id, containerInfo.ID, cmd, stdin, req)
 }
 
-// prepareRunCodeCommand prepares the command and stdin for code execution
-func (s *Service) prepareRunCodeCommand(req *model.BoxRunCodeParams) ([]string, string, error) {
+// RunCodeLanguages implements Service.RunCodeLanguages
+func (s *Service) RunCodeLanguages(ctx context.Context, params *model.RunCodeLanguageListParams) (*model.RunCodeLanguageListResult, error) {
+	languages := service.Languages().List()
+	if params.BoxID == "" {
+		return &model.RunCodeLanguageListResult{Languages: languages}, nil
+	}
+
+	containerInfo, err := s.getContainerByID(ctx, params.BoxID)
+	if err != nil {
+		return nil, err
+	}
+	if containerInfo.State != "running" {
+		return nil, fmt.Errorf("box %s is not running (current state: %s)", params.BoxID, containerInfo.State)
+	}
+
+	// Look up every required executable in a single exec
+	seen := make(map[string]bool)
+	cmd := []string{"sh", "-c", `for c; do command -v "$c" >/dev/null 2>&1 && echo "$c"; done`, "sh"}
+	for _, lang := range languages {
+		for _, exe := range lang.Requires {
+			if !seen[exe] {
+				seen[exe] = true
+				cmd = append(cmd, exe)
+			}
+		}
+	}
+
+	outcome, err := s.runExec(ctx, containerInfo.ID, types.ExecConfig{
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd:          cmd,
+	}, execOptions{boxID: params.BoxID, timeout: languageProbeTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to probe run-code languages: %w", err)
+	}
+
+	found := make(map[string]bool)
+	for _, line := range strings.Split(outcome.stdout, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			found[line] = true
+		}
+	}
+	for i := range languages {
+		available := true
+		for _, exe := range languages[i].Requires {
+			available = available && found[exe]
+		}
+		languages[i].Available = &available
+	}
+
+	return &model.RunCodeLanguageListResult{Languages: languages}, nil
+}
+
+// prepareRunCodeCommand prepares the command, stdin and input files for code execution.
+// Languages in stdin mode normally read the code from stdin; when the caller supplies
+// its own stdin, the code is written to a script file instead.
+func (s *Service) prepareRunCodeCommand(req *model.BoxRunCodeParams, userStdin string) ([]string, string, map[string]string, error) {
 	if req.Code == "" || req.Language == "" {
-		return nil, "", fmt.Errorf("code and language are required for run-code functionality")
+		return nil, "", nil, fmt.Errorf("%w: code and language are required for run-code functionality", service.ErrInvalidRequest)
 	}
 
-	var cmd []string
-	var stdin string
+	lang, ok := service.Languages().Lookup(req.Language)
+	if !ok {
+		return nil, "", nil, fmt.Errorf("%w: unsupported code type: %s", service.ErrInvalidRequest, req.Language)
+	}
 
-	switch req.Language {
-	case "python3":
-		cmd = []string{"python3"}
-		stdin = req.Code
-	case "typescript":
-		cmd = []string{"npx", "ts-node"}
+	inputFiles := make(map[string]string, len(req.InputFiles)+1)
+	for path, content := range req.InputFiles {
+		inputFiles[path] = content
+	}
+
+	stdin := userStdin
+	scriptPath := ""
+	switch {
+	case lang.Mode == model.CodeModeArg:
+	case lang.Mode == model.CodeModeStdin && userStdin == "":
 		stdin = req.Code
-	case "bash":
-		cmd = []string{"sh", "-c", req.Code}
-		stdin = ""
 	default:
-		return nil, "", fmt.Errorf("unsupported code type: %s", req.Language)
+		scriptPath = fmt.Sprintf("/tmp/gbox-run-code-%d%s", time.Now().UnixNano(), lang.Extension)
+		inputFiles[scriptPath] = req.Code
 	}
+	cmd := service.BuildCommand(lang, scriptPath, req.Code)
 
 	// Add argv to cmd
 	cmd = append(cmd, req.Argv...)
 
-	return cmd, stdin, nil
+	return cmd, stdin, inputFiles, nil
 }
 
 // executeRunCode executes the prepared command and collects results
-func (s *Service) executeRunCode(ctx context.Context, containerID string, cmd []string, stdin string, req *model.BoxRunCodeParams) (*model.BoxRunCodeResult, error) {
+func (s *Service) executeRunCode(ctx context.Context, boxID, containerID string, cmd []string, stdin string, req *model.BoxRunCodeParams) (*model.BoxRunCodeResult, error) {
 	// Create exec configuration
 	execConfig := s.createRunCodeExecConfig(cmd, stdin, req)
 
-	// Create and attach to exec instance
-	execResp, err := s.client.ContainerExecCreate(ctx, containerID, execConfig)
+	limits, err := resolveOutputLimits(req.MaxOutputBytes, req.MaxOutputLines, req.OutputRetention)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create exec: %w", err)
+		return nil, err
 	}
 
-	attachResp, err := s.client.ContainerExecAttach(ctx, execResp.ID, types.ExecStartCheck{
-		Detach: false,
-		Tty:    false,
+	outcome, err := s.runExec(ctx, containerID, execConfig, execOptions{
+		boxID:       boxID,
+		stdin:       stdin,
+		timeout:     parseExecTimeout(req.Timeout),
+		limits:      limits,
+		spillOutput: req.SpillOutput,
+		reportUsage: req.ReportUsage,
+
+		workingDir:       execConfig.WorkingDir,
+		collectArtifacts: req.CollectArtifacts,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to attach to exec: %w", err)
+		return nil, err
 	}
-	defer attachResp.Close()
 
-	// Handle stdin and collect output
-	return s.handleRunCodeExecution(ctx, execResp.ID, attachResp, stdin)
+	return &model.BoxRunCodeResult{
+		ExitCode:        outcome.exitCode,
+		Stdout:          outcome.stdout,
+		Stderr:          outcome.stderr,
+		TimedOut:        outcome.timedOut,
+		StdoutTruncated: outcome.stdoutTruncated,
+		StderrTruncated: outcome.stderrTruncated,
+		StdoutBytes:     outcome.stdoutBytes,
+		StderrBytes:     outcome.stderrBytes,
+		StdoutURL:       outcome.stdoutURL,
+		StderrURL:       outcome.stderrURL,
+		Usage:           outcome.usage,
+		Artifacts:       outcome.artifacts,
+	}, nil
 }
 
 // createRunCodeExecConfig creates the exec configuration for running code
 func (s *Service) createRunCodeExecConfig(cmd []string, stdin string, req *model.BoxRunCodeParams) types.ExecConfig {
 	// Set working directory
-	workingDir := common.DefaultWorkDirPath
-	if req.WorkingDir != "" {
-		workingDir = req.WorkingDir
-	}
+	workingDir := resolveWorkingDir(req.WorkingDir)
 
 	// Convert envs to []string
 	envs := make([]string, 0, len(req.Envs))
@@ -261,7 +651,7 @@ func (s *Service) createRunCodeExecConfig(cmd []string, stdin string, req *model
 	}
 
 	return types.ExecConfig{
-		User:         "", // Use default user
+		User:         req.User, // Empty means the default user
 		Privileged:   false,
 		Tty:          false, // Run commands typically don't need TTY
 		AttachStdin:  stdin != "",
@@ -275,84 +665,71 @@ func (s *Service) createRunCodeExecConfig(cmd []string, stdin string, req *model
 	}
 }
 
-// handleRunCodeExecution handles the execution, stdin writing, and output collection
-func (s *Service) handleRunCodeExecution(ctx context.Context, execID string, attachResp types.HijackedResponse, stdin string) (*model.BoxRunCodeResult, error) {
-	// Use a single channel for coordination
-	type executionResult struct {
-		stdout   string
-		stderr   string
-		exitCode int
-		err      error
+// writeStdin writes stdin data and closes the write end
+func (s *Service) writeStdin(writer io.Writer, stdin string) error {
+	if _, err := io.WriteString(writer, stdin); err != nil {
+		return err
 	}
 
-	resultChan := make(chan executionResult, 1)
-
-	// Start goroutine to handle the entire execution
-	go func() {
-		defer close(resultChan)
+	// Close write end of the connection to signal EOF
+	if closer, ok := writer.(interface{ CloseWrite() error }); ok {
+		return closer.CloseWrite()
+	}
 
-		// Write stdin if provided
-		if stdin != "" {
-			if err := s.writeStdinForRunCode(attachResp.Conn, stdin); err != nil {
-				resultChan <- executionResult{err: fmt.Errorf("failed to write stdin: %w", err)}
-				return
-			}
-		}
+	return nil
+}
 
-		// Collect output
-		stdout, stderr := s.collectOutput(attachResp.Reader, -1, -1)
+// resolveWorkingDir returns the working directory for a command, falling back to the default
+func resolveWorkingDir(workingDir string) string {
+	if workingDir == "" {
+		return common.DefaultWorkDirPath
+	}
+	return workingDir
+}
 
-		// Get exit code
-		exitCode, err := s.getExecExitCode(ctx, execID)
+// decodeStdin decodes the stdin payload of a request according to its encoding
+func decodeStdin(stdin, encoding string) (string, error) {
+	switch encoding {
+	case "", model.StdinEncodingText:
+		return stdin, nil
+	case model.StdinEncodingBase64:
+		data, err := base64.StdEncoding.DecodeString(stdin)
 		if err != nil {
-			resultChan <- executionResult{err: fmt.Errorf("failed to get exit code: %w", err)}
-			return
-		}
-
-		resultChan <- executionResult{
-			stdout:   stdout,
-			stderr:   stderr,
-			exitCode: exitCode,
-		}
-	}()
-
-	// Wait for completion or context cancellation
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	case result := <-resultChan:
-		if result.err != nil {
-			return nil, result.err
+			return "", fmt.Errorf("%w: invalid base64 stdin: %v", service.ErrInvalidRequest, err)
 		}
-		return &model.BoxRunCodeResult{
-			ExitCode: result.exitCode,
-			Stdout:   result.stdout,
-			Stderr:   result.stderr,
-		}, nil
+		return string(data), nil
+	default:
+		return "", fmt.Errorf("%w: unsupported stdin encoding: %s", service.ErrInvalidRequest, encoding)
 	}
 }
 
-// writeStdinForRunCode writes stdin data and closes the write end
-func (s *Service) writeStdinForRunCode(writer io.Writer, stdin string) error {
-	if _, err := io.WriteString(writer, stdin); err != nil {
-		return err
+// writeInputFiles writes files into the container with a single archive extraction,
+// so the command never observes a partially written set of inputs
+func (s *Service) writeInputFiles(ctx context.Context, containerID, workingDir string, files map[string]string) error {
+	if len(files) == 0 {
+		return nil
 	}
 
-	// Close write end of the connection to signal EOF
-	if closer, ok := writer.(interface{ CloseWrite() error }); ok {
-		return closer.CloseWrite()
+	entries := make(map[string][]byte, len(files))
+	for p, content := range files {
+		if p == "" {
+			return fmt.Errorf("%w: input file path must not be empty", service.ErrInvalidRequest)
+		}
+		if !path.IsAbs(p) {
+			p = path.Join(workingDir, p)
+		}
+		entries[path.Clean(p)] = []byte(content)
 	}
 
-	return nil
-}
-
-// getExecExitCode gets the exit code of an exec instance
-func (s *Service) getExecExitCode(ctx context.Context, execID string) (int, error) {
-	inspectResp, err := s.client.ContainerExecInspect(ctx, execID)
+	archive, err := buildTarArchive(entries)
 	if err != nil {
-		return -1, err
+		return fmt.Errorf("failed to build input files archive: %w", err)
 	}
-	return inspectResp.ExitCode, nil
+
+	if err := s.client.CopyToContainer(ctx, containerID, "/", archive, types.CopyToContainerOptions{}); err != nil {
+		return fmt.Errorf("failed to write input files: %w", err)
+	}
+	return nil
 }
 
 // isConnectionClosed checks if the error is due to a closed connection
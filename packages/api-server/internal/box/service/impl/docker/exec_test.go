@@ -0,0 +1,279 @@
+package docker
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/babelcloud/gbox/packages/api-server/internal/box/service"
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+	"github.com/babelcloud/gbox/packages/api-server/pkg/logger"
+)
+
+func TestDecodeStdin(t *testing.T) {
+	stdin, err := decodeStdin("hello\n", "")
+	require.NoError(t, err)
+	assert.Equal(t, "hello\n", stdin)
+
+	stdin, err = decodeStdin("aGVsbG8=", model.StdinEncodingText)
+	require.NoError(t, err)
+	assert.Equal(t, "aGVsbG8=", stdin, "text stdin is passed as is")
+
+	binary := string([]byte{0, 1, 0xff, '\n'})
+	stdin, err = decodeStdin(base64.StdEncoding.EncodeToString([]byte(binary)), model.StdinEncodingBase64)
+	require.NoError(t, err)
+	assert.Equal(t, binary, stdin)
+
+	_, err = decodeStdin("not base64!", model.StdinEncodingBase64)
+	assert.ErrorIs(t, err, service.ErrInvalidRequest)
+	_, err = decodeStdin("hello", "hex")
+	assert.ErrorIs(t, err, service.ErrInvalidRequest)
+}
+
+// archiveEntry is a file of an archive copied to a container
+type archiveEntry struct {
+	mode    int64
+	content string
+}
+
+// newArchiveRecorder returns a service whose Docker client records the archives copied to containers
+func newArchiveRecorder(t *testing.T) (*Service, *map[string]archiveEntry) {
+	entries := map[string]archiveEntry{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || !strings.HasSuffix(r.URL.Path, "/containers/box/archive") {
+			http.NotFound(w, r)
+			return
+		}
+		assert.Equal(t, "/", r.URL.Query().Get("path"))
+		tr := tar.NewReader(r.Body)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			content, err := io.ReadAll(tr)
+			require.NoError(t, err)
+			entries[header.Name] = archiveEntry{mode: header.Mode, content: string(content)}
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://"+strings.TrimPrefix(server.URL, "http://")), client.WithVersion("1.41"))
+	require.NoError(t, err)
+	return &Service{client: cli}, &entries
+}
+
+func TestWriteInputFiles(t *testing.T) {
+	s, entries := newArchiveRecorder(t)
+
+	err := s.writeInputFiles(context.Background(), "box", "/var/gbox", map[string]string{
+		"data/input.csv":      "a,b\n",
+		"/etc/gbox/../app.rc": "set -e\n",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]archiveEntry{
+		"var/gbox/data/input.csv": {mode: 0644, content: "a,b\n"},
+		"etc/app.rc":              {mode: 0644, content: "set -e\n"},
+	}, *entries)
+
+	// Nothing is copied without files, and empty paths are rejected
+	*entries = map[string]archiveEntry{}
+	require.NoError(t, s.writeInputFiles(context.Background(), "box", "/var/gbox", nil))
+	assert.Empty(t, *entries)
+	assert.ErrorIs(t, s.writeInputFiles(context.Background(), "box", "/var/gbox", map[string]string{"": "x"}), service.ErrInvalidRequest)
+}
+
+func TestPrepareRunCodeCommand(t *testing.T) {
+	s := &Service{}
+	code := "print(input())"
+
+	// Stdin languages read the code from stdin
+	cmd, stdin, files, err := s.prepareRunCodeCommand(&model.BoxRunCodeParams{
+		Language:   "python3",
+		Code:       code,
+		Argv:       []string{"--verbose"},
+		InputFiles: map[string]string{"data.txt": "42"},
+	}, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"python3", "--verbose"}, cmd)
+	assert.Equal(t, code, stdin)
+	assert.Equal(t, map[string]string{"data.txt": "42"}, files)
+
+	// With stdin for the program, the code moves to a file
+	cmd, stdin, files, err = s.prepareRunCodeCommand(&model.BoxRunCodeParams{Language: "python", Code: code}, "hello\n")
+	require.NoError(t, err)
+	assert.Equal(t, "hello\n", stdin)
+	require.Len(t, cmd, 2)
+	assert.Equal(t, "python3", cmd[0])
+	assert.True(t, strings.HasPrefix(cmd[1], "/tmp/gbox-run-code-") && strings.HasSuffix(cmd[1], ".py"), "script path %s", cmd[1])
+	assert.Equal(t, map[string]string{cmd[1]: code}, files)
+
+	// File languages always get a file, argument languages none
+	cmd, _, files, err = s.prepareRunCodeCommand(&model.BoxRunCodeParams{Language: "go", Code: "package main"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "package main", files[cmd[2]])
+	cmd, stdin, files, err = s.prepareRunCodeCommand(&model.BoxRunCodeParams{Language: "bash", Code: "echo hi"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sh", "-c", "echo hi"}, cmd)
+	assert.Empty(t, stdin)
+	assert.Empty(t, files)
+
+	_, _, _, err = s.prepareRunCodeCommand(&model.BoxRunCodeParams{Language: "cobol", Code: "x"}, "")
+	assert.Error(t, err)
+}
+
+// fakeExecDaemon serves the exec endpoints of the Docker API. Without reply, the command
+// writes some output and then hangs until a kill exec is started; with reply, every exec
+// prints what reply returns for it and exits.
+type fakeExecDaemon struct {
+	mu      sync.Mutex
+	marker  string
+	killCmd []string
+	exited  bool
+	stream  net.Conn
+
+	reply func(config types.ExecConfig) string
+	execs []types.ExecConfig
+}
+
+func (d *fakeExecDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, "/containers/box/archive"):
+		io.Copy(io.Discard, r.Body)
+
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/containers/box/exec"):
+		var config types.ExecConfig
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		id := "main"
+		d.mu.Lock()
+		switch {
+		case d.reply != nil:
+			id = strconv.Itoa(len(d.execs))
+			d.execs = append(d.execs, config)
+		case len(config.Cmd) > 3 && config.Cmd[3] == "gbox-kill":
+			id = "kill"
+			d.killCmd = config.Cmd
+		default:
+			for _, env := range config.Env {
+				if value, ok := strings.CutPrefix(env, execMarkerEnv+"="); ok {
+					d.marker = value
+				}
+			}
+		}
+		d.mu.Unlock()
+		json.NewEncoder(w).Encode(types.IDResponse{ID: id})
+
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/start"):
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		fmt.Fprint(conn, "HTTP/1.1 101 UPGRADED\r\nContent-Type: application/vnd.docker.raw-stream\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+		id := path.Base(path.Dir(r.URL.Path))
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		switch {
+		case d.reply != nil:
+			index, _ := strconv.Atoi(id)
+			writeStdoutFrame(conn, d.reply(d.execs[index]))
+			conn.Close()
+		case id == "kill":
+			// Killing the command ends its stream
+			d.exited = true
+			if d.stream != nil {
+				d.stream.Close()
+			}
+			conn.Close()
+		default:
+			writeStdoutFrame(conn, "partial\n")
+			d.stream = conn
+		}
+
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/containers/json"):
+		json.NewEncoder(w).Encode([]types.Container{{ID: "box", State: "running"}})
+
+	case r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/exec/"):
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		inspect := types.ContainerExecInspect{ExecID: "main", Running: !d.exited, ExitCode: 137, Pid: 4242}
+		if d.reply != nil {
+			inspect = types.ContainerExecInspect{ExecID: path.Base(path.Dir(r.URL.Path))}
+		}
+		json.NewEncoder(w).Encode(inspect)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// writeStdoutFrame writes data to a Docker stream as a single stdout frame
+func writeStdoutFrame(w io.Writer, data string) {
+	header := []byte{1, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(header[4:], uint32(len(data)))
+	w.Write(append(header, data...))
+}
+
+// newExecTestService returns a service talking to a fake exec daemon
+func newExecTestService(t *testing.T) (*Service, *fakeExecDaemon) {
+	daemon := &fakeExecDaemon{}
+	server := httptest.NewServer(daemon)
+	t.Cleanup(server.Close)
+
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://"+strings.TrimPrefix(server.URL, "http://")), client.WithVersion("1.41"))
+	require.NoError(t, err)
+	return &Service{client: cli, logger: logger.New()}, daemon
+}
+
+func TestRunExecTimeout(t *testing.T) {
+	s, daemon := newExecTestService(t)
+
+	outcome, err := s.runExec(context.Background(), "box", types.ExecConfig{Cmd: []string{"sleep", "infinity"}}, execOptions{
+		boxID:   "box",
+		timeout: 200 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	assert.True(t, outcome.timedOut)
+	assert.Equal(t, 137, outcome.exitCode)
+	assert.Equal(t, "partial\n", outcome.stdout, "output written before the timeout is kept")
+
+	// The processes are found inside the box by the marker of the exec
+	require.NotEmpty(t, daemon.marker)
+	require.Len(t, daemon.killCmd, 6)
+	assert.Equal(t, execMarkerEnv+"="+daemon.marker, daemon.killCmd[4])
+}
+
+func TestRunExecCancel(t *testing.T) {
+	s, daemon := newExecTestService(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	_, err := s.runExec(ctx, "box", types.ExecConfig{Cmd: []string{"sleep", "infinity"}}, execOptions{boxID: "box"})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	daemon.mu.Lock()
+	defer daemon.mu.Unlock()
+	assert.True(t, daemon.exited, "a cancelled exec is killed")
+}
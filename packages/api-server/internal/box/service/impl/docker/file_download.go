@@ -0,0 +1,140 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/babelcloud/gbox/packages/api-server/config"
+	"github.com/babelcloud/gbox/packages/api-server/internal/box/service"
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+// downloadTimeout bounds downloads fetched by boxes themselves
+const downloadTimeout = 30 * time.Minute
+
+// DownloadFile downloads a URL into a box, fetched by the server or by the box itself
+// depending on the download policy
+func (s *Service) DownloadFile(ctx context.Context, id string, params *model.BoxFileDownloadParams, progressWriter io.Writer) (*model.BoxFileDownloadResult, error) {
+	// Update access time when writing files
+	s.accessTracker.Update(id)
+
+	u, checksum, err := service.ValidateDownload(params)
+	if err != nil {
+		return nil, err
+	}
+	containerID, err := s.getRunningContainerID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := config.GetInstance().File.DownloadPolicy
+	via, err := service.DownloadVia(ctx, policy, u)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *model.BoxFileDownloadResult
+	if via == model.DownloadViaBox {
+		result, err = s.downloadInBox(ctx, containerID, params, checksum, progressWriter)
+	} else {
+		result, err = s.downloadToBox(ctx, containerID, params, checksum, policy != service.DownloadPolicyServer, progressWriter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	service.WriteDownloadProgress(progressWriter, model.ProgressStatusComplete,
+		fmt.Sprintf("Downloaded %d bytes to %s", result.Size, result.Path))
+	return result, nil
+}
+
+// downloadInBox has the box fetch the URL of a download with its own tools and network
+func (s *Service) downloadInBox(ctx context.Context, containerID string, params *model.BoxFileDownloadParams, checksum string, progressWriter io.Writer) (*model.BoxFileDownloadResult, error) {
+	service.WriteDownloadProgress(progressWriter, model.ProgressStatusPrepare,
+		fmt.Sprintf("Downloading %s in the box", params.URL))
+
+	token := uuid.NewString()
+	op := service.DownloadOperation(params, service.DownloadLimit(params), checksum, token)
+	stopProgress := service.WatchDownloadProgress(ctx, service.DownloadTempPath(params.Path, token), progressWriter,
+		func(ctx context.Context, op *service.FileOperation) (string, error) {
+			outcome, err := s.runExec(ctx, containerID, execHelperConfig(op.Command()...), execOptions{timeout: fileOperationTimeout})
+			if err != nil {
+				return "", err
+			}
+			return op.Output(outcome.exitCode, outcome.stdout, outcome.stderr)
+		})
+	outcome, err := s.runExec(ctx, containerID, execHelperConfig(op.Command()...), execOptions{timeout: downloadTimeout})
+	stopProgress()
+	if err != nil {
+		return nil, err
+	}
+	if outcome.timedOut {
+		return nil, fmt.Errorf("%w: timed out after %s", service.ErrDownloadFailed, downloadTimeout)
+	}
+	output, err := op.Output(outcome.exitCode, outcome.stdout, outcome.stderr)
+	if err != nil {
+		return nil, err
+	}
+	return service.ParseDownloadOutput(params.Path, output)
+}
+
+// downloadToBox fetches the URL of a download on the server and copies the content into
+// the box once it has passed the size and checksum checks. Existing files are replaced
+// like by WriteFile: symlinks are written through and files keep their mode and owner.
+func (s *Service) downloadToBox(ctx context.Context, containerID string, params *model.BoxFileDownloadParams, checksum string, publicOnly bool, progressWriter io.Writer) (*model.BoxFileDownloadResult, error) {
+	filePath := resolveBoxPath(params.Path)
+	mode, uid, gid := int64(defaultFileMode), 0, 0
+
+	existing, err := s.openBoxFile(ctx, containerID, filePath)
+	switch {
+	case err == nil:
+		existing.Close()
+		if params.Overwrite != nil && !*params.Overwrite {
+			return nil, fmt.Errorf("%w: %s", service.ErrFileExists, params.Path)
+		}
+		filePath = existing.path
+		mode, uid, gid = existing.header.Mode&07777, existing.header.Uid, existing.header.Gid
+	case !errors.Is(err, service.ErrPathNotFound):
+		return nil, err
+	}
+
+	service.WriteDownloadProgress(progressWriter, model.ProgressStatusPrepare,
+		fmt.Sprintf("Downloading %s", params.URL))
+
+	// The content is buffered on the server as archives need its size up front
+	tmp, err := os.CreateTemp("", "gbox-download-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	result, err := service.NewDownloader(publicOnly).Download(ctx, params, service.DownloadLimit(params), checksum, tmp, progressWriter)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read downloaded content: %w", err)
+	}
+
+	if existing == nil {
+		if err := s.runHelperExec(ctx, containerID, "mkdir", "-p", path.Dir(filePath)); err != nil {
+			return nil, fmt.Errorf("failed to create parent directories of %s: %w", params.Path, err)
+		}
+	}
+
+	header := newFileHeader(path.Base(filePath), result.Size, mode, uid, gid)
+	if err := s.replaceBoxFile(ctx, containerID, filePath, header, tmp, nil); err != nil {
+		return nil, err
+	}
+
+	result.Path = filePath
+	return result, nil
+}
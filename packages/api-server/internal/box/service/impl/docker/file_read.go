@@ -0,0 +1,139 @@
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"github.com/gabriel-vasile/mimetype"
+
+	"github.com/babelcloud/gbox/packages/api-server/internal/box/service"
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+// mimeSniffLen is the number of leading bytes used to detect the MIME type of a file
+const mimeSniffLen = 3072
+
+// readFileContent reads the part of a file selected by params from r, which yields the
+// whole file of the given size. At most maxSize bytes are returned: reading a whole file
+// larger than that fails with service.ErrFileTooLarge, while ranges are cut short.
+func readFileContent(r io.Reader, size int64, params *model.BoxFileReadParams, maxSize int64) (*model.BoxFileReadResult, error) {
+	limit := maxSize
+	if params.MaxSize > 0 && (limit <= 0 || params.MaxSize < limit) {
+		limit = params.MaxSize
+	}
+
+	// The MIME type is detected from the start of the file, whatever range is read
+	head := make([]byte, min(size, mimeSniffLen))
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("failed to read file %s: %w", params.Path, err)
+	}
+	head = head[:n]
+	r = io.MultiReader(bytes.NewReader(head), r)
+
+	result := &model.BoxFileReadResult{
+		MimeType: mimetype.Detect(head).String(),
+		Size:     size,
+	}
+
+	// The auto format converts whole files by their type, ranges are rejected by the handler
+	if params.Format == model.FileReadFormatAuto {
+		content, _, err := readRange(r, size, &model.BoxFileReadParams{Path: params.Path}, limit)
+		if err != nil {
+			return nil, err
+		}
+		preview, err := service.PreviewFile(params.Path, content, params)
+		if err != nil {
+			return nil, err
+		}
+		preview.Size = size
+		return preview, nil
+	}
+
+	var content []byte
+	if params.StartLine > 0 || params.EndLine > 0 {
+		content, result.Truncated, err = readLines(r, params.StartLine, params.EndLine, limit)
+	} else {
+		content, result.Truncated, err = readRange(r, size, params, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if params.Encoding != model.FileEncodingBase64 && utf8.Valid(content) {
+		result.Encoding = model.FileEncodingUTF8
+		result.Content = string(content)
+	} else {
+		result.Encoding = model.FileEncodingBase64
+		result.Content = base64.StdEncoding.EncodeToString(content)
+	}
+	return result, nil
+}
+
+// readRange reads the byte range selected by params, or the whole file if none is
+func readRange(r io.Reader, size int64, params *model.BoxFileReadParams, limit int64) ([]byte, bool, error) {
+	if params.Offset == 0 && params.Length == 0 && limit > 0 && size > limit {
+		return nil, false, fmt.Errorf("%w: %s is %d bytes, the limit is %d bytes; read it in ranges",
+			service.ErrFileTooLarge, params.Path, size, limit)
+	}
+
+	if params.Offset >= size {
+		return []byte{}, false, nil
+	}
+	if _, err := io.CopyN(io.Discard, r, params.Offset); err != nil {
+		return nil, false, fmt.Errorf("failed to seek to offset %d: %w", params.Offset, err)
+	}
+
+	length := size - params.Offset
+	if params.Length > 0 && params.Length < length {
+		length = params.Length
+	}
+	truncated := false
+	if limit > 0 && length > limit {
+		length = limit
+		truncated = true
+	}
+
+	content, err := io.ReadAll(io.LimitReader(r, length))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read file content: %w", err)
+	}
+	return content, truncated, nil
+}
+
+// readLines reads the inclusive 1-based line range from startLine to endLine, where a zero
+// startLine means the first line and a zero endLine the last one
+func readLines(r io.Reader, startLine, endLine int, limit int64) ([]byte, bool, error) {
+	if startLine < 1 {
+		startLine = 1
+	}
+
+	br := bufio.NewReader(r)
+	var content bytes.Buffer
+	for line := 1; endLine <= 0 || line <= endLine; {
+		// Long lines come in several chunks, only a newline moves on to the next line
+		chunk, err := br.ReadSlice('\n')
+		if line >= startLine {
+			if limit > 0 && int64(content.Len()+len(chunk)) > limit {
+				content.Write(chunk[:limit-int64(content.Len())])
+				return content.Bytes(), true, nil
+			}
+			content.Write(chunk)
+		}
+
+		switch err {
+		case nil:
+			line++
+		case bufio.ErrBufferFull:
+		case io.EOF:
+			return content.Bytes(), false, nil
+		default:
+			return nil, false, fmt.Errorf("failed to read file content: %w", err)
+		}
+	}
+	return content.Bytes(), false, nil
+}
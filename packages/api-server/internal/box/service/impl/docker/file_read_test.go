@@ -0,0 +1,100 @@
+package docker
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/babelcloud/gbox/packages/api-server/internal/box/service"
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+func readTestFile(t *testing.T, content string, params model.BoxFileReadParams, maxSize int64) *model.BoxFileReadResult {
+	t.Helper()
+	result, err := readFileContent(strings.NewReader(content), int64(len(content)), &params, maxSize)
+	assert.NoError(t, err)
+	return result
+}
+
+func TestReadFileContent(t *testing.T) {
+	const text = "line 1\nline 2\nline 3\n"
+
+	t.Run("whole file", func(t *testing.T) {
+		result := readTestFile(t, text, model.BoxFileReadParams{}, 0)
+		assert.Equal(t, text, result.Content)
+		assert.Equal(t, model.FileEncodingUTF8, result.Encoding)
+		assert.Equal(t, int64(len(text)), result.Size)
+		assert.Equal(t, "text/plain; charset=utf-8", result.MimeType)
+		assert.False(t, result.Truncated)
+	})
+
+	t.Run("byte range", func(t *testing.T) {
+		result := readTestFile(t, text, model.BoxFileReadParams{Offset: 7, Length: 6}, 0)
+		assert.Equal(t, "line 2", result.Content)
+		assert.Equal(t, int64(len(text)), result.Size)
+	})
+
+	t.Run("offset past the end", func(t *testing.T) {
+		result := readTestFile(t, text, model.BoxFileReadParams{Offset: 100}, 0)
+		assert.Equal(t, "", result.Content)
+	})
+
+	t.Run("line range", func(t *testing.T) {
+		result := readTestFile(t, text, model.BoxFileReadParams{StartLine: 2, EndLine: 3}, 0)
+		assert.Equal(t, "line 2\nline 3\n", result.Content)
+	})
+
+	t.Run("open line range", func(t *testing.T) {
+		result := readTestFile(t, "a\nb\nc", model.BoxFileReadParams{StartLine: 3}, 0)
+		assert.Equal(t, "c", result.Content)
+	})
+
+	t.Run("lines longer than the read buffer", func(t *testing.T) {
+		long := strings.Repeat("x", 10000)
+		result := readTestFile(t, long+"\n"+long+"\nend\n", model.BoxFileReadParams{StartLine: 2, EndLine: 2}, 0)
+		assert.Equal(t, long+"\n", result.Content)
+	})
+
+	t.Run("auto format", func(t *testing.T) {
+		result := readTestFile(t, text, model.BoxFileReadParams{Format: model.FileReadFormatAuto}, 0)
+		assert.Equal(t, text, result.Content)
+		assert.Equal(t, int64(len(text)), result.Size)
+	})
+
+	t.Run("whole file over the limit", func(t *testing.T) {
+		_, err := readFileContent(strings.NewReader(text), int64(len(text)), &model.BoxFileReadParams{Path: "/a"}, 10)
+		assert.True(t, errors.Is(err, service.ErrFileTooLarge))
+	})
+
+	t.Run("range over the limit", func(t *testing.T) {
+		result := readTestFile(t, text, model.BoxFileReadParams{Offset: 2, MaxSize: 5}, 0)
+		assert.Equal(t, "ne 1\n", result.Content)
+		assert.True(t, result.Truncated)
+	})
+
+	t.Run("line range over the limit", func(t *testing.T) {
+		result := readTestFile(t, text, model.BoxFileReadParams{StartLine: 1}, 10)
+		assert.Equal(t, "line 1\nlin", result.Content)
+		assert.True(t, result.Truncated)
+	})
+
+	t.Run("base64", func(t *testing.T) {
+		result := readTestFile(t, text, model.BoxFileReadParams{Encoding: model.FileEncodingBase64}, 0)
+		assert.Equal(t, base64.StdEncoding.EncodeToString([]byte(text)), result.Content)
+		assert.Equal(t, model.FileEncodingBase64, result.Encoding)
+	})
+
+	t.Run("binary content falls back to base64", func(t *testing.T) {
+		png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0xff, 0x00}, 8)...)
+		result := readTestFile(t, string(png), model.BoxFileReadParams{}, 0)
+		assert.Equal(t, model.FileEncodingBase64, result.Encoding)
+		assert.Equal(t, "image/png", result.MimeType)
+		decoded, err := base64.StdEncoding.DecodeString(result.Content)
+		assert.NoError(t, err)
+		assert.Equal(t, png, decoded)
+	})
+}
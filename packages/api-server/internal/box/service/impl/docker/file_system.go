@@ -1,356 +1,280 @@
 package docker
 
 import (
-	"bytes"
+	"archive/tar"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
-	"path/filepath"
-	"strconv"
+	"path"
 	"strings"
-	"time"
 
 	"github.com/docker/docker/api/types"
+	"github.com/google/uuid"
 
+	"github.com/babelcloud/gbox/packages/api-server/config"
+	"github.com/babelcloud/gbox/packages/api-server/internal/box/service"
 	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
 )
 
-// demuxDockerOutput demultiplexes Docker exec output and returns the clean content
-func demuxDockerOutput(raw []byte) string {
-	if len(raw) == 0 {
-		return ""
+// ListFiles lists the files in a directory within a container from the stat of each
+// file, then sorts and pages them
+func (s *Service) ListFiles(ctx context.Context, id string, params *model.BoxFileListParams) (*model.BoxFileListResult, error) {
+	op := service.ListOperation(params)
+	outcome, err := s.execFileOperation(ctx, id, op)
+	if err != nil {
+		return nil, err
 	}
-
-	// Docker uses an 8-byte header for multiplexed streams:
-	// [0] stream type (1=stdout, 2=stderr)
-	// [1-3] reserved
-	// [4-7] size (big endian)
-	var result bytes.Buffer
-	offset := 0
-
-	for offset < len(raw) {
-		if offset+8 > len(raw) {
-			// Not enough bytes for header, treat rest as raw content
-			result.Write(raw[offset:])
-			break
-		}
-
-		// Read the size from bytes 4-7 (big endian)
-		size := int(raw[offset+4])<<24 | int(raw[offset+5])<<16 | int(raw[offset+6])<<8 | int(raw[offset+7])
-
-		if size == 0 {
-			// No payload, skip this frame
-			offset += 8
-			continue
-		}
-
-		if offset+8+size > len(raw) {
-			// Not enough bytes for payload, treat rest as raw content
-			result.Write(raw[offset:])
-			break
-		}
-
-		// Extract the payload
-		payload := raw[offset+8 : offset+8+size]
-		result.Write(payload)
-		offset += 8 + size
+	output, err := op.Output(outcome.exitCode, outcome.stdout, outcome.stderr)
+	if err != nil {
+		return nil, err
 	}
 
-	// If no proper demux was done, return original string
-	if result.Len() == 0 {
-		return string(raw)
+	files, err := service.ParseFileList(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse file list: %w", err)
 	}
+	return service.ListFilesResult(files, params)
+}
 
-	return result.String()
+// FileManifest describes every file under a directory within a container with the hash
+// of its content
+func (s *Service) FileManifest(ctx context.Context, id string, params *model.BoxFileManifestParams) (*model.BoxFileManifest, error) {
+	return service.RunFileManifest(params, func(op *service.FileOperation) (string, error) {
+		outcome, err := s.execFileOperation(ctx, id, op)
+		if err != nil {
+			return "", err
+		}
+		return op.Output(outcome.exitCode, outcome.stdout, outcome.stderr)
+	})
 }
 
-// ListFiles lists files in a directory within a container
-func (s *Service) ListFiles(ctx context.Context, id string, params *model.BoxFileListParams) (*model.BoxFileListResult, error) {
-	// Get container info first to validate box exists
+// ReadFile reads the content of a file within a container through the archive API,
+// which keeps binary content intact and streams only what the requested range needs
+func (s *Service) ReadFile(ctx context.Context, id string, params *model.BoxFileReadParams) (*model.BoxFileReadResult, error) {
+	// Update access time when reading files
+	s.accessTracker.Update(id)
+
 	containerInfo, err := s.getContainerByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
-	// Ensure container is running
-	if containerInfo.State != "running" {
-		return nil, fmt.Errorf("box %s is not running", id)
-	}
-
-	// Build ls command based on depth
-	path := params.Path
-	if path == "" {
-		path = "/"
-	}
-
-	// Use ls command to list files (BusyBox compatible)
-	cmd := []string{"ls", "-la", path}
-	if params.Depth > 1 {
-		// For depth > 1, use find command
-		maxDepth := int(params.Depth)
-		cmd = []string{"find", path, "-maxdepth", strconv.Itoa(maxDepth), "-ls"}
+	file, err := s.openBoxFile(ctx, containerInfo.ID, resolveBoxPath(params.Path))
+	if err != nil {
+		return nil, err
 	}
+	defer file.Close()
 
-	execConfig := types.ExecConfig{
-		Cmd:          cmd,
-		AttachStdout: true,
-		AttachStderr: true,
-	}
+	return readFileContent(file, file.header.Size, params, config.GetInstance().File.MaxReadBytes)
+}
 
-	execID, err := s.client.ContainerExecCreate(ctx, containerInfo.ID, execConfig)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create exec: %w", err)
-	}
+// resolveBoxPath resolves a path inside a box against the default working directory
+func resolveBoxPath(p string) string {
+	return service.ResolveBoxPath(p)
+}
 
-	resp, err := s.client.ContainerExecAttach(ctx, execID.ID, types.ExecStartCheck{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to attach exec: %w", err)
-	}
-	defer resp.Close()
+// WriteFile writes content to a file within a container. The content is extracted
+// through the archive API next to the file and renamed over it, so readers never see
+// a partially written file.
+func (s *Service) WriteFile(ctx context.Context, id string, params *model.BoxFileWriteParams) (*model.BoxFileWriteResult, error) {
+	// Update access time when writing files
+	s.accessTracker.Update(id)
 
-	// Read output
-	output := &bytes.Buffer{}
-	_, err = io.Copy(output, resp.Reader)
+	containerID, err := s.getRunningContainerID(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read exec output: %w", err)
+		return nil, err
 	}
 
-	// Demultiplex Docker output and clean up
-	cleanOutput := demuxDockerOutput(output.Bytes())
-
-	// Parse ls output to BoxFile structs
-	files, err := s.parseLsOutput(cleanOutput, path)
+	content, err := decodeFileContent(params.Content, params.Encoding)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse ls output: %w", err)
+		return nil, err
 	}
 
-	return &model.BoxFileListResult{
-		Data: files,
-	}, nil
-}
+	filePath := resolveBoxPath(params.Path)
+	mode, uid, gid := int64(defaultFileMode), 0, 0
 
-// ReadFile reads the content of a file within a container
-func (s *Service) ReadFile(ctx context.Context, id string, params *model.BoxFileReadParams) (*model.BoxFileReadResult, error) {
-	// Get container info first to validate box exists
-	containerInfo, err := s.getContainerByID(ctx, id)
-	if err != nil {
+	existing, err := s.openBoxFile(ctx, containerID, filePath)
+	switch {
+	case err == nil:
+		defer func() {
+			if existing != nil {
+				existing.Close()
+			}
+		}()
+		// Symlinks are written through, and the file keeps its mode and owner
+		filePath = existing.path
+		mode, uid, gid = existing.header.Mode&07777, existing.header.Uid, existing.header.Gid
+	case errors.Is(err, service.ErrPathNotFound):
+		existing = nil
+	default:
 		return nil, err
 	}
 
-	// Ensure container is running
-	if containerInfo.State != "running" {
-		return nil, fmt.Errorf("box %s is not running", id)
+	if existing != nil && !params.Append && params.Overwrite != nil && !*params.Overwrite {
+		return nil, fmt.Errorf("%w: %s", service.ErrFileExists, params.Path)
 	}
 
-	// Use cat command to read file content
-	cmd := []string{"cat", params.Path}
-
-	execConfig := types.ExecConfig{
-		Cmd:          cmd,
-		AttachStdout: true,
-		AttachStderr: true,
+	if params.IfMatch != "" {
+		if existing == nil {
+			return nil, fmt.Errorf("%w: %s does not exist", service.ErrChecksumMismatch, params.Path)
+		}
+		sum := sha256.New()
+		if _, err := io.Copy(sum, existing); err != nil {
+			return nil, fmt.Errorf("failed to checksum file %s: %w", params.Path, err)
+		}
+		if actual := hex.EncodeToString(sum.Sum(nil)); !strings.EqualFold(actual, params.IfMatch) {
+			return nil, fmt.Errorf("%w: %s has sha256 %s", service.ErrChecksumMismatch, params.Path, actual)
+		}
+		if params.Append {
+			// The checksum consumed the content that is about to be appended to
+			existing.Close()
+			if existing, err = s.openBoxFile(ctx, containerID, filePath); err != nil {
+				return nil, err
+			}
+		}
 	}
 
-	execID, err := s.client.ContainerExecCreate(ctx, containerInfo.ID, execConfig)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create exec: %w", err)
+	if params.Mode != "" {
+		if mode, err = parseFileMode(params.Mode); err != nil {
+			return nil, err
+		}
 	}
-
-	resp, err := s.client.ContainerExecAttach(ctx, execID.ID, types.ExecStartCheck{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to attach exec: %w", err)
+	if params.Owner != "" {
+		if uid, gid, err = s.resolveOwner(ctx, containerID, params.Owner); err != nil {
+			return nil, err
+		}
 	}
-	defer resp.Close()
 
-	// Read file content
-	content := &bytes.Buffer{}
-	_, err = io.Copy(content, resp.Reader)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read file content: %w", err)
+	if existing == nil && (params.CreateParents == nil || *params.CreateParents) {
+		if err := s.runHelperExec(ctx, containerID, "mkdir", "-p", path.Dir(filePath)); err != nil {
+			return nil, fmt.Errorf("failed to create parent directories of %s: %w", params.Path, err)
+		}
 	}
 
-	// Check exec exit code
-	inspect, err := s.client.ContainerExecInspect(ctx, execID.ID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to inspect exec: %w", err)
+	var prefix io.Reader
+	size := int64(len(content))
+	if params.Append && existing != nil {
+		prefix = existing
+		size += existing.header.Size
 	}
 
-	if inspect.ExitCode != 0 {
-		return nil, fmt.Errorf("failed to read file %s: command exited with code %d", params.Path, inspect.ExitCode)
+	header := newFileHeader(path.Base(filePath), size, mode, uid, gid)
+	sum := sha256.New()
+	if err := s.replaceBoxFile(ctx, containerID, filePath, header, prefixedContent(prefix, content), sum); err != nil {
+		return nil, err
 	}
 
-	// Demultiplex Docker output and clean up the content
-	cleanContent := demuxDockerOutput(content.Bytes())
-
-	return &model.BoxFileReadResult{
-		Content: strings.TrimSpace(cleanContent),
+	return &model.BoxFileWriteResult{
+		Message: fmt.Sprintf("File %s written successfully", params.Path),
+		Size:    size,
+		SHA256:  hex.EncodeToString(sum.Sum(nil)),
 	}, nil
 }
 
-// WriteFile writes content to a file within a container
-func (s *Service) WriteFile(ctx context.Context, id string, params *model.BoxFileWriteParams) (*model.BoxFileWriteResult, error) {
-	// Get container info first to validate box exists
-	containerInfo, err := s.getContainerByID(ctx, id)
+// replaceBoxFile streams content into a temporary file next to filePath and moves it
+// into place, so readers never observe a partially written file. The header describes
+// the new file and is renamed to the temporary name; sum, if set, hashes the content.
+// Streaming the archive keeps large files, e.g. appended to, out of memory.
+func (s *Service) replaceBoxFile(ctx context.Context, containerID, filePath string, header *tar.Header, content io.Reader, sum hash.Hash) error {
+	dir := path.Dir(filePath)
+	header.Name = fmt.Sprintf(".%s.gbox-%s", path.Base(filePath), uuid.NewString())
+	pr, pw := io.Pipe()
+	written := make(chan error, 1)
+	go func() {
+		err := writeFileArchive(pw, header, content, sum)
+		pw.CloseWithError(err)
+		written <- err
+	}()
+
+	err := s.client.CopyToContainer(ctx, containerID, dir, pr, types.CopyToContainerOptions{CopyUIDGID: true})
+	pr.Close()
+	writeErr := <-written
 	if err != nil {
-		return nil, err
+		return archiveError("failed to write file", filePath, err)
 	}
-
-	// Ensure container is running
-	if containerInfo.State != "running" {
-		return nil, fmt.Errorf("box %s is not running", id)
+	tempPath := path.Join(dir, header.Name)
+	if writeErr != nil {
+		s.removeTempFile(containerID, tempPath)
+		return fmt.Errorf("failed to write file %s: %w", filePath, writeErr)
 	}
 
-	// Create parent directory if it doesn't exist
-	parentDir := filepath.Dir(params.Path)
-	if parentDir != "/" && parentDir != "." {
-		mkdirCmd := []string{"mkdir", "-p", parentDir}
-		mkdirExecConfig := types.ExecConfig{
-			Cmd:          mkdirCmd,
-			AttachStdout: true,
-			AttachStderr: true,
-		}
-
-		mkdirExecID, err := s.client.ContainerExecCreate(ctx, containerInfo.ID, mkdirExecConfig)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create mkdir exec: %w", err)
-		}
-
-		mkdirResp, err := s.client.ContainerExecAttach(ctx, mkdirExecID.ID, types.ExecStartCheck{})
-		if err != nil {
-			return nil, fmt.Errorf("failed to attach mkdir exec: %w", err)
-		}
-		mkdirResp.Close()
+	if err := s.runHelperExec(ctx, containerID, "mv", "-f", tempPath, filePath); err != nil {
+		s.removeTempFile(containerID, tempPath)
+		return fmt.Errorf("failed to replace file %s: %w", filePath, err)
 	}
+	return nil
+}
 
-	// Use sh -c to write file content with proper escaping
-	escapedContent := strings.ReplaceAll(params.Content, "'", "'\"'\"'")
-	cmd := []string{"sh", "-c", fmt.Sprintf("echo '%s' > '%s'", escapedContent, params.Path)}
-
-	execConfig := types.ExecConfig{
-		Cmd:          cmd,
-		AttachStdout: true,
-		AttachStderr: true,
+// removeTempFile removes a temporary file left in the box by a failed operation. It uses
+// a fresh context, as the one of the operation may be done already.
+func (s *Service) removeTempFile(containerID, tempPath string) {
+	ctx, cancel := context.WithTimeout(context.Background(), execCleanupTimeout)
+	defer cancel()
+	if err := s.runHelperExec(ctx, containerID, "rm", "-f", tempPath); err != nil {
+		s.logger.Error("Error removing temporary file %s: %v", tempPath, err)
 	}
+}
+
+// EditFile edits a text file within a container. The file is written back only if it
+// still has the content the edits were applied to.
+func (s *Service) EditFile(ctx context.Context, id string, params *model.BoxFileEditParams) (*model.BoxFileEditResult, error) {
+	// Update access time when editing files
+	s.accessTracker.Update(id)
 
-	execID, err := s.client.ContainerExecCreate(ctx, containerInfo.ID, execConfig)
+	containerInfo, err := s.getContainerByID(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create exec: %w", err)
+		return nil, err
 	}
 
-	resp, err := s.client.ContainerExecAttach(ctx, execID.ID, types.ExecStartCheck{})
+	file, err := s.openBoxFile(ctx, containerInfo.ID, resolveBoxPath(params.Path))
 	if err != nil {
-		return nil, fmt.Errorf("failed to attach exec: %w", err)
+		return nil, err
 	}
-	defer resp.Close()
+	defer file.Close()
 
-	// Read any output (mainly for error detection)
-	output := &bytes.Buffer{}
-	_, err = io.Copy(output, resp.Reader)
+	if limit := config.GetInstance().File.MaxReadBytes; limit > 0 && file.header.Size > limit {
+		return nil, fmt.Errorf("%w: %s is %d bytes, the limit is %d bytes", service.ErrFileTooLarge, params.Path, file.header.Size, limit)
+	}
+	original, err := io.ReadAll(file)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read exec output: %w", err)
+		return nil, fmt.Errorf("failed to read file %s: %w", params.Path, err)
 	}
 
-	// Check exec exit code
-	inspect, err := s.client.ContainerExecInspect(ctx, execID.ID)
+	edited, result, err := service.EditFileContent(original, params)
 	if err != nil {
-		return nil, fmt.Errorf("failed to inspect exec: %w", err)
+		return nil, err
 	}
-
-	if inspect.ExitCode != 0 {
-		return nil, fmt.Errorf("failed to write file %s: command exited with code %d, output: %s", params.Path, inspect.ExitCode, output.String())
+	if params.DryRun || !result.Changed {
+		return result, nil
 	}
 
-	return &model.BoxFileWriteResult{
-		Message: fmt.Sprintf("File %s written successfully", params.Path),
-	}, nil
+	sum := sha256.Sum256(original)
+	if _, err := s.WriteFile(ctx, id, &model.BoxFileWriteParams{
+		Path:    file.path,
+		Content: edited,
+		IfMatch: hex.EncodeToString(sum[:]),
+	}); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
-// parseLsOutput parses the output of ls command and returns BoxFile structs
-func (s *Service) parseLsOutput(output, basePath string) ([]model.BoxFile, error) {
-	lines := strings.Split(strings.TrimSpace(output), "\n")
-	var files []model.BoxFile
-
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "total") {
-			continue
-		}
-
-		// Parse ls -la output format
-		// Example: -rw-r--r-- 1 root root 1234 2023-01-01 12:00 filename
-		fields := strings.Fields(line)
-		if len(fields) < 9 {
-			continue // Skip malformed lines
-		}
-
-		permissions := fields[0]
-
-		// Validate permissions field (should start with - or d or l)
-		if !strings.HasPrefix(permissions, "-") && !strings.HasPrefix(permissions, "d") && !strings.HasPrefix(permissions, "l") {
-			continue // Skip invalid lines
-		}
-
-		size := fields[4]
-
-		// Date and time parsing for BusyBox ls output
-		var lastModified time.Time
-		if len(fields) >= 8 {
-			// BusyBox ls output format: "Jan 1 12:34" or "Jan 1 2023"
-			dateTimeStr := strings.Join(fields[5:8], " ")
-			formats := []string{
-				"Jan 2 15:04",  // Recent files: "Jan 1 12:34"
-				"Jan 2 2006",   // Old files: "Jan 1 2023"
-				"Jan 02 15:04", // Alternative format
-				"Jan 02 2006",  // Alternative format
-			}
-
-			for _, format := range formats {
-				if parsed, err := time.Parse(format, dateTimeStr); err == nil {
-					// For "Jan 2 15:04" format, assume current year
-					if parsed.Year() == 0 {
-						parsed = parsed.AddDate(time.Now().Year(), 0, 0)
-					}
-					lastModified = parsed
-					break
-				}
-			}
-		}
-
-		// Filename is the rest of the fields joined
-		filename := strings.Join(fields[8:], " ")
-
-		// Skip . and .. entries
-		if filename == "." || filename == ".." {
-			continue
-		}
-
-		// Skip empty filenames
-		if filename == "" {
-			continue
-		}
-
-		// Determine file type
-		fileType := "file"
-		if strings.HasPrefix(permissions, "d") {
-			fileType = "directory"
-		} else if strings.HasPrefix(permissions, "l") {
-			fileType = "symlink"
-		}
-
-		// Build full path
-		fullPath := filepath.Join(basePath, filename)
-		if basePath == "/" {
-			fullPath = "/" + filename
-		}
-
-		files = append(files, model.BoxFile{
-			Name:         filename,
-			Path:         fullPath,
-			Type:         fileType,
-			Size:         size,
-			LastModified: lastModified,
-		})
+// SearchFiles searches the names and contents of the files under a directory within a
+// container. The box lists the files and archives the ones whose contents are searched.
+func (s *Service) SearchFiles(ctx context.Context, id string, params *model.BoxFileSearchParams) (*model.BoxFileSearchResult, error) {
+	search, err := service.NewFileSearch(resolveBoxPath(params.Path), params)
+	if err != nil {
+		return nil, err
 	}
-
-	return files, nil
+	return search.Run(func(op *service.FileOperation) (string, error) {
+		outcome, err := s.execFileOperation(ctx, id, op)
+		if err != nil {
+			return "", err
+		}
+		return op.Output(outcome.exitCode, outcome.stdout, outcome.stderr)
+	})
 }
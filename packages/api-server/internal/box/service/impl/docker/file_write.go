@@ -0,0 +1,223 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/api-server/internal/box/service"
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+// defaultFileMode is the permission of files created without an explicit mode
+const defaultFileMode = 0644
+
+// boxFile is a regular file of a box opened for reading through the archive API
+type boxFile struct {
+	*tar.Reader
+	// path is the path of the file with symlinks followed
+	path   string
+	header *tar.Header
+	closer io.Closer
+}
+
+// Close implements io.Closer
+func (f *boxFile) Close() error {
+	return f.closer.Close()
+}
+
+// openBoxFile opens the regular file at filePath, following symlinks. Missing files
+// fail with service.ErrPathNotFound and anything but a regular file with service.ErrNotAFile.
+func (s *Service) openBoxFile(ctx context.Context, containerID, filePath string) (*boxFile, error) {
+	reader, stat, err := s.client.CopyFromContainer(ctx, containerID, filePath)
+	if err != nil {
+		return nil, archiveError("failed to read file", filePath, err)
+	}
+
+	// Symlinks are archived as links, so open their target instead
+	if stat.Mode&os.ModeSymlink != 0 && stat.LinkTarget != "" {
+		reader.Close()
+		filePath = stat.LinkTarget
+		reader, stat, err = s.client.CopyFromContainer(ctx, containerID, filePath)
+		if err != nil {
+			return nil, archiveError("failed to read file", filePath, err)
+		}
+	}
+	if !stat.Mode.IsRegular() {
+		reader.Close()
+		return nil, fmt.Errorf("%w: %s", service.ErrNotAFile, filePath)
+	}
+
+	tr := tar.NewReader(reader)
+	header, err := tr.Next()
+	if err != nil {
+		reader.Close()
+		return nil, fmt.Errorf("failed to read archive of %s: %w", filePath, err)
+	}
+
+	return &boxFile{Reader: tr, path: filePath, header: header, closer: reader}, nil
+}
+
+// decodeFileContent decodes the content of a write according to its encoding
+func decodeFileContent(content, encoding string) ([]byte, error) {
+	switch encoding {
+	case "", model.FileEncodingUTF8:
+		return []byte(content), nil
+	case model.FileEncodingBase64:
+		data, err := base64.StdEncoding.DecodeString(content)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid base64 content: %v", service.ErrInvalidEncoding, err)
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported encoding: %s", service.ErrInvalidEncoding, encoding)
+	}
+}
+
+// parseFileMode parses an octal file permission such as "0644"
+func parseFileMode(mode string) (int64, error) {
+	n, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || n > 07777 {
+		return 0, fmt.Errorf("invalid file mode: %s", mode)
+	}
+	return int64(n), nil
+}
+
+// resolveOwner resolves "user[:group]" to numeric IDs using the passwd and group
+// databases of the box; a missing group means the primary group of the user
+func (s *Service) resolveOwner(ctx context.Context, containerID, owner string) (int, int, error) {
+	user, group, hasGroup := strings.Cut(owner, ":")
+	uid, uidErr := strconv.Atoi(user)
+	gid, gidErr := strconv.Atoi(group)
+	if uidErr == nil && hasGroup && gidErr == nil {
+		return uid, gid, nil
+	}
+
+	passwd, err := s.readSmallBoxFile(ctx, containerID, "/etc/passwd")
+	if err != nil {
+		return 0, 0, err
+	}
+	var groups []byte
+	if hasGroup && gidErr != nil {
+		if groups, err = s.readSmallBoxFile(ctx, containerID, "/etc/group"); err != nil {
+			return 0, 0, err
+		}
+	}
+	return lookupOwner(user, group, hasGroup, passwd, groups)
+}
+
+// lookupOwner resolves a user and optional group against passwd and group databases
+func lookupOwner(user, group string, hasGroup bool, passwd, groups []byte) (int, int, error) {
+	uid, err := strconv.Atoi(user)
+	primaryGID := -1
+	if err != nil {
+		entry := lookupDatabaseEntry(passwd, user)
+		if len(entry) < 4 {
+			return 0, 0, fmt.Errorf("%w: user %s", service.ErrUnknownOwner, user)
+		}
+		if uid, err = strconv.Atoi(entry[2]); err != nil {
+			return 0, 0, fmt.Errorf("%w: user %s", service.ErrUnknownOwner, user)
+		}
+		primaryGID, _ = strconv.Atoi(entry[3])
+	} else {
+		for _, line := range strings.Split(string(passwd), "\n") {
+			if fields := strings.Split(line, ":"); len(fields) >= 4 && fields[2] == user {
+				primaryGID, _ = strconv.Atoi(fields[3])
+				break
+			}
+		}
+	}
+
+	if !hasGroup {
+		if primaryGID < 0 {
+			// A numeric user without a passwd entry gets the group with the same ID
+			primaryGID = uid
+		}
+		return uid, primaryGID, nil
+	}
+
+	if gid, err := strconv.Atoi(group); err == nil {
+		return uid, gid, nil
+	}
+	entry := lookupDatabaseEntry(groups, group)
+	if len(entry) < 3 {
+		return 0, 0, fmt.Errorf("%w: group %s", service.ErrUnknownOwner, group)
+	}
+	gid, err := strconv.Atoi(entry[2])
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: group %s", service.ErrUnknownOwner, group)
+	}
+	return uid, gid, nil
+}
+
+// lookupDatabaseEntry returns the fields of the entry for name in a colon-separated
+// database such as /etc/passwd, or nil if there is none
+func lookupDatabaseEntry(db []byte, name string) []string {
+	for _, line := range strings.Split(string(db), "\n") {
+		if fields := strings.Split(line, ":"); fields[0] == name {
+			return fields
+		}
+	}
+	return nil
+}
+
+// readSmallBoxFile reads a small file such as /etc/passwd from a box
+func (s *Service) readSmallBoxFile(ctx context.Context, containerID, filePath string) ([]byte, error) {
+	file, err := s.openBoxFile(ctx, containerID, filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(io.LimitReader(file, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filePath, err)
+	}
+	return content, nil
+}
+
+// writeFileArchive writes a tar archive holding a single file with the given header and
+// content to w, feeding the content to sum as it goes if it is not nil
+func writeFileArchive(w io.Writer, header *tar.Header, content io.Reader, sum hash.Hash) error {
+	tw := tar.NewWriter(w)
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	dst := io.Writer(tw)
+	if sum != nil {
+		dst = io.MultiWriter(tw, sum)
+	}
+	if _, err := io.Copy(dst, content); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// newFileHeader returns the tar header of a file written by WriteFile
+func newFileHeader(name string, size, mode int64, uid, gid int) *tar.Header {
+	return &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     mode,
+		Uid:      uid,
+		Gid:      gid,
+		ModTime:  time.Now(),
+	}
+}
+
+// prefixedContent returns the content of a write, appended to the existing file if any
+func prefixedContent(existing io.Reader, content []byte) io.Reader {
+	if existing == nil {
+		return bytes.NewReader(content)
+	}
+	return io.MultiReader(existing, bytes.NewReader(content))
+}
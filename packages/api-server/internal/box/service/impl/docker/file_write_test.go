@@ -0,0 +1,95 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/babelcloud/gbox/packages/api-server/internal/box/service"
+)
+
+func TestLookupOwner(t *testing.T) {
+	passwd := []byte("root:x:0:0:root:/root:/bin/sh\ngbox:x:1000:1001::/home/gbox:/bin/sh\n")
+	groups := []byte("root:x:0:\nstaff:x:50:gbox\n")
+
+	tests := []struct {
+		owner    string
+		uid, gid int
+		err      bool
+	}{
+		{"gbox", 1000, 1001, false},
+		{"gbox:staff", 1000, 50, false},
+		{"gbox:7", 1000, 7, false},
+		{"1000", 1000, 1001, false},
+		{"2000", 2000, 2000, false},
+		{"nobody", 0, 0, true},
+		{"gbox:nogroup", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.owner, func(t *testing.T) {
+			user, group, hasGroup := strings.Cut(tt.owner, ":")
+			uid, gid, err := lookupOwner(user, group, hasGroup, passwd, groups)
+			if tt.err {
+				assert.True(t, errors.Is(err, service.ErrUnknownOwner))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.uid, uid)
+			assert.Equal(t, tt.gid, gid)
+		})
+	}
+}
+
+func TestParseFileMode(t *testing.T) {
+	mode, err := parseFileMode("0755")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0755), mode)
+
+	_, err = parseFileMode("0999")
+	assert.Error(t, err)
+	_, err = parseFileMode("17777")
+	assert.Error(t, err)
+}
+
+func TestDecodeFileContent(t *testing.T) {
+	content, err := decodeFileContent("aGVsbG8=", "base64")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hello"), content)
+
+	content, err = decodeFileContent("hello", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hello"), content)
+
+	_, err = decodeFileContent("not base64!", "base64")
+	assert.ErrorIs(t, err, service.ErrInvalidEncoding)
+}
+
+func TestWriteFileArchive(t *testing.T) {
+	var buf bytes.Buffer
+	sum := sha256.New()
+	header := newFileHeader(".out.txt.gbox-tmp", 11, 0600, 1000, 1001)
+	err := writeFileArchive(&buf, header, prefixedContent(strings.NewReader("hello "), []byte("world")), sum)
+	assert.NoError(t, err)
+
+	expected := sha256.Sum256([]byte("hello world"))
+	assert.Equal(t, hex.EncodeToString(expected[:]), hex.EncodeToString(sum.Sum(nil)))
+
+	tr := tar.NewReader(&buf)
+	got, err := tr.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, ".out.txt.gbox-tmp", got.Name)
+	assert.Equal(t, int64(0600), got.Mode)
+	assert.Equal(t, 1000, got.Uid)
+	assert.Equal(t, 1001, got.Gid)
+	content, err := io.ReadAll(tr)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(content))
+}
@@ -0,0 +1,83 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/api-server/internal/box/service"
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+// fileOperationTimeout bounds file operations, which may copy or remove large trees
+const fileOperationTimeout = 5 * time.Minute
+
+// StatFile implements Service.StatFile
+func (s *Service) StatFile(ctx context.Context, id string, params *model.BoxFileStatParams) (*model.BoxFile, error) {
+	return s.runFileOperation(ctx, id, service.StatOperation(params))
+}
+
+// MakeDir implements Service.MakeDir
+func (s *Service) MakeDir(ctx context.Context, id string, params *model.BoxFileMkdirParams) (*model.BoxFile, error) {
+	return s.runFileOperation(ctx, id, service.MkdirOperation(params))
+}
+
+// RemoveFile implements Service.RemoveFile
+func (s *Service) RemoveFile(ctx context.Context, id string, params *model.BoxFileRemoveParams) (*model.BoxFileRemoveResult, error) {
+	if _, err := s.runFileOperation(ctx, id, service.RemoveOperation(params)); err != nil {
+		return nil, err
+	}
+	return &model.BoxFileRemoveResult{Message: fmt.Sprintf("%s removed successfully", params.Path)}, nil
+}
+
+// MoveFile implements Service.MoveFile
+func (s *Service) MoveFile(ctx context.Context, id string, params *model.BoxFileMoveParams) (*model.BoxFile, error) {
+	return s.runFileOperation(ctx, id, service.MoveOperation(params))
+}
+
+// CopyFile implements Service.CopyFile
+func (s *Service) CopyFile(ctx context.Context, id string, params *model.BoxFileCopyParams) (*model.BoxFile, error) {
+	return s.runFileOperation(ctx, id, service.CopyOperation(params))
+}
+
+// ChmodFile implements Service.ChmodFile
+func (s *Service) ChmodFile(ctx context.Context, id string, params *model.BoxFileChmodParams) (*model.BoxFile, error) {
+	return s.runFileOperation(ctx, id, service.ChmodOperation(params))
+}
+
+// runFileOperation runs a file operation script in a running box
+func (s *Service) runFileOperation(ctx context.Context, id string, op *service.FileOperation) (*model.BoxFile, error) {
+	outcome, err := s.execFileOperation(ctx, id, op)
+	if err != nil {
+		return nil, err
+	}
+	return op.Result(outcome.exitCode, outcome.stdout, outcome.stderr)
+}
+
+// execFileOperation runs a file operation in a running box and returns its outcome
+func (s *Service) execFileOperation(ctx context.Context, id string, op *service.FileOperation) (*execOutcome, error) {
+	return s.execFileOperationWithTimeout(ctx, id, op, fileOperationTimeout)
+}
+
+// execFileOperationWithTimeout runs a file operation that may take longer than others,
+// such as a clone, in a running box and returns its outcome
+func (s *Service) execFileOperationWithTimeout(ctx context.Context, id string, op *service.FileOperation, timeout time.Duration) (*execOutcome, error) {
+	// Update access time on file operations
+	s.accessTracker.Update(id)
+
+	containerID, err := s.getRunningContainerID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	execConfig := execHelperConfig(op.Command()...)
+	execConfig.AttachStdin = op.Stdin() != ""
+	outcome, err := s.runExec(ctx, containerID, execConfig, execOptions{stdin: op.Stdin(), timeout: timeout})
+	if err != nil {
+		return nil, err
+	}
+	if outcome.timedOut {
+		return nil, fmt.Errorf("file operation timed out after %s", timeout)
+	}
+	return outcome, nil
+}
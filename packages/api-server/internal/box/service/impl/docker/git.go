@@ -0,0 +1,61 @@
+package docker
+
+import (
+	"context"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/api-server/internal/box/service"
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+// gitCloneTimeout bounds clones, which may fetch large repositories
+const gitCloneTimeout = 30 * time.Minute
+
+// GitClone implements Service.GitClone
+func (s *Service) GitClone(ctx context.Context, id string, params *model.BoxGitCloneParams) (*model.BoxGitCloneResult, error) {
+	op, err := service.GitCloneOperation(params)
+	if err != nil {
+		return nil, err
+	}
+	output, err := s.gitOutput(ctx, id, op, gitCloneTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return service.ParseGitClone(output)
+}
+
+// GitStatus implements Service.GitStatus
+func (s *Service) GitStatus(ctx context.Context, id string, params *model.BoxGitStatusParams) (*model.BoxGitStatus, error) {
+	output, err := s.gitOutput(ctx, id, service.GitStatusOperation(params), fileOperationTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return service.ParseGitStatus(output)
+}
+
+// GitDiff implements Service.GitDiff
+func (s *Service) GitDiff(ctx context.Context, id string, params *model.BoxGitDiffParams) (*model.BoxGitDiff, error) {
+	output, err := s.gitOutput(ctx, id, service.GitDiffOperation(params), fileOperationTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return service.ParseGitDiff(output)
+}
+
+// GitCommit implements Service.GitCommit
+func (s *Service) GitCommit(ctx context.Context, id string, params *model.BoxGitCommitParams) (*model.BoxGitCommitResult, error) {
+	output, err := s.gitOutput(ctx, id, service.GitCommitOperation(params), fileOperationTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return service.ParseGitCommit(output)
+}
+
+// gitOutput runs a git operation in a running box and returns its output
+func (s *Service) gitOutput(ctx context.Context, id string, op *service.FileOperation, timeout time.Duration) (string, error) {
+	outcome, err := s.execFileOperationWithTimeout(ctx, id, op, timeout)
+	if err != nil {
+		return "", err
+	}
+	return op.Output(outcome.exitCode, outcome.stdout, outcome.stderr)
+}
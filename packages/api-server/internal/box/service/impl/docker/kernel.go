@@ -0,0 +1,292 @@
+package docker
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+
+	"github.com/babelcloud/gbox/packages/api-server/internal/box/service"
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+// kernelScript relays run-code requests to long-lived Python interpreters inside the box
+//
+//go:embed kernel.py
+var kernelScript string
+
+const (
+	// kernelScriptPath is where the kernel script is written inside the box
+	kernelScriptPath = "/tmp/gbox-kernel.py"
+	// kernelCommandTimeout bounds listing, interrupting and restarting kernels
+	kernelCommandTimeout = 30 * time.Second
+	// kernelNotFoundExitCode is the exit code of the kernel script for unknown kernels
+	kernelNotFoundExitCode = 2
+)
+
+var kernelIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// kernelRequest is the run request read by the kernel script from stdin
+type kernelRequest struct {
+	Code       string            `json:"code"`
+	Envs       map[string]string `json:"envs,omitempty"`
+	WorkingDir string            `json:"workingDir,omitempty"`
+}
+
+// kernelResponse is the reply of the kernel to a run request
+type kernelResponse struct {
+	Status         string                   `json:"status"`
+	ExecutionCount int                      `json:"executionCount"`
+	Outputs        []model.BoxRunCodeOutput `json:"outputs"`
+}
+
+// kernelError is printed by the kernel script when a command fails
+type kernelError struct {
+	Error string `json:"error"`
+}
+
+// runInKernel runs python3 code in the stateful kernel named by req.KernelID
+func (s *Service) runInKernel(ctx context.Context, boxID, containerID string, req *model.BoxRunCodeParams) (*model.BoxRunCodeResult, error) {
+	if !kernelIDPattern.MatchString(req.KernelID) {
+		return nil, fmt.Errorf("invalid kernel ID: %s", req.KernelID)
+	}
+	if lang, ok := service.Languages().Lookup(req.Language); !ok || lang.Name != "python3" {
+		return nil, fmt.Errorf("kernels are only supported for python3, got: %s", req.Language)
+	}
+	if req.Stdin != "" || req.SpillOutput {
+		return nil, fmt.Errorf("stdin and spillOutput are not supported when running in a kernel")
+	}
+
+	limits, err := resolveOutputLimits(req.MaxOutputBytes, req.MaxOutputLines, req.OutputRetention)
+	if err != nil {
+		return nil, err
+	}
+
+	workingDir := resolveWorkingDir(req.WorkingDir)
+	inputFiles := map[string]string{kernelScriptPath: kernelScript}
+	for path, content := range req.InputFiles {
+		inputFiles[path] = content
+	}
+	if err := s.writeInputFiles(ctx, containerID, workingDir, inputFiles); err != nil {
+		return nil, err
+	}
+
+	request, err := json.Marshal(kernelRequest{
+		Code:       req.Code,
+		Envs:       req.Envs,
+		WorkingDir: workingDir,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode kernel request: %w", err)
+	}
+
+	// The relay output is parsed as a whole, so the output limits are applied
+	// to the streams afterwards rather than to the relay itself
+	outcome, err := s.runExec(ctx, containerID, types.ExecConfig{
+		User:         req.User,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+		WorkingDir:   workingDir,
+		Cmd:          []string{"python3", kernelScriptPath, "run", req.KernelID},
+	}, execOptions{
+		boxID:       boxID,
+		stdin:       string(request),
+		timeout:     parseExecTimeout(req.Timeout),
+		reportUsage: req.ReportUsage,
+
+		workingDir:       workingDir,
+		collectArtifacts: req.CollectArtifacts,
+	})
+	if err != nil || outcome.timedOut {
+		// The code keeps running in the kernel unless it is interrupted
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), execCleanupTimeout)
+		defer cancel()
+		if _, interruptErr := s.runKernelCommand(cleanupCtx, containerID, req.User, "interrupt", req.KernelID); interruptErr != nil {
+			s.logger.Error("Error interrupting kernel %s: %v", req.KernelID, interruptErr)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if outcome.timedOut {
+		return &model.BoxRunCodeResult{
+			ExitCode:  outcome.exitCode,
+			TimedOut:  true,
+			KernelID:  req.KernelID,
+			Usage:     outcome.usage,
+			Artifacts: outcome.artifacts,
+		}, nil
+	}
+	if outcome.exitCode != 0 {
+		return nil, fmt.Errorf("kernel %s failed: %s", req.KernelID, kernelErrorMessage(outcome))
+	}
+
+	var response kernelResponse
+	if err := json.Unmarshal([]byte(outcome.stdout), &response); err != nil {
+		return nil, fmt.Errorf("failed to decode kernel response: %w", err)
+	}
+
+	// Flatten the streams for clients that only look at stdout and stderr
+	stdout := newLimitedBuffer(limits, nil)
+	stderr := newLimitedBuffer(limits, nil)
+	exitCode := 0
+	for _, output := range response.Outputs {
+		switch output.Type {
+		case model.OutputTypeStream:
+			if output.Name == "stderr" {
+				stderr.Write([]byte(output.Text))
+			} else {
+				stdout.Write([]byte(output.Text))
+			}
+		case model.OutputTypeError:
+			stderr.Write([]byte(strings.Join(output.Traceback, "")))
+			exitCode = 1
+		}
+	}
+
+	result := &model.BoxRunCodeResult{
+		ExitCode:       exitCode,
+		StdoutBytes:    stdout.total,
+		StderrBytes:    stderr.total,
+		Usage:          outcome.usage,
+		Artifacts:      outcome.artifacts,
+		KernelID:       req.KernelID,
+		ExecutionCount: response.ExecutionCount,
+		Outputs:        response.Outputs,
+	}
+	result.Stdout, result.StdoutTruncated = stdout.result()
+	result.Stderr, result.StderrTruncated = stderr.result()
+	return result, nil
+}
+
+// ListKernels implements Service.ListKernels
+func (s *Service) ListKernels(ctx context.Context, id string) (*model.BoxKernelListResult, error) {
+	containerID, err := s.getRunningContainerID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := s.runKernelCommand(ctx, containerID, "", "list")
+	if err != nil {
+		return nil, err
+	}
+
+	result := &model.BoxKernelListResult{Kernels: []model.BoxKernel{}}
+	if err := json.Unmarshal([]byte(output), &result.Kernels); err != nil {
+		return nil, fmt.Errorf("failed to decode kernel list: %w", err)
+	}
+	return result, nil
+}
+
+// InterruptKernel implements Service.InterruptKernel
+func (s *Service) InterruptKernel(ctx context.Context, id, kernelID string) (*model.BoxKernel, error) {
+	return s.controlKernel(ctx, id, kernelID, "interrupt")
+}
+
+// RestartKernel implements Service.RestartKernel
+func (s *Service) RestartKernel(ctx context.Context, id, kernelID string) (*model.BoxKernel, error) {
+	return s.controlKernel(ctx, id, kernelID, "restart")
+}
+
+// controlKernel runs a kernel script command that reports the state of a single kernel
+func (s *Service) controlKernel(ctx context.Context, id, kernelID, command string) (*model.BoxKernel, error) {
+	if !kernelIDPattern.MatchString(kernelID) {
+		return nil, fmt.Errorf("invalid kernel ID: %s", kernelID)
+	}
+
+	containerID, err := s.getRunningContainerID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Kernels only take signals from their owner, which also owns the restarted kernel
+	user, err := s.kernelOwner(ctx, containerID, kernelID)
+	if err != nil {
+		return nil, err
+	}
+	output, err := s.runKernelCommand(ctx, containerID, user, command, kernelID)
+	if err != nil {
+		return nil, err
+	}
+
+	var kernel model.BoxKernel
+	if err := json.Unmarshal([]byte(output), &kernel); err != nil {
+		return nil, fmt.Errorf("failed to decode kernel state: %w", err)
+	}
+	return &kernel, nil
+}
+
+// kernelOwner returns the user a kernel runs as, empty for the default user of the box
+func (s *Service) kernelOwner(ctx context.Context, containerID, kernelID string) (string, error) {
+	output, err := s.runKernelCommand(ctx, containerID, "", "list")
+	if err != nil {
+		return "", err
+	}
+	var kernels []model.BoxKernel
+	if err := json.Unmarshal([]byte(output), &kernels); err != nil {
+		return "", fmt.Errorf("failed to decode kernel list: %w", err)
+	}
+	for _, kernel := range kernels {
+		if kernel.ID == kernelID {
+			return kernel.User, nil
+		}
+	}
+	return "", fmt.Errorf("%w: kernel %s not found", service.ErrKernelNotFound, kernelID)
+}
+
+// getRunningContainerID returns the container ID of a box, which must be running
+func (s *Service) getRunningContainerID(ctx context.Context, id string) (string, error) {
+	containerInfo, err := s.getContainerByID(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if containerInfo.State != "running" {
+		return "", fmt.Errorf("box %s is not running (current state: %s)", id, containerInfo.State)
+	}
+	return containerInfo.ID, nil
+}
+
+// runKernelCommand writes the kernel script to the box and runs one of its commands
+func (s *Service) runKernelCommand(ctx context.Context, containerID, user string, args ...string) (string, error) {
+	if err := s.writeInputFiles(ctx, containerID, "/", map[string]string{kernelScriptPath: kernelScript}); err != nil {
+		return "", err
+	}
+
+	outcome, err := s.runExec(ctx, containerID, types.ExecConfig{
+		User:         user,
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd:          append([]string{"python3", kernelScriptPath}, args...),
+	}, execOptions{timeout: kernelCommandTimeout})
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case outcome.timedOut:
+		return "", fmt.Errorf("kernel command %s timed out", args[0])
+	case outcome.exitCode == kernelNotFoundExitCode:
+		return "", fmt.Errorf("%w: %s", service.ErrKernelNotFound, kernelErrorMessage(outcome))
+	case outcome.exitCode != 0:
+		return "", fmt.Errorf("kernel command %s failed: %s", args[0], kernelErrorMessage(outcome))
+	}
+	return outcome.stdout, nil
+}
+
+// kernelErrorMessage extracts the error reported by the kernel script
+func kernelErrorMessage(outcome *execOutcome) string {
+	var kerr kernelError
+	if err := json.Unmarshal([]byte(outcome.stdout), &kerr); err == nil && kerr.Error != "" {
+		return kerr.Error
+	}
+	if msg := strings.TrimSpace(outcome.stderr); msg != "" {
+		return msg
+	}
+	return fmt.Sprintf("exit code %d", outcome.exitCode)
+}
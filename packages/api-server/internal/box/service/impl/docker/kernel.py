@@ -0,0 +1,414 @@
+"""Stateful Python kernel for gbox run-code.
+
+Usage:
+    kernel.py run <id>        relay the request read from stdin to kernel <id>, starting it if needed
+    kernel.py interrupt <id>  interrupt the code kernel <id> is running
+    kernel.py restart <id>    restart kernel <id> with a fresh namespace
+    kernel.py list            list the kernels
+    kernel.py serve <id>      run kernel <id> (started by "run")
+
+Every command prints a single JSON document on stdout.
+"""
+
+import ast
+import base64
+import fcntl
+import io
+import json
+import linecache
+import os
+import signal
+import socket
+import subprocess
+import sys
+import time
+import traceback
+
+STATE_DIR = "/tmp/gbox-kernels"
+START_TIMEOUT = 30
+EXEC_MARKER_ENV = "GBOX_EXEC_ID"
+
+
+class KernelNotFound(Exception):
+    """Raised when a kernel does not exist or is not running; exits with status 2."""
+
+
+def paths(kernel_id):
+    base = os.path.join(STATE_DIR, kernel_id)
+    return {
+        "sock": base + ".sock",
+        "lock": base + ".lock",
+        "state": base + ".json",
+        "log": base + ".log",
+    }
+
+
+def ensure_state_dir():
+    os.makedirs(STATE_DIR, exist_ok=True)
+    try:
+        os.chmod(STATE_DIR, 0o1777)
+    except OSError:
+        pass
+
+
+def read_state(kernel_id):
+    try:
+        with open(paths(kernel_id)["state"]) as f:
+            return json.load(f)
+    except (OSError, ValueError):
+        return None
+
+
+def pid_alive(pid):
+    try:
+        os.kill(pid, 0)
+    except ProcessLookupError:
+        return False
+    except PermissionError:
+        return True
+    return True
+
+
+def kernel_info(kernel_id):
+    state = read_state(kernel_id)
+    if state is None:
+        return None
+    if not pid_alive(state.get("pid", 0)):
+        state["status"] = "dead"
+    return state
+
+
+# --- Kernel side ---------------------------------------------------------
+
+
+class StreamCapture(io.TextIOBase):
+    """Collects writes to stdout or stderr as stream outputs."""
+
+    def __init__(self, outputs, name):
+        self.outputs = outputs
+        self.name = name
+
+    def writable(self):
+        return True
+
+    def write(self, text):
+        if not text:
+            return 0
+        last = self.outputs[-1] if self.outputs else None
+        if last and last["type"] == "stream" and last["name"] == self.name:
+            last["text"] += text
+        else:
+            self.outputs.append({"type": "stream", "name": self.name, "text": text})
+        return len(text)
+
+
+REPR_METHODS = (
+    ("_repr_html_", "text/html"),
+    ("_repr_markdown_", "text/markdown"),
+    ("_repr_svg_", "image/svg+xml"),
+    ("_repr_json_", "application/json"),
+    ("_repr_png_", "image/png"),
+    ("_repr_jpeg_", "image/jpeg"),
+)
+
+
+def mime_bundle(obj):
+    data = {"text/plain": repr(obj)}
+    for method, mime in REPR_METHODS:
+        fn = getattr(obj, method, None)
+        if not callable(fn):
+            continue
+        try:
+            value = fn()
+        except Exception:
+            continue
+        if isinstance(value, tuple):
+            value = value[0]
+        if value is None:
+            continue
+        if isinstance(value, bytes):
+            value = base64.b64encode(value).decode()
+        elif mime == "application/json":
+            value = json.dumps(value)
+        data[mime] = value
+    return data
+
+
+class Kernel:
+    def __init__(self, kernel_id):
+        self.id = kernel_id
+        self.paths = paths(kernel_id)
+        self.execution_count = 0
+        self.outputs = []
+        self.namespace = {"__name__": "__main__", "display": self.display}
+        self.started_at = time.strftime("%Y-%m-%dT%H:%M:%SZ", time.gmtime())
+
+    def write_state(self, status):
+        state = {
+            "id": self.id,
+            "language": "python3",
+            "pid": os.getpid(),
+            "user": "%d:%d" % (os.getuid(), os.getgid()),
+            "status": status,
+            "executionCount": self.execution_count,
+            "startedAt": self.started_at,
+        }
+        tmp = self.paths["state"] + ".tmp"
+        with open(tmp, "w") as f:
+            json.dump(state, f)
+        os.replace(tmp, self.paths["state"])
+
+    def display(self, *objs):
+        for obj in objs:
+            self.outputs.append({"type": "display_data", "data": mime_bundle(obj)})
+
+    def collect_figures(self):
+        plt = sys.modules.get("matplotlib.pyplot")
+        if plt is None:
+            return
+        for num in plt.get_fignums():
+            fig = plt.figure(num)
+            buf = io.BytesIO()
+            try:
+                fig.savefig(buf, format="png", bbox_inches="tight")
+            except Exception:
+                continue
+            self.outputs.append({
+                "type": "display_data",
+                "data": {
+                    "image/png": base64.b64encode(buf.getvalue()).decode(),
+                    "text/plain": repr(fig),
+                },
+            })
+        plt.close("all")
+
+    def execute(self, request):
+        self.execution_count += 1
+        self.outputs = []
+        filename = "<cell-%d>" % self.execution_count
+        code = request.get("code", "")
+        linecache.cache[filename] = (len(code), None, code.splitlines(True), filename)
+
+        # The variables of a request only apply to it, the kernel outlives it
+        envs = request.get("envs") or {}
+        saved_envs = {key: os.environ.get(key) for key in envs}
+        for key, value in envs.items():
+            os.environ[key] = value
+        if request.get("workingDir"):
+            os.chdir(request["workingDir"])
+
+        status = "ok"
+        stdout, stderr = sys.stdout, sys.stderr
+        sys.stdout = StreamCapture(self.outputs, "stdout")
+        sys.stderr = StreamCapture(self.outputs, "stderr")
+        try:
+            tree = ast.parse(code, filename, "exec")
+            last = None
+            if tree.body and isinstance(tree.body[-1], ast.Expr):
+                last = ast.Expression(tree.body.pop().value)
+            exec(compile(tree, filename, "exec"), self.namespace)
+            if last is not None:
+                value = eval(compile(last, filename, "eval"), self.namespace)
+                if value is not None:
+                    self.namespace["_"] = value
+                    self.outputs.append({
+                        "type": "execute_result",
+                        "data": mime_bundle(value),
+                    })
+        except BaseException as e:  # Including KeyboardInterrupt when interrupted
+            status = "error"
+            tb = e.__traceback__
+            # Drop the frame of the kernel itself
+            if tb is not None and tb.tb_frame.f_code.co_filename == __file__:
+                tb = tb.tb_next
+            self.outputs.append({
+                "type": "error",
+                "ename": type(e).__name__,
+                "evalue": str(e),
+                "traceback": traceback.format_exception(type(e), e, tb),
+            })
+        finally:
+            sys.stdout, sys.stderr = stdout, stderr
+            for key, value in saved_envs.items():
+                if value is None:
+                    os.environ.pop(key, None)
+                else:
+                    os.environ[key] = value
+
+        try:
+            self.collect_figures()
+        except Exception:
+            pass
+
+        return {
+            "status": status,
+            "executionCount": self.execution_count,
+            "outputs": self.outputs,
+        }
+
+    def serve(self):
+        lock = open(self.paths["lock"], "w")
+        try:
+            fcntl.flock(lock, fcntl.LOCK_EX | fcntl.LOCK_NB)
+        except OSError:
+            return  # Another process already serves this kernel
+
+        if os.path.exists(self.paths["sock"]):
+            os.unlink(self.paths["sock"])
+        server = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
+        server.bind(self.paths["sock"])
+        server.listen(16)
+
+        signal.signal(signal.SIGTERM, lambda *_: sys.exit(0))
+        self.write_state("idle")
+        while True:
+            try:
+                conn, _ = server.accept()
+            except KeyboardInterrupt:
+                continue  # Interrupted while idle
+            try:
+                with conn:
+                    request = json.loads(recv_all(conn))
+                    self.write_state("busy")
+                    response = self.execute(request)
+                    conn.sendall(json.dumps(response).encode())
+            except KeyboardInterrupt:
+                pass
+            except Exception:
+                traceback.print_exc()
+            finally:
+                self.write_state("idle")
+
+
+def recv_all(conn):
+    chunks = []
+    while True:
+        chunk = conn.recv(65536)
+        if not chunk:
+            break
+        chunks.append(chunk)
+    return b"".join(chunks)
+
+
+# --- Client side ---------------------------------------------------------
+
+
+def start_kernel(kernel_id):
+    env = dict(os.environ)
+    # The kernel outlives this exec, so it must not be killed with it
+    env.pop(EXEC_MARKER_ENV, None)
+    env.setdefault("MPLBACKEND", "Agg")
+    log = open(paths(kernel_id)["log"], "ab")
+    subprocess.Popen(
+        [sys.executable, os.path.abspath(__file__), "serve", kernel_id],
+        stdin=subprocess.DEVNULL,
+        stdout=log,
+        stderr=log,
+        env=env,
+        start_new_session=True,
+        close_fds=True,
+    )
+
+
+def connect(kernel_id, start):
+    sock_path = paths(kernel_id)["sock"]
+    deadline = time.time() + START_TIMEOUT
+    started = False
+    while True:
+        conn = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
+        try:
+            conn.connect(sock_path)
+            return conn
+        except OSError:
+            conn.close()
+        if not start:
+            raise RuntimeError("kernel %s is not running" % kernel_id)
+        if not started:
+            start_kernel(kernel_id)
+            started = True
+        if time.time() > deadline:
+            raise RuntimeError("kernel %s did not start, see %s" % (kernel_id, paths(kernel_id)["log"]))
+        time.sleep(0.05)
+
+
+def run(kernel_id):
+    request = sys.stdin.buffer.read()
+    conn = connect(kernel_id, start=True)
+    with conn:
+        conn.sendall(request)
+        conn.shutdown(socket.SHUT_WR)
+        response = recv_all(conn)
+    if not response:
+        raise RuntimeError("kernel %s died while running the code" % kernel_id)
+    sys.stdout.write(response.decode())
+
+
+def stop(kernel_id):
+    info = kernel_info(kernel_id)
+    if info is None or info["status"] == "dead":
+        return
+    pid = info["pid"]
+    os.kill(pid, signal.SIGTERM)
+    deadline = time.time() + 5
+    while pid_alive(pid) and time.time() < deadline:
+        time.sleep(0.05)
+    if pid_alive(pid):
+        os.kill(pid, signal.SIGKILL)
+        while pid_alive(pid):
+            time.sleep(0.05)
+
+
+def interrupt(kernel_id):
+    info = kernel_info(kernel_id)
+    if info is None or info["status"] == "dead":
+        raise KernelNotFound("kernel %s is not running" % kernel_id)
+    os.kill(info["pid"], signal.SIGINT)
+    print(json.dumps(info))
+
+
+def restart(kernel_id):
+    if read_state(kernel_id) is None:
+        raise KernelNotFound("kernel %s not found" % kernel_id)
+    stop(kernel_id)
+    connect(kernel_id, start=True).close()
+    print(json.dumps(kernel_info(kernel_id)))
+
+
+def list_kernels():
+    kernels = []
+    if os.path.isdir(STATE_DIR):
+        for name in sorted(os.listdir(STATE_DIR)):
+            if name.endswith(".json"):
+                info = kernel_info(name[: -len(".json")])
+                if info is not None:
+                    kernels.append(info)
+    print(json.dumps(kernels))
+
+
+def main():
+    command = sys.argv[1] if len(sys.argv) > 1 else ""
+    kernel_id = sys.argv[2] if len(sys.argv) > 2 else ""
+    ensure_state_dir()
+    try:
+        if command == "serve":
+            Kernel(kernel_id).serve()
+        elif command == "run":
+            run(kernel_id)
+        elif command == "interrupt":
+            interrupt(kernel_id)
+        elif command == "restart":
+            restart(kernel_id)
+        elif command == "list":
+            list_kernels()
+        else:
+            raise RuntimeError("unknown command: %s" % command)
+    except KernelNotFound as e:
+        print(json.dumps({"error": str(e)}))
+        sys.exit(2)
+    except Exception as e:
+        print(json.dumps({"error": str(e)}))
+        sys.exit(1)
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,38 @@
+package docker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/babelcloud/gbox/packages/api-server/internal/box/service"
+)
+
+func TestControlKernelAsOwner(t *testing.T) {
+	s, daemon := newExecTestService(t)
+	daemon.reply = func(config types.ExecConfig) string {
+		switch config.Cmd[2] {
+		case "list":
+			return `[{"id": "default", "pid": 7, "user": "1000:1000", "status": "busy"}]`
+		case "interrupt":
+			return `{"id": "default", "pid": 7, "user": "1000:1000", "status": "busy"}`
+		}
+		return ""
+	}
+
+	// The kernel is looked up as the default user and interrupted as its owner
+	kernel, err := s.InterruptKernel(context.Background(), "box", "default")
+	require.NoError(t, err)
+	assert.Equal(t, "1000:1000", kernel.User)
+	require.Len(t, daemon.execs, 2)
+	assert.Equal(t, []string{"python3", kernelScriptPath, "list"}, daemon.execs[0].Cmd)
+	assert.Empty(t, daemon.execs[0].User)
+	assert.Equal(t, []string{"python3", kernelScriptPath, "interrupt", "default"}, daemon.execs[1].Cmd)
+	assert.Equal(t, "1000:1000", daemon.execs[1].User)
+
+	_, err = s.RestartKernel(context.Background(), "box", "other")
+	assert.ErrorIs(t, err, service.ErrKernelNotFound)
+}
@@ -17,6 +17,7 @@ import (
 
 	"github.com/babelcloud/gbox/packages/api-server/config"
 	"github.com/babelcloud/gbox/packages/api-server/internal/common"
+	"github.com/babelcloud/gbox/packages/api-server/internal/file/share"
 	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
 	"github.com/babelcloud/gbox/packages/api-server/pkg/id"
 )
@@ -381,12 +382,23 @@ func (s *Service) Delete(ctx context.Context, id string, req *model.BoxDeletePar
 
 	// Remove access tracking info on delete
 	s.accessTracker.Remove(id)
+	if !req.KeepShare {
+		s.removeShareDir(id)
+	}
 
 	return &model.BoxDeleteResult{
 		Message: "Box deleted successfully",
 	}, nil
 }
 
+// removeShareDir removes the share directory of a deleted box. The box is gone already,
+// so failures are only logged and left to the file reclamation.
+func (s *Service) removeShareDir(boxID string) {
+	if err := share.RemoveBox(boxID); err != nil {
+		s.logger.Error("Failed to remove share directory of box %s: %v", boxID, err)
+	}
+}
+
 // DeleteAll implements Service.DeleteAll
 func (s *Service) DeleteAll(ctx context.Context, req *model.BoxesDeleteParams) (*model.BoxesDeleteResult, error) {
 	// Build filter for gbox containers
@@ -412,6 +424,9 @@ func (s *Service) DeleteAll(ctx context.Context, req *model.BoxesDeleteParams) (
 		deletedIDs = append(deletedIDs, container.Labels[labelID])
 		// Remove access tracking info on delete
 		s.accessTracker.Remove(container.Labels[labelID])
+		if !req.KeepShare {
+			s.removeShareDir(container.Labels[labelID])
+		}
 	}
 
 	return &model.BoxesDeleteResult{
@@ -501,6 +516,7 @@ func (s *Service) Reclaim(ctx context.Context) (*model.BoxReclaimResult, error)
 				deletedCount++
 				deletedIDs = append(deletedIDs, boxID)
 				s.accessTracker.Remove(boxID) // Remove tracker info after deleting
+				s.removeShareDir(boxID)
 			} else {
 				// Stopped but not idle long enough to delete
 				s.logger.Debug("Box %s is stopped but not idle long enough for deletion (idle for %v), skipping deletion", boxID, idleDuration)
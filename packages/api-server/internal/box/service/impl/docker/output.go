@@ -0,0 +1,231 @@
+package docker
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/api-server/config"
+	"github.com/babelcloud/gbox/packages/api-server/internal/box/service"
+	"github.com/babelcloud/gbox/packages/api-server/internal/file/share"
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+// outputLimits bounds how much of a stream is retained in memory
+type outputLimits struct {
+	maxBytes int64 // 0 means unlimited
+	maxLines int   // 0 means unlimited
+	tail     bool  // keep the end of the output instead of the beginning
+}
+
+// resolveOutputLimits combines the limits of a request with the server-side cap
+func resolveOutputLimits(maxBytes int64, maxLines int, retention string) (outputLimits, error) {
+	limits := outputLimits{
+		maxBytes: maxBytes,
+		maxLines: maxLines,
+	}
+	if maxBytes < 0 || maxLines < 0 {
+		return limits, fmt.Errorf("%w: output limits must not be negative", service.ErrInvalidRequest)
+	}
+
+	switch retention {
+	case "", model.OutputRetentionHead:
+	case model.OutputRetentionTail:
+		limits.tail = true
+	default:
+		return limits, fmt.Errorf("%w: unsupported output retention mode: %s", service.ErrInvalidRequest, retention)
+	}
+
+	if serverCap := config.GetInstance().Exec.MaxOutputBytes; serverCap > 0 {
+		if limits.maxBytes == 0 || limits.maxBytes > serverCap {
+			limits.maxBytes = serverCap
+		}
+	}
+	return limits, nil
+}
+
+// maxRetainedOutputBytes bounds the output kept in memory per stream when neither the
+// request nor the server caps it
+const maxRetainedOutputBytes = 64 << 20 // 64 MiB
+
+// limitedBuffer is an io.Writer that retains at most limits.maxBytes of what is written
+// to it, while counting the total and optionally copying everything to a spill writer
+type limitedBuffer struct {
+	limits outputLimits
+	buf    []byte
+	total  int64
+	spill  io.Writer
+	// spillErr is the error that stopped spilling, the output is still retained
+	spillErr error
+}
+
+func newLimitedBuffer(limits outputLimits, spill io.Writer) *limitedBuffer {
+	if limits.maxBytes <= 0 {
+		limits.maxBytes = maxRetainedOutputBytes
+	}
+	return &limitedBuffer{limits: limits, spill: spill}
+}
+
+// Write implements io.Writer
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	b.total += int64(n)
+
+	if b.spill != nil {
+		if _, err := b.spill.Write(p); err != nil {
+			b.spillErr = err
+			b.spill = nil
+		}
+	}
+
+	max := b.limits.maxBytes
+	switch {
+	case !b.limits.tail:
+		if room := max - int64(len(b.buf)); room > 0 {
+			if int64(len(p)) > room {
+				p = p[:room]
+			}
+			b.buf = append(b.buf, p...)
+		}
+	default:
+		b.buf = append(b.buf, p...)
+		// Compact lazily so the buffer never grows beyond twice the limit
+		if int64(len(b.buf)) > 2*max {
+			b.buf = append(b.buf[:0], b.buf[int64(len(b.buf))-max:]...)
+		}
+	}
+	return n, nil
+}
+
+// result returns the retained content and whether anything was dropped
+func (b *limitedBuffer) result() (string, bool) {
+	content := b.buf
+	truncated := false
+
+	if max := b.limits.maxBytes; max > 0 && int64(len(content)) > max {
+		content = content[int64(len(content))-max:]
+	}
+	if int64(len(content)) < b.total {
+		truncated = true
+	}
+
+	if b.limits.maxLines > 0 {
+		lines := bytes.SplitAfter(content, []byte("\n"))
+		if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+			lines = lines[:len(lines)-1]
+		}
+		if len(lines) > b.limits.maxLines {
+			if b.limits.tail {
+				lines = lines[len(lines)-b.limits.maxLines:]
+			} else {
+				lines = lines[:b.limits.maxLines]
+			}
+			content = bytes.Join(lines, nil)
+			truncated = true
+		}
+	}
+
+	return string(content), truncated
+}
+
+// outputSpill writes the full output of an exec to the box share directory, within what
+// is left of the share quota of the box
+type outputSpill struct {
+	stdout    *spillFile
+	stderr    *spillFile
+	stdoutURL string
+	stderrURL string
+
+	mu   sync.Mutex
+	room int64 // bytes both files may still grow by, -1 if unlimited
+}
+
+// spillFile is a spill file, the written part of a file that exceeded the quota is removed
+// on close
+type spillFile struct {
+	*os.File
+	spill    *outputSpill
+	exceeded bool
+}
+
+// newOutputSpill creates the spill files for an exec under <share>/<boxID>/exec
+func newOutputSpill(boxID string) (*outputSpill, error) {
+	baseDir := filepath.Join(config.GetInstance().File.Share, boxID, "exec")
+	room, err := share.Remaining(boxID)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output spill directory '%s': %w", baseDir, err)
+	}
+
+	prefix := fmt.Sprintf("exec_%s", time.Now().Format("20060102_150405.000000"))
+	prefix = strings.ReplaceAll(prefix, ".", "_")
+
+	spill := &outputSpill{room: room}
+	stdout, err := os.Create(filepath.Join(baseDir, prefix+"_stdout.log"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdout spill file: %w", err)
+	}
+	stderr, err := os.Create(filepath.Join(baseDir, prefix+"_stderr.log"))
+	if err != nil {
+		stdout.Close()
+		return nil, fmt.Errorf("failed to create stderr spill file: %w", err)
+	}
+	spill.stdout = &spillFile{File: stdout, spill: spill}
+	spill.stderr = &spillFile{File: stderr, spill: spill}
+
+	// Signed URLs like the ones of screenshots saved to the share directory
+	spill.stdoutURL, _ = share.SignURL(fmt.Sprintf("%s/exec/%s_stdout.log", boxID, prefix))
+	spill.stderrURL, _ = share.SignURL(fmt.Sprintf("%s/exec/%s_stderr.log", boxID, prefix))
+	return spill, nil
+}
+
+// reserve takes n bytes from the room left in the quota
+func (o *outputSpill) reserve(n int) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.room < 0 {
+		return nil
+	}
+	if int64(n) > o.room {
+		return fmt.Errorf("%w: %d bytes left for the exec output, %d more written", share.ErrQuotaExceeded, o.room, n)
+	}
+	o.room -= int64(n)
+	return nil
+}
+
+// Write implements io.Writer
+func (f *spillFile) Write(p []byte) (int, error) {
+	if err := f.spill.reserve(len(p)); err != nil {
+		f.exceeded = true
+		return 0, err
+	}
+	return f.File.Write(p)
+}
+
+// Close closes the file, removing it if it exceeded the quota
+func (f *spillFile) Close() error {
+	err := f.File.Close()
+	if f.exceeded {
+		if removeErr := os.Remove(f.Name()); err == nil {
+			err = removeErr
+		}
+	}
+	return err
+}
+
+// Close closes the spill files
+func (o *outputSpill) Close() error {
+	errOut := o.stdout.Close()
+	errErr := o.stderr.Close()
+	if errOut != nil {
+		return errOut
+	}
+	return errErr
+}
@@ -0,0 +1,175 @@
+package docker
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/babelcloud/gbox/packages/api-server/config"
+	"github.com/babelcloud/gbox/packages/api-server/internal/box/service"
+	"github.com/babelcloud/gbox/packages/api-server/internal/file/share"
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+func TestLimitedBuffer(t *testing.T) {
+	tests := []struct {
+		name          string
+		limits        outputLimits
+		writes        []string
+		wantContent   string
+		wantTruncated bool
+	}{
+		{
+			name:        "unlimited",
+			limits:      outputLimits{},
+			writes:      []string{"hello ", "world\n"},
+			wantContent: "hello world\n",
+		},
+		{
+			name:          "head bytes",
+			limits:        outputLimits{maxBytes: 5},
+			writes:        []string{"abc", "defgh", "ijk"},
+			wantContent:   "abcde",
+			wantTruncated: true,
+		},
+		{
+			name:          "tail bytes",
+			limits:        outputLimits{maxBytes: 4, tail: true},
+			writes:        []string{"abc", "defgh", "ijk"},
+			wantContent:   "hijk",
+			wantTruncated: true,
+		},
+		{
+			name:          "head lines",
+			limits:        outputLimits{maxLines: 2},
+			writes:        []string{"1\n2\n", "3\n4\n"},
+			wantContent:   "1\n2\n",
+			wantTruncated: true,
+		},
+		{
+			name:          "tail lines",
+			limits:        outputLimits{maxLines: 2, tail: true},
+			writes:        []string{"1\n2\n", "3\n4"},
+			wantContent:   "3\n4",
+			wantTruncated: true,
+		},
+		{
+			name:        "within limits",
+			limits:      outputLimits{maxBytes: 10, maxLines: 3},
+			writes:      []string{"1\n2\n"},
+			wantContent: "1\n2\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var spill bytes.Buffer
+			buf := newLimitedBuffer(tt.limits, &spill)
+
+			var all string
+			for _, w := range tt.writes {
+				n, err := buf.Write([]byte(w))
+				assert.NoError(t, err)
+				assert.Equal(t, len(w), n)
+				all += w
+			}
+
+			content, truncated := buf.result()
+			assert.Equal(t, tt.wantContent, content)
+			assert.Equal(t, tt.wantTruncated, truncated)
+			assert.Equal(t, int64(len(all)), buf.total)
+			assert.Equal(t, all, spill.String())
+		})
+	}
+}
+
+// failingWriter fails every write after the first n bytes
+type failingWriter struct {
+	n int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		return 0, errors.New("disk full")
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestResolveOutputLimits(t *testing.T) {
+	limits, err := resolveOutputLimits(10, 2, model.OutputRetentionTail)
+	require.NoError(t, err)
+	assert.Equal(t, outputLimits{maxBytes: 10, maxLines: 2, tail: true}, limits)
+
+	_, err = resolveOutputLimits(-1, 0, "")
+	assert.ErrorIs(t, err, service.ErrInvalidRequest)
+	_, err = resolveOutputLimits(0, -1, "")
+	assert.ErrorIs(t, err, service.ErrInvalidRequest)
+	_, err = resolveOutputLimits(0, 0, "middle")
+	assert.ErrorIs(t, err, service.ErrInvalidRequest)
+}
+
+func TestLimitedBufferSpillError(t *testing.T) {
+	buf := newLimitedBuffer(outputLimits{}, &failingWriter{n: 4})
+	for _, w := range []string{"abc", "defg", "hij"} {
+		n, err := buf.Write([]byte(w))
+		assert.NoError(t, err, "spill errors do not abort reading")
+		assert.Equal(t, len(w), n)
+	}
+
+	content, truncated := buf.result()
+	assert.Equal(t, "abcdefghij", content)
+	assert.False(t, truncated)
+	assert.EqualError(t, buf.spillErr, "disk full")
+}
+
+func TestLimitedBufferDefaultCap(t *testing.T) {
+	buf := newLimitedBuffer(outputLimits{}, nil)
+	chunk := bytes.Repeat([]byte("x"), 1<<20)
+	for i := 0; i < maxRetainedOutputBytes>>20+1; i++ {
+		_, err := buf.Write(chunk)
+		assert.NoError(t, err)
+	}
+
+	content, truncated := buf.result()
+	assert.Len(t, content, maxRetainedOutputBytes)
+	assert.True(t, truncated)
+}
+
+func TestOutputSpillQuota(t *testing.T) {
+	cfg := config.GetInstance()
+	savedShare, savedQuota := cfg.File.Share, cfg.File.ShareQuota
+	t.Cleanup(func() { cfg.File.Share, cfg.File.ShareQuota = savedShare, savedQuota })
+	cfg.File.Share = t.TempDir()
+	cfg.File.ShareQuota = 10
+
+	spill, err := newOutputSpill("box")
+	require.NoError(t, err)
+	stdout := newLimitedBuffer(outputLimits{}, spill.stdout)
+	stderr := newLimitedBuffer(outputLimits{}, spill.stderr)
+	_, err = stdout.Write([]byte("abcdef"))
+	require.NoError(t, err)
+	_, err = stderr.Write([]byte("ghijkl"))
+	require.NoError(t, err)
+	_, err = stdout.Write([]byte("mnop"))
+	require.NoError(t, err)
+
+	// Both streams share the quota, the one that exceeded it keeps being retained
+	assert.NoError(t, stdout.spillErr)
+	assert.ErrorIs(t, stderr.spillErr, share.ErrQuotaExceeded)
+	content, _ := stderr.result()
+	assert.Equal(t, "ghijkl", content)
+
+	require.NoError(t, spill.Close())
+	data, err := os.ReadFile(spill.stdout.Name())
+	require.NoError(t, err)
+	assert.Equal(t, "abcdefmnop", string(data))
+	_, err = os.Stat(spill.stderr.Name())
+	assert.True(t, os.IsNotExist(err), "the incomplete spill file is removed")
+	assert.Equal(t, filepath.Join(cfg.File.Share, "box", "exec"), filepath.Dir(spill.stdout.Name()))
+}
@@ -0,0 +1,298 @@
+package docker
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/google/uuid"
+
+	"github.com/babelcloud/gbox/packages/api-server/config"
+	"github.com/babelcloud/gbox/packages/api-server/internal/box/service"
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+const (
+	// watchHelperPrefix starts the path the gbox-watch helper is written to inside the box,
+	// which ends with the hash of the helper so a changed helper is installed again
+	watchHelperPrefix = "/tmp/gbox-watch-"
+	// watchHelperName is the file name of the helper next to the server executable
+	watchHelperName = "gbox-watch"
+	// watchHelperReady is the type of the line the helper prints once it watches
+	watchHelperReady = "ready"
+	// watchPollInterval is how often directories are listed when inotify is unavailable
+	watchPollInterval = time.Second
+)
+
+// watchHelper holds the gbox-watch binary, loaded once from the host, and its path in boxes
+var watchHelper struct {
+	once    sync.Once
+	content []byte
+	boxPath string
+	err     error
+}
+
+// loadWatchHelper reads the gbox-watch binary configured or found next to the server,
+// and returns it with the path it is installed at in boxes
+func loadWatchHelper() ([]byte, string, error) {
+	watchHelper.once.Do(func() {
+		helperPath := config.GetInstance().File.WatchHelper
+		if helperPath == "" {
+			executable, err := os.Executable()
+			if err != nil {
+				watchHelper.err = err
+				return
+			}
+			helperPath = filepath.Join(filepath.Dir(executable), watchHelperName)
+		}
+		watchHelper.content, watchHelper.err = os.ReadFile(helperPath)
+		sum := sha256.Sum256(watchHelper.content)
+		watchHelper.boxPath = watchHelperPrefix + hex.EncodeToString(sum[:8])
+	})
+	return watchHelper.content, watchHelper.boxPath, watchHelper.err
+}
+
+// WatchFiles implements Service.WatchFiles. Changes are reported by the gbox-watch
+// helper using inotify inside the box, or found by listing the directory every
+// watchPollInterval where the helper cannot run.
+func (s *Service) WatchFiles(ctx context.Context, id string, params *model.BoxFileWatchParams) (<-chan model.BoxFileEvent, error) {
+	// Update access time when watching files
+	s.accessTracker.Update(id)
+
+	containerID, err := s.getRunningContainerID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	root := resolveBoxPath(params.Path)
+	stat, err := s.client.ContainerStatPath(ctx, containerID, root)
+	if err != nil {
+		return nil, archiveError("failed to watch files", params.Path, err)
+	}
+	if !stat.Mode.IsDir() {
+		return nil, fmt.Errorf("%w: %s", service.ErrNotADirectory, root)
+	}
+
+	raw := make(chan model.BoxFileEvent)
+	started, err := s.startWatchHelper(ctx, id, containerID, root, params.Recursive, raw)
+	if err != nil {
+		return nil, err
+	}
+	if !started {
+		if err := s.startWatchPolling(ctx, id, containerID, root, params.Recursive, raw); err != nil {
+			return nil, err
+		}
+	}
+
+	events := make(chan model.BoxFileEvent)
+	go service.DebounceFileEvents(ctx, raw, events, params.Debounce)
+	return events, nil
+}
+
+// startWatchHelper runs the gbox-watch helper in the box and relays its events until ctx
+// is done. It reports false, so the caller can fall back to polling, if the helper is not
+// available or cannot watch with inotify in this box.
+func (s *Service) startWatchHelper(ctx context.Context, boxID, containerID, root string, recursive bool, events chan<- model.BoxFileEvent) (bool, error) {
+	helper, helperPath, err := loadWatchHelper()
+	if err != nil {
+		s.logger.Warn("gbox-watch helper unavailable, polling for file changes: %v", err)
+		return false, nil
+	}
+	if err := s.installWatchHelper(ctx, containerID, helper, helperPath); err != nil {
+		return false, err
+	}
+
+	cmd := []string{helperPath}
+	if recursive {
+		cmd = append(cmd, "-r")
+	}
+	// Tag the exec so the helper can be terminated with the processes of other execs
+	marker := uuid.NewString()
+	execConfig := types.ExecConfig{
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd:          append(cmd, root),
+		Env:          []string{fmt.Sprintf("%s=%s", execMarkerEnv, marker)},
+	}
+	execResp, err := s.client.ContainerExecCreate(ctx, containerID, execConfig)
+	if err != nil {
+		return false, fmt.Errorf("failed to create exec: %w", err)
+	}
+	attachResp, err := s.client.ContainerExecAttach(ctx, execResp.ID, types.ExecStartCheck{})
+	if err != nil {
+		return false, fmt.Errorf("failed to attach to exec: %w", err)
+	}
+
+	stdout, pw := io.Pipe()
+	var stderr bytes.Buffer
+	go func() {
+		s.collectOutput(attachResp.Reader, pw, &stderr)
+		pw.Close()
+	}()
+
+	// Closing the connection closes the stdin of the helper, which then exits
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stop:
+		}
+		attachResp.Close()
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), execKillGracePeriod+execCleanupTimeout)
+		defer cancel()
+		s.terminateExec(cleanupCtx, containerID, execResp.ID, marker)
+	}()
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	var ready model.BoxFileEvent
+	if !scanner.Scan() || json.Unmarshal(scanner.Bytes(), &ready) != nil || ready.Type != watchHelperReady {
+		close(stop)
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		// Wait for the output to be collected before reading stderr
+		io.Copy(io.Discard, stdout)
+		s.logger.Warn("gbox-watch helper failed in box %s, polling for file changes: %s", boxID, bytes.TrimSpace(stderr.Bytes()))
+		return false, nil
+	}
+
+	go func() {
+		defer close(events)
+		defer close(stop)
+		for scanner.Scan() {
+			var event model.BoxFileEvent
+			if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+				s.logger.Error("Error parsing gbox-watch event %q: %v", scanner.Text(), err)
+				continue
+			}
+			event.Time = time.Now()
+			select {
+			case events <- event:
+				s.accessTracker.Update(boxID)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return true, nil
+}
+
+// installWatchHelper copies the helper into the box through the archive API, unless it
+// is there already. The path names the hash of the helper, so a complete file at the path
+// is the same helper.
+func (s *Service) installWatchHelper(ctx context.Context, containerID string, helper []byte, helperPath string) error {
+	if stat, err := s.client.ContainerStatPath(ctx, containerID, helperPath); err == nil && stat.Size == int64(len(helper)) {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	header := newFileHeader(helperPath[1:], int64(len(helper)), 0755, 0, 0)
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := tw.Write(helper); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	if err := s.client.CopyToContainer(ctx, containerID, "/", &buf, types.CopyToContainerOptions{}); err != nil {
+		return fmt.Errorf("failed to install gbox-watch helper: %w", err)
+	}
+	return nil
+}
+
+// startWatchPolling lists the directory every watchPollInterval and relays the changes
+// between the listings until ctx is done or the directory is removed
+func (s *Service) startWatchPolling(ctx context.Context, boxID, containerID, root string, recursive bool, events chan<- model.BoxFileEvent) error {
+	snapshot, err := s.watchSnapshot(ctx, containerID, root, recursive)
+	if err != nil {
+		return err
+	}
+	if snapshot == nil {
+		return fmt.Errorf("%w: %s", service.ErrPathNotFound, root)
+	}
+
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(watchPollInterval)
+		defer ticker.Stop()
+
+		send := func(event model.BoxFileEvent) bool {
+			select {
+			case events <- event:
+				s.accessTracker.Update(boxID)
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+
+			next, err := s.watchSnapshot(ctx, containerID, root, recursive)
+			if err != nil {
+				if ctx.Err() == nil {
+					s.logger.Error("Error polling %s in box %s: %v", root, boxID, err)
+				}
+				return
+			}
+			if next == nil {
+				send(model.BoxFileEvent{Type: model.FileEventDelete, Path: root, IsDir: true, Time: time.Now()})
+				return
+			}
+
+			for _, event := range service.DiffFileSnapshots(snapshot, next, time.Now()) {
+				if !send(event) {
+					return
+				}
+			}
+			snapshot = next
+		}
+	}()
+	return nil
+}
+
+// watchSnapshot lists the states of the files under root, or returns nil if root is gone
+func (s *Service) watchSnapshot(ctx context.Context, containerID, root string, recursive bool) (map[string]service.FileState, error) {
+	script := `find "$1" -exec stat -c "$0" {} +`
+	if !recursive {
+		script = `find "$1" -maxdepth 1 -exec stat -c "$0" {} +`
+	}
+	outcome, err := s.runExec(ctx, containerID, execHelperConfig("sh", "-c", script, service.WatchSnapshotFormat, root),
+		execOptions{timeout: artifactScanTimeout})
+	if err != nil {
+		return nil, err
+	}
+	if outcome.exitCode == 127 {
+		return nil, fmt.Errorf("polling for file changes requires find and stat in the box: %s", outcome.stderr)
+	}
+
+	// Files that vanish during the listing make find fail, so only a missing root counts
+	snapshot := service.ParseFileSnapshot(outcome.stdout)
+	if _, ok := snapshot[root]; !ok {
+		return nil, nil
+	}
+	delete(snapshot, root)
+	return snapshot, nil
+}
@@ -0,0 +1,193 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+	utilexec "k8s.io/client-go/util/exec"
+
+	"github.com/babelcloud/gbox/packages/api-server/internal/box/service"
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+// StatFile describes a file in a box
+func (s *Service) StatFile(ctx context.Context, id string, params *model.BoxFileStatParams) (*model.BoxFile, error) {
+	return s.runFileOperation(ctx, id, service.StatOperation(params))
+}
+
+// MakeDir creates a directory in a box
+func (s *Service) MakeDir(ctx context.Context, id string, params *model.BoxFileMkdirParams) (*model.BoxFile, error) {
+	return s.runFileOperation(ctx, id, service.MkdirOperation(params))
+}
+
+// RemoveFile removes a file or directory in a box
+func (s *Service) RemoveFile(ctx context.Context, id string, params *model.BoxFileRemoveParams) (*model.BoxFileRemoveResult, error) {
+	if _, err := s.runFileOperation(ctx, id, service.RemoveOperation(params)); err != nil {
+		return nil, err
+	}
+	return &model.BoxFileRemoveResult{Message: fmt.Sprintf("%s removed successfully", params.Path)}, nil
+}
+
+// MoveFile moves a file or directory in a box
+func (s *Service) MoveFile(ctx context.Context, id string, params *model.BoxFileMoveParams) (*model.BoxFile, error) {
+	return s.runFileOperation(ctx, id, service.MoveOperation(params))
+}
+
+// CopyFile copies a file or directory in a box
+func (s *Service) CopyFile(ctx context.Context, id string, params *model.BoxFileCopyParams) (*model.BoxFile, error) {
+	return s.runFileOperation(ctx, id, service.CopyOperation(params))
+}
+
+// ChmodFile changes the permission of a file or directory in a box
+func (s *Service) ChmodFile(ctx context.Context, id string, params *model.BoxFileChmodParams) (*model.BoxFile, error) {
+	return s.runFileOperation(ctx, id, service.ChmodOperation(params))
+}
+
+// DownloadFile downloads a URL into a box. Pods are fetched from by the box itself, as
+// files cannot be written into them by the server yet.
+func (s *Service) DownloadFile(ctx context.Context, id string, params *model.BoxFileDownloadParams, progressWriter io.Writer) (*model.BoxFileDownloadResult, error) {
+	s.accessTracker.Update(id)
+
+	_, checksum, err := service.ValidateDownload(params)
+	if err != nil {
+		return nil, err
+	}
+	service.WriteDownloadProgress(progressWriter, model.ProgressStatusPrepare,
+		fmt.Sprintf("Downloading %s in the box", params.URL))
+
+	token := uuid.NewString()
+	op := service.DownloadOperation(params, service.DownloadLimit(params), checksum, token)
+	stopProgress := service.WatchDownloadProgress(ctx, service.DownloadTempPath(params.Path, token), progressWriter,
+		func(ctx context.Context, op *service.FileOperation) (string, error) {
+			stdout, stderr, exitCode, err := s.runPodCommand(ctx, id, op.Command())
+			if err != nil {
+				return "", err
+			}
+			return op.Output(exitCode, stdout, stderr)
+		})
+	stdout, stderr, exitCode, err := s.runPodCommand(ctx, id, op.Command())
+	stopProgress()
+	if err != nil {
+		return nil, err
+	}
+	output, err := op.Output(exitCode, stdout, stderr)
+	if err != nil {
+		return nil, err
+	}
+	result, err := service.ParseDownloadOutput(params.Path, output)
+	if err != nil {
+		return nil, err
+	}
+
+	service.WriteDownloadProgress(progressWriter, model.ProgressStatusComplete,
+		fmt.Sprintf("Downloaded %d bytes to %s", result.Size, result.Path))
+	return result, nil
+}
+
+// ListFiles implements Service.ListFiles
+func (s *Service) ListFiles(ctx context.Context, id string, params *model.BoxFileListParams) (*model.BoxFileListResult, error) {
+	s.accessTracker.Update(id)
+
+	op := service.ListOperation(params)
+	stdout, stderr, exitCode, err := s.runPodCommand(ctx, id, op.Command())
+	if err != nil {
+		return nil, err
+	}
+	output, err := op.Output(exitCode, stdout, stderr)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := service.ParseFileList(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse file list: %w", err)
+	}
+	return service.ListFilesResult(files, params)
+}
+
+// FileManifest implements Service.FileManifest
+func (s *Service) FileManifest(ctx context.Context, id string, params *model.BoxFileManifestParams) (*model.BoxFileManifest, error) {
+	s.accessTracker.Update(id)
+
+	return service.RunFileManifest(params, func(op *service.FileOperation) (string, error) {
+		stdout, stderr, exitCode, err := s.runPodCommand(ctx, id, op.Command())
+		if err != nil {
+			return "", err
+		}
+		return op.Output(exitCode, stdout, stderr)
+	})
+}
+
+// runFileOperation runs a file operation script in the pod of a running box
+func (s *Service) runFileOperation(ctx context.Context, id string, op *service.FileOperation) (*model.BoxFile, error) {
+	s.accessTracker.Update(id)
+
+	stdout, stderr, exitCode, err := s.runPodCommand(ctx, id, op.Command())
+	if err != nil {
+		return nil, err
+	}
+	return op.Result(exitCode, stdout, stderr)
+}
+
+// runPodCommand runs a command in the pod of a running box and returns its output and exit code
+func (s *Service) runPodCommand(ctx context.Context, id string, cmd []string) (string, string, int, error) {
+	return s.runPodCommandWithInput(ctx, id, cmd, "")
+}
+
+// runPodCommandWithInput runs a command like runPodCommand, feeding stdin to it if it is not empty
+func (s *Service) runPodCommandWithInput(ctx context.Context, id string, cmd []string, stdin string) (string, string, int, error) {
+	pods, err := s.client.CoreV1().Pods(tenantNamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=gbox,%s=%s", labelName, labelInstance, id),
+	})
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to list pods: %v", err)
+	}
+	if len(pods.Items) == 0 {
+		return "", "", 0, fmt.Errorf("%w: %s", service.ErrBoxNotFound, id)
+	}
+	pod := pods.Items[0]
+	if pod.Status.Phase != corev1.PodRunning {
+		return "", "", 0, fmt.Errorf("%w: %s", service.ErrBoxNotRunning, id)
+	}
+
+	execURL := s.client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(tenantNamespace).
+		Name(pod.Name).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Command: cmd,
+			Stdin:   stdin != "",
+			Stdout:  true,
+			Stderr:  true,
+		}, scheme.ParameterCodec).
+		URL()
+	executor, err := remotecommand.NewSPDYExecutor(s.config, "POST", execURL)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to create executor: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	streamOptions := remotecommand.StreamOptions{Stdout: &stdout, Stderr: &stderr}
+	if stdin != "" {
+		streamOptions.Stdin = strings.NewReader(stdin)
+	}
+	err = executor.Stream(streamOptions)
+	var exitErr utilexec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		return stdout.String(), stderr.String(), exitErr.ExitStatus(), nil
+	case err != nil:
+		return "", "", 0, fmt.Errorf("failed to execute command: %v", err)
+	}
+	return stdout.String(), stderr.String(), 0, nil
+}
@@ -0,0 +1,59 @@
+package k8s
+
+import (
+	"context"
+
+	"github.com/babelcloud/gbox/packages/api-server/internal/box/service"
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+// GitClone implements Service.GitClone
+func (s *Service) GitClone(ctx context.Context, id string, params *model.BoxGitCloneParams) (*model.BoxGitCloneResult, error) {
+	op, err := service.GitCloneOperation(params)
+	if err != nil {
+		return nil, err
+	}
+	output, err := s.gitOutput(ctx, id, op)
+	if err != nil {
+		return nil, err
+	}
+	return service.ParseGitClone(output)
+}
+
+// GitStatus implements Service.GitStatus
+func (s *Service) GitStatus(ctx context.Context, id string, params *model.BoxGitStatusParams) (*model.BoxGitStatus, error) {
+	output, err := s.gitOutput(ctx, id, service.GitStatusOperation(params))
+	if err != nil {
+		return nil, err
+	}
+	return service.ParseGitStatus(output)
+}
+
+// GitDiff implements Service.GitDiff
+func (s *Service) GitDiff(ctx context.Context, id string, params *model.BoxGitDiffParams) (*model.BoxGitDiff, error) {
+	output, err := s.gitOutput(ctx, id, service.GitDiffOperation(params))
+	if err != nil {
+		return nil, err
+	}
+	return service.ParseGitDiff(output)
+}
+
+// GitCommit implements Service.GitCommit
+func (s *Service) GitCommit(ctx context.Context, id string, params *model.BoxGitCommitParams) (*model.BoxGitCommitResult, error) {
+	output, err := s.gitOutput(ctx, id, service.GitCommitOperation(params))
+	if err != nil {
+		return nil, err
+	}
+	return service.ParseGitCommit(output)
+}
+
+// gitOutput runs a git operation in the pod of a running box and returns its output
+func (s *Service) gitOutput(ctx context.Context, id string, op *service.FileOperation) (string, error) {
+	s.accessTracker.Update(id)
+
+	stdout, stderr, exitCode, err := s.runPodCommandWithInput(ctx, id, op.Command(), op.Stdin())
+	if err != nil {
+		return "", err
+	}
+	return op.Output(exitCode, stdout, stderr)
+}
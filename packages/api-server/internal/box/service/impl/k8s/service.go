@@ -1,12 +1,14 @@
 package k8s
 
 import (
+	"archive/tar"
 	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/url"
+	"path"
 	"strconv"
 	"strings"
 	"time"
@@ -23,6 +25,7 @@ import (
 
 	"github.com/babelcloud/gbox/packages/api-server/config"
 	"github.com/babelcloud/gbox/packages/api-server/internal/box/service"
+	"github.com/babelcloud/gbox/packages/api-server/internal/file/share"
 	"github.com/babelcloud/gbox/packages/api-server/internal/tracker"
 	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
 	"github.com/babelcloud/gbox/packages/api-server/pkg/id"
@@ -243,12 +246,23 @@ func (s *Service) Delete(ctx context.Context, id string, req *model.BoxDeletePar
 	if err != nil {
 		return nil, fmt.Errorf("failed to delete deployment: %v", err)
 	}
+	if !req.KeepShare {
+		s.removeShareDir(id)
+	}
 
 	return &model.BoxDeleteResult{
 		Message: "Box deleted successfully",
 	}, nil
 }
 
+// removeShareDir removes the share directory of a deleted box. The box is gone already,
+// so failures are only logged and left to the file reclamation.
+func (s *Service) removeShareDir(boxID string) {
+	if err := share.RemoveBox(boxID); err != nil {
+		s.logger.Error("Failed to remove share directory of box %s: %v", boxID, err)
+	}
+}
+
 // DeleteAll deletes all boxes
 func (s *Service) DeleteAll(ctx context.Context, req *model.BoxesDeleteParams) (*model.BoxesDeleteResult, error) {
 	// List all deployments with gbox label
@@ -268,6 +282,9 @@ func (s *Service) DeleteAll(ctx context.Context, req *model.BoxesDeleteParams) (
 		}
 		deletedIDs = append(deletedIDs, deployment.Labels[labelInstance])
 		s.accessTracker.Remove(deployment.Labels[labelInstance])
+		if !req.KeepShare {
+			s.removeShareDir(deployment.Labels[labelInstance])
+		}
 	}
 
 	return &model.BoxesDeleteResult{
@@ -377,6 +394,40 @@ func (s *Service) RunCode(ctx context.Context, id string, req *model.BoxRunCodeP
 	return nil, fmt.Errorf("run-code operation not implemented for K8s")
 }
 
+// RunCodeLanguages lists the run-code languages; probing a box is not implemented for K8s
+func (s *Service) RunCodeLanguages(ctx context.Context, params *model.RunCodeLanguageListParams) (*model.RunCodeLanguageListResult, error) {
+	if params.BoxID != "" {
+		return nil, fmt.Errorf("run-code language probing not implemented for K8s")
+	}
+	return &model.RunCodeLanguageListResult{Languages: service.Languages().List()}, nil
+}
+
+// Changes lists the changes to the filesystem of a box (Not Implemented for K8s, which has
+// no equivalent of the container diff of Docker)
+func (s *Service) Changes(ctx context.Context, id string, params *model.BoxChangesParams) (*model.BoxChanges, error) {
+	return nil, fmt.Errorf("changes operation not implemented for K8s")
+}
+
+// ExportChanges exports the changes to the filesystem of a box (Not Implemented for K8s)
+func (s *Service) ExportChanges(ctx context.Context, id string, params *model.BoxChangesParams) (*model.BoxChanges, io.ReadCloser, error) {
+	return nil, nil, fmt.Errorf("export changes operation not implemented for K8s")
+}
+
+// ListKernels lists the kernels of a box (Not Implemented for K8s)
+func (s *Service) ListKernels(ctx context.Context, id string) (*model.BoxKernelListResult, error) {
+	return nil, fmt.Errorf("list kernels operation not implemented for K8s")
+}
+
+// InterruptKernel interrupts a kernel (Not Implemented for K8s)
+func (s *Service) InterruptKernel(ctx context.Context, id, kernelID string) (*model.BoxKernel, error) {
+	return nil, fmt.Errorf("interrupt kernel operation not implemented for K8s")
+}
+
+// RestartKernel restarts a kernel (Not Implemented for K8s)
+func (s *Service) RestartKernel(ctx context.Context, id, kernelID string) (*model.BoxKernel, error) {
+	return nil, fmt.Errorf("restart kernel operation not implemented for K8s")
+}
+
 // ExecWS executes a command in a box via WebSocket (Not Implemented for K8s)
 func (s *Service) ExecWS(ctx context.Context, id string, params *model.BoxExecWSParams, wsConn *websocket.Conn) (*model.BoxExecResult, error) {
 	// Close the WebSocket immediately as K8s implementation doesn't support it
@@ -427,8 +478,15 @@ func (s *Service) GetArchive(ctx context.Context, id string, req *model.BoxArchi
 		return nil, nil, fmt.Errorf("box is not running: %s", id)
 	}
 
-	// Create command to get file/directory
-	cmd := []string{"tar", "czf", "-", req.Path}
+	// Archive the file or directory uncompressed under its base name, like Docker does.
+	// The handler compresses the response when asked to. The root has no base name,
+	// so its content is archived instead.
+	p := path.Clean(req.Path)
+	base := path.Base(p)
+	if p == "/" {
+		base = "."
+	}
+	cmd := []string{"tar", "cf", "-", "-C", path.Dir(p), base}
 	exec, err := s.client.CoreV1().RESTClient().Post().
 		Resource("pods").
 		Namespace(tenantNamespace).
@@ -553,7 +611,7 @@ func (s *Service) ExtractArchive(ctx context.Context, id string, req *model.BoxA
 	}
 
 	// Create command to extract archive
-	cmd := []string{"tar", "xzf", "-", "-C", req.Path}
+	cmd := []string{"tar", "xf", "-", "-C", req.Path}
 	exec, err := s.client.CoreV1().RESTClient().Post().
 		Resource("pods").
 		Namespace(tenantNamespace).
@@ -588,7 +646,7 @@ func (s *Service) ExtractArchive(ctx context.Context, id string, req *model.BoxA
 
 	// Execute the command with stdin from request body
 	err = executor.Stream(remotecommand.StreamOptions{
-		Stdin:  bytes.NewReader(req.Content),
+		Stdin:  req.Reader,
 		Stdout: &stdout,
 		Stderr: &stderr,
 		Tty:    false,
@@ -871,11 +929,6 @@ func (s *Service) BoxActionType(ctx context.Context, id string, params *model.Bo
 	return nil, nil
 }
 
-func (s *Service) ListFiles(ctx context.Context, id string, params *model.BoxFileListParams) (*model.BoxFileListResult, error) {
-	// unimplemented
-	return nil, nil
-}
-
 func (s *Service) ReadFile(ctx context.Context, id string, params *model.BoxFileReadParams) (*model.BoxFileReadResult, error) {
 	// unimplemented
 	return nil, nil
@@ -886,6 +939,91 @@ func (s *Service) WriteFile(ctx context.Context, id string, params *model.BoxFil
 	return nil, nil
 }
 
+// EditFile edits a text file in a box, reading and rewriting it through the archive methods
+func (s *Service) EditFile(ctx context.Context, id string, params *model.BoxFileEditParams) (*model.BoxFileEditResult, error) {
+	filePath := service.ResolveBoxPath(params.Path)
+	_, reader, err := s.GetArchive(ctx, id, &model.BoxArchiveGetParams{Path: filePath})
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	tr := tar.NewReader(reader)
+	header, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive of %s: %v", params.Path, err)
+	}
+	if header.Typeflag != tar.TypeReg {
+		return nil, fmt.Errorf("%w: %s", service.ErrNotAFile, params.Path)
+	}
+	if limit := config.GetInstance().File.MaxReadBytes; limit > 0 && header.Size > limit {
+		return nil, fmt.Errorf("%w: %s is %d bytes, the limit is %d bytes", service.ErrFileTooLarge, params.Path, header.Size, limit)
+	}
+	original, err := io.ReadAll(tr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %v", params.Path, err)
+	}
+
+	edited, result, err := service.EditFileContent(original, params)
+	if err != nil {
+		return nil, err
+	}
+	if params.DryRun || !result.Changed {
+		return result, nil
+	}
+
+	// Rewrite the file with the mode and owner it had
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     path.Base(filePath),
+		Size:     int64(len(edited)),
+		Mode:     header.Mode,
+		Uid:      header.Uid,
+		Gid:      header.Gid,
+		ModTime:  time.Now(),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to build archive: %v", err)
+	}
+	if _, err := tw.Write([]byte(edited)); err != nil {
+		return nil, fmt.Errorf("failed to build archive: %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to build archive: %v", err)
+	}
+
+	if err := s.ExtractArchive(ctx, id, &model.BoxArchiveExtractParams{
+		Path:   path.Dir(filePath),
+		Reader: &buf,
+	}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SearchFiles searches the files under a directory in a box, which lists the files and
+// archives the ones whose contents are searched
+func (s *Service) SearchFiles(ctx context.Context, id string, params *model.BoxFileSearchParams) (*model.BoxFileSearchResult, error) {
+	search, err := service.NewFileSearch(service.ResolveBoxPath(params.Path), params)
+	if err != nil {
+		return nil, err
+	}
+	s.accessTracker.Update(id)
+	return search.Run(func(op *service.FileOperation) (string, error) {
+		stdout, stderr, exitCode, err := s.runPodCommand(ctx, id, op.Command())
+		if err != nil {
+			return "", err
+		}
+		return op.Output(exitCode, stdout, stderr)
+	})
+}
+
+// WatchFiles is not implemented for K8s
+func (s *Service) WatchFiles(ctx context.Context, id string, params *model.BoxFileWatchParams) (<-chan model.BoxFileEvent, error) {
+	return nil, fmt.Errorf("file watch operation not implemented for K8s")
+}
+
 func init() {
 	service.Register("k8s", func(tracker tracker.AccessTracker) (service.BoxService, error) {
 		return NewService(tracker)
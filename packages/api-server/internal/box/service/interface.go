@@ -29,6 +29,12 @@ type BoxService interface {
 	Exec(ctx context.Context, id string, params *model.BoxExecParams) (*model.BoxExecResult, error)
 	ExecWS(ctx context.Context, id string, params *model.BoxExecWSParams, wsConn *websocket.Conn) (*model.BoxExecResult, error)
 	RunCode(ctx context.Context, id string, params *model.BoxRunCodeParams) (*model.BoxRunCodeResult, error)
+	RunCodeLanguages(ctx context.Context, params *model.RunCodeLanguageListParams) (*model.RunCodeLanguageListResult, error)
+
+	// Box kernel operations
+	ListKernels(ctx context.Context, id string) (*model.BoxKernelListResult, error)
+	InterruptKernel(ctx context.Context, id, kernelID string) (*model.BoxKernel, error)
+	RestartKernel(ctx context.Context, id, kernelID string) (*model.BoxKernel, error)
 
 	// Box file operations
 	GetArchive(ctx context.Context, id string, params *model.BoxArchiveGetParams) (*model.BoxArchiveResult, io.ReadCloser, error)
@@ -37,8 +43,34 @@ type BoxService interface {
 
 	// Box filesystem operations
 	ListFiles(ctx context.Context, id string, params *model.BoxFileListParams) (*model.BoxFileListResult, error)
+	FileManifest(ctx context.Context, id string, params *model.BoxFileManifestParams) (*model.BoxFileManifest, error)
 	ReadFile(ctx context.Context, id string, params *model.BoxFileReadParams) (*model.BoxFileReadResult, error)
 	WriteFile(ctx context.Context, id string, params *model.BoxFileWriteParams) (*model.BoxFileWriteResult, error)
+	EditFile(ctx context.Context, id string, params *model.BoxFileEditParams) (*model.BoxFileEditResult, error)
+	SearchFiles(ctx context.Context, id string, params *model.BoxFileSearchParams) (*model.BoxFileSearchResult, error)
+	StatFile(ctx context.Context, id string, params *model.BoxFileStatParams) (*model.BoxFile, error)
+	MakeDir(ctx context.Context, id string, params *model.BoxFileMkdirParams) (*model.BoxFile, error)
+	RemoveFile(ctx context.Context, id string, params *model.BoxFileRemoveParams) (*model.BoxFileRemoveResult, error)
+	MoveFile(ctx context.Context, id string, params *model.BoxFileMoveParams) (*model.BoxFile, error)
+	CopyFile(ctx context.Context, id string, params *model.BoxFileCopyParams) (*model.BoxFile, error)
+	ChmodFile(ctx context.Context, id string, params *model.BoxFileChmodParams) (*model.BoxFile, error)
+	// DownloadFile downloads a URL into a box, writing progress to progressWriter if it is not nil
+	DownloadFile(ctx context.Context, id string, params *model.BoxFileDownloadParams, progressWriter io.Writer) (*model.BoxFileDownloadResult, error)
+	// WatchFiles streams the debounced changes to a directory until ctx is done
+	WatchFiles(ctx context.Context, id string, params *model.BoxFileWatchParams) (<-chan model.BoxFileEvent, error)
+
+	// Box changes operations
+	// Changes lists the paths added, modified and deleted in a box since it was created
+	Changes(ctx context.Context, id string, params *model.BoxChangesParams) (*model.BoxChanges, error)
+	// ExportChanges lists the changes of a box like Changes, along with a tar archive of the
+	// added and modified paths relative to "/"; the caller must close the archive
+	ExportChanges(ctx context.Context, id string, params *model.BoxChangesParams) (*model.BoxChanges, io.ReadCloser, error)
+
+	// Git operations
+	GitClone(ctx context.Context, id string, params *model.BoxGitCloneParams) (*model.BoxGitCloneResult, error)
+	GitStatus(ctx context.Context, id string, params *model.BoxGitStatusParams) (*model.BoxGitStatus, error)
+	GitDiff(ctx context.Context, id string, params *model.BoxGitDiffParams) (*model.BoxGitDiff, error)
+	GitCommit(ctx context.Context, id string, params *model.BoxGitCommitParams) (*model.BoxGitCommitResult, error)
 
 	// Box image operations
 	UpdateBoxImage(ctx context.Context, params *model.ImageUpdateParams) (*model.ImageUpdateResponse, error)
@@ -80,6 +112,9 @@ func New(name string, tracker tracker.AccessTracker) (BoxService, error) {
 	if !ok {
 		return nil, fmt.Errorf("unknown box service implementation: %s", name)
 	}
+	if err := LoadLanguages(); err != nil {
+		return nil, err
+	}
 	// Pass the tracker to the factory function
 	return factory(tracker)
 }
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/babelcloud/gbox/packages/api-server/config"
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+// Placeholders in run-code command templates
+const (
+	CodeFilePlaceholder = "{file}"
+	CodePlaceholder     = "{code}"
+)
+
+// builtinLanguages are the run-code languages available without configuration
+var builtinLanguages = []model.RunCodeLanguage{
+	{Name: "python3", Aliases: []string{"python"}, Extension: ".py", Command: []string{"python3"}, Mode: model.CodeModeStdin, Requires: []string{"python3"}},
+	{Name: "typescript", Aliases: []string{"ts"}, Extension: ".ts", Command: []string{"npx", "ts-node"}, Mode: model.CodeModeStdin, Requires: []string{"npx"}},
+	{Name: "bash", Aliases: []string{"sh"}, Extension: ".sh", Command: []string{"sh", "-c", CodePlaceholder}, Mode: model.CodeModeArg, Requires: []string{"sh"}},
+	{Name: "javascript", Aliases: []string{"node", "js"}, Extension: ".js", Command: []string{"node"}, Mode: model.CodeModeStdin, Requires: []string{"node"}},
+	{Name: "deno", Extension: ".ts", Command: []string{"deno", "run", "--allow-all", CodeFilePlaceholder}, Mode: model.CodeModeFile, Requires: []string{"deno"}},
+	{Name: "go", Aliases: []string{"golang"}, Extension: ".go", Command: []string{"go", "run", CodeFilePlaceholder}, Mode: model.CodeModeFile, Requires: []string{"go"}},
+	{Name: "ruby", Aliases: []string{"rb"}, Extension: ".rb", Command: []string{"ruby"}, Mode: model.CodeModeStdin, Requires: []string{"ruby"}},
+	{Name: "php", Extension: ".php", Command: []string{"php"}, Mode: model.CodeModeStdin, Requires: []string{"php"}},
+	{Name: "r", Aliases: []string{"R"}, Extension: ".R", Command: []string{"Rscript", CodeFilePlaceholder}, Mode: model.CodeModeFile, Requires: []string{"Rscript"}},
+}
+
+// LanguageRegistry resolves run-code languages by name or alias
+type LanguageRegistry struct {
+	languages []model.RunCodeLanguage
+	byName    map[string]int
+}
+
+var (
+	languages     *LanguageRegistry
+	languagesErr  error
+	languagesOnce sync.Once
+)
+
+// LoadLanguages builds the run-code language registry from the built-ins and the
+// configuration, so that an invalid configuration is reported when the service starts
+func LoadLanguages() error {
+	languagesOnce.Do(func() {
+		languages, languagesErr = NewLanguageRegistry(config.GetInstance().RunCode.Languages)
+		if languagesErr != nil {
+			languagesErr = fmt.Errorf("failed to load run-code languages: %w", languagesErr)
+		}
+	})
+	return languagesErr
+}
+
+// Languages returns the run-code language registry. If the configuration is invalid,
+// which LoadLanguages reports, only the built-in languages are available.
+func Languages() *LanguageRegistry {
+	if err := LoadLanguages(); err != nil {
+		builtins, _ := NewLanguageRegistry(nil)
+		return builtins
+	}
+	return languages
+}
+
+// NewLanguageRegistry creates a registry of the built-in languages, extended or overridden by configured ones
+func NewLanguageRegistry(configured []config.LanguageConfig) (*LanguageRegistry, error) {
+	r := &LanguageRegistry{byName: make(map[string]int)}
+	for _, lang := range builtinLanguages {
+		r.add(lang)
+	}
+
+	for _, c := range configured {
+		lang := model.RunCodeLanguage{
+			Name:      c.Name,
+			Aliases:   c.Aliases,
+			Extension: c.Extension,
+			Command:   c.Command,
+			Mode:      c.Mode,
+			Requires:  c.Requires,
+		}
+		if lang.Mode == "" {
+			lang.Mode = model.CodeModeFile
+		}
+		if err := validateLanguage(lang); err != nil {
+			return nil, err
+		}
+		r.add(lang)
+	}
+	return r, nil
+}
+
+// add registers a language, replacing any language with the same name
+func (r *LanguageRegistry) add(lang model.RunCodeLanguage) {
+	replaced := false
+	for i := range r.languages {
+		if r.languages[i].Name == lang.Name {
+			r.languages[i] = lang
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		r.languages = append(r.languages, lang)
+	}
+
+	// Names take precedence over aliases
+	r.byName = make(map[string]int, len(r.languages))
+	for i, l := range r.languages {
+		r.byName[l.Name] = i
+	}
+	for i, l := range r.languages {
+		for _, alias := range l.Aliases {
+			if _, ok := r.byName[alias]; !ok {
+				r.byName[alias] = i
+			}
+		}
+	}
+}
+
+// validateLanguage checks that a configured language is usable
+func validateLanguage(lang model.RunCodeLanguage) error {
+	if lang.Name == "" {
+		return fmt.Errorf("run-code language without a name")
+	}
+	if len(lang.Command) == 0 {
+		return fmt.Errorf("run-code language %s has no command", lang.Name)
+	}
+
+	template := strings.Join(lang.Command, " ")
+	switch lang.Mode {
+	case model.CodeModeStdin:
+	case model.CodeModeFile:
+		if !strings.Contains(template, CodeFilePlaceholder) {
+			return fmt.Errorf("run-code language %s uses file mode but its command has no %s", lang.Name, CodeFilePlaceholder)
+		}
+	case model.CodeModeArg:
+		if !strings.Contains(template, CodePlaceholder) {
+			return fmt.Errorf("run-code language %s uses arg mode but its command has no %s", lang.Name, CodePlaceholder)
+		}
+	default:
+		return fmt.Errorf("run-code language %s has unsupported mode: %s", lang.Name, lang.Mode)
+	}
+	return nil
+}
+
+// Lookup returns the language with the given name or alias
+func (r *LanguageRegistry) Lookup(name string) (model.RunCodeLanguage, bool) {
+	idx, ok := r.byName[name]
+	if !ok {
+		return model.RunCodeLanguage{}, false
+	}
+	return r.languages[idx], true
+}
+
+// List returns all languages sorted by name
+func (r *LanguageRegistry) List() []model.RunCodeLanguage {
+	list := make([]model.RunCodeLanguage, len(r.languages))
+	copy(list, r.languages)
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// BuildCommand expands the command template of a language. scriptPath replaces {file}
+// and is appended when the template has no placeholder for it; code replaces {code}.
+func BuildCommand(lang model.RunCodeLanguage, scriptPath, code string) []string {
+	cmd := make([]string, 0, len(lang.Command)+1)
+	usedFile := false
+	for _, arg := range lang.Command {
+		if strings.Contains(arg, CodeFilePlaceholder) {
+			usedFile = true
+		}
+		arg = strings.ReplaceAll(arg, CodeFilePlaceholder, scriptPath)
+		arg = strings.ReplaceAll(arg, CodePlaceholder, code)
+		cmd = append(cmd, arg)
+	}
+	if scriptPath != "" && !usedFile {
+		cmd = append(cmd, scriptPath)
+	}
+	return cmd
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/babelcloud/gbox/packages/api-server/config"
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLanguageRegistry(t *testing.T) {
+	registry, err := NewLanguageRegistry([]config.LanguageConfig{
+		{Name: "lua", Extension: ".lua", Command: []string{"lua", "{file}"}, Requires: []string{"lua"}},
+		{Name: "python3", Extension: ".py", Command: []string{"python3.12"}, Mode: model.CodeModeStdin},
+	})
+	assert.NoError(t, err)
+
+	lua, ok := registry.Lookup("lua")
+	assert.True(t, ok)
+	assert.Equal(t, model.CodeModeFile, lua.Mode)
+
+	// Configured languages replace built-ins and drop their aliases
+	python, ok := registry.Lookup("python3")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"python3.12"}, python.Command)
+	_, ok = registry.Lookup("python")
+	assert.False(t, ok)
+
+	node, ok := registry.Lookup("node")
+	assert.True(t, ok)
+	assert.Equal(t, "javascript", node.Name)
+
+	_, err = NewLanguageRegistry([]config.LanguageConfig{{Name: "bad", Command: []string{"bad"}, Mode: model.CodeModeArg}})
+	assert.Error(t, err)
+}
+
+func TestBuildCommand(t *testing.T) {
+	registry, err := NewLanguageRegistry(nil)
+	assert.NoError(t, err)
+
+	goLang, _ := registry.Lookup("go")
+	assert.Equal(t, []string{"go", "run", "/tmp/main.go"}, BuildCommand(goLang, "/tmp/main.go", "package main"))
+
+	bash, _ := registry.Lookup("bash")
+	assert.Equal(t, []string{"sh", "-c", "echo hi"}, BuildCommand(bash, "", "echo hi"))
+
+	python, _ := registry.Lookup("python3")
+	assert.Equal(t, []string{"python3"}, BuildCommand(python, "", "print(1)"))
+	assert.Equal(t, []string{"python3", "/tmp/a.py"}, BuildCommand(python, "/tmp/a.py", "print(1)"))
+}
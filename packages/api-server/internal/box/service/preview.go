@@ -0,0 +1,265 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gabriel-vasile/mimetype"
+	"golang.org/x/image/draw"
+
+	// Decoders of the image formats previewed besides JPEG and PNG
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+const (
+	// DefaultPreviewRows is the number of CSV rows or JSON items previewed when none is requested
+	DefaultPreviewRows = 100
+	// DefaultPreviewPages is the number of document pages extracted when none is requested
+	DefaultPreviewPages = 50
+	// downscaledJPEGQuality is the quality downscaled JPEG images are encoded with
+	downscaledJPEGQuality = 85
+	// maxDownscalePixels is the largest image, in pixels, decoded to be downscaled
+	maxDownscalePixels = 64 << 20
+)
+
+// PreviewFile converts the whole content of a file by its detected type for the auto read
+// format: images are returned as base64 with their dimensions, documents as the text of
+// their pages, CSV files and spreadsheets as tables and JSON as parsed values. Content of
+// any other type is returned as text, or base64 if it is not valid UTF-8.
+func PreviewFile(p string, content []byte, params *model.BoxFileReadParams) (*model.BoxFileReadResult, error) {
+	mime := mimetype.Detect(content)
+	result := &model.BoxFileReadResult{
+		MimeType: mime.String(),
+		Size:     int64(len(content)),
+	}
+
+	var err error
+	ext := strings.ToLower(path.Ext(p))
+	switch {
+	case isMime(mime, "image/png", "image/jpeg", "image/gif", "image/webp", "image/bmp", "image/tiff"):
+		err = previewImage(result, content, params.MaxDimension)
+	case isMime(mime, "application/pdf"):
+		err = previewPDF(result, content, pageLimit(params))
+	case isMime(mime, mimeDOCX):
+		err = previewDOCX(result, content)
+	case isMime(mime, mimePPTX):
+		err = previewPPTX(result, content, pageLimit(params))
+	case isMime(mime, mimeXLSX):
+		err = previewXLSX(result, content, rowLimit(params))
+	case isMime(mime, "text/csv") || (isText(mime) && ext == ".csv"):
+		err = previewCSV(result, content, ',', rowLimit(params))
+	case isMime(mime, "text/tab-separated-values") || (isText(mime) && ext == ".tsv"):
+		err = previewCSV(result, content, '\t', rowLimit(params))
+	case isMime(mime, "application/x-ndjson") || (isText(mime) && (ext == ".jsonl" || ext == ".ndjson")):
+		err = previewJSONLines(result, content, rowLimit(params))
+	case isMime(mime, "application/json") || (isText(mime) && ext == ".json"):
+		err = previewJSON(result, content, rowLimit(params))
+	case utf8.Valid(content):
+		result.Kind = model.FileKindText
+		result.Encoding = model.FileEncodingUTF8
+		result.Content = string(content)
+	default:
+		result.Kind = model.FileKindBinary
+		result.Encoding = model.FileEncodingBase64
+		result.Content = base64.StdEncoding.EncodeToString(content)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s is not a valid %s: %v", ErrInvalidContent, p, mime.String(), err)
+	}
+	return result, nil
+}
+
+// isMime reports whether the detected type is one of the types or an alias or subtype of one
+func isMime(mime *mimetype.MIME, types ...string) bool {
+	for m := mime; m != nil; m = m.Parent() {
+		for _, t := range types {
+			if m.Is(t) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isText(mime *mimetype.MIME) bool {
+	return isMime(mime, "text/plain")
+}
+
+func rowLimit(params *model.BoxFileReadParams) int {
+	if params.MaxRows > 0 {
+		return params.MaxRows
+	}
+	return DefaultPreviewRows
+}
+
+func pageLimit(params *model.BoxFileReadParams) int {
+	if params.MaxPages > 0 {
+		return params.MaxPages
+	}
+	return DefaultPreviewPages
+}
+
+// previewImage returns the image as base64 with its dimensions, downscaled to fit
+// maxDimension if it is larger. Downscaled images are encoded as JPEG if the original
+// is one and as PNG otherwise.
+func previewImage(result *model.BoxFileReadResult, content []byte, maxDimension int) error {
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	info := &model.BoxFileImage{
+		Width:          config.Width,
+		Height:         config.Height,
+		OriginalWidth:  config.Width,
+		OriginalHeight: config.Height,
+	}
+	result.Kind = model.FileKindImage
+	result.Encoding = model.FileEncodingBase64
+	result.Image = info
+
+	if maxDimension <= 0 || (config.Width <= maxDimension && config.Height <= maxDimension) {
+		result.Content = base64.StdEncoding.EncodeToString(content)
+		return nil
+	}
+	// Decoding allocates the whole image, check its size before
+	if int64(config.Width)*int64(config.Height) > maxDownscalePixels {
+		return fmt.Errorf("image of %dx%d pixels is too large to downscale", config.Width, config.Height)
+	}
+
+	src, format, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	scale := float64(maxDimension) / float64(max(config.Width, config.Height))
+	info.Width = max(1, int(float64(config.Width)*scale+0.5))
+	info.Height = max(1, int(float64(config.Height)*scale+0.5))
+	info.Downscaled = true
+
+	dst := image.NewRGBA(image.Rect(0, 0, info.Width, info.Height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+
+	var buf bytes.Buffer
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: downscaledJPEGQuality})
+		result.MimeType = "image/jpeg"
+	} else {
+		err = png.Encode(&buf, dst)
+		result.MimeType = "image/png"
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode downscaled image: %w", err)
+	}
+	result.Content = base64.StdEncoding.EncodeToString(buf.Bytes())
+	return nil
+}
+
+// previewCSV returns the first row of the file as columns and up to maxRows rows after it
+func previewCSV(result *model.BoxFileReadResult, content []byte, comma rune, maxRows int) error {
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.ReuseRecord = false
+
+	table := &model.BoxFileTable{Columns: []string{}, Rows: [][]string{}}
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if first {
+			table.Columns = record
+			continue
+		}
+		table.TotalRows++
+		if len(table.Rows) < maxRows {
+			table.Rows = append(table.Rows, record)
+		}
+	}
+
+	result.Kind = model.FileKindTable
+	result.Table = table
+	result.Truncated = table.TotalRows > len(table.Rows)
+	return nil
+}
+
+// previewJSON returns the parsed document, keeping the first maxItems items of a
+// top-level array
+func previewJSON(result *model.BoxFileReadResult, content []byte, maxItems int) error {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("unexpected data after the top-level value")
+	}
+
+	preview := &model.BoxFileJSON{Value: value}
+	if items, ok := value.([]any); ok {
+		preview.TotalItems = len(items)
+		if len(items) > maxItems {
+			preview.Value = items[:maxItems]
+			result.Truncated = true
+		}
+	}
+	result.Kind = model.FileKindJSON
+	result.JSON = preview
+	return nil
+}
+
+// previewJSONLines returns the values of the first maxItems non-empty lines
+func previewJSONLines(result *model.BoxFileReadResult, content []byte, maxItems int) error {
+	preview := &model.BoxFileJSON{}
+	items := []any{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, len(content)+1)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		preview.TotalItems++
+		if len(items) >= maxItems {
+			continue
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(text))
+		decoder.UseNumber()
+		var value any
+		if err := decoder.Decode(&value); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		items = append(items, value)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	preview.Value = items
+	result.Kind = model.FileKindJSON
+	result.JSON = preview
+	result.Truncated = preview.TotalItems > len(items)
+	return nil
+}
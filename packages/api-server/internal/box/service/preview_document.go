@@ -0,0 +1,318 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+// Office Open XML types, which are ZIP archives of XML parts
+const (
+	mimeDOCX = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	mimePPTX = "application/vnd.openxmlformats-officedocument.presentationml.presentation"
+	mimeXLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+var (
+	slidePart     = regexp.MustCompile(`^ppt/slides/slide(\d+)\.xml$`)
+	worksheetPart = regexp.MustCompile(`^xl/worksheets/sheet(\d+)\.xml$`)
+	cellColumn    = regexp.MustCompile(`^[A-Z]+`)
+
+	// errPartNotFound is returned when an Office Open XML archive lacks a part
+	errPartNotFound = errors.New("part not found")
+)
+
+// setDocumentPages sets the pages of a document, also joined as its content
+func setDocumentPages(result *model.BoxFileReadResult, pages []model.BoxFilePage) {
+	texts := make([]string, len(pages))
+	for i, page := range pages {
+		texts[i] = page.Text
+	}
+	result.Kind = model.FileKindDocument
+	result.Encoding = model.FileEncodingUTF8
+	result.Content = strings.Join(texts, "\n\n")
+	result.Pages = pages
+}
+
+// previewPDF extracts the text of the first maxPages pages of a PDF
+func previewPDF(result *model.BoxFileReadResult, content []byte, maxPages int) (err error) {
+	// The PDF reader panics on some malformed documents
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return err
+	}
+
+	numPages := reader.NumPage()
+	pages := []model.BoxFilePage{}
+	fonts := make(map[string]*pdf.Font)
+	for i := 1; i <= numPages && len(pages) < maxPages; i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		// Fonts are shared by the pages, so their character maps are parsed once
+		for _, name := range page.Fonts() {
+			if _, ok := fonts[name]; !ok {
+				font := page.Font(name)
+				fonts[name] = &font
+			}
+		}
+		text, err := page.GetPlainText(fonts)
+		if err != nil {
+			return fmt.Errorf("page %d: %w", i, err)
+		}
+		pages = append(pages, model.BoxFilePage{Number: i, Text: text})
+	}
+
+	setDocumentPages(result, pages)
+	result.Truncated = numPages > maxPages
+	return nil
+}
+
+// previewDOCX extracts the text of a Word document, which has no fixed pages and is
+// returned as a single one
+func previewDOCX(result *model.BoxFileReadResult, content []byte) error {
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return err
+	}
+	text, err := officePartText(archive, "word/document.xml")
+	if err != nil {
+		return err
+	}
+	setDocumentPages(result, []model.BoxFilePage{{Number: 1, Text: text}})
+	return nil
+}
+
+// previewPPTX extracts the text of the first maxPages slides of a presentation
+func previewPPTX(result *model.BoxFileReadResult, content []byte, maxPages int) error {
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return err
+	}
+
+	slides := numberedParts(archive, slidePart)
+	pages := []model.BoxFilePage{}
+	for _, number := range slides {
+		if len(pages) == maxPages {
+			break
+		}
+		text, err := officePartText(archive, fmt.Sprintf("ppt/slides/slide%d.xml", number))
+		if err != nil {
+			return err
+		}
+		pages = append(pages, model.BoxFilePage{Number: number, Text: text})
+	}
+
+	setDocumentPages(result, pages)
+	result.Truncated = len(slides) > maxPages
+	return nil
+}
+
+// xlsxSharedStrings is the table of the strings of a workbook, which cells refer to by index
+type xlsxSharedStrings struct {
+	Items []struct {
+		Text string `xml:"t"`
+		Runs []struct {
+			Text string `xml:"t"`
+		} `xml:"r"`
+	} `xml:"si"`
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref    string `xml:"r,attr"`
+			Type   string `xml:"t,attr"`
+			Value  string `xml:"v"`
+			Inline string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// previewXLSX returns the first worksheet of a workbook as a table, with its first row as
+// columns and up to maxRows rows after it
+func previewXLSX(result *model.BoxFileReadResult, content []byte, maxRows int) error {
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return err
+	}
+
+	var shared xlsxSharedStrings
+	if err := decodeOfficePart(archive, "xl/sharedStrings.xml", &shared); err != nil && !errors.Is(err, errPartNotFound) {
+		return err
+	}
+	strs := make([]string, len(shared.Items))
+	for i, item := range shared.Items {
+		strs[i] = item.Text
+		for _, run := range item.Runs {
+			strs[i] += run.Text
+		}
+	}
+
+	sheets := numberedParts(archive, worksheetPart)
+	if len(sheets) == 0 {
+		return errors.New("workbook has no worksheet")
+	}
+	var sheet xlsxWorksheet
+	if err := decodeOfficePart(archive, fmt.Sprintf("xl/worksheets/sheet%d.xml", sheets[0]), &sheet); err != nil {
+		return err
+	}
+
+	table := &model.BoxFileTable{Columns: []string{}, Rows: [][]string{}}
+	for i, row := range sheet.Rows {
+		if i > 0 {
+			table.TotalRows++
+			if len(table.Rows) == maxRows {
+				continue
+			}
+		}
+
+		record := []string{}
+		for _, cell := range row.Cells {
+			// Empty cells are left out of the sheet, so cells are placed by their column
+			if column := columnIndex(cell.Ref); column >= len(record) {
+				record = append(record, make([]string, column-len(record)+1)...)
+			} else {
+				record = append(record, "")
+			}
+
+			value := cell.Value
+			switch cell.Type {
+			case "s":
+				index, err := strconv.Atoi(value)
+				if err != nil || index < 0 || index >= len(strs) {
+					return fmt.Errorf("cell %s refers to unknown shared string %q", cell.Ref, value)
+				}
+				value = strs[index]
+			case "inlineStr":
+				value = cell.Inline
+			case "b":
+				value = strings.ToUpper(strconv.FormatBool(value == "1"))
+			}
+			record[len(record)-1] = value
+		}
+
+		if i == 0 {
+			table.Columns = record
+		} else {
+			table.Rows = append(table.Rows, record)
+		}
+	}
+
+	result.Kind = model.FileKindTable
+	result.Table = table
+	result.Truncated = table.TotalRows > len(table.Rows)
+	return nil
+}
+
+// columnIndex returns the 0-based column of a cell reference such as "AB12", or -1 if
+// the reference has no column
+func columnIndex(ref string) int {
+	index := 0
+	for _, c := range cellColumn.FindString(ref) {
+		index = index*26 + int(c-'A') + 1
+	}
+	return index - 1
+}
+
+// openOfficePart opens a part of an Office Open XML archive
+func openOfficePart(archive *zip.Reader, name string) (io.ReadCloser, error) {
+	for _, file := range archive.File {
+		if file.Name == name {
+			return file.Open()
+		}
+	}
+	return nil, errPartNotFound
+}
+
+func decodeOfficePart(archive *zip.Reader, name string, v any) error {
+	part, err := openOfficePart(archive, name)
+	if err != nil {
+		return err
+	}
+	defer part.Close()
+	if err := xml.NewDecoder(part).Decode(v); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// officePartText extracts the text of a document or slide part: the content of its text
+// runs, with tabs and breaks kept and a newline after each paragraph
+func officePartText(archive *zip.Reader, name string) (string, error) {
+	part, err := openOfficePart(archive, name)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	defer part.Close()
+
+	var text strings.Builder
+	inText := false
+	decoder := xml.NewDecoder(part)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", name, err)
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			switch token.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				text.WriteByte('\t')
+			case "br", "cr":
+				text.WriteByte('\n')
+			}
+		case xml.EndElement:
+			switch token.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				text.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(token)
+			}
+		}
+	}
+	return strings.TrimRight(text.String(), "\n"), nil
+}
+
+// numberedParts returns the numbers of the parts matching pattern, such as the slides
+// of a presentation, in order
+func numberedParts(archive *zip.Reader, pattern *regexp.Regexp) []int {
+	var numbers []int
+	for _, file := range archive.File {
+		if match := pattern.FindStringSubmatch(file.Name); match != nil {
+			if number, err := strconv.Atoi(match[1]); err == nil {
+				numbers = append(numbers, number)
+			}
+		}
+	}
+	sort.Ints(numbers)
+	return numbers
+}
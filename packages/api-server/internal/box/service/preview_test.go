@@ -0,0 +1,259 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+func testImage(t *testing.T, width, height int, encode func(*bytes.Buffer, image.Image) error) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		img.Set(x, 0, color.RGBA{R: 255, A: 255})
+	}
+	var buf bytes.Buffer
+	require.NoError(t, encode(&buf, img))
+	return buf.Bytes()
+}
+
+func encodePNG(buf *bytes.Buffer, img image.Image) error { return png.Encode(buf, img) }
+
+func encodeJPEG(buf *bytes.Buffer, img image.Image) error { return jpeg.Encode(buf, img, nil) }
+
+// testZip builds an archive of the given parts, as Office Open XML files are
+func testZip(t *testing.T, parts map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	// mimetype detects Office files by their first part
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "word/document.xml", "ppt/slides/slide1.xml",
+		"ppt/slides/slide2.xml", "ppt/slides/slide10.xml", "xl/sharedStrings.xml", "xl/worksheets/sheet1.xml"} {
+		content, ok := parts[name]
+		if !ok {
+			continue
+		}
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+// testPDF builds a PDF with a page of text for each of pages
+func testPDF(pages ...string) []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"", // the page tree, once the pages are known
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	}
+	var kids []string
+	for _, text := range pages {
+		stream := fmt.Sprintf("BT /F1 12 Tf 72 712 Td (%s) Tj ET", text)
+		objects = append(objects, fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream))
+		objects = append(objects, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] "+
+			"/Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", len(objects)))
+		kids = append(kids, fmt.Sprintf("%d 0 R", len(objects)))
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids))
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+func TestPreviewFileImage(t *testing.T) {
+	content := testImage(t, 400, 100, encodePNG)
+	result, err := PreviewFile("/app/a.png", content, &model.BoxFileReadParams{})
+	require.NoError(t, err)
+	assert.Equal(t, model.FileKindImage, result.Kind)
+	assert.Equal(t, "image/png", result.MimeType)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(content), result.Content)
+	assert.Equal(t, &model.BoxFileImage{Width: 400, Height: 100, OriginalWidth: 400, OriginalHeight: 100}, result.Image)
+
+	result, err = PreviewFile("/app/a.jpg", testImage(t, 400, 100, encodeJPEG), &model.BoxFileReadParams{MaxDimension: 200})
+	require.NoError(t, err)
+	assert.Equal(t, "image/jpeg", result.MimeType)
+	assert.Equal(t, &model.BoxFileImage{Width: 200, Height: 50, OriginalWidth: 400, OriginalHeight: 100, Downscaled: true}, result.Image)
+	decoded, err := base64.StdEncoding.DecodeString(result.Content)
+	require.NoError(t, err)
+	config, format, err := image.DecodeConfig(bytes.NewReader(decoded))
+	require.NoError(t, err)
+	assert.Equal(t, "jpeg", format)
+	assert.Equal(t, 200, config.Width)
+	assert.Equal(t, 50, config.Height)
+
+	// Images that fit are returned as they are
+	result, err = PreviewFile("/app/a.png", content, &model.BoxFileReadParams{MaxDimension: 400})
+	require.NoError(t, err)
+	assert.False(t, result.Image.Downscaled)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(content), result.Content)
+
+	_, err = PreviewFile("/app/a.png", content[:40], &model.BoxFileReadParams{MaxDimension: 10})
+	assert.True(t, errors.Is(err, ErrInvalidContent), "got %v", err)
+
+	// Images too large to decode are rejected from their header, the PNG claims to be
+	// 100000x100000 pixels
+	huge := testImage(t, 1, 1, encodePNG)
+	binary.BigEndian.PutUint32(huge[16:], 100000)
+	binary.BigEndian.PutUint32(huge[20:], 100000)
+	binary.BigEndian.PutUint32(huge[29:], crc32.ChecksumIEEE(huge[12:29]))
+	_, err = PreviewFile("/app/a.png", huge, &model.BoxFileReadParams{MaxDimension: 200})
+	assert.True(t, errors.Is(err, ErrInvalidContent), "got %v", err)
+	assert.Contains(t, err.Error(), "too large to downscale")
+}
+
+func TestPreviewFileDocuments(t *testing.T) {
+	t.Run("pdf", func(t *testing.T) {
+		result, err := PreviewFile("/app/a.pdf", testPDF("first page", "second page", "third page"), &model.BoxFileReadParams{MaxPages: 2})
+		require.NoError(t, err)
+		assert.Equal(t, model.FileKindDocument, result.Kind)
+		assert.Equal(t, []model.BoxFilePage{{Number: 1, Text: "first page"}, {Number: 2, Text: "second page"}}, result.Pages)
+		assert.Equal(t, "first page\n\nsecond page", result.Content)
+		assert.True(t, result.Truncated)
+
+		_, err = PreviewFile("/app/a.pdf", []byte("%PDF-1.4\ngarbage"), &model.BoxFileReadParams{})
+		assert.True(t, errors.Is(err, ErrInvalidContent), "got %v", err)
+	})
+
+	t.Run("docx", func(t *testing.T) {
+		content := testZip(t, map[string]string{
+			"[Content_Types].xml": `<Types/>`,
+			"word/document.xml": `<w:document xmlns:w="w"><w:body>` +
+				`<w:p><w:r><w:t>Hello</w:t></w:r><w:r><w:t xml:space="preserve"> world</w:t></w:r></w:p>` +
+				`<w:p><w:r><w:t>a</w:t><w:tab/><w:t>b</w:t><w:br/><w:t>c</w:t></w:r></w:p>` +
+				`</w:body></w:document>`,
+		})
+		result, err := PreviewFile("/app/a.docx", content, &model.BoxFileReadParams{})
+		require.NoError(t, err)
+		assert.Equal(t, mimeDOCX, result.MimeType)
+		assert.Equal(t, []model.BoxFilePage{{Number: 1, Text: "Hello world\na\tb\nc"}}, result.Pages)
+	})
+
+	t.Run("pptx", func(t *testing.T) {
+		slide := func(text string) string {
+			return `<p:sld xmlns:p="p" xmlns:a="a"><a:p><a:r><a:t>` + text + `</a:t></a:r></a:p></p:sld>`
+		}
+		content := testZip(t, map[string]string{
+			"[Content_Types].xml":    `<Types/>`,
+			"ppt/slides/slide1.xml":  slide("one"),
+			"ppt/slides/slide2.xml":  slide("two"),
+			"ppt/slides/slide10.xml": slide("ten"),
+		})
+		result, err := PreviewFile("/app/a.pptx", content, &model.BoxFileReadParams{})
+		require.NoError(t, err)
+		assert.Equal(t, mimePPTX, result.MimeType)
+		assert.Equal(t, []model.BoxFilePage{{Number: 1, Text: "one"}, {Number: 2, Text: "two"}, {Number: 10, Text: "ten"}}, result.Pages)
+		assert.False(t, result.Truncated)
+	})
+}
+
+func TestPreviewFileTables(t *testing.T) {
+	t.Run("csv", func(t *testing.T) {
+		result, err := PreviewFile("/app/a.csv", []byte("name,age\nann,3\n\"bo, b\",4\ncy,5\n"), &model.BoxFileReadParams{MaxRows: 2})
+		require.NoError(t, err)
+		assert.Equal(t, model.FileKindTable, result.Kind)
+		assert.Equal(t, &model.BoxFileTable{
+			Columns:   []string{"name", "age"},
+			Rows:      [][]string{{"ann", "3"}, {"bo, b", "4"}},
+			TotalRows: 3,
+		}, result.Table)
+		assert.True(t, result.Truncated)
+	})
+
+	t.Run("tsv", func(t *testing.T) {
+		result, err := PreviewFile("/app/a.tsv", []byte("a\tb\n1\t2\n"), &model.BoxFileReadParams{})
+		require.NoError(t, err)
+		assert.Equal(t, [][]string{{"1", "2"}}, result.Table.Rows)
+		assert.False(t, result.Truncated)
+	})
+
+	t.Run("xlsx", func(t *testing.T) {
+		content := testZip(t, map[string]string{
+			"[Content_Types].xml": `<Types/>`,
+			"xl/sharedStrings.xml": `<sst xmlns="s"><si><t>name</t></si><si><t>count</t></si>` +
+				`<si><r><t>an</t></r><r><t>n</t></r></si></sst>`,
+			"xl/worksheets/sheet1.xml": `<worksheet xmlns="s"><sheetData>` +
+				`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c></row>` +
+				`<row r="2"><c r="A2" t="s"><v>2</v></c><c r="C2"><v>3.5</v></c></row>` +
+				`<row r="3"><c r="B3" t="b"><v>1</v></c><c r="C3" t="inlineStr"><is><t>x</t></is></c></row>` +
+				`</sheetData></worksheet>`,
+		})
+		result, err := PreviewFile("/app/a.xlsx", content, &model.BoxFileReadParams{})
+		require.NoError(t, err)
+		assert.Equal(t, mimeXLSX, result.MimeType)
+		assert.Equal(t, &model.BoxFileTable{
+			Columns:   []string{"name", "count"},
+			Rows:      [][]string{{"ann", "", "3.5"}, {"", "TRUE", "x"}},
+			TotalRows: 2,
+		}, result.Table)
+	})
+}
+
+func TestPreviewFileJSON(t *testing.T) {
+	result, err := PreviewFile("/app/a.json", []byte(`[{"id": 1}, {"id": 2}, {"id": 3}]`), &model.BoxFileReadParams{MaxRows: 2})
+	require.NoError(t, err)
+	assert.Equal(t, model.FileKindJSON, result.Kind)
+	assert.Equal(t, 3, result.JSON.TotalItems)
+	assert.True(t, result.Truncated)
+	value, err := json.Marshal(result.JSON.Value)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"id": 1}, {"id": 2}]`, string(value))
+
+	result, err = PreviewFile("/app/config", []byte(`{"big": 12345678901234567890}`), &model.BoxFileReadParams{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"big": json.Number("12345678901234567890")}, result.JSON.Value)
+	assert.Zero(t, result.JSON.TotalItems)
+
+	result, err = PreviewFile("/app/a.jsonl", []byte("{\"a\": 1}\n\n[2]\n\"three\"\n"), &model.BoxFileReadParams{MaxRows: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []any{map[string]any{"a": json.Number("1")}, []any{json.Number("2")}}, result.JSON.Value)
+	assert.Equal(t, 3, result.JSON.TotalItems)
+	assert.True(t, result.Truncated)
+
+	_, err = PreviewFile("/app/a.json", []byte(`{"a": `), &model.BoxFileReadParams{})
+	assert.True(t, errors.Is(err, ErrInvalidContent), "got %v", err)
+}
+
+func TestPreviewFileOther(t *testing.T) {
+	result, err := PreviewFile("/app/a.txt", []byte("hello"), &model.BoxFileReadParams{})
+	require.NoError(t, err)
+	assert.Equal(t, model.FileKindText, result.Kind)
+	assert.Equal(t, model.FileEncodingUTF8, result.Encoding)
+	assert.Equal(t, "hello", result.Content)
+
+	result, err = PreviewFile("/app/a.bin", []byte{0xff, 0x00, 0xfe}, &model.BoxFileReadParams{})
+	require.NoError(t, err)
+	assert.Equal(t, model.FileKindBinary, result.Kind)
+	assert.Equal(t, model.FileEncodingBase64, result.Encoding)
+	assert.Equal(t, "/wD+", result.Content)
+}
@@ -0,0 +1,452 @@
+package service
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+	"github.com/babelcloud/gbox/packages/api-server/pkg/gitignore"
+)
+
+const (
+	// DefaultSearchResults is the number of matches returned when none is requested
+	DefaultSearchResults = 100
+	// MaxSearchResults bounds the number of matches a search returns
+	MaxSearchResults = 1000
+	// MaxSearchContextLines bounds the context lines returned around a match
+	MaxSearchContextLines = 10
+
+	// maxSearchFileSize is the size above which file contents are not searched
+	maxSearchFileSize = 4 << 20
+	// binarySniffLen is the number of leading bytes checked for NUL to skip binary files
+	binarySniffLen = 8000
+	// maxMatchTextLen bounds the length of the lines returned with a match
+	maxMatchTextLen = 1000
+)
+
+// defaultIgnoredDirs are skipped by searches unless ignore rules are disabled
+var defaultIgnoredDirs = map[string]bool{".git": true, "node_modules": true}
+
+const (
+	// maxGitignoreSize bounds the part of a .gitignore file a search reads
+	maxGitignoreSize = 64 << 10
+	// maxSearchBatchBytes bounds the size of the files archived by one content operation
+	maxSearchBatchBytes = 16 << 20
+	// maxSearchBatchArgs bounds the length of the paths passed to one content operation
+	maxSearchBatchArgs = 64 << 10
+)
+
+// FileSearch searches the files of a directory in a box. The box lists the files, pruning
+// the directories ignored by default, and only archives the files whose contents are
+// searched, so the search does not depend on any tool but find, stat and tar.
+type FileSearch struct {
+	root   string
+	params *model.BoxFileSearchParams
+	query  *regexp.Regexp
+	ignore *gitignore.Matcher
+	result *model.BoxFileSearchResult
+}
+
+// searchEntry is a file listed by the list operation of a search
+type searchEntry struct {
+	// rel is the path relative to the root, "." for the root itself
+	rel       string
+	file      *model.BoxFile
+	gitignore string
+}
+
+// NewFileSearch validates a search of the directory root
+func NewFileSearch(root string, params *model.BoxFileSearchParams) (*FileSearch, error) {
+	if params.Pattern == "" && params.Query == "" {
+		return nil, fmt.Errorf("%w: a pattern or a query is required", ErrInvalidSearch)
+	}
+
+	globs := append([]string{params.Pattern}, params.Include...)
+	for _, glob := range append(globs, params.Exclude...) {
+		for _, segment := range strings.Split(glob, "/") {
+			if _, err := path.Match(segment, ""); err != nil {
+				return nil, fmt.Errorf("%w: malformed glob %q", ErrInvalidSearch, glob)
+			}
+		}
+	}
+
+	search := &FileSearch{
+		root:   root,
+		params: params,
+		result: &model.BoxFileSearchResult{Matches: []model.BoxFileSearchMatch{}},
+	}
+
+	if params.Query != "" {
+		expr := params.Query
+		if params.IgnoreCase {
+			expr = "(?i)" + expr
+		}
+		query, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSearch, err)
+		}
+		search.query = query
+	}
+	return search, nil
+}
+
+// maxResults returns the number of matches the search returns at most
+func (f *FileSearch) maxResults() int {
+	switch {
+	case f.params.MaxResults <= 0:
+		return DefaultSearchResults
+	case f.params.MaxResults > MaxSearchResults:
+		return MaxSearchResults
+	}
+	return f.params.MaxResults
+}
+
+// contextLines returns the number of context lines around content matches
+func (f *FileSearch) contextLines() int {
+	return max(0, min(f.params.ContextLines, MaxSearchContextLines))
+}
+
+// ListOperation lists the root of the search and, if it is a directory, the files under
+// it, pruning the directories ignored by default. Each file is printed as its path
+// relative to the directory of the listing, its description and, for .gitignore files,
+// the start of its content, all terminated by NUL. A directory root is listed as ".".
+func (f *FileSearch) ListOperation() *FileOperation {
+	args := []string{f.root}
+	if !f.params.NoIgnore {
+		args = append(args, "(")
+		for i, name := range slices.Sorted(maps.Keys(defaultIgnoredDirs)) {
+			if i > 0 {
+				args = append(args, "-o")
+			}
+			args = append(args, "-type", "d", "-name", name)
+		}
+		args = append(args, ")", "-prune", "-o")
+	}
+	return &FileOperation{
+		name: "search",
+		script: `
+need "$1"
+root=$1; shift
+if [ -d "$root" ]; then
+	cd "$root" || fail 13 "$root: permission denied"
+	set -- . "$@"
+else
+	cd "$(dirname "$root")" || fail 13 "$root: permission denied"
+	set -- "./$(basename "$root")" -prune
+fi
+find "$@" -exec sh -c '
+for f do
+	printf "%s\0" "${f#./}"
+	stat -c "%f %s %Y %u %g %U %G" "$f" && { [ ! -L "$f" ] || readlink "$f"; }
+	printf "\0"
+	case "$f" in */.gitignore) [ -f "$f" ] && head -c ` + strconv.Itoa(maxGitignoreSize) + ` "$f" | tr -d "\000" ;; esac
+	printf "\0"
+done' gbox-search {} +
+exit 0`,
+		args: args,
+	}
+}
+
+// contentOperation archives files of the directory dir, given by their paths relative to it.
+// Files that vanished since they were listed are left out.
+func contentOperation(dir string, rels []string) *FileOperation {
+	args := []string{dir}
+	for _, rel := range rels {
+		args = append(args, "./"+rel)
+	}
+	return &FileOperation{
+		name: "search-content",
+		script: `
+cd "$1" || fail 13 "$1: permission denied"
+shift
+tar cf - "$@" 2>/dev/null
+exit 0`,
+		args: args,
+	}
+}
+
+// parseSearchList parses the output of ListOperation, sorted by path
+func parseSearchList(output string) ([]searchEntry, error) {
+	fields := strings.Split(output, "\x00")
+	var entries []searchEntry
+	for i := 0; i+2 < len(fields); i += 3 {
+		if fields[i+1] == "" {
+			// The file vanished while it was listed
+			continue
+		}
+		file, err := ParseFileStat(fields[i], fields[i+1])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, searchEntry{rel: fields[i], file: file, gitignore: fields[i+2]})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].rel < entries[j].rel })
+	return entries, nil
+}
+
+// Run runs the search, where run runs a file operation in the box and returns its output
+// or the error it failed with
+func (f *FileSearch) Run(run func(op *FileOperation) (string, error)) (*model.BoxFileSearchResult, error) {
+	output, err := run(f.ListOperation())
+	if err != nil {
+		return nil, err
+	}
+	entries, err := parseSearchList(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse file list: %w", err)
+	}
+
+	// The root is listed as "." if it is a directory, otherwise under its name
+	rootIsFile := !slices.ContainsFunc(entries, func(entry searchEntry) bool { return entry.rel == "." })
+	dir := f.root
+	if rootIsFile {
+		dir = path.Dir(f.root)
+	}
+
+	// Every .gitignore file applies whatever the order its directory is listed in, with
+	// the rules of deeper files taking precedence
+	if !f.params.NoIgnore && !rootIsFile {
+		f.ignore = &gitignore.Matcher{}
+		for _, name := range slices.Sorted(maps.Keys(defaultIgnoredDirs)) {
+			f.ignore.AddPatterns("", []string{name + "/"})
+		}
+		var gitignores []searchEntry
+		for _, entry := range entries {
+			if path.Base(entry.rel) == ".gitignore" && entry.file.Type == model.FileTypeFile {
+				gitignores = append(gitignores, entry)
+			}
+		}
+		sort.SliceStable(gitignores, func(i, j int) bool {
+			return ignoreDepth(path.Dir(gitignores[i].rel)) < ignoreDepth(path.Dir(gitignores[j].rel))
+		})
+		for _, entry := range gitignores {
+			f.ignore.AddFile(path.Dir(entry.rel), []byte(entry.gitignore))
+		}
+	}
+
+	// Select the files, completing searches by name
+	paths := make(map[string]string)
+	var batch []string
+	var batches [][]string
+	var batchBytes int64
+	batchArgs := 0
+	for _, entry := range entries {
+		if entry.rel == "." || entry.file.Type != model.FileTypeFile {
+			continue
+		}
+		rel, filePath := entry.rel, path.Join(dir, entry.rel)
+		if rootIsFile {
+			filePath = f.root
+		} else if f.ignore != nil && f.ignore.Ignored(rel, false) {
+			continue
+		}
+		if !f.selected(rel) {
+			continue
+		}
+
+		if f.query == nil {
+			f.result.FilesSearched++
+			if !f.add(model.BoxFileSearchMatch{Path: filePath}) {
+				return f.result, nil
+			}
+			continue
+		}
+		if entry.file.Size > maxSearchFileSize {
+			f.result.Skipped = append(f.result.Skipped, filePath)
+			continue
+		}
+		if len(batch) > 0 && (batchBytes+entry.file.Size > maxSearchBatchBytes || batchArgs+len(rel) > maxSearchBatchArgs) {
+			batches = append(batches, batch)
+			batch, batchBytes, batchArgs = nil, 0, 0
+		}
+		batch = append(batch, rel)
+		batchBytes += entry.file.Size
+		batchArgs += len(rel) + 3
+		paths[rel] = filePath
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+
+	// Search the contents of the selected files, a batch at a time
+	for _, batch := range batches {
+		output, err := run(contentOperation(dir, batch))
+		if err != nil {
+			return nil, err
+		}
+		more, err := f.searchArchive(tar.NewReader(strings.NewReader(output)), paths)
+		if err != nil {
+			return nil, err
+		}
+		if !more {
+			break
+		}
+	}
+	return f.result, nil
+}
+
+// searchArchive searches the contents of the files of an archive made by contentOperation,
+// whose paths relative to the root are mapped to the paths reported in matches
+func (f *FileSearch) searchArchive(tr *tar.Reader, paths map[string]string) (bool, error) {
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return true, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to read archive: %w", err)
+		}
+		rel, _ := relativeEntryName(header.Name, "")
+		filePath, ok := paths[rel]
+		if !ok || header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if header.Size > maxSearchFileSize {
+			// The file grew since it was listed
+			f.result.Skipped = append(f.result.Skipped, filePath)
+			continue
+		}
+		more, err := f.searchContent(tr, filePath)
+		if err != nil || !more {
+			return false, err
+		}
+	}
+}
+
+// ignoreDepth returns the depth of the directory of a .gitignore file below the root
+func ignoreDepth(base string) int {
+	if base == "." {
+		return 0
+	}
+	return strings.Count(base, "/") + 1
+}
+
+// add adds a match to the result, or reports false if the result is full
+func (f *FileSearch) add(match model.BoxFileSearchMatch) bool {
+	if len(f.result.Matches) >= f.maxResults() {
+		f.result.Truncated = true
+		return false
+	}
+	f.result.Matches = append(f.result.Matches, match)
+	return true
+}
+
+// searchContent searches the content of a file for the query, skipping binary files
+func (f *FileSearch) searchContent(r io.Reader, filePath string) (bool, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", filePath, err)
+	}
+	if bytes.IndexByte(content[:min(len(content), binarySniffLen)], 0) >= 0 {
+		return true, nil
+	}
+	f.result.FilesSearched++
+
+	lines := strings.Split(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for i := range lines {
+		lines[i] = strings.TrimSuffix(lines[i], "\r")
+	}
+
+	contextLines := f.contextLines()
+	for i, line := range lines {
+		loc := f.query.FindStringIndex(line)
+		if loc == nil {
+			continue
+		}
+		match := model.BoxFileSearchMatch{
+			Path:   filePath,
+			Line:   i + 1,
+			Column: loc[0] + 1,
+			Text:   truncateMatchText(line),
+		}
+		if contextLines > 0 {
+			match.Before = truncateMatchTexts(lines[max(0, i-contextLines):i])
+			match.After = truncateMatchTexts(lines[i+1 : min(len(lines), i+1+contextLines)])
+		}
+		if !f.add(match) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// selected reports whether a file is selected by the pattern and the include and exclude globs
+func (f *FileSearch) selected(rel string) bool {
+	if f.params.Pattern != "" && !matchSearchGlob(f.params.Pattern, rel) {
+		return false
+	}
+	if len(f.params.Include) > 0 {
+		included := false
+		for _, glob := range f.params.Include {
+			if matchSearchGlob(glob, rel) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	for _, glob := range f.params.Exclude {
+		if matchSearchGlob(glob, rel) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchSearchGlob matches globs without a slash against the file name, others against the relative path
+func matchSearchGlob(glob, rel string) bool {
+	if !strings.Contains(glob, "/") {
+		ok, _ := path.Match(glob, path.Base(rel))
+		return ok
+	}
+	return MatchGlob(glob, rel)
+}
+
+// relativeEntryName returns the path of a tar entry relative to the archived root, whose
+// entries are named prefix or prefix/...
+func relativeEntryName(name, prefix string) (string, bool) {
+	name = strings.TrimSuffix(strings.TrimPrefix(name, "./"), "/")
+	prefix = strings.Trim(prefix, "/")
+	switch {
+	case name == prefix:
+		return "", true
+	case prefix == "":
+		return name, true
+	case strings.HasPrefix(name, prefix+"/"):
+		return strings.TrimPrefix(name, prefix+"/"), true
+	}
+	return "", false
+}
+
+// truncateMatchText bounds the length of a line returned with a match
+func truncateMatchText(line string) string {
+	if len(line) > maxMatchTextLen {
+		return line[:maxMatchTextLen]
+	}
+	return line
+}
+
+func truncateMatchTexts(lines []string) []string {
+	if len(lines) == 0 {
+		return nil
+	}
+	texts := make([]string, len(lines))
+	for i, line := range lines {
+		texts[i] = truncateMatchText(line)
+	}
+	return texts
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+// searchTestTree creates a project to search and returns its root
+func searchTestTree(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+	root := filepath.Join(t.TempDir(), "app")
+	files := map[string]string{
+		// Listed before the .gitignore that ignores it
+		"+draft.tmp":                     "answer\n",
+		".gitignore":                     "*.log\n*.tmp\nbuild/\n!keep.log\n",
+		"build/out.js":                   "const answer = 42\n",
+		"debug.log":                      "answer\n",
+		"keep.log":                       "answer kept\n",
+		"main.go":                        "package main\n\n// Answer is the answer\nconst Answer = 42\n\nfunc main() {}\n",
+		"node_modules/dep/index.js":      "module.exports = 42\n",
+		"pkg/.gitignore":                 "/generated.go\n!pkg.log\n",
+		"pkg/generated.go":               "const answer = 42\n",
+		"pkg/pkg.log":                    "answer\n",
+		"pkg/util.go":                    "package pkg\n\nfunc answer() int { return 42 }\n",
+		"logo.png":                       "\x89PNG\x00answer",
+		"data/large.txt":                 "answer\n" + strings.Repeat("x", maxSearchFileSize),
+		"data/docs/notes with spaces.md": "no answer here\n",
+	}
+	for name, content := range files {
+		file := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+		require.NoError(t, os.WriteFile(file, []byte(content), 0644))
+	}
+	return root
+}
+
+// searchPaths returns the paths of the matches of a search relative to its root
+func searchPaths(root string, result *model.BoxFileSearchResult) []string {
+	var paths []string
+	for _, match := range result.Matches {
+		paths = append(paths, strings.TrimPrefix(match.Path, root+"/"))
+	}
+	return paths
+}
+
+// runSearch runs a search with the local shell, as a box would
+func runSearch(t *testing.T, root string, params *model.BoxFileSearchParams) *model.BoxFileSearchResult {
+	t.Helper()
+	search, err := NewFileSearch(root, params)
+	require.NoError(t, err)
+	operations := 0
+	result, err := search.Run(func(op *FileOperation) (string, error) {
+		operations++
+		return op.Output(execFileOperation(t, op))
+	})
+	require.NoError(t, err)
+	if params.Query == "" {
+		assert.Equal(t, 1, operations, "name searches only list the files")
+	}
+	return result
+}
+
+func TestFileSearchNames(t *testing.T) {
+	root := searchTestTree(t)
+	result := runSearch(t, root, &model.BoxFileSearchParams{Pattern: "*.go"})
+	assert.Equal(t, []string{"main.go", "pkg/util.go"}, searchPaths(root, result))
+	assert.Equal(t, 2, result.FilesSearched)
+
+	result = runSearch(t, root, &model.BoxFileSearchParams{Pattern: "*.log"})
+	assert.Equal(t, []string{"keep.log", "pkg/pkg.log"}, searchPaths(root, result))
+
+	result = runSearch(t, root, &model.BoxFileSearchParams{Pattern: "*.tmp"})
+	assert.Empty(t, result.Matches)
+
+	result = runSearch(t, root, &model.BoxFileSearchParams{Pattern: "**/*.js", NoIgnore: true})
+	assert.Equal(t, []string{"build/out.js", "node_modules/dep/index.js"}, searchPaths(root, result))
+
+	result = runSearch(t, root, &model.BoxFileSearchParams{Pattern: "data/**/*.md"})
+	assert.Equal(t, []string{"data/docs/notes with spaces.md"}, searchPaths(root, result))
+
+	// The root may be a file
+	result = runSearch(t, filepath.Join(root, "main.go"), &model.BoxFileSearchParams{Pattern: "*.go"})
+	assert.Equal(t, []string{filepath.Join(root, "main.go")}, searchPaths(root+"/none", result))
+}
+
+func TestFileSearchContent(t *testing.T) {
+	root := searchTestTree(t)
+	result := runSearch(t, root, &model.BoxFileSearchParams{Query: `answer`, IgnoreCase: true, Include: []string{"*.go"}, ContextLines: 1})
+	assert.Equal(t, []model.BoxFileSearchMatch{
+		{Path: root + "/main.go", Line: 3, Column: 4, Text: "// Answer is the answer", Before: []string{""}, After: []string{"const Answer = 42"}},
+		{Path: root + "/main.go", Line: 4, Column: 7, Text: "const Answer = 42", Before: []string{"// Answer is the answer"}, After: []string{""}},
+		{Path: root + "/pkg/util.go", Line: 3, Column: 6, Text: "func answer() int { return 42 }", Before: []string{""}},
+	}, result.Matches)
+	assert.Equal(t, 2, result.FilesSearched)
+
+	// Binary files are left out, large files are reported as skipped
+	result = runSearch(t, root, &model.BoxFileSearchParams{Query: `answer`, Exclude: []string{"*.go"}})
+	assert.Equal(t, []string{"data/docs/notes with spaces.md", "keep.log", "pkg/pkg.log"}, searchPaths(root, result))
+	assert.Equal(t, []string{root + "/data/large.txt"}, result.Skipped)
+
+	result = runSearch(t, filepath.Join(root, "keep.log"), &model.BoxFileSearchParams{Query: `kept`})
+	assert.Equal(t, []string{filepath.Join(root, "keep.log")}, searchPaths(root+"/none", result))
+}
+
+func TestFileSearchMaxResults(t *testing.T) {
+	root := searchTestTree(t)
+	result := runSearch(t, root, &model.BoxFileSearchParams{Query: `42`, MaxResults: 1})
+	assert.Len(t, result.Matches, 1)
+	assert.True(t, result.Truncated)
+}
+
+func TestFileSearchMissingRoot(t *testing.T) {
+	root := searchTestTree(t)
+	search, err := NewFileSearch(filepath.Join(root, "missing"), &model.BoxFileSearchParams{Pattern: "*"})
+	require.NoError(t, err)
+	_, err = search.Run(func(op *FileOperation) (string, error) {
+		return op.Output(execFileOperation(t, op))
+	})
+	assert.True(t, errors.Is(err, ErrPathNotFound), "got %v", err)
+}
+
+func TestNewFileSearchErrors(t *testing.T) {
+	_, err := NewFileSearch("/", &model.BoxFileSearchParams{})
+	assert.True(t, errors.Is(err, ErrInvalidSearch))
+	_, err = NewFileSearch("/", &model.BoxFileSearchParams{Query: "("})
+	assert.True(t, errors.Is(err, ErrInvalidSearch))
+	_, err = NewFileSearch("/", &model.BoxFileSearchParams{Pattern: "[a"})
+	assert.True(t, errors.Is(err, ErrInvalidSearch))
+}
+
+func TestRelativeEntryName(t *testing.T) {
+	rel, ok := relativeEntryName("var/gbox/src/main.go", "/var/gbox")
+	assert.True(t, ok)
+	assert.Equal(t, "src/main.go", rel)
+
+	rel, ok = relativeEntryName("gbox/", "gbox")
+	assert.True(t, ok)
+	assert.Equal(t, "", rel)
+
+	_, ok = relativeEntryName("other/main.go", "gbox")
+	assert.False(t, ok)
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+const (
+	// DefaultWatchDebounce is the debounce window used when none is requested
+	DefaultWatchDebounce = 200 * time.Millisecond
+	// MaxWatchDebounce bounds the debounce window of a watch
+	MaxWatchDebounce = 10 * time.Second
+
+	// maxWatchEventDelay bounds how long a steady stream of events is held back
+	maxWatchEventDelay = 2 * time.Second
+)
+
+// DebounceFileEvents coalesces the events read from in and sends them to out once none
+// arrived for window, or at the latest after maxWatchEventDelay. out is closed when in
+// is closed or ctx is done.
+func DebounceFileEvents(ctx context.Context, in <-chan model.BoxFileEvent, out chan<- model.BoxFileEvent, window time.Duration) {
+	defer close(out)
+
+	timer := time.NewTimer(window)
+	timer.Stop()
+	defer timer.Stop()
+
+	var pending fileEventCoalescer
+	var first time.Time
+	flush := func() bool {
+		first = time.Time{}
+		for _, event := range pending.flush() {
+			select {
+			case out <- event:
+			case <-ctx.Done():
+				return false
+			}
+		}
+		return true
+	}
+
+	for {
+		select {
+		case event, ok := <-in:
+			if !ok {
+				flush()
+				return
+			}
+			pending.add(event)
+
+			if first.IsZero() {
+				first = time.Now()
+			}
+			wait := min(window, max(window, maxWatchEventDelay)-time.Since(first))
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(max(0, wait))
+		case <-timer.C:
+			if !flush() {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// fileEventCoalescer merges the successive events of a path, so that e.g. a file
+// created and written to is reported once as created, and a temporary file created
+// and deleted again is not reported at all
+type fileEventCoalescer struct {
+	events []*model.BoxFileEvent
+	// byPath holds the last event of each path that later events can be merged into
+	byPath map[string]*model.BoxFileEvent
+}
+
+func (c *fileEventCoalescer) add(event model.BoxFileEvent) {
+	if c.byPath == nil {
+		c.byPath = make(map[string]*model.BoxFileEvent)
+	}
+
+	// Renames are kept in order with the events of both of their paths
+	if event.Type == model.FileEventRename {
+		delete(c.byPath, event.OldPath)
+		delete(c.byPath, event.Path)
+		c.events = append(c.events, &event)
+		return
+	}
+
+	if prev := c.byPath[event.Path]; prev != nil && prev.IsDir == event.IsDir {
+		merged := ""
+		switch {
+		case prev.Type == model.FileEventCreate && event.Type == model.FileEventModify:
+			merged = model.FileEventCreate
+		case prev.Type == model.FileEventModify && event.Type != model.FileEventCreate:
+			merged = event.Type
+		case prev.Type == model.FileEventDelete && event.Type == model.FileEventCreate:
+			// The file was replaced
+			merged = model.FileEventModify
+		case prev.Type == model.FileEventCreate && event.Type == model.FileEventDelete:
+			// The file never existed as far as the client is concerned
+			prev.Type = ""
+			delete(c.byPath, event.Path)
+			return
+		}
+		if merged != "" {
+			prev.Type, prev.Time = merged, event.Time
+			return
+		}
+	}
+
+	c.events = append(c.events, &event)
+	c.byPath[event.Path] = &event
+}
+
+// flush returns the pending events in order and resets the coalescer
+func (c *fileEventCoalescer) flush() []model.BoxFileEvent {
+	var events []model.BoxFileEvent
+	for _, event := range c.events {
+		if event.Type != "" {
+			events = append(events, *event)
+		}
+	}
+	c.events, c.byPath = nil, nil
+	return events
+}
+
+// WatchSnapshotFormat is the stat format of the lines parsed by ParseFileSnapshot
+const WatchSnapshotFormat = "%i %Y %s %f %n"
+
+// FileState is the state of a file in a snapshot taken when polling a directory
+type FileState struct {
+	Inode   uint64
+	ModTime int64
+	Size    int64
+	IsDir   bool
+}
+
+// ParseFileSnapshot parses the output of stat with WatchSnapshotFormat into the states
+// of the files by path. Lines that cannot be parsed, e.g. of files with a newline in
+// their name, are skipped.
+func ParseFileSnapshot(output string) map[string]FileState {
+	snapshot := make(map[string]FileState)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.SplitN(line, " ", 5)
+		if len(fields) != 5 || fields[4] == "" {
+			continue
+		}
+		inode, err1 := strconv.ParseUint(fields[0], 10, 64)
+		modTime, err2 := strconv.ParseInt(fields[1], 10, 64)
+		size, err3 := strconv.ParseInt(fields[2], 10, 64)
+		mode, err4 := strconv.ParseUint(fields[3], 16, 32)
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+			continue
+		}
+		snapshot[fields[4]] = FileState{
+			Inode:   inode,
+			ModTime: modTime,
+			Size:    size,
+			IsDir:   mode&0170000 == 0040000,
+		}
+	}
+	return snapshot
+}
+
+// DiffFileSnapshots returns the events that turn the old snapshot into the new one. A
+// file that disappeared while its inode showed up under another path was renamed; the
+// contents of a renamed directory are not reported separately.
+func DiffFileSnapshots(old, new map[string]FileState, now time.Time) []model.BoxFileEvent {
+	var deleted, created, modified []string
+	// candidates are the new paths a deleted file may have been renamed to, by inode
+	candidates := make(map[uint64][]string)
+	for p, state := range new {
+		prev, ok := old[p]
+		switch {
+		case !ok:
+			created = append(created, p)
+			candidates[state.Inode] = append(candidates[state.Inode], p)
+		case prev.Inode != state.Inode || prev.IsDir != state.IsDir:
+			// Replaced, possibly by renaming another file over it
+			modified = append(modified, p)
+			candidates[state.Inode] = append(candidates[state.Inode], p)
+		case !state.IsDir && (prev.ModTime != state.ModTime || prev.Size != state.Size):
+			modified = append(modified, p)
+		}
+	}
+	for p := range old {
+		if _, ok := new[p]; !ok {
+			deleted = append(deleted, p)
+		}
+	}
+	sort.Strings(deleted)
+	sort.Strings(created)
+	sort.Strings(modified)
+
+	var events []model.BoxFileEvent
+	renamed := make(map[string]string)
+	renamedDirs := make(map[string]string)
+	for _, oldPath := range deleted {
+		state := old[oldPath]
+		newPath := ""
+		for _, p := range candidates[state.Inode] {
+			if _, used := renamed[p]; !used && new[p].IsDir == state.IsDir {
+				newPath = p
+				break
+			}
+		}
+		if newPath == "" {
+			events = append(events, model.BoxFileEvent{Type: model.FileEventDelete, Path: oldPath, IsDir: state.IsDir, Time: now})
+			continue
+		}
+
+		renamed[newPath] = oldPath
+		if state.IsDir {
+			renamedDirs[oldPath] = newPath
+		}
+		if dir, ok := renamedDirs[path.Dir(oldPath)]; ok && dir == path.Dir(newPath) && path.Base(oldPath) == path.Base(newPath) {
+			// Moved along with its directory
+			continue
+		}
+		events = append(events, model.BoxFileEvent{Type: model.FileEventRename, Path: newPath, OldPath: oldPath, IsDir: state.IsDir, Time: now})
+	}
+
+	for _, p := range created {
+		if _, ok := renamed[p]; !ok {
+			events = append(events, model.BoxFileEvent{Type: model.FileEventCreate, Path: p, IsDir: new[p].IsDir, Time: now})
+		}
+	}
+	for _, p := range modified {
+		if _, ok := renamed[p]; !ok {
+			events = append(events, model.BoxFileEvent{Type: model.FileEventModify, Path: p, IsDir: new[p].IsDir, Time: now})
+		}
+	}
+	return events
+}
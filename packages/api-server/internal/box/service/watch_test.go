@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+func fileEvent(eventType, p string) model.BoxFileEvent {
+	return model.BoxFileEvent{Type: eventType, Path: p}
+}
+
+func TestFileEventCoalescer(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []model.BoxFileEvent
+		want   []model.BoxFileEvent
+	}{
+		{
+			name:   "created and written",
+			events: []model.BoxFileEvent{fileEvent("create", "/a"), fileEvent("modify", "/a"), fileEvent("modify", "/a")},
+			want:   []model.BoxFileEvent{fileEvent("create", "/a")},
+		},
+		{
+			name:   "temporary file",
+			events: []model.BoxFileEvent{fileEvent("create", "/tmp"), fileEvent("modify", "/tmp"), fileEvent("delete", "/tmp"), fileEvent("modify", "/b")},
+			want:   []model.BoxFileEvent{fileEvent("modify", "/b")},
+		},
+		{
+			name:   "written and deleted",
+			events: []model.BoxFileEvent{fileEvent("modify", "/a"), fileEvent("delete", "/a")},
+			want:   []model.BoxFileEvent{fileEvent("delete", "/a")},
+		},
+		{
+			name:   "replaced",
+			events: []model.BoxFileEvent{fileEvent("delete", "/a"), fileEvent("create", "/a")},
+			want:   []model.BoxFileEvent{fileEvent("modify", "/a")},
+		},
+		{
+			name: "renames stay in order",
+			events: []model.BoxFileEvent{
+				fileEvent("create", "/a.tmp"),
+				{Type: "rename", Path: "/a", OldPath: "/a.tmp"},
+				fileEvent("modify", "/a"),
+			},
+			want: []model.BoxFileEvent{
+				fileEvent("create", "/a.tmp"),
+				{Type: "rename", Path: "/a", OldPath: "/a.tmp"},
+				fileEvent("modify", "/a"),
+			},
+		},
+		{
+			name:   "file replaced by a directory",
+			events: []model.BoxFileEvent{fileEvent("delete", "/a"), {Type: "create", Path: "/a", IsDir: true}},
+			want:   []model.BoxFileEvent{fileEvent("delete", "/a"), {Type: "create", Path: "/a", IsDir: true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c fileEventCoalescer
+			for _, event := range tt.events {
+				c.add(event)
+			}
+			assert.Equal(t, tt.want, c.flush())
+			assert.Empty(t, c.flush())
+		})
+	}
+}
+
+func TestDebounceFileEvents(t *testing.T) {
+	in := make(chan model.BoxFileEvent)
+	out := make(chan model.BoxFileEvent)
+	go DebounceFileEvents(context.Background(), in, out, 50*time.Millisecond)
+
+	in <- fileEvent("create", "/a")
+	in <- fileEvent("modify", "/a")
+	in <- fileEvent("modify", "/b")
+	select {
+	case event := <-out:
+		t.Fatalf("event %v sent before the debounce window elapsed", event)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	assert.Equal(t, fileEvent("create", "/a"), <-out)
+	assert.Equal(t, fileEvent("modify", "/b"), <-out)
+
+	// Pending events are sent when the input ends
+	in <- fileEvent("delete", "/b")
+	close(in)
+	assert.Equal(t, fileEvent("delete", "/b"), <-out)
+	_, ok := <-out
+	assert.False(t, ok)
+}
+
+func TestParseFileSnapshot(t *testing.T) {
+	snapshot := ParseFileSnapshot("10 1700000000 4096 41ed /app\n11 1700000001 12 81a4 /app/my file.txt\nmalformed\n")
+	assert.Equal(t, map[string]FileState{
+		"/app":             {Inode: 10, ModTime: 1700000000, Size: 4096, IsDir: true},
+		"/app/my file.txt": {Inode: 11, ModTime: 1700000001, Size: 12},
+	}, snapshot)
+}
+
+func TestDiffFileSnapshots(t *testing.T) {
+	now := time.Now()
+	old := map[string]FileState{
+		"/app/dir":       {Inode: 1, IsDir: true},
+		"/app/dir/a.txt": {Inode: 2, ModTime: 1, Size: 1},
+		"/app/b.txt":     {Inode: 3, ModTime: 1, Size: 1},
+		"/app/c.txt":     {Inode: 4, ModTime: 1, Size: 1},
+		"/app/d.tmp":     {Inode: 5, ModTime: 2, Size: 2},
+		"/app/d.txt":     {Inode: 6, ModTime: 1, Size: 1},
+		"/app/gone.txt":  {Inode: 7},
+	}
+	new := map[string]FileState{
+		"/app/moved":       {Inode: 1, IsDir: true},
+		"/app/moved/a.txt": {Inode: 2, ModTime: 1, Size: 1},
+		"/app/b.txt":       {Inode: 3, ModTime: 2, Size: 1},
+		"/app/c.txt":       {Inode: 4, ModTime: 1, Size: 1},
+		"/app/d.txt":       {Inode: 5, ModTime: 2, Size: 2},
+		"/app/new.txt":     {Inode: 8},
+	}
+
+	assert.Equal(t, []model.BoxFileEvent{
+		{Type: "rename", Path: "/app/d.txt", OldPath: "/app/d.tmp", Time: now},
+		{Type: "rename", Path: "/app/moved", OldPath: "/app/dir", IsDir: true, Time: now},
+		{Type: "delete", Path: "/app/gone.txt", Time: now},
+		{Type: "create", Path: "/app/new.txt", Time: now},
+		{Type: "modify", Path: "/app/b.txt", Time: now},
+	}, DiffFileSnapshots(old, new, now))
+}
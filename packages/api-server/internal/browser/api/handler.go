@@ -4,9 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/emicklei/go-restful/v3"
+	"github.com/gorilla/websocket"
 
 	browserSvc "github.com/babelcloud/gbox/packages/api-server/internal/browser/service"
 	model "github.com/babelcloud/gbox/packages/api-server/pkg/browser"
@@ -302,16 +304,176 @@ func executeSpecificAction[P any, R any]( // P: Params type, R: Result type
 	_ = resp.WriteAsJson(result)
 }
 
-// --- TODO: Add Snapshot Action Handlers ---
+// --- Snapshot Action Handlers ---
+
+func (h *Handler) ExecuteSnapshotCaptureAction(req *restful.Request, resp *restful.Response) {
+	executeSpecificAction[model.SnapshotCaptureParams, model.SnapshotCaptureResult](h, req, resp, h.service.ExecuteSnapshotCapture)
+}
+
+func (h *Handler) ExecuteSnapshotClickAction(req *restful.Request, resp *restful.Response) {
+	executeSpecificAction[model.SnapshotClickParams, model.SnapshotClickResult](h, req, resp, h.service.ExecuteSnapshotClick)
+}
+
+func (h *Handler) ExecuteSnapshotHoverAction(req *restful.Request, resp *restful.Response) {
+	executeSpecificAction[model.SnapshotHoverParams, model.SnapshotHoverResult](h, req, resp, h.service.ExecuteSnapshotHover)
+}
+
+func (h *Handler) ExecuteSnapshotDragAction(req *restful.Request, resp *restful.Response) {
+	executeSpecificAction[model.SnapshotDragParams, model.SnapshotDragResult](h, req, resp, h.service.ExecuteSnapshotDrag)
+}
+
+func (h *Handler) ExecuteSnapshotTypeAction(req *restful.Request, resp *restful.Response) {
+	executeSpecificAction[model.SnapshotTypeParams, model.SnapshotTypeResult](h, req, resp, h.service.ExecuteSnapshotType)
+}
+
+func (h *Handler) ExecuteSnapshotSelectOptionAction(req *restful.Request, resp *restful.Response) {
+	executeSpecificAction[model.SnapshotSelectOptionParams, model.SnapshotSelectOptionResult](h, req, resp, h.service.ExecuteSnapshotSelectOption)
+}
+
+func (h *Handler) ExecuteSnapshotTakeScreenshotAction(req *restful.Request, resp *restful.Response) {
+	executeSpecificAction[model.SnapshotTakeScreenshotParams, model.SnapshotTakeScreenshotResult](h, req, resp, h.service.ExecuteSnapshotTakeScreenshot)
+}
+
+// --- Navigation Action Handlers ---
+
+func (h *Handler) ExecuteNavigateAction(req *restful.Request, resp *restful.Response) {
+	executeSpecificAction[model.NavigateParams, model.NavigationResult](h, req, resp, h.service.ExecuteNavigate)
+}
+
+func (h *Handler) ExecuteBackAction(req *restful.Request, resp *restful.Response) {
+	executeSpecificAction[model.HistoryParams, model.NavigationResult](h, req, resp, h.service.ExecuteBack)
+}
+
+func (h *Handler) ExecuteForwardAction(req *restful.Request, resp *restful.Response) {
+	executeSpecificAction[model.HistoryParams, model.NavigationResult](h, req, resp, h.service.ExecuteForward)
+}
+
+func (h *Handler) ExecuteReloadAction(req *restful.Request, resp *restful.Response) {
+	executeSpecificAction[model.HistoryParams, model.NavigationResult](h, req, resp, h.service.ExecuteReload)
+}
+
+func (h *Handler) ExecuteWaitForAction(req *restful.Request, resp *restful.Response) {
+	executeSpecificAction[model.WaitForParams, model.NavigationResult](h, req, resp, h.service.ExecuteWaitFor)
+}
+
+func (h *Handler) ExecuteSetViewportAction(req *restful.Request, resp *restful.Response) {
+	executeSpecificAction[model.SetViewportParams, model.NavigationResult](h, req, resp, h.service.ExecuteSetViewport)
+}
 
 // --- CDP Connection Handlers ---
 
+// upgrader accepts the WebSocket connections relayed to box browsers
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// Clients are scripts rather than pages, the token authorizes them
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
 // GetCdpURL handles GET /boxes/{id}/browser/connect-url/cdp
 func (h *Handler) GetCdpURL(req *restful.Request, resp *restful.Response) {
-	writeError(resp, http.StatusNotImplemented, fmt.Errorf("This feature is exclusively available in the cloud version. Learn more at https://gbox.cloud/."))
+	boxID := req.PathParameter("id")
+	query, _, err := h.service.ConnectQuery(req.Request.Context(), boxID, browserSvc.ConnectProtocolCDP)
+	if err != nil {
+		writeConnectError(resp, err)
+		return
+	}
+
+	resp.WriteHeader(http.StatusOK)
+	_ = resp.WriteAsJson(connectURL(req.Request, "cdp", query))
 }
 
 // GetConnectURL handles GET /boxes/{id}/browser/connect-url
 func (h *Handler) GetConnectURL(req *restful.Request, resp *restful.Response) {
-	writeError(resp, http.StatusNotImplemented, fmt.Errorf("This feature is exclusively available in the cloud version. Learn more at https://gbox.cloud/."))
+	boxID := req.PathParameter("id")
+	query, expiresAt, err := h.service.ConnectQuery(req.Request.Context(), boxID, browserSvc.ConnectProtocolPlaywright)
+	if err != nil {
+		writeConnectError(resp, err)
+		return
+	}
+	result := model.ConnectURLResult{
+		URL:       connectURL(req.Request, "", query),
+		ExpiresAt: expiresAt,
+	}
+
+	// The CDP URL is only available when the box browser exposes a DevTools endpoint
+	cdpQuery, _, err := h.service.ConnectQuery(req.Request.Context(), boxID, browserSvc.ConnectProtocolCDP)
+	if err == nil {
+		result.CdpURL = connectURL(req.Request, "cdp", cdpQuery)
+	} else if !errors.Is(err, browserSvc.ErrCDPUnavailable) {
+		writeConnectError(resp, err)
+		return
+	}
+
+	resp.WriteHeader(http.StatusOK)
+	_ = resp.WriteAsJson(result)
+}
+
+// ConnectBrowser handles GET /boxes/{id}/browser/connect, relaying a WebSocket connection
+// of a Playwright client to the browser of the box
+func (h *Handler) ConnectBrowser(req *restful.Request, resp *restful.Response) {
+	h.connectBrowser(req, resp, browserSvc.ConnectProtocolPlaywright)
+}
+
+// ConnectBrowserCDP handles GET /boxes/{id}/browser/connect/cdp, relaying a WebSocket
+// connection of a CDP client to the browser of the box
+func (h *Handler) ConnectBrowserCDP(req *restful.Request, resp *restful.Response) {
+	h.connectBrowser(req, resp, browserSvc.ConnectProtocolCDP)
+}
+
+func (h *Handler) connectBrowser(req *restful.Request, resp *restful.Response, protocol string) {
+	boxID := req.PathParameter("id")
+	query := req.Request.URL.Query()
+	if err := browserSvc.VerifyConnect(boxID, protocol, query); err != nil {
+		writeError(resp, http.StatusForbidden, err)
+		return
+	}
+
+	// Connect to the box first, so failures are reported before the upgrade
+	upstream, err := h.service.DialBrowser(req.Request.Context(), boxID, protocol, query, req.Request.Header)
+	if err != nil {
+		writeConnectError(resp, err)
+		return
+	}
+	client, err := upgrader.Upgrade(resp.ResponseWriter, req.Request, nil)
+	if err != nil {
+		// Upgrade writes the error response itself
+		upstream.Close()
+		fmt.Printf("ERROR: failed to upgrade browser connection of box %s: %v\n", boxID, err)
+		return
+	}
+	browserSvc.ProxyWebSocket(client, upstream)
+}
+
+// writeConnectError writes the error of a browser connection with its status code
+func writeConnectError(resp *restful.Response, err error) {
+	switch {
+	case errors.Is(err, browserSvc.ErrBoxNotFound):
+		writeError(resp, http.StatusNotFound, err)
+	case errors.Is(err, browserSvc.ErrCDPUnavailable):
+		writeError(resp, http.StatusNotImplemented, err)
+	default:
+		writeError(resp, http.StatusBadGateway, err)
+	}
+}
+
+// connectURL returns the WebSocket URL of the connect proxy of a box as reached by the
+// client of req, honoring the headers of reverse proxies
+func connectURL(req *http.Request, protocol string, query url.Values) string {
+	scheme := "ws"
+	if req.TLS != nil || strings.EqualFold(req.Header.Get("X-Forwarded-Proto"), "https") {
+		scheme = "wss"
+	}
+	host := req.Host
+	if forwarded := req.Header.Get("X-Forwarded-Host"); forwarded != "" {
+		host = forwarded
+	}
+	// Both connect-url routes live next to the proxy routes
+	p := req.URL.Path[:strings.Index(req.URL.Path, "/connect-url")] + "/connect"
+	if protocol == browserSvc.ConnectProtocolCDP {
+		p += "/cdp"
+	}
+	return (&url.URL{Scheme: scheme, Host: host, Path: p, RawQuery: query.Encode()}).String()
 }
@@ -172,20 +172,202 @@ func RegisterBrowserRoutes(ws *restful.WebService, handler *Handler) {
 		Returns(http.StatusNotFound, "Not Found", model.VisionErrorResult{}).
 		Returns(http.StatusInternalServerError, "Internal Server Error", model.VisionErrorResult{}))
 
+	// --- Snapshot Action Routes ---
+
+	// Snapshot Capture
+	ws.Route(ws.POST(actionsPath+"/snapshot-capture").To(handler.ExecuteSnapshotCaptureAction).
+		Doc("Execute snapshot.capture action").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Param(ws.PathParameter("context_id", "identifier of the context").DataType("string")).
+		Param(ws.PathParameter("page_id", "identifier of the page").DataType("string")).
+		Reads(model.SnapshotCaptureParams{}).
+		Returns(http.StatusOK, "OK", model.SnapshotCaptureResult{}).
+		Returns(http.StatusBadRequest, "Bad Request", model.VisionErrorResult{}).
+		Returns(http.StatusNotFound, "Not Found", model.VisionErrorResult{}).
+		Returns(http.StatusInternalServerError, "Internal Server Error", model.VisionErrorResult{}))
+
+	// Snapshot Click
+	ws.Route(ws.POST(actionsPath+"/snapshot-click").To(handler.ExecuteSnapshotClickAction).
+		Doc("Execute snapshot.click action").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Param(ws.PathParameter("context_id", "identifier of the context").DataType("string")).
+		Param(ws.PathParameter("page_id", "identifier of the page").DataType("string")).
+		Reads(model.SnapshotClickParams{}).
+		Returns(http.StatusOK, "OK", model.SnapshotClickResult{}).
+		Returns(http.StatusBadRequest, "Bad Request", model.VisionErrorResult{}).
+		Returns(http.StatusNotFound, "Not Found", model.VisionErrorResult{}).
+		Returns(http.StatusInternalServerError, "Internal Server Error", model.VisionErrorResult{}))
+
+	// Snapshot Hover
+	ws.Route(ws.POST(actionsPath+"/snapshot-hover").To(handler.ExecuteSnapshotHoverAction).
+		Doc("Execute snapshot.hover action").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Param(ws.PathParameter("context_id", "identifier of the context").DataType("string")).
+		Param(ws.PathParameter("page_id", "identifier of the page").DataType("string")).
+		Reads(model.SnapshotHoverParams{}).
+		Returns(http.StatusOK, "OK", model.SnapshotHoverResult{}).
+		Returns(http.StatusBadRequest, "Bad Request", model.VisionErrorResult{}).
+		Returns(http.StatusNotFound, "Not Found", model.VisionErrorResult{}).
+		Returns(http.StatusInternalServerError, "Internal Server Error", model.VisionErrorResult{}))
+
+	// Snapshot Drag
+	ws.Route(ws.POST(actionsPath+"/snapshot-drag").To(handler.ExecuteSnapshotDragAction).
+		Doc("Execute snapshot.drag action").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Param(ws.PathParameter("context_id", "identifier of the context").DataType("string")).
+		Param(ws.PathParameter("page_id", "identifier of the page").DataType("string")).
+		Reads(model.SnapshotDragParams{}).
+		Returns(http.StatusOK, "OK", model.SnapshotDragResult{}).
+		Returns(http.StatusBadRequest, "Bad Request", model.VisionErrorResult{}).
+		Returns(http.StatusNotFound, "Not Found", model.VisionErrorResult{}).
+		Returns(http.StatusInternalServerError, "Internal Server Error", model.VisionErrorResult{}))
+
+	// Snapshot Type
+	ws.Route(ws.POST(actionsPath+"/snapshot-type").To(handler.ExecuteSnapshotTypeAction).
+		Doc("Execute snapshot.type action").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Param(ws.PathParameter("context_id", "identifier of the context").DataType("string")).
+		Param(ws.PathParameter("page_id", "identifier of the page").DataType("string")).
+		Reads(model.SnapshotTypeParams{}).
+		Returns(http.StatusOK, "OK", model.SnapshotTypeResult{}).
+		Returns(http.StatusBadRequest, "Bad Request", model.VisionErrorResult{}).
+		Returns(http.StatusNotFound, "Not Found", model.VisionErrorResult{}).
+		Returns(http.StatusInternalServerError, "Internal Server Error", model.VisionErrorResult{}))
+
+	// Snapshot Select Option
+	ws.Route(ws.POST(actionsPath+"/snapshot-selectOption").To(handler.ExecuteSnapshotSelectOptionAction).
+		Doc("Execute snapshot.selectOption action").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Param(ws.PathParameter("context_id", "identifier of the context").DataType("string")).
+		Param(ws.PathParameter("page_id", "identifier of the page").DataType("string")).
+		Reads(model.SnapshotSelectOptionParams{}).
+		Returns(http.StatusOK, "OK", model.SnapshotSelectOptionResult{}).
+		Returns(http.StatusBadRequest, "Bad Request", model.VisionErrorResult{}).
+		Returns(http.StatusNotFound, "Not Found", model.VisionErrorResult{}).
+		Returns(http.StatusInternalServerError, "Internal Server Error", model.VisionErrorResult{}))
+
+	// Snapshot Take Screenshot
+	ws.Route(ws.POST(actionsPath+"/snapshot-takeScreenshot").To(handler.ExecuteSnapshotTakeScreenshotAction).
+		Doc("Execute snapshot.takeScreenshot action").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Param(ws.PathParameter("context_id", "identifier of the context").DataType("string")).
+		Param(ws.PathParameter("page_id", "identifier of the page").DataType("string")).
+		Reads(model.SnapshotTakeScreenshotParams{}).
+		Returns(http.StatusOK, "OK", model.SnapshotTakeScreenshotResult{}).
+		Returns(http.StatusBadRequest, "Bad Request", model.VisionErrorResult{}).
+		Returns(http.StatusNotFound, "Not Found", model.VisionErrorResult{}).
+		Returns(http.StatusInternalServerError, "Internal Server Error", model.VisionErrorResult{}))
+
+	// --- Navigation Action Routes ---
+
+	// Navigate
+	ws.Route(ws.POST(actionsPath+"/navigate").To(handler.ExecuteNavigateAction).
+		Doc("Execute navigate action").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Param(ws.PathParameter("context_id", "identifier of the context").DataType("string")).
+		Param(ws.PathParameter("page_id", "identifier of the page").DataType("string")).
+		Reads(model.NavigateParams{}).
+		Returns(http.StatusOK, "OK", model.NavigationResult{}).
+		Returns(http.StatusBadRequest, "Bad Request", model.VisionErrorResult{}).
+		Returns(http.StatusNotFound, "Not Found", model.VisionErrorResult{}).
+		Returns(http.StatusInternalServerError, "Internal Server Error", model.VisionErrorResult{}))
+
+	// Back
+	ws.Route(ws.POST(actionsPath+"/back").To(handler.ExecuteBackAction).
+		Doc("Execute back action").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Param(ws.PathParameter("context_id", "identifier of the context").DataType("string")).
+		Param(ws.PathParameter("page_id", "identifier of the page").DataType("string")).
+		Reads(model.HistoryParams{}).
+		Returns(http.StatusOK, "OK", model.NavigationResult{}).
+		Returns(http.StatusBadRequest, "Bad Request", model.VisionErrorResult{}).
+		Returns(http.StatusNotFound, "Not Found", model.VisionErrorResult{}).
+		Returns(http.StatusInternalServerError, "Internal Server Error", model.VisionErrorResult{}))
+
+	// Forward
+	ws.Route(ws.POST(actionsPath+"/forward").To(handler.ExecuteForwardAction).
+		Doc("Execute forward action").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Param(ws.PathParameter("context_id", "identifier of the context").DataType("string")).
+		Param(ws.PathParameter("page_id", "identifier of the page").DataType("string")).
+		Reads(model.HistoryParams{}).
+		Returns(http.StatusOK, "OK", model.NavigationResult{}).
+		Returns(http.StatusBadRequest, "Bad Request", model.VisionErrorResult{}).
+		Returns(http.StatusNotFound, "Not Found", model.VisionErrorResult{}).
+		Returns(http.StatusInternalServerError, "Internal Server Error", model.VisionErrorResult{}))
+
+	// Reload
+	ws.Route(ws.POST(actionsPath+"/reload").To(handler.ExecuteReloadAction).
+		Doc("Execute reload action").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Param(ws.PathParameter("context_id", "identifier of the context").DataType("string")).
+		Param(ws.PathParameter("page_id", "identifier of the page").DataType("string")).
+		Reads(model.HistoryParams{}).
+		Returns(http.StatusOK, "OK", model.NavigationResult{}).
+		Returns(http.StatusBadRequest, "Bad Request", model.VisionErrorResult{}).
+		Returns(http.StatusNotFound, "Not Found", model.VisionErrorResult{}).
+		Returns(http.StatusInternalServerError, "Internal Server Error", model.VisionErrorResult{}))
+
+	// Wait For
+	ws.Route(ws.POST(actionsPath+"/waitFor").To(handler.ExecuteWaitForAction).
+		Doc("Execute waitFor action").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Param(ws.PathParameter("context_id", "identifier of the context").DataType("string")).
+		Param(ws.PathParameter("page_id", "identifier of the page").DataType("string")).
+		Reads(model.WaitForParams{}).
+		Returns(http.StatusOK, "OK", model.NavigationResult{}).
+		Returns(http.StatusBadRequest, "Bad Request", model.VisionErrorResult{}).
+		Returns(http.StatusNotFound, "Not Found", model.VisionErrorResult{}).
+		Returns(http.StatusInternalServerError, "Internal Server Error", model.VisionErrorResult{}))
+
+	// Set Viewport
+	ws.Route(ws.POST(actionsPath+"/setViewport").To(handler.ExecuteSetViewportAction).
+		Doc("Execute setViewport action").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Param(ws.PathParameter("context_id", "identifier of the context").DataType("string")).
+		Param(ws.PathParameter("page_id", "identifier of the page").DataType("string")).
+		Reads(model.SetViewportParams{}).
+		Returns(http.StatusOK, "OK", model.NavigationResult{}).
+		Returns(http.StatusBadRequest, "Bad Request", model.VisionErrorResult{}).
+		Returns(http.StatusNotFound, "Not Found", model.VisionErrorResult{}).
+		Returns(http.StatusInternalServerError, "Internal Server Error", model.VisionErrorResult{}))
+
 	// --- CDP Connection Routes ---
 
 	ws.Route(ws.GET("/boxes/{id}/browser/connect-url/cdp").To(handler.GetCdpURL).
-		Doc("Get CDP URL for browser connection").
+		Doc("Get the CDP URL for connecting to the browser through the server").
 		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
 		Returns(http.StatusOK, "OK", "string").
+		Returns(http.StatusNotFound, "Not Found", nil).
 		Returns(http.StatusNotImplemented, "Not Implemented", nil).
 		Returns(http.StatusInternalServerError, "Internal Server Error", nil))
 
 	ws.Route(ws.GET("/boxes/{id}/browser/connect-url").To(handler.GetConnectURL).
-		Doc("Get connect URL information for browser").
+		Doc("Get the Playwright and CDP URLs for connecting to the browser through the server").
 		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
 		Returns(http.StatusOK, "OK", model.ConnectURLResult{}).
-		Returns(http.StatusNotImplemented, "Not Implemented", nil).
+		Returns(http.StatusNotFound, "Not Found", nil).
 		Returns(http.StatusInternalServerError, "Internal Server Error", nil))
 
+	ws.Route(ws.GET("/boxes/{id}/browser/connect").To(handler.ConnectBrowser).
+		Doc("Relay a WebSocket connection of a Playwright client to the browser").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Param(ws.QueryParameter("expires", "expiry of the connect URL, as returned by connect-url").DataType("string")).
+		Param(ws.QueryParameter("signature", "token of the connect URL, as returned by connect-url").DataType("string")).
+		Returns(http.StatusSwitchingProtocols, "Switching Protocols", nil).
+		Returns(http.StatusForbidden, "Forbidden", nil).
+		Returns(http.StatusNotFound, "Not Found", nil).
+		Returns(http.StatusBadGateway, "Bad Gateway", nil))
+
+	ws.Route(ws.GET("/boxes/{id}/browser/connect/cdp").To(handler.ConnectBrowserCDP).
+		Doc("Relay a WebSocket connection of a CDP client to the browser").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Param(ws.QueryParameter("expires", "expiry of the connect URL, as returned by connect-url").DataType("string")).
+		Param(ws.QueryParameter("signature", "token of the connect URL, as returned by connect-url").DataType("string")).
+		Returns(http.StatusSwitchingProtocols, "Switching Protocols", nil).
+		Returns(http.StatusForbidden, "Forbidden", nil).
+		Returns(http.StatusNotFound, "Not Found", nil).
+		Returns(http.StatusNotImplemented, "Not Implemented", nil).
+		Returns(http.StatusBadGateway, "Bad Gateway", nil))
+
 }
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/babelcloud/gbox/packages/api-server/config"
+	boxSvc "github.com/babelcloud/gbox/packages/api-server/internal/box/service"
+	"github.com/babelcloud/gbox/packages/api-server/internal/file/share"
+)
+
+// Protocols the browser of a box can be driven with through the connect proxy
+const (
+	ConnectProtocolPlaywright = "playwright"
+	ConnectProtocolCDP        = "cdp"
+)
+
+// defaultLaunchOptions are the launch options of Playwright clients that send none
+const defaultLaunchOptions = `{"channel":"chromium"}`
+
+// ErrCDPUnavailable is returned when the box browser has no Chrome DevTools endpoint configured
+var ErrCDPUnavailable = errors.New("the box browser exposes no CDP endpoint, set browser.cdp_port to the DevTools port of the box image")
+
+// connectSignPath is the path the connect URLs of a box are signed for
+func connectSignPath(boxID, protocol string) string {
+	return path.Join(boxID, protocol)
+}
+
+// ConnectQuery returns the query authorizing connections to the browser of a box through
+// the connect proxy, and when it expires. Both are empty when connect tokens are disabled.
+func (s *BrowserService) ConnectQuery(ctx context.Context, boxID, protocol string) (url.Values, *time.Time, error) {
+	if protocol == ConnectProtocolCDP && config.GetInstance().Browser.CdpPort <= 0 {
+		return nil, nil, ErrCDPUnavailable
+	}
+	if _, err := s.boxManager.Get(ctx, boxID); err != nil {
+		return nil, nil, boxError(boxID, err)
+	}
+
+	ttl := config.GetInstance().Browser.ConnectURLTTL
+	if ttl <= 0 {
+		return url.Values{}, nil, nil
+	}
+	expires := time.Now().Add(ttl)
+	return share.Default().SignQuery(share.PurposeBrowserConnect, connectSignPath(boxID, protocol), expires, ""), &expires, nil
+}
+
+// VerifyConnect checks the token in the query of a connection to the browser of a box
+func VerifyConnect(boxID, protocol string, query url.Values) error {
+	if config.GetInstance().Browser.ConnectURLTTL <= 0 {
+		return nil
+	}
+	return share.Default().Verify(share.PurposeBrowserConnect, connectSignPath(boxID, protocol), query, time.Now())
+}
+
+// DialBrowser opens a WebSocket connection to the browser endpoint of a box. For Playwright,
+// the query and the Playwright headers of the client are passed on to the server in the
+// box, less the token, so clients can pick launch options.
+func (s *BrowserService) DialBrowser(ctx context.Context, boxID, protocol string, query url.Values, header http.Header) (*websocket.Conn, error) {
+	cfg := config.GetInstance().Browser
+	internalPort := cfg.InternalPort
+	if protocol == ConnectProtocolCDP {
+		if cfg.CdpPort <= 0 {
+			return nil, ErrCDPUnavailable
+		}
+		internalPort = cfg.CdpPort
+	}
+	port, err := s.boxManager.GetExternalPort(ctx, boxID, internalPort)
+	if err != nil {
+		return nil, boxError(boxID, err)
+	}
+	host := cfg.Host
+	if host == "" {
+		host = "localhost"
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+
+	upstreamHeader := http.Header{}
+	var endpoint string
+	if protocol == ConnectProtocolCDP {
+		if endpoint, err = cdpBrowserEndpoint(ctx, addr); err != nil {
+			return nil, err
+		}
+	} else {
+		forwarded := url.Values{}
+		for key, values := range query {
+			if key != "expires" && key != "signature" {
+				forwarded[key] = values
+			}
+		}
+		// The Playwright server rejects clients of another version, which it reads from the user agent
+		for key, values := range header {
+			if strings.HasPrefix(strings.ToLower(key), "x-playwright-") || strings.EqualFold(key, "User-Agent") {
+				upstreamHeader[key] = values
+			}
+		}
+		if forwarded.Get("launch-options") == "" && upstreamHeader.Get("X-Playwright-Launch-Options") == "" {
+			forwarded.Set("launch-options", defaultLaunchOptions)
+		}
+		endpoint = (&url.URL{Scheme: "ws", Host: addr, Path: "/", RawQuery: forwarded.Encode()}).String()
+	}
+
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, endpoint, upstreamHeader)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("failed to connect to the browser of box %s: %v (status %d)", boxID, err, resp.StatusCode)
+		}
+		return nil, fmt.Errorf("failed to connect to the browser of box %s: %w", boxID, err)
+	}
+	return conn, nil
+}
+
+// cdpBrowserEndpoint returns the WebSocket URL of the browser target of a DevTools endpoint.
+// The endpoint advertises its address inside the box, which is replaced by addr.
+func cdpBrowserEndpoint(ctx context.Context, addr string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+"/json/version", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to reach the DevTools endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("DevTools endpoint returned status %d", resp.StatusCode)
+	}
+
+	var version struct {
+		WebSocketDebuggerURL string `json:"webSocketDebuggerUrl"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&version); err != nil {
+		return "", fmt.Errorf("invalid DevTools version response: %w", err)
+	}
+	endpoint, err := url.Parse(version.WebSocketDebuggerURL)
+	if err != nil || endpoint.Path == "" {
+		return "", fmt.Errorf("invalid DevTools browser endpoint %q", version.WebSocketDebuggerURL)
+	}
+	endpoint.Scheme = "ws"
+	endpoint.Host = addr
+	return endpoint.String(), nil
+}
+
+// boxError wraps the not found errors of the box service in ErrBoxNotFound
+func boxError(boxID string, err error) error {
+	if errors.Is(err, boxSvc.ErrBoxNotFound) {
+		return fmt.Errorf("%w: %s", ErrBoxNotFound, boxID)
+	}
+	return err
+}
+
+// ProxyWebSocket relays messages between a client and an upstream WebSocket connection
+// until either side closes, passing the close code on to the other side, then closes both.
+func ProxyWebSocket(client, upstream *websocket.Conn) {
+	done := make(chan struct{}, 2)
+	relay := func(dst, src *websocket.Conn) {
+		defer func() { done <- struct{}{} }()
+		for {
+			messageType, data, err := src.ReadMessage()
+			if err != nil {
+				code, text := websocket.CloseGoingAway, ""
+				var closeErr *websocket.CloseError
+				// Codes reporting a dropped connection cannot be sent
+				if errors.As(err, &closeErr) && closeErr.Code != websocket.CloseAbnormalClosure && closeErr.Code != websocket.CloseTLSHandshake {
+					code, text = closeErr.Code, closeErr.Text
+				}
+				_ = dst.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(time.Second))
+				return
+			}
+			if err := dst.WriteMessage(messageType, data); err != nil {
+				return
+			}
+		}
+	}
+
+	go relay(upstream, client)
+	go relay(client, upstream)
+	<-done
+	client.Close()
+	upstream.Close()
+	<-done
+}
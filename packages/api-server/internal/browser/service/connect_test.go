@@ -0,0 +1,61 @@
+package service_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/babelcloud/gbox/packages/api-server/internal/browser/service"
+)
+
+// TestProxyWebSocket verifies that messages and close codes are relayed both ways.
+func TestProxyWebSocket(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+
+	// Upstream echoes messages in upper case, and closes when told to
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if string(data) == "bye" {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "done"))
+				return
+			}
+			conn.WriteMessage(messageType, []byte(strings.ToUpper(string(data))))
+		}
+	}))
+	defer upstreamServer.Close()
+
+	proxyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(upstreamServer.URL, "http"), nil)
+		require.NoError(t, err)
+		client, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		service.ProxyWebSocket(client, upstream)
+	}))
+	defer proxyServer.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(proxyServer.URL, "http"), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("hello")))
+	messageType, data, err := conn.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, websocket.TextMessage, messageType)
+	assert.Equal(t, "HELLO", string(data))
+
+	require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, []byte("bye")))
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), "got %v", err)
+}
@@ -0,0 +1,196 @@
+// packages/api-server/internal/browser/service/page_action_navigation.go
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/browser"
+)
+
+// defaultWaitForTimeout bounds waitFor actions without a timeout, like Playwright's default
+const defaultWaitForTimeout = 30 * time.Second
+
+var (
+	validWaitUntilStates = map[playwright.WaitUntilState]bool{
+		"": true, "load": true, "domcontentloaded": true, "networkidle": true, "commit": true,
+	}
+	validLoadStates = map[string]bool{
+		"load": true, "domcontentloaded": true, "networkidle": true,
+	}
+	validSelectorStates = map[string]bool{
+		"visible": true, "hidden": true, "attached": true, "detached": true,
+	}
+)
+
+// navigationResult returns the URL and title of a page after a navigation action
+func navigationResult(action model.PageActionType, page playwright.Page) interface{} {
+	title, err := page.Title()
+	if err != nil {
+		return actionError(action, err)
+	}
+	return model.NavigationResult{Success: true, URL: page.URL(), Title: title}
+}
+
+// navigationOptions returns the timeout and wait state options of a navigation
+func navigationOptions(waitUntil playwright.WaitUntilState, timeout int) (*float64, *playwright.WaitUntilState, error) {
+	if !validWaitUntilStates[waitUntil] {
+		return nil, nil, fmt.Errorf("invalid wait_until %q", waitUntil)
+	}
+	var timeoutOpt *float64
+	if timeout > 0 {
+		timeoutOpt = playwright.Float(float64(timeout))
+	}
+	var waitUntilOpt *playwright.WaitUntilState
+	if waitUntil != "" {
+		waitUntilOpt = &waitUntil
+	}
+	return timeoutOpt, waitUntilOpt, nil
+}
+
+// --- Navigation Actions ---
+
+// ExecuteNavigate handles the navigate action.
+func (s *BrowserService) ExecuteNavigate(boxID, contextID, pageID string, params model.NavigateParams) interface{} {
+	targetPage, err := s.GetPageInstance(boxID, contextID, pageID)
+	if err != nil {
+		return actionError(model.ActionNavigate, err)
+	}
+	if params.URL == "" {
+		return actionError(model.ActionNavigate, fmt.Errorf("url is required"))
+	}
+	timeout, waitUntil, err := navigationOptions(params.WaitUntil, params.Timeout)
+	if err != nil {
+		return actionError(model.ActionNavigate, err)
+	}
+	if _, err := targetPage.Goto(params.URL, playwright.PageGotoOptions{Timeout: timeout, WaitUntil: waitUntil}); err != nil {
+		return actionError(model.ActionNavigate, err)
+	}
+	return navigationResult(model.ActionNavigate, targetPage)
+}
+
+// ExecuteBack handles the back action. The page stays where it is without history.
+func (s *BrowserService) ExecuteBack(boxID, contextID, pageID string, params model.HistoryParams) interface{} {
+	targetPage, err := s.GetPageInstance(boxID, contextID, pageID)
+	if err != nil {
+		return actionError(model.ActionBack, err)
+	}
+	timeout, waitUntil, err := navigationOptions(params.WaitUntil, params.Timeout)
+	if err != nil {
+		return actionError(model.ActionBack, err)
+	}
+	if _, err := targetPage.GoBack(playwright.PageGoBackOptions{Timeout: timeout, WaitUntil: waitUntil}); err != nil {
+		return actionError(model.ActionBack, err)
+	}
+	return navigationResult(model.ActionBack, targetPage)
+}
+
+// ExecuteForward handles the forward action. The page stays where it is without history.
+func (s *BrowserService) ExecuteForward(boxID, contextID, pageID string, params model.HistoryParams) interface{} {
+	targetPage, err := s.GetPageInstance(boxID, contextID, pageID)
+	if err != nil {
+		return actionError(model.ActionForward, err)
+	}
+	timeout, waitUntil, err := navigationOptions(params.WaitUntil, params.Timeout)
+	if err != nil {
+		return actionError(model.ActionForward, err)
+	}
+	if _, err := targetPage.GoForward(playwright.PageGoForwardOptions{Timeout: timeout, WaitUntil: waitUntil}); err != nil {
+		return actionError(model.ActionForward, err)
+	}
+	return navigationResult(model.ActionForward, targetPage)
+}
+
+// ExecuteReload handles the reload action.
+func (s *BrowserService) ExecuteReload(boxID, contextID, pageID string, params model.HistoryParams) interface{} {
+	targetPage, err := s.GetPageInstance(boxID, contextID, pageID)
+	if err != nil {
+		return actionError(model.ActionReload, err)
+	}
+	timeout, waitUntil, err := navigationOptions(params.WaitUntil, params.Timeout)
+	if err != nil {
+		return actionError(model.ActionReload, err)
+	}
+	if _, err := targetPage.Reload(playwright.PageReloadOptions{Timeout: timeout, WaitUntil: waitUntil}); err != nil {
+		return actionError(model.ActionReload, err)
+	}
+	return navigationResult(model.ActionReload, targetPage)
+}
+
+// ExecuteWaitFor handles the waitFor action. All the conditions share the timeout.
+func (s *BrowserService) ExecuteWaitFor(boxID, contextID, pageID string, params model.WaitForParams) interface{} {
+	targetPage, err := s.GetPageInstance(boxID, contextID, pageID)
+	if err != nil {
+		return actionError(model.ActionWaitFor, err)
+	}
+	if params.Selector == "" && params.Text == "" && params.URL == "" && params.LoadState == "" {
+		return actionError(model.ActionWaitFor, fmt.Errorf("one of selector, text, url or load_state is required"))
+	}
+	if params.LoadState != "" && !validLoadStates[params.LoadState] {
+		return actionError(model.ActionWaitFor, fmt.Errorf("invalid load_state %q", params.LoadState))
+	}
+	state := "visible"
+	if params.State != "" {
+		if !validSelectorStates[params.State] {
+			return actionError(model.ActionWaitFor, fmt.Errorf("invalid state %q", params.State))
+		}
+		state = params.State
+	}
+
+	timeout := defaultWaitForTimeout
+	if params.Timeout > 0 {
+		timeout = time.Duration(params.Timeout) * time.Millisecond
+	}
+	deadline := time.Now().Add(timeout)
+	// remaining returns the time left for the next condition, in milliseconds
+	remaining := func() *float64 {
+		left := time.Until(deadline).Milliseconds()
+		if left < 1 {
+			left = 1
+		}
+		return playwright.Float(float64(left))
+	}
+	selectorState := playwright.WaitForSelectorState(state)
+
+	if params.URL != "" {
+		if err := targetPage.WaitForURL(params.URL, playwright.PageWaitForURLOptions{Timeout: remaining()}); err != nil {
+			return actionError(model.ActionWaitFor, err)
+		}
+	}
+	if params.LoadState != "" {
+		loadState := playwright.LoadState(params.LoadState)
+		if err := targetPage.WaitForLoadState(playwright.PageWaitForLoadStateOptions{State: &loadState, Timeout: remaining()}); err != nil {
+			return actionError(model.ActionWaitFor, err)
+		}
+	}
+	if params.Selector != "" {
+		err := targetPage.Locator(params.Selector).First().WaitFor(playwright.LocatorWaitForOptions{State: &selectorState, Timeout: remaining()})
+		if err != nil {
+			return actionError(model.ActionWaitFor, err)
+		}
+	}
+	if params.Text != "" {
+		err := targetPage.GetByText(params.Text).First().WaitFor(playwright.LocatorWaitForOptions{State: &selectorState, Timeout: remaining()})
+		if err != nil {
+			return actionError(model.ActionWaitFor, err)
+		}
+	}
+	return navigationResult(model.ActionWaitFor, targetPage)
+}
+
+// ExecuteSetViewport handles the setViewport action.
+func (s *BrowserService) ExecuteSetViewport(boxID, contextID, pageID string, params model.SetViewportParams) interface{} {
+	targetPage, err := s.GetPageInstance(boxID, contextID, pageID)
+	if err != nil {
+		return actionError(model.ActionSetViewport, err)
+	}
+	if params.Width <= 0 || params.Height <= 0 {
+		return actionError(model.ActionSetViewport, fmt.Errorf("width and height must be positive"))
+	}
+	if err := targetPage.SetViewportSize(params.Width, params.Height); err != nil {
+		return actionError(model.ActionSetViewport, err)
+	}
+	return navigationResult(model.ActionSetViewport, targetPage)
+}
@@ -0,0 +1,72 @@
+package service_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/browser"
+)
+
+// requireNavigationResult asserts that a navigation action succeeded and returns its result
+func requireNavigationResult(t *testing.T, result interface{}) model.NavigationResult {
+	t.Helper()
+	navigation, ok := result.(model.NavigationResult)
+	require.True(t, ok, "Navigation action failed: %v", result)
+	assert.True(t, navigation.Success)
+	return navigation
+}
+
+// TestNavigationActions verifies navigating between pages and through the history, and
+// that each action reports the URL and title afterwards.
+func TestNavigationActions(t *testing.T) {
+	svc, boxID, contextID, pageID, page, cleanup := setupServiceWithVisionTestPage(t)
+	defer cleanup()
+	firstURL := page.URL()
+
+	secondURL := "data:text/html,<title>Second Page</title><p id=\"second\">Second page</p>"
+	result := requireNavigationResult(t, svc.ExecuteNavigate(boxID, contextID, pageID, model.NavigateParams{URL: secondURL}))
+	assert.Equal(t, "Second Page", result.Title)
+	assert.True(t, strings.HasPrefix(result.URL, "data:text/html"), "Unexpected URL after navigate: %s", result.URL)
+
+	result = requireNavigationResult(t, svc.ExecuteBack(boxID, contextID, pageID, model.HistoryParams{}))
+	assert.Equal(t, firstURL, result.URL)
+	assert.Equal(t, "Vision Action Test Page", result.Title)
+
+	result = requireNavigationResult(t, svc.ExecuteForward(boxID, contextID, pageID, model.HistoryParams{}))
+	assert.Equal(t, "Second Page", result.Title)
+
+	result = requireNavigationResult(t, svc.ExecuteReload(boxID, contextID, pageID, model.HistoryParams{WaitUntil: "domcontentloaded"}))
+	assert.Equal(t, "Second Page", result.Title)
+
+	// Wait for conditions that already hold
+	result = requireNavigationResult(t, svc.ExecuteWaitFor(boxID, contextID, pageID, model.WaitForParams{
+		Selector:  "#second",
+		Text:      "Second page",
+		URL:       "data:**",
+		LoadState: "load",
+		Timeout:   5000,
+	}))
+	assert.Equal(t, "Second Page", result.Title)
+
+	// Wait for a condition that never holds
+	errResult, ok := svc.ExecuteWaitFor(boxID, contextID, pageID, model.WaitForParams{Selector: "#missing", Timeout: 500}).(model.VisionErrorResult)
+	require.True(t, ok, "Expected waitFor to time out")
+	assert.Contains(t, errResult.Error, "waitFor failed")
+
+	// Invalid parameters
+	_, ok = svc.ExecuteWaitFor(boxID, contextID, pageID, model.WaitForParams{}).(model.VisionErrorResult)
+	assert.True(t, ok, "Expected waitFor without conditions to fail")
+	_, ok = svc.ExecuteNavigate(boxID, contextID, pageID, model.NavigateParams{URL: secondURL, WaitUntil: "never"}).(model.VisionErrorResult)
+	assert.True(t, ok, "Expected navigate with an invalid wait_until to fail")
+
+	requireNavigationResult(t, svc.ExecuteSetViewport(boxID, contextID, pageID, model.SetViewportParams{Width: 800, Height: 600}))
+	viewport := page.ViewportSize()
+	require.NotNil(t, viewport)
+	assert.Equal(t, 800, viewport.Width)
+	assert.Equal(t, 600, viewport.Height)
+	_, ok = svc.ExecuteSetViewport(boxID, contextID, pageID, model.SetViewportParams{Width: 0, Height: 600}).(model.VisionErrorResult)
+	assert.True(t, ok, "Expected setViewport with a zero width to fail")
+}
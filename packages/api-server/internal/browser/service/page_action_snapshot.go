@@ -2,56 +2,208 @@
 package service
 
 import (
+	_ "embed"
+	"encoding/base64"
 	"fmt"
+	"regexp"
 
 	"github.com/playwright-community/playwright-go"
 
 	model "github.com/babelcloud/gbox/packages/api-server/pkg/browser"
 )
 
-// --- Snapshot Actions (Placeholders) ---
-// TODO: Implement these functions when snapshot logic is developed.
-// They should accept specific parameter structs (e.g., model.SnapshotClickParams)
-// and return specific result structs (e.g., model.SnapshotClickResult) or VisionErrorResult.
+// snapshotScript captures the accessibility tree of a page and assigns refs to its elements
+//
+//go:embed snapshot.js
+var snapshotScript string
 
-func (s *BrowserService) ExecuteSnapshotClick(targetPage playwright.Page, params interface{}) interface{} {
-	// TODO: Type assert params to model.SnapshotClickParams, implement logic
-	err := fmt.Errorf("snapshot action '%s' is not yet implemented", model.ActionSnapshotClick)
-	return model.VisionErrorResult{Success: false, Error: err.Error()}
+// snapshotRefAttribute is the attribute snapshotScript stores the ref of an element in
+const snapshotRefAttribute = "data-gbox-ref"
+
+// snapshotRefPattern matches the refs assigned by snapshotScript
+var snapshotRefPattern = regexp.MustCompile(`^[a-z0-9]+e[0-9]+$`)
+
+// refLocator returns the locator of the element with a ref from the last snapshot of the page
+func refLocator(page playwright.Page, ref string) (playwright.Locator, error) {
+	if ref == "" {
+		return nil, fmt.Errorf("ref is required")
+	}
+	if !snapshotRefPattern.MatchString(ref) {
+		return nil, fmt.Errorf("invalid ref %q, use a ref returned by %s", ref, model.ActionSnapshotCapture)
+	}
+	locator := page.Locator(fmt.Sprintf("[%s=%q]", snapshotRefAttribute, ref))
+	count, err := locator.Count()
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("element with ref %s not found, capture a new snapshot", ref)
+	}
+	return locator.First(), nil
+}
+
+// --- Snapshot Actions ---
+
+// ExecuteSnapshotCapture handles the snapshot.capture action.
+func (s *BrowserService) ExecuteSnapshotCapture(boxID, contextID, pageID string, params model.SnapshotCaptureParams) interface{} {
+	targetPage, err := s.GetPageInstance(boxID, contextID, pageID)
+	if err != nil {
+		return actionError(model.ActionSnapshotCapture, err)
+	}
+	if params.Ref != "" && !snapshotRefPattern.MatchString(params.Ref) {
+		return actionError(model.ActionSnapshotCapture, fmt.Errorf("invalid ref %q", params.Ref))
+	}
+	snapshot, err := targetPage.Evaluate(snapshotScript, params.Ref)
+	if err != nil {
+		return actionError(model.ActionSnapshotCapture, err)
+	}
+	title, err := targetPage.Title()
+	if err != nil {
+		return actionError(model.ActionSnapshotCapture, err)
+	}
+	text, _ := snapshot.(string)
+	return model.SnapshotCaptureResult{Success: true, Snapshot: text, URL: targetPage.URL(), Title: title}
 }
 
-func (s *BrowserService) ExecuteSnapshotHover(targetPage playwright.Page, params interface{}) interface{} {
-	// TODO: Type assert params to model.SnapshotHoverParams, implement logic
-	err := fmt.Errorf("snapshot action '%s' is not yet implemented", model.ActionSnapshotHover)
-	return model.VisionErrorResult{Success: false, Error: err.Error()}
+// ExecuteSnapshotClick handles the snapshot.click action.
+func (s *BrowserService) ExecuteSnapshotClick(boxID, contextID, pageID string, params model.SnapshotClickParams) interface{} {
+	targetPage, err := s.GetPageInstance(boxID, contextID, pageID)
+	if err != nil {
+		return actionError(model.ActionSnapshotClick, err)
+	}
+	locator, err := refLocator(targetPage, params.Ref)
+	if err != nil {
+		return actionError(model.ActionSnapshotClick, err)
+	}
+	if params.DoubleClick {
+		err = locator.Dblclick(playwright.LocatorDblclickOptions{Button: mapMouseButton(params.Button)})
+	} else {
+		err = locator.Click(playwright.LocatorClickOptions{Button: mapMouseButton(params.Button)})
+	}
+	if err != nil {
+		return actionError(model.ActionSnapshotClick, err)
+	}
+	return model.SnapshotClickResult{Success: true}
 }
 
-func (s *BrowserService) ExecuteSnapshotDrag(targetPage playwright.Page, params interface{}) interface{} {
-	// TODO: Type assert params to model.SnapshotDragParams, implement logic
-	err := fmt.Errorf("snapshot action '%s' is not yet implemented", model.ActionSnapshotDrag)
-	return model.VisionErrorResult{Success: false, Error: err.Error()}
+// ExecuteSnapshotHover handles the snapshot.hover action.
+func (s *BrowserService) ExecuteSnapshotHover(boxID, contextID, pageID string, params model.SnapshotHoverParams) interface{} {
+	targetPage, err := s.GetPageInstance(boxID, contextID, pageID)
+	if err != nil {
+		return actionError(model.ActionSnapshotHover, err)
+	}
+	locator, err := refLocator(targetPage, params.Ref)
+	if err != nil {
+		return actionError(model.ActionSnapshotHover, err)
+	}
+	if err := locator.Hover(); err != nil {
+		return actionError(model.ActionSnapshotHover, err)
+	}
+	return model.SnapshotHoverResult{Success: true}
 }
 
-func (s *BrowserService) ExecuteSnapshotType(targetPage playwright.Page, params interface{}) interface{} {
-	// TODO: Type assert params to model.SnapshotTypeParams, implement logic
-	err := fmt.Errorf("snapshot action '%s' is not yet implemented", model.ActionSnapshotType)
-	return model.VisionErrorResult{Success: false, Error: err.Error()}
+// ExecuteSnapshotDrag handles the snapshot.drag action.
+func (s *BrowserService) ExecuteSnapshotDrag(boxID, contextID, pageID string, params model.SnapshotDragParams) interface{} {
+	targetPage, err := s.GetPageInstance(boxID, contextID, pageID)
+	if err != nil {
+		return actionError(model.ActionSnapshotDrag, err)
+	}
+	source, err := refLocator(targetPage, params.StartRef)
+	if err != nil {
+		return actionError(model.ActionSnapshotDrag, err)
+	}
+	target, err := refLocator(targetPage, params.EndRef)
+	if err != nil {
+		return actionError(model.ActionSnapshotDrag, err)
+	}
+	if err := source.DragTo(target); err != nil {
+		return actionError(model.ActionSnapshotDrag, err)
+	}
+	return model.SnapshotDragResult{Success: true}
 }
 
-func (s *BrowserService) ExecuteSnapshotSelectOption(targetPage playwright.Page, params interface{}) interface{} {
-	// TODO: Type assert params to model.SnapshotSelectOptionParams, implement logic
-	err := fmt.Errorf("snapshot action '%s' is not yet implemented", model.ActionSnapshotSelectOption)
-	return model.VisionErrorResult{Success: false, Error: err.Error()}
+// ExecuteSnapshotType handles the snapshot.type action.
+func (s *BrowserService) ExecuteSnapshotType(boxID, contextID, pageID string, params model.SnapshotTypeParams) interface{} {
+	targetPage, err := s.GetPageInstance(boxID, contextID, pageID)
+	if err != nil {
+		return actionError(model.ActionSnapshotType, err)
+	}
+	locator, err := refLocator(targetPage, params.Ref)
+	if err != nil {
+		return actionError(model.ActionSnapshotType, err)
+	}
+	if params.Slowly {
+		// Clear the element first, so that typing replaces its content like Fill does
+		if err = locator.Fill(""); err == nil {
+			err = locator.PressSequentially(params.Text)
+		}
+	} else {
+		err = locator.Fill(params.Text)
+	}
+	if err == nil && params.Submit {
+		err = locator.Press("Enter")
+	}
+	if err != nil {
+		return actionError(model.ActionSnapshotType, err)
+	}
+	return model.SnapshotTypeResult{Success: true}
 }
 
-func (s *BrowserService) ExecuteSnapshotCapture(targetPage playwright.Page, params interface{}) interface{} {
-	// TODO: Type assert params to model.SnapshotCaptureParams, implement logic
-	err := fmt.Errorf("snapshot action '%s' is not yet implemented", model.ActionSnapshotCapture)
-	return model.VisionErrorResult{Success: false, Error: err.Error()}
+// ExecuteSnapshotSelectOption handles the snapshot.selectOption action.
+func (s *BrowserService) ExecuteSnapshotSelectOption(boxID, contextID, pageID string, params model.SnapshotSelectOptionParams) interface{} {
+	targetPage, err := s.GetPageInstance(boxID, contextID, pageID)
+	if err != nil {
+		return actionError(model.ActionSnapshotSelectOption, err)
+	}
+	if len(params.Values) == 0 {
+		return actionError(model.ActionSnapshotSelectOption, fmt.Errorf("at least one value is required"))
+	}
+	locator, err := refLocator(targetPage, params.Ref)
+	if err != nil {
+		return actionError(model.ActionSnapshotSelectOption, err)
+	}
+	selected, err := locator.SelectOption(playwright.SelectOptionValues{ValuesOrLabels: &params.Values})
+	if err != nil {
+		return actionError(model.ActionSnapshotSelectOption, err)
+	}
+	return model.SnapshotSelectOptionResult{Success: true, Selected: selected}
 }
 
-func (s *BrowserService) ExecuteSnapshotTakeScreenshot(targetPage playwright.Page, params interface{}) interface{} {
-	// TODO: Type assert params to model.SnapshotTakeScreenshotParams, implement logic
-	err := fmt.Errorf("snapshot action '%s' is not yet implemented", model.ActionSnapshotTakeScreenshot)
-	return model.VisionErrorResult{Success: false, Error: err.Error()}
+// ExecuteSnapshotTakeScreenshot handles the snapshot.takeScreenshot action.
+func (s *BrowserService) ExecuteSnapshotTakeScreenshot(boxID, contextID, pageID string, params model.SnapshotTakeScreenshotParams) interface{} {
+	targetPage, err := s.GetPageInstance(boxID, contextID, pageID)
+	if err != nil {
+		return actionError(model.ActionSnapshotTakeScreenshot, err)
+	}
+
+	screenshotType, fileExt := playwright.ScreenshotTypePng, "png"
+	if params.Type != nil && (*params.Type == "jpeg" || *params.Type == "jpg") {
+		screenshotType, fileExt = playwright.ScreenshotTypeJpeg, "jpeg"
+	}
+
+	var buffer []byte
+	if params.Ref != "" {
+		locator, err := refLocator(targetPage, params.Ref)
+		if err != nil {
+			return actionError(model.ActionSnapshotTakeScreenshot, err)
+		}
+		buffer, err = locator.Screenshot(playwright.LocatorScreenshotOptions{Type: screenshotType})
+		if err != nil {
+			return actionError(model.ActionSnapshotTakeScreenshot, err)
+		}
+	} else {
+		buffer, err = targetPage.Screenshot(playwright.PageScreenshotOptions{Type: screenshotType})
+		if err != nil {
+			return actionError(model.ActionSnapshotTakeScreenshot, err)
+		}
+	}
+
+	if params.OutputFormat != nil && *params.OutputFormat == "url" {
+		accessURL, err := saveScreenshot(boxID, buffer, fileExt)
+		if err != nil {
+			return actionError(model.ActionSnapshotTakeScreenshot, err)
+		}
+		return model.SnapshotTakeScreenshotResult{Success: true, URL: accessURL}
+	}
+	return model.SnapshotTakeScreenshotResult{Success: true, Base64Content: base64.StdEncoding.EncodeToString(buffer)}
 }
@@ -0,0 +1,96 @@
+package service_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/browser"
+)
+
+// findSnapshotRef returns the ref of the first snapshot line starting with prefix
+func findSnapshotRef(t *testing.T, snapshot, prefix string) string {
+	t.Helper()
+	refPattern := regexp.MustCompile(`\[ref=([a-z0-9]+)\]`)
+	for _, line := range strings.Split(snapshot, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), prefix) {
+			match := refPattern.FindStringSubmatch(line)
+			require.NotNil(t, match, "Snapshot line has no ref: %s", line)
+			return match[1]
+		}
+	}
+	require.Failf(t, "Element not found in snapshot", "No line starting with %q in:\n%s", prefix, snapshot)
+	return ""
+}
+
+// TestSnapshotActions verifies that snapshot.capture assigns stable refs that the other
+// snapshot actions can target.
+func TestSnapshotActions(t *testing.T) {
+	svc, boxID, contextID, pageID, page, cleanup := setupServiceWithVisionTestPage(t)
+	defer cleanup()
+
+	captureResult := svc.ExecuteSnapshotCapture(boxID, contextID, pageID, model.SnapshotCaptureParams{})
+	capture, ok := captureResult.(model.SnapshotCaptureResult)
+	require.True(t, ok, "ExecuteSnapshotCapture returned unexpected type: %T (%v)", captureResult, captureResult)
+	assert.Equal(t, "Vision Action Test Page", capture.Title)
+	assert.Contains(t, capture.Snapshot, `- heading "Vision Action Test Page" [level=1]`)
+	t.Logf("Snapshot:\n%s", capture.Snapshot)
+
+	clickRef := findSnapshotRef(t, capture.Snapshot, `- button "Click Button"`)
+	inputRef := findSnapshotRef(t, capture.Snapshot, `- textbox "Type here..."`)
+	dragRef := findSnapshotRef(t, capture.Snapshot, `- generic [ref=`)
+
+	// Refs stay the same across captures
+	again, ok := svc.ExecuteSnapshotCapture(boxID, contextID, pageID, model.SnapshotCaptureParams{}).(model.SnapshotCaptureResult)
+	require.True(t, ok)
+	assert.Equal(t, clickRef, findSnapshotRef(t, again.Snapshot, `- button "Click Button"`))
+
+	// Capture limited to an element
+	partial, ok := svc.ExecuteSnapshotCapture(boxID, contextID, pageID, model.SnapshotCaptureParams{Ref: clickRef}).(model.SnapshotCaptureResult)
+	require.True(t, ok)
+	assert.Equal(t, `- button "Click Button" [ref=`+clickRef+`]`, partial.Snapshot)
+
+	// Click
+	result := svc.ExecuteSnapshotClick(boxID, contextID, pageID, model.SnapshotClickParams{Ref: clickRef})
+	require.IsType(t, model.SnapshotClickResult{}, result, "ExecuteSnapshotClick failed: %v", result)
+	require.Eventually(t, func() bool {
+		return strings.HasSuffix(page.URL(), "#click-click_btn")
+	}, 5*time.Second, 100*time.Millisecond, "URL hash did not change after click, current URL: %s", page.URL())
+
+	// Type
+	result = svc.ExecuteSnapshotType(boxID, contextID, pageID, model.SnapshotTypeParams{Ref: inputRef, Text: "hello world", Slowly: true})
+	require.IsType(t, model.SnapshotTypeResult{}, result, "ExecuteSnapshotType failed: %v", result)
+	inputValue, err := page.Locator("#type-input").InputValue()
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", inputValue)
+	typed, ok := svc.ExecuteSnapshotCapture(boxID, contextID, pageID, model.SnapshotCaptureParams{Ref: inputRef}).(model.SnapshotCaptureResult)
+	require.True(t, ok)
+	assert.Equal(t, `- textbox "Type here..." [ref=`+inputRef+`]: hello world`, typed.Snapshot)
+
+	// Hover and drag
+	result = svc.ExecuteSnapshotHover(boxID, contextID, pageID, model.SnapshotHoverParams{Ref: dragRef})
+	require.IsType(t, model.SnapshotHoverResult{}, result, "ExecuteSnapshotHover failed: %v", result)
+	result = svc.ExecuteSnapshotDrag(boxID, contextID, pageID, model.SnapshotDragParams{StartRef: dragRef, EndRef: inputRef})
+	require.IsType(t, model.SnapshotDragResult{}, result, "ExecuteSnapshotDrag failed: %v", result)
+	require.Eventually(t, func() bool {
+		return strings.Contains(page.URL(), "#dragEnd-")
+	}, 5*time.Second, 100*time.Millisecond, "URL hash did not change after drag, current URL: %s", page.URL())
+
+	// Screenshot of an element
+	result = svc.ExecuteSnapshotTakeScreenshot(boxID, contextID, pageID, model.SnapshotTakeScreenshotParams{Ref: clickRef})
+	screenshot, ok := result.(model.SnapshotTakeScreenshotResult)
+	require.True(t, ok, "ExecuteSnapshotTakeScreenshot failed: %v", result)
+	assert.NotEmpty(t, screenshot.Base64Content)
+
+	// Unknown and invalid refs
+	result = svc.ExecuteSnapshotClick(boxID, contextID, pageID, model.SnapshotClickParams{Ref: "zzzze999"})
+	errResult, ok := result.(model.VisionErrorResult)
+	require.True(t, ok, "Expected an error for an unknown ref, got %T", result)
+	assert.Contains(t, errResult.Error, "capture a new snapshot")
+	result = svc.ExecuteSnapshotClick(boxID, contextID, pageID, model.SnapshotClickParams{Ref: `"]`})
+	assert.IsType(t, model.VisionErrorResult{}, result)
+}
@@ -6,16 +6,23 @@ import (
 	"encoding/base64"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"time"
 
 	"github.com/playwright-community/playwright-go"
 
 	"github.com/babelcloud/gbox/packages/api-server/config" // Import config package
+	"github.com/babelcloud/gbox/packages/api-server/internal/file/share"
 	model "github.com/babelcloud/gbox/packages/api-server/pkg/browser"
 )
 
 // --- Helper ---
+// actionError builds the error result of a failed page action
+func actionError(action model.PageActionType, err error) model.VisionErrorResult {
+	return model.VisionErrorResult{Success: false, Error: fmt.Sprintf("%s failed: %v", action, err)}
+}
+
 // Helper to map our MouseButtonType enum to Playwright MouseButton type pointer
 func mapMouseButton(button model.MouseButtonType) *playwright.MouseButton {
 	switch button { // Use the enum directly
@@ -34,6 +41,32 @@ func mapMouseButton(button model.MouseButtonType) *playwright.MouseButton {
 	}
 }
 
+// saveScreenshot saves a screenshot to the screenshot directory in the share directory of a
+// box, within its share quota, and returns the signed URL of the file.
+func saveScreenshot(boxID string, buffer []byte, fileExt string) (string, error) {
+	// Define base dir and generate filename
+	baseScreenshotDir := filepath.Join(config.GetInstance().File.Share, boxID, "screenshot")
+	timestamp := time.Now().Format("20060102_150405")
+	filename := fmt.Sprintf("screenshot_%s.%s", timestamp, fileExt)
+	finalPath := filepath.Join(baseScreenshotDir, filename)
+	relativeSavePath := filepath.Join("screenshot", filename) // Path relative to box share dir
+
+	// Ensure the target directory exists
+	if err := os.MkdirAll(baseScreenshotDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create target directory '%s': %w", baseScreenshotDir, err)
+	}
+	if err := share.CheckQuota(boxID, int64(len(buffer))); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(finalPath, buffer, 0644); err != nil {
+		return "", fmt.Errorf("failed to save screenshot '%s': %w", finalPath, err)
+	}
+
+	// Generate the signed access URL of the screenshot in the share directory
+	accessURL, _ := share.SignURL(path.Join(boxID, filepath.ToSlash(relativeSavePath)))
+	return accessURL, nil
+}
+
 // --- Vision Actions ---
 
 // ExecuteVisionClick handles the vision.click action.
@@ -162,7 +195,6 @@ func (s *BrowserService) ExecuteVisionScreenshot(boxID, contextID, pageID string
 		return model.VisionErrorResult{Success: false, Error: fmt.Sprintf("vision.screenshot failed to get page: %v", err)}
 	}
 
-	cfg := config.GetInstance() // Get config instance once
 	screenshotOpts := playwright.PageScreenshotOptions{}
 	outputFormat := "base64" // Default output format
 	if params.OutputFormat != nil && *params.OutputFormat == "url" {
@@ -233,31 +265,17 @@ func (s *BrowserService) ExecuteVisionScreenshot(boxID, contextID, pageID string
 			fileExt = "jpeg"
 		}
 
-		// Define base dir and generate filename
-		baseScreenshotDir := filepath.Join(cfg.File.Share, boxID, "screenshot")
-		timestamp := time.Now().Format("20060102_150405")
-		filename := fmt.Sprintf("screenshot_%s.%s", timestamp, fileExt)
-		finalPath := filepath.Join(baseScreenshotDir, filename)
-		relativeSavePath := filepath.Join("screenshot", filename) // Path relative to box share dir
-
-		// Ensure the target directory exists
-		if err := os.MkdirAll(baseScreenshotDir, 0755); err != nil {
-			return model.VisionErrorResult{Success: false, Error: fmt.Sprintf("failed to create target directory '%s': %v", baseScreenshotDir, err)}
+		// Take the screenshot to a buffer, so it is only saved within the share quota
+		screenshotOpts.Path = nil
+		buffer, err := targetPage.Screenshot(screenshotOpts)
+		if err != nil {
+			return model.VisionErrorResult{Success: false, Error: fmt.Sprintf("vision.screenshot (url mode) failed: %v", err)}
 		}
-
-		// Set the path for saving the file
-		screenshotOpts.Path = &finalPath
-
-		// Execute screenshot to file
-		_, err = targetPage.Screenshot(screenshotOpts)
+		accessURL, err := saveScreenshot(boxID, buffer, fileExt)
 		if err != nil {
 			return model.VisionErrorResult{Success: false, Error: fmt.Sprintf("vision.screenshot (url mode) failed: %v", err)}
 		}
 
-		// Generate the access URL (adjust format as needed)
-		// Assuming /api/v1/files/shared/{boxID}/{relativePath}
-		accessURL := fmt.Sprintf("/api/v1/files/shared/%s/%s", boxID, relativeSavePath)
-
 		return model.VisionScreenshotResult{Success: true, URL: accessURL}
 
 	} else {
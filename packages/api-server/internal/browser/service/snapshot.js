@@ -0,0 +1,205 @@
+// Captures the accessibility tree of the page, or of the element with the ref rootRef, as
+// YAML in the format of Playwright ARIA snapshots. Elements with a role and the ones that
+// handle clicks get a ref, stored in the data-gbox-ref attribute, that stays the same across
+// captures so that actions can target them.
+(rootRef) => {
+  const attr = 'data-gbox-ref';
+  // Refs are prefixed with a tag of the document, so that the refs of a previous document
+  // are not mistaken for the ones of the current one
+  const state = window.__gboxSnapshot || (window.__gboxSnapshot = {
+    tag: Math.random().toString(36).slice(2, 6).padEnd(4, '0'),
+    seq: 0,
+    owners: new Map(),
+  });
+
+  // Elements cloned with their attributes get a ref of their own
+  const refOf = (el) => {
+    let ref = el.getAttribute(attr);
+    if (ref) {
+      const owner = state.owners.get(ref);
+      if (owner && owner.deref() === el) return ref;
+    }
+    ref = state.tag + 'e' + (++state.seq);
+    el.setAttribute(attr, ref);
+    state.owners.set(ref, new WeakRef(el));
+    return ref;
+  };
+
+  const skipTags = new Set(['SCRIPT', 'STYLE', 'NOSCRIPT', 'TEMPLATE', 'HEAD', 'META', 'LINK', 'IFRAME', 'FRAME', 'OBJECT', 'EMBED']);
+  const inputRoles = {
+    button: 'button', submit: 'button', reset: 'button', image: 'button', file: 'button',
+    checkbox: 'checkbox', radio: 'radio', range: 'slider', number: 'spinbutton', search: 'searchbox',
+  };
+  const tagRoles = {
+    ARTICLE: 'article', ASIDE: 'complementary', BUTTON: 'button', DETAILS: 'group', DIALOG: 'dialog',
+    FIELDSET: 'group', FOOTER: 'contentinfo', FORM: 'form', H1: 'heading', H2: 'heading', H3: 'heading',
+    H4: 'heading', H5: 'heading', H6: 'heading', HEADER: 'banner', HR: 'separator', LI: 'listitem',
+    MAIN: 'main', NAV: 'navigation', OL: 'list', OPTION: 'option', P: 'paragraph', PROGRESS: 'progressbar',
+    SUMMARY: 'button', TABLE: 'table', TD: 'cell', TEXTAREA: 'textbox', TH: 'columnheader', TR: 'row', UL: 'list',
+  };
+  // Roles whose name is computed from their content, which is then not repeated as text
+  const nameFromContent = new Set([
+    'button', 'link', 'heading', 'option', 'cell', 'columnheader', 'rowheader', 'tab', 'menuitem',
+    'menuitemcheckbox', 'menuitemradio', 'treeitem', 'checkbox', 'radio', 'switch', 'tooltip',
+  ]);
+
+  const collapse = (s) => (s || '').replace(/\s+/g, ' ').trim();
+  const truncate = (s) => (s.length > 200 ? s.slice(0, 200) + '…' : s);
+  const quote = (s) => JSON.stringify(s);
+  const yamlText = (s) => (/[:#'"\[\]{}]|^[-?!&*|>%@,]/.test(s) ? quote(s) : s);
+  const textOf = (el) => collapse(el.innerText !== undefined ? el.innerText : el.textContent);
+  const childrenOf = (el) => (el.shadowRoot || el).childNodes;
+
+  const hidden = (el) => {
+    if (el.hidden || el.getAttribute('aria-hidden') === 'true') return true;
+    const style = getComputedStyle(el);
+    return style.display === 'none' || style.visibility === 'hidden';
+  };
+
+  const roleOf = (el) => {
+    const explicit = (el.getAttribute('role') || '').trim().split(/\s+/)[0];
+    if (explicit) return explicit === 'presentation' || explicit === 'none' ? null : explicit;
+    const editable = el.getAttribute('contenteditable');
+    if (editable !== null && editable !== 'false') return 'textbox';
+    const tag = el.tagName;
+    if (tag === 'A' || tag === 'AREA') return el.hasAttribute('href') ? 'link' : null;
+    if (tag === 'INPUT') {
+      const type = (el.getAttribute('type') || 'text').toLowerCase();
+      return type === 'hidden' ? null : inputRoles[type] || 'textbox';
+    }
+    if (tag === 'SELECT') return el.multiple || el.size > 1 ? 'listbox' : 'combobox';
+    if (tag === 'IMG') return el.getAttribute('alt') === '' ? null : 'img';
+    return tagRoles[tag] || null;
+  };
+
+  // Elements without a role that still handle clicks, drags or focus
+  const clickable = (el) => {
+    if (el.hasAttribute('onclick') || el.getAttribute('draggable') === 'true') return true;
+    if (el.hasAttribute('tabindex') && el.getAttribute('tabindex') !== '-1') return true;
+    if (getComputedStyle(el).cursor !== 'pointer') return false;
+    // The cursor is inherited, only its first element counts
+    return !el.parentElement || getComputedStyle(el.parentElement).cursor !== 'pointer';
+  };
+
+  const nameOf = (el, role) => {
+    const labelledBy = el.getAttribute('aria-labelledby');
+    if (labelledBy) {
+      const text = labelledBy.split(/\s+/)
+        .map((id) => document.getElementById(id))
+        .filter(Boolean)
+        .map(textOf)
+        .filter(Boolean)
+        .join(' ');
+      if (text) return text;
+    }
+    const label = collapse(el.getAttribute('aria-label'));
+    if (label) return label;
+    const tag = el.tagName;
+    if (tag === 'INPUT' && ['button', 'submit', 'reset'].includes(el.type)) {
+      return collapse(el.value) || (el.type === 'submit' ? 'Submit' : el.type === 'reset' ? 'Reset' : '');
+    }
+    if (tag === 'INPUT' && el.type === 'image') return collapse(el.getAttribute('alt') || el.value);
+    if (tag === 'INPUT' || tag === 'SELECT' || tag === 'TEXTAREA') {
+      const labels = el.labels ? Array.from(el.labels).map(textOf).filter(Boolean) : [];
+      if (labels.length) return labels.join(' ');
+      return collapse(el.getAttribute('placeholder') || el.getAttribute('title'));
+    }
+    if (tag === 'IMG' || tag === 'AREA') return collapse(el.getAttribute('alt') || el.getAttribute('title'));
+    if (nameFromContent.has(role)) {
+      const text = textOf(el);
+      if (text) return text;
+      const img = el.querySelector('img[alt]');
+      if (img) return collapse(img.getAttribute('alt'));
+    }
+    return collapse(el.getAttribute('title'));
+  };
+
+  const propsOf = (el, role) => {
+    const props = [];
+    if (role === 'heading') {
+      const level = el.getAttribute('aria-level') || (/^H[1-6]$/.test(el.tagName) ? el.tagName[1] : '');
+      if (level) props.push('level=' + level);
+    }
+    let checked = el.getAttribute('aria-checked');
+    if (el.tagName === 'INPUT' && (el.type === 'checkbox' || el.type === 'radio')) {
+      checked = el.indeterminate ? 'mixed' : String(el.checked);
+    }
+    if (checked === 'true') props.push('checked');
+    else if (checked === 'mixed') props.push('checked=mixed');
+    if (el.disabled || el.getAttribute('aria-disabled') === 'true') props.push('disabled');
+    if (el.getAttribute('aria-expanded') === 'true' || (el.tagName === 'DETAILS' && el.open)) props.push('expanded');
+    if (role === 'option' && (el.selected || el.getAttribute('aria-selected') === 'true')) props.push('selected');
+    const pressed = el.getAttribute('aria-pressed');
+    if (pressed === 'true') props.push('pressed');
+    else if (pressed === 'mixed') props.push('pressed=mixed');
+    return props;
+  };
+
+  // Passwords are never included
+  const valueOf = (el, role) => {
+    if (el.tagName !== 'INPUT' && el.tagName !== 'TEXTAREA') return '';
+    if (el.type === 'password') return '';
+    if (['textbox', 'searchbox', 'spinbutton', 'combobox', 'slider'].includes(role)) return collapse(el.value);
+    return '';
+  };
+
+  const lines = [];
+
+  const visit = (nodes, indent, withText) => {
+    let emitted = false;
+    for (const node of nodes) {
+      if (node.nodeType === Node.TEXT_NODE) {
+        const text = withText ? collapse(node.textContent) : '';
+        if (text) {
+          lines.push(indent + '- text: ' + yamlText(truncate(text)));
+          emitted = true;
+        }
+      } else if (node.nodeType === Node.ELEMENT_NODE && emit(node, indent, withText)) {
+        emitted = true;
+      }
+    }
+    return emitted;
+  };
+
+  const emit = (el, indent, withText) => {
+    if (skipTags.has(el.tagName) || hidden(el)) return false;
+    if (el.tagName === 'SLOT') {
+      const assigned = el.assignedNodes({ flatten: true });
+      return visit(assigned.length ? assigned : el.childNodes, indent, withText);
+    }
+    const role = roleOf(el);
+    if (!role && !clickable(el)) return visit(childrenOf(el), indent, withText);
+
+    const name = role ? truncate(nameOf(el, role)) : '';
+    let line = indent + '- ' + (role || 'generic');
+    if (name) line += ' ' + quote(name);
+    for (const prop of propsOf(el, role)) line += ' [' + prop + ']';
+    line += ' [ref=' + refOf(el) + ']';
+
+    const index = lines.push(line) - 1;
+    const childText = !(name && nameFromContent.has(role));
+    if (visit(childrenOf(el), indent + '  ', childText)) {
+      // A single text child is inlined, like Playwright does
+      const textPrefix = indent + '  - text: ';
+      if (lines.length === index + 2 && lines[index + 1].startsWith(textPrefix)) {
+        lines[index] += ': ' + lines.pop().slice(textPrefix.length);
+      } else {
+        lines[index] += ':';
+      }
+    } else {
+      const value = valueOf(el, role);
+      if (value) lines[index] += ': ' + yamlText(truncate(value));
+    }
+    return true;
+  };
+
+  if (rootRef) {
+    const root = document.querySelector('[' + attr + '="' + CSS.escape(rootRef) + '"]');
+    if (!root) throw new Error('element with ref ' + rootRef + ' not found, capture a new snapshot');
+    emit(root, '', true);
+  } else {
+    const root = document.body || document.documentElement;
+    if (root) visit(childrenOf(root), '', true);
+  }
+  return lines.join('\n');
+}
@@ -96,6 +96,22 @@ func (m *mockBoxService) Start(ctx context.Context, id string) (*boxModel.BoxSta
 func (m *mockBoxService) Stop(ctx context.Context, id string) (*boxModel.BoxStopResult, error) {
 	return nil, fmt.Errorf("mockBoxService.Stop not implemented")
 }
+func (m *mockBoxService) RunCodeLanguages(ctx context.Context, params *boxModel.RunCodeLanguageListParams) (*boxModel.RunCodeLanguageListResult, error) {
+	return nil, fmt.Errorf("mockBoxService.RunCodeLanguages not implemented")
+}
+
+func (m *mockBoxService) ListKernels(ctx context.Context, id string) (*boxModel.BoxKernelListResult, error) {
+	return nil, fmt.Errorf("mockBoxService.ListKernels not implemented")
+}
+
+func (m *mockBoxService) InterruptKernel(ctx context.Context, id, kernelID string) (*boxModel.BoxKernel, error) {
+	return nil, fmt.Errorf("mockBoxService.InterruptKernel not implemented")
+}
+
+func (m *mockBoxService) RestartKernel(ctx context.Context, id, kernelID string) (*boxModel.BoxKernel, error) {
+	return nil, fmt.Errorf("mockBoxService.RestartKernel not implemented")
+}
+
 func (m *mockBoxService) RunCode(ctx context.Context, id string, params *boxModel.BoxRunCodeParams) (*boxModel.BoxRunCodeResult, error) {
 	return nil, fmt.Errorf("mockBoxService.RunCode not implemented")
 }
@@ -140,6 +156,10 @@ func (m *mockBoxService) BoxActionType(ctx context.Context, id string, params *b
 	return nil, fmt.Errorf("mockBoxService.BoxActionType not implemented")
 }
 
+func (m *mockBoxService) FileManifest(ctx context.Context, id string, params *boxModel.BoxFileManifestParams) (*boxModel.BoxFileManifest, error) {
+	return nil, fmt.Errorf("mockBoxService.FileManifest not implemented")
+}
+
 func (m *mockBoxService) ListFiles(ctx context.Context, id string, params *boxModel.BoxFileListParams) (*boxModel.BoxFileListResult, error) {
 	return nil, fmt.Errorf("mockBoxService.ListFiles not implemented")
 }
@@ -152,6 +172,70 @@ func (m *mockBoxService) WriteFile(ctx context.Context, id string, params *boxMo
 	return nil, fmt.Errorf("mockBoxService.WriteFile not implemented")
 }
 
+func (m *mockBoxService) EditFile(ctx context.Context, id string, params *boxModel.BoxFileEditParams) (*boxModel.BoxFileEditResult, error) {
+	return nil, fmt.Errorf("mockBoxService.EditFile not implemented")
+}
+
+func (m *mockBoxService) SearchFiles(ctx context.Context, id string, params *boxModel.BoxFileSearchParams) (*boxModel.BoxFileSearchResult, error) {
+	return nil, fmt.Errorf("mockBoxService.SearchFiles not implemented")
+}
+
+func (m *mockBoxService) StatFile(ctx context.Context, id string, params *boxModel.BoxFileStatParams) (*boxModel.BoxFile, error) {
+	return nil, fmt.Errorf("mockBoxService.StatFile not implemented")
+}
+
+func (m *mockBoxService) MakeDir(ctx context.Context, id string, params *boxModel.BoxFileMkdirParams) (*boxModel.BoxFile, error) {
+	return nil, fmt.Errorf("mockBoxService.MakeDir not implemented")
+}
+
+func (m *mockBoxService) RemoveFile(ctx context.Context, id string, params *boxModel.BoxFileRemoveParams) (*boxModel.BoxFileRemoveResult, error) {
+	return nil, fmt.Errorf("mockBoxService.RemoveFile not implemented")
+}
+
+func (m *mockBoxService) MoveFile(ctx context.Context, id string, params *boxModel.BoxFileMoveParams) (*boxModel.BoxFile, error) {
+	return nil, fmt.Errorf("mockBoxService.MoveFile not implemented")
+}
+
+func (m *mockBoxService) CopyFile(ctx context.Context, id string, params *boxModel.BoxFileCopyParams) (*boxModel.BoxFile, error) {
+	return nil, fmt.Errorf("mockBoxService.CopyFile not implemented")
+}
+
+func (m *mockBoxService) ChmodFile(ctx context.Context, id string, params *boxModel.BoxFileChmodParams) (*boxModel.BoxFile, error) {
+	return nil, fmt.Errorf("mockBoxService.ChmodFile not implemented")
+}
+
+func (m *mockBoxService) DownloadFile(ctx context.Context, id string, params *boxModel.BoxFileDownloadParams, progressWriter io.Writer) (*boxModel.BoxFileDownloadResult, error) {
+	return nil, fmt.Errorf("mockBoxService.DownloadFile not implemented")
+}
+
+func (m *mockBoxService) GitClone(ctx context.Context, id string, params *boxModel.BoxGitCloneParams) (*boxModel.BoxGitCloneResult, error) {
+	return nil, fmt.Errorf("mockBoxService.GitClone not implemented")
+}
+
+func (m *mockBoxService) GitStatus(ctx context.Context, id string, params *boxModel.BoxGitStatusParams) (*boxModel.BoxGitStatus, error) {
+	return nil, fmt.Errorf("mockBoxService.GitStatus not implemented")
+}
+
+func (m *mockBoxService) GitDiff(ctx context.Context, id string, params *boxModel.BoxGitDiffParams) (*boxModel.BoxGitDiff, error) {
+	return nil, fmt.Errorf("mockBoxService.GitDiff not implemented")
+}
+
+func (m *mockBoxService) GitCommit(ctx context.Context, id string, params *boxModel.BoxGitCommitParams) (*boxModel.BoxGitCommitResult, error) {
+	return nil, fmt.Errorf("mockBoxService.GitCommit not implemented")
+}
+
+func (m *mockBoxService) Changes(ctx context.Context, id string, params *boxModel.BoxChangesParams) (*boxModel.BoxChanges, error) {
+	return nil, fmt.Errorf("mockBoxService.Changes not implemented")
+}
+
+func (m *mockBoxService) ExportChanges(ctx context.Context, id string, params *boxModel.BoxChangesParams) (*boxModel.BoxChanges, io.ReadCloser, error) {
+	return nil, nil, fmt.Errorf("mockBoxService.ExportChanges not implemented")
+}
+
+func (m *mockBoxService) WatchFiles(ctx context.Context, id string, params *boxModel.BoxFileWatchParams) (<-chan boxModel.BoxFileEvent, error) {
+	return nil, fmt.Errorf("mockBoxService.WatchFiles not implemented")
+}
+
 // CheckImageExists checks if an image exists locally (Mock implementation)
 func (m *mockBoxService) CheckImageExists(ctx context.Context, params *boxModel.BoxCreateParams) (bool, string) {
 	// In test environment, assume image always exists
@@ -6,6 +6,7 @@ import (
 
 	"github.com/robfig/cron/v3"
 
+	"github.com/babelcloud/gbox/packages/api-server/config"
 	boxservice "github.com/babelcloud/gbox/packages/api-server/internal/box/service"
 	fileservice "github.com/babelcloud/gbox/packages/api-server/internal/file/service"
 	"github.com/babelcloud/gbox/packages/api-server/pkg/logger"
@@ -44,8 +45,8 @@ func (m *Manager) Start() {
 		m.logger.Fatal("Failed to add box reclaim job: %v", err)
 	}
 
-	// Run file reclamation daily at midnight
-	_, err = m.cron.AddFunc("0 0 * * *", m.reclaimFiles)
+	// Run file reclamation on the configured schedule
+	_, err = m.cron.AddFunc(config.GetInstance().File.ShareReclaimSchedule, m.reclaimFiles)
 	if err != nil {
 		m.logger.Fatal("Failed to add file reclaim job: %v", err)
 	}
@@ -82,12 +83,17 @@ func (m *Manager) reclaimFiles() {
 	ctx, cancel := context.WithTimeout(context.Background(), fileReclaimTimeout)
 	defer cancel()
 
-	_, err := m.fileService.ReclaimFiles(ctx)
+	result, err := m.fileService.ReclaimFiles(ctx, config.GetInstance().File.ShareReclaimDryRun)
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
 			m.logger.Error("File reclamation timed out after %v", fileReclaimTimeout)
 		} else {
 			m.logger.Error("Failed to reclaim files: %v", err)
 		}
+		return
+	}
+	m.logger.Info("File reclamation finished: %s", result.Message)
+	for _, file := range result.FileList {
+		m.logger.Debug("Reclaimed file %s (%d bytes, modified %s)", file.Path, file.Size, file.ModTime)
 	}
 }
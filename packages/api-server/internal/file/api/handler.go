@@ -2,13 +2,19 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/babelcloud/gbox/packages/api-server/config"
+	boxService "github.com/babelcloud/gbox/packages/api-server/internal/box/service"
 	"github.com/babelcloud/gbox/packages/api-server/internal/file/service"
+	"github.com/babelcloud/gbox/packages/api-server/internal/file/share"
 	model "github.com/babelcloud/gbox/packages/api-server/pkg/file"
 	"github.com/emicklei/go-restful/v3"
 )
@@ -113,9 +119,10 @@ func (h *FileHandler) HandleFileOperation(req *restful.Request, resp *restful.Re
 	}
 }
 
-// ReclaimFiles handles reclaiming files that haven't been accessed for more than 14 days
+// ReclaimFiles handles reclaiming files older than the configured age. Like the scheduled
+// reclamation, it only reports them when share_reclaim_dry_run is set.
 func (h *FileHandler) ReclaimFiles(req *restful.Request, resp *restful.Response) {
-	response, err := h.service.ReclaimFiles(req.Request.Context())
+	response, err := h.service.ReclaimFiles(req.Request.Context(), config.GetInstance().File.ShareReclaimDryRun)
 	if err != nil {
 		replyFileError(resp, http.StatusInternalServerError, "INTERNAL_ERROR", fmt.Sprintf("Error reclaiming files: %v", err))
 		return
@@ -158,11 +165,97 @@ func (h *FileHandler) WriteFile(req *restful.Request, resp *restful.Response, wr
 	resp.WriteAsJson(response)
 }
 
+// GetSharedFile serves a file of the share directory under a signed URL, with support
+// for range and conditional requests
+func (h *FileHandler) GetSharedFile(req *restful.Request, resp *restful.Response) {
+	path := req.PathParameter("path")
+	query := req.Request.URL.Query()
+	if err := share.Default().Verify(share.PurposeShare, path, query, time.Now()); err != nil {
+		code := "INVALID_SIGNATURE"
+		if errors.Is(err, share.ErrExpired) {
+			code = "LINK_EXPIRED"
+		}
+		replyFileError(resp, http.StatusForbidden, code, err.Error())
+		return
+	}
+
+	file, err := h.service.OpenSharedFile(path)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrFileNotFound):
+			replyFileError(resp, http.StatusNotFound, "NOT_FOUND", err.Error())
+		case errors.Is(err, boxService.ErrNotAFile):
+			replyFileError(resp, http.StatusBadRequest, "NOT_A_FILE", err.Error())
+		default:
+			replyFileError(resp, http.StatusInternalServerError, "INTERNAL_ERROR", fmt.Sprintf("Error opening file: %v", err))
+		}
+		return
+	}
+	defer file.Close()
+
+	disposition := "inline"
+	if filename := query.Get("filename"); filename != "" {
+		disposition = mime.FormatMediaType("attachment", map[string]string{"filename": filename})
+	}
+	resp.Header().Set("Content-Type", file.MimeType)
+	resp.Header().Set("Content-Disposition", disposition)
+	resp.Header().Set("Cache-Control", "private")
+	http.ServeContent(resp, req.Request, file.Info.Name(), file.Info.ModTime(), file)
+}
+
+// ShareBoxFile publishes a file of a box under a signed, expiring URL
+func (h *FileHandler) ShareBoxFile(req *restful.Request, resp *restful.Response) {
+	boxID := req.PathParameter("id")
+
+	var params model.FileShareParams
+	if err := req.ReadEntity(&params); err != nil {
+		replyFileError(resp, http.StatusBadRequest, "INVALID_REQUEST", fmt.Sprintf("Error reading request body: %v", err))
+		return
+	}
+
+	result, err := h.service.PublishFile(req.Request.Context(), boxID, &params)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidShare):
+			replyFileError(resp, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		case errors.Is(err, boxService.ErrBoxNotFound):
+			replyFileError(resp, http.StatusNotFound, "BOX_NOT_FOUND", err.Error())
+		case errors.Is(err, boxService.ErrPathNotFound), errors.Is(err, service.ErrFileNotFound):
+			replyFileError(resp, http.StatusNotFound, "NOT_FOUND", err.Error())
+		case errors.Is(err, boxService.ErrNotAFile):
+			replyFileError(resp, http.StatusBadRequest, "NOT_A_FILE", err.Error())
+		case errors.Is(err, share.ErrQuotaExceeded):
+			replyFileError(resp, http.StatusInsufficientStorage, "QUOTA_EXCEEDED", err.Error())
+		default:
+			replyFileError(resp, http.StatusInternalServerError, "INTERNAL_ERROR", fmt.Sprintf("Error sharing file: %v", err))
+		}
+		return
+	}
+
+	resp.WriteHeaderAndEntity(http.StatusOK, result)
+}
+
+// GetShareUsage returns the space a box takes up in the share directory
+func (h *FileHandler) GetShareUsage(req *restful.Request, resp *restful.Response) {
+	boxID := req.PathParameter("id")
+
+	result, err := h.service.ShareUsage(req.Request.Context(), boxID)
+	if err != nil {
+		if errors.Is(err, boxService.ErrBoxNotFound) {
+			replyFileError(resp, http.StatusNotFound, "BOX_NOT_FOUND", err.Error())
+			return
+		}
+		replyFileError(resp, http.StatusInternalServerError, "INTERNAL_ERROR", fmt.Sprintf("Error getting share usage: %v", err))
+		return
+	}
+
+	resp.WriteHeaderAndEntity(http.StatusOK, result)
+}
+
 // replyFileError writes a structured error response
 func replyFileError(resp *restful.Response, statusCode int, code, message string) {
-	resp.WriteHeader(statusCode)
-	resp.WriteAsJson(model.FileError{
+	resp.WriteHeaderAndJson(statusCode, model.FileError{
 		Code:    code,
 		Message: message,
-	})
+	}, restful.MIME_JSON)
 }
@@ -1,12 +1,48 @@
 package api
 
 import (
-	// model "github.com/babelcloud/gbox/packages/api-server/pkg/file"
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/file"
 	"github.com/emicklei/go-restful/v3"
 )
 
 // RegisterRoutes registers the file-related routes
 func RegisterRoutes(ws *restful.WebService, handler *FileHandler) {
+	// Shared files are only served under URLs signed by the server
+	for _, builder := range []*restful.RouteBuilder{ws.GET("/files/shared/{path:*}"), ws.HEAD("/files/shared/{path:*}")} {
+		ws.Route(builder.To(handler.GetSharedFile).
+			Doc("get a shared file by its signed URL").
+			Param(ws.PathParameter("path", "path to the file in the share directory").DataType("string")).
+			Param(ws.QueryParameter("expires", "expiry of the URL as a Unix time").DataType("integer").Required(true)).
+			Param(ws.QueryParameter("signature", "signature of the URL").DataType("string").Required(true)).
+			Param(ws.QueryParameter("filename", "name to download the file as").DataType("string").Required(false)).
+			Produces("*/*").
+			Notes("The response Content-Type is the file's MIME type. Range requests are supported.").
+			Returns(200, "OK", nil).
+			Returns(206, "Partial Content", nil).
+			Returns(400, "Bad Request", model.FileError{}).
+			Returns(403, "Forbidden", model.FileError{}).
+			Returns(404, "Not Found", model.FileError{}).
+			Returns(416, "Range Not Satisfiable", nil).
+			Returns(500, "Internal Server Error", model.FileError{}))
+	}
+
+	ws.Route(ws.POST("/boxes/{id}/share").To(handler.ShareBoxFile).
+		Doc("publish a file of a box under a signed, expiring URL").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Reads(model.FileShareParams{}).
+		Returns(200, "OK", model.FileShareURL{}).
+		Returns(400, "Bad Request", model.FileError{}).
+		Returns(404, "Not Found", model.FileError{}).
+		Returns(500, "Internal Server Error", model.FileError{}).
+		Returns(507, "Insufficient Storage", model.FileError{}))
+
+	ws.Route(ws.GET("/boxes/{id}/share/usage").To(handler.GetShareUsage).
+		Doc("get the space a box takes up in the share directory").
+		Param(ws.PathParameter("id", "identifier of the box").DataType("string")).
+		Returns(200, "OK", model.FileShareUsage{}).
+		Returns(404, "Not Found", model.FileError{}).
+		Returns(500, "Internal Server Error", model.FileError{}))
+
 	// // File routes
 	// ws.Route(ws.HEAD("/files/{path:*}").To(handler.HeadFile).
 	// 	Doc("get file metadata").
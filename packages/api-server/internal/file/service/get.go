@@ -71,7 +71,7 @@ func (s *FileService) GetFile(ctx context.Context, pathWithBoxID string) (*FileC
 
 	return &FileContent{
 		Reader:   file,
-		MimeType: getMimeType(fullPath, info),
+		MimeType: GetMimeType(fullPath, info),
 		Size:     info.Size(),
 	}, nil
 }
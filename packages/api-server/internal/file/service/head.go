@@ -35,7 +35,7 @@ func (s *FileService) HeadFile(ctx context.Context, pathWithBoxID string) (*mode
 		Mode:    info.Mode().String(),
 		ModTime: info.ModTime().Format("2006-01-02T15:04:05Z07:00"),
 		Type:    getFileType(info),
-		Mime:    getMimeType(fullPath, info),
+		Mime:    GetMimeType(fullPath, info),
 	}
 
 	return stat, nil
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/api-server/config"
+	boxService "github.com/babelcloud/gbox/packages/api-server/internal/box/service"
+	"github.com/babelcloud/gbox/packages/api-server/internal/common"
+	"github.com/babelcloud/gbox/packages/api-server/internal/file/share"
+	boxModel "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/file"
+)
+
+// publishedDir is the directory of a box's share directory that files published from
+// elsewhere in the box are copied to
+const publishedDir = "published"
+
+var (
+	// ErrFileNotFound is returned when a file is not in the share directory
+	ErrFileNotFound = errors.New("file not found")
+
+	// ErrInvalidShare is returned when a share request is malformed
+	ErrInvalidShare = errors.New("invalid share request")
+)
+
+// SharedFile is an open file of the share directory
+type SharedFile struct {
+	*os.File
+	Info     os.FileInfo
+	MimeType string
+}
+
+// OpenSharedFile opens a regular file of the share directory, whose paths start with the
+// ID of the box the file belongs to. Boxes can write to their share directory, so links are
+// resolved and must stay inside the directory of the box.
+func (s *FileService) OpenSharedFile(p string) (*SharedFile, error) {
+	cleanPath, err := s.validateAndCleanPath(p)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFileNotFound, err)
+	}
+
+	boxID, _, _ := strings.Cut(strings.TrimPrefix(filepath.Clean(cleanPath), "/"), "/")
+	if boxID == "" {
+		return nil, fmt.Errorf("%w: %s", ErrFileNotFound, p)
+	}
+	boxDir, err := filepath.EvalSymlinks(filepath.Join(s.shareDir, boxID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrFileNotFound, p)
+		}
+		return nil, fmt.Errorf("failed to resolve share directory: %w", err)
+	}
+	fullPath, err := filepath.EvalSymlinks(s.getFullPath(cleanPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrFileNotFound, p)
+		}
+		return nil, fmt.Errorf("error resolving file: %w", err)
+	}
+	if !strings.HasPrefix(fullPath, boxDir+string(filepath.Separator)) {
+		return nil, fmt.Errorf("%w: %s", ErrFileNotFound, p)
+	}
+
+	file, err := os.Open(fullPath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("error getting file info: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		file.Close()
+		return nil, fmt.Errorf("%w: %s", boxService.ErrNotAFile, p)
+	}
+
+	return &SharedFile{File: file, Info: info, MimeType: GetMimeType(fullPath, info)}, nil
+}
+
+// PublishFile returns a signed URL of a file of a box. Files in the share directory of
+// the box are served from there, others are copied into it first.
+func (s *FileService) PublishFile(ctx context.Context, boxID string, params *model.FileShareParams) (*model.FileShareURL, error) {
+	if params.Path == "" {
+		return nil, fmt.Errorf("%w: path is required", ErrInvalidShare)
+	}
+	ttl := config.GetInstance().File.ShareURLTTL
+	if params.ExpiresIn != "" {
+		var err error
+		ttl, err = time.ParseDuration(params.ExpiresIn)
+		if err != nil || ttl <= 0 || ttl > share.MaxTTL {
+			return nil, fmt.Errorf("%w: expiresIn must be a duration between 1s and %s", ErrInvalidShare, share.MaxTTL)
+		}
+	}
+	if strings.ContainsAny(params.Filename, "/\\") {
+		return nil, fmt.Errorf("%w: filename must not contain a path", ErrInvalidShare)
+	}
+
+	boxPath := boxService.ResolveBoxPath(params.Path)
+	var rel string
+	if inShare := strings.TrimPrefix(boxPath, common.DefaultShareDirPath); inShare != boxPath && strings.HasPrefix(inShare, "/") {
+		rel = path.Join(boxID, inShare)
+	} else {
+		rel = path.Join(boxID, publishedDir, boxPath)
+		if err := s.copyFromBox(ctx, boxID, boxPath, s.getFullPath("/"+rel)); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := s.OpenSharedFile(rel)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	expires := time.Now().Add(ttl)
+	return &model.FileShareURL{
+		URL:       share.Default().Sign(rel, expires, params.Filename),
+		ExpiresAt: expires.UTC().Truncate(time.Second),
+		Path:      boxPath,
+		Size:      file.Info.Size(),
+		MimeType:  file.MimeType,
+	}, nil
+}
+
+// copyFromBox copies a regular file of a box to the host, replacing the target at once
+func (s *FileService) copyFromBox(ctx context.Context, boxID, boxPath, target string) error {
+	_, reader, err := s.boxSvc.GetArchive(ctx, boxID, &boxModel.BoxArchiveGetParams{Path: boxPath})
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	tr := tar.NewReader(reader)
+	header, err := tr.Next()
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+	if header.Typeflag != tar.TypeReg {
+		return fmt.Errorf("%w: %s", boxService.ErrNotAFile, boxPath)
+	}
+	// A file published again replaces its earlier copy
+	size := header.Size
+	if info, err := os.Stat(target); err == nil {
+		size -= info.Size()
+	}
+	if err := share.CheckQuota(boxID, size); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create target directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".publish-*")
+	if err != nil {
+		return fmt.Errorf("failed to create target file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, tr); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write file content: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), os.FileMode(header.Mode).Perm()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+// ShareUsage returns the space a box takes up in the share directory
+func (s *FileService) ShareUsage(ctx context.Context, boxID string) (*model.FileShareUsage, error) {
+	if _, err := s.boxSvc.Get(ctx, boxID); err != nil {
+		return nil, err
+	}
+	size, files, err := share.Usage(boxID)
+	if err != nil {
+		return nil, err
+	}
+	return &model.FileShareUsage{
+		BoxID: boxID,
+		Size:  size,
+		Files: files,
+		Quota: config.GetInstance().File.ShareQuota,
+	}, nil
+}
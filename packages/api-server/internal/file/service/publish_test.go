@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	boxService "github.com/babelcloud/gbox/packages/api-server/internal/box/service"
+	"github.com/babelcloud/gbox/packages/api-server/internal/common"
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/file"
+)
+
+func TestOpenSharedFile(t *testing.T) {
+	root := t.TempDir()
+	shareDir := filepath.Join(root, "share")
+	require.NoError(t, os.MkdirAll(filepath.Join(shareDir, "box", "screenshot"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(shareDir, "box", "screenshot", "a.png"), []byte("\x89PNG\r\n\x1a\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "secret"), []byte("secret"), 0644))
+	require.NoError(t, os.Symlink("screenshot/a.png", filepath.Join(shareDir, "box", "inside")))
+	require.NoError(t, os.Symlink(filepath.Join(root, "secret"), filepath.Join(shareDir, "box", "outside")))
+	require.NoError(t, os.MkdirAll(filepath.Join(shareDir, "other"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(shareDir, "other", "b.txt"), []byte("other"), 0644))
+	require.NoError(t, os.Symlink("../other/b.txt", filepath.Join(shareDir, "box", "cross")))
+	s := &FileService{shareDir: shareDir}
+
+	file, err := s.OpenSharedFile("box/screenshot/a.png")
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", file.MimeType)
+	file.Close()
+
+	file, err = s.OpenSharedFile("box/inside")
+	require.NoError(t, err)
+	content, err := io.ReadAll(file)
+	require.NoError(t, err)
+	assert.Equal(t, "\x89PNG\r\n\x1a\n", string(content))
+	file.Close()
+
+	// Links must not leave the directory of the box, even to the one of another box
+	for _, p := range []string{"box/outside", "box/cross", "../secret", "box/../../secret", "box/missing", "missing/a.png"} {
+		_, err = s.OpenSharedFile(p)
+		assert.True(t, errors.Is(err, ErrFileNotFound), "%s: got %v", p, err)
+	}
+	_, err = s.OpenSharedFile("box/screenshot")
+	assert.True(t, errors.Is(err, boxService.ErrNotAFile), "got %v", err)
+}
+
+func TestPublishFileCrossBoxLink(t *testing.T) {
+	shareDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(shareDir, "box"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(shareDir, "other", "screenshot"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(shareDir, "other", "screenshot", "a.png"), []byte("other"), 0644))
+	require.NoError(t, os.Symlink("../other/screenshot/a.png", filepath.Join(shareDir, "box", "x")))
+	s := &FileService{shareDir: shareDir}
+
+	_, err := s.PublishFile(context.Background(), "box", &model.FileShareParams{Path: common.DefaultShareDirPath + "/x"})
+	assert.True(t, errors.Is(err, ErrFileNotFound), "got %v", err)
+
+	result, err := s.PublishFile(context.Background(), "other", &model.FileShareParams{Path: common.DefaultShareDirPath + "/screenshot/a.png"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), result.Size)
+}
@@ -5,108 +5,106 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/babelcloud/gbox/packages/api-server/config"
 	model "github.com/babelcloud/gbox/packages/api-server/pkg/file"
 )
 
-// ReclaimFiles removes files that haven't been accessed for more than 14 days
-func (s *FileService) ReclaimFiles(ctx context.Context) (*model.FileShareResult, error) {
-	cutoffTime := time.Now().Add(-defaultFileReclaimInterval)
-	var reclaimedFiles []string
-	var fileStats []model.FileStat
+// ReclaimFiles removes files of the share directory not modified within the configured
+// reclaim age, and the directories left empty. With dryRun the files are only reported.
+func (s *FileService) ReclaimFiles(ctx context.Context, dryRun bool) (*model.FileShareResult, error) {
+	age := config.GetInstance().File.ShareReclaimAge
+	if age <= 0 {
+		return nil, fmt.Errorf("share reclaim age must be positive, got %s", age)
+	}
+	return s.reclaimFiles(ctx, time.Now().Add(-age), dryRun)
+}
+
+func (s *FileService) reclaimFiles(ctx context.Context, cutoffTime time.Time, dryRun bool) (*model.FileShareResult, error) {
+	fileStats := []model.FileStat{}
+	var reclaimedSize int64
 	var errors []string
-	emptyDirs := make(map[string]bool) // Track empty directories
+	var dirs []string
 
 	// Walk through the share directory
 	err := filepath.Walk(s.shareDir, func(path string, info os.FileInfo, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
 		if err != nil {
 			errors = append(errors, fmt.Sprintf("Error accessing path %s: %v", path, err))
 			return nil
 		}
 
-		// Skip the share directory itself
-		if path == s.shareDir {
+		// Directories are only removed once empty, as their mtime doesn't change with
+		// the files below them. The share directories of boxes are mounted into running
+		// boxes, so they are kept even when empty.
+		if info.IsDir() {
+			if path != s.shareDir && filepath.Dir(path) != s.shareDir {
+				dirs = append(dirs, path)
+			}
 			return nil
 		}
 
-		// Check if file is older than cutoff time
-		if info.ModTime().Before(cutoffTime) {
-			// Collect file stats before deletion
-			fileStats = append(fileStats, model.FileStat{
-				Name:    info.Name(),
-				Path:    path,
-				Size:    info.Size(),
-				Mode:    info.Mode().String(),
-				ModTime: info.ModTime().Format("2006-01-02T15:04:05Z07:00"),
-				Type:    getFileType(info),
-				Mime:    getMimeType(path, info),
-			})
-
-			// For symbolic links, only remove the link itself
-			if info.Mode()&os.ModeSymlink != 0 {
-				if err := os.Remove(path); err != nil {
-					errors = append(errors, fmt.Sprintf("Error removing symlink %s: %v", path, err))
-				} else {
-					reclaimedFiles = append(reclaimedFiles, path)
-					// Mark parent directory as potentially empty
-					parentDir := filepath.Dir(path)
-					emptyDirs[parentDir] = true
-				}
-				return nil
-			}
-
-			// For regular files and directories, use RemoveAll
-			if err := os.RemoveAll(path); err != nil {
+		if !info.ModTime().Before(cutoffTime) {
+			return nil
+		}
+		if !dryRun {
+			// Symbolic links are removed themselves, not their targets
+			if err := os.Remove(path); err != nil {
 				errors = append(errors, fmt.Sprintf("Error removing %s: %v", path, err))
-			} else {
-				reclaimedFiles = append(reclaimedFiles, path)
-				// Mark parent directory as potentially empty
-				parentDir := filepath.Dir(path)
-				emptyDirs[parentDir] = true
+				return nil
 			}
 		}
-
+		fileStats = append(fileStats, model.FileStat{
+			Name:    info.Name(),
+			Path:    path,
+			Size:    info.Size(),
+			Mode:    info.Mode().String(),
+			ModTime: info.ModTime().Format("2006-01-02T15:04:05Z07:00"),
+			Type:    getFileType(info),
+			Mime:    GetMimeType(path, info),
+		})
+		reclaimedSize += info.Size()
 		return nil
 	})
-
 	if err != nil {
 		return nil, fmt.Errorf("error walking directory: %v", err)
 	}
 
-	// Check and remove empty directories
-	for dir := range emptyDirs {
-		// Skip the share directory itself
-		if dir == s.shareDir {
-			continue
-		}
-
-		// Check if directory is empty
-		entries, err := os.ReadDir(dir)
-		if err != nil {
-			errors = append(errors, fmt.Sprintf("Error checking directory %s: %v", dir, err))
-			continue
-		}
-
-		// If directory is empty, remove it
-		if len(entries) == 0 {
-			if err := os.Remove(dir); err != nil {
-				errors = append(errors, fmt.Sprintf("Error removing empty directory %s: %v", dir, err))
-			} else {
-				reclaimedFiles = append(reclaimedFiles, dir)
-				// Mark parent directory as potentially empty
-				parentDir := filepath.Dir(dir)
-				emptyDirs[parentDir] = true
+	// Remove empty directories deepest first, so their parents may become empty too
+	if !dryRun {
+		sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+		for _, dir := range dirs {
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				errors = append(errors, fmt.Sprintf("Error checking directory %s: %v", dir, err))
+				continue
+			}
+			if len(entries) == 0 {
+				if err := os.Remove(dir); err != nil {
+					errors = append(errors, fmt.Sprintf("Error removing empty directory %s: %v", dir, err))
+				}
 			}
 		}
 	}
 
-	// Prepare response
-	response := &model.FileShareResult{
-		Success:  true,
-		Message:  "Files reclaimed successfully",
-		FileList: fileStats,
+	verb := "Reclaimed"
+	if dryRun {
+		verb = "Would reclaim"
+	}
+	message := fmt.Sprintf("%s %d files (%d bytes) not modified since %s",
+		verb, len(fileStats), reclaimedSize, cutoffTime.UTC().Format(time.RFC3339))
+	if len(errors) > 0 {
+		message += fmt.Sprintf("; %d errors: %s", len(errors), strings.Join(errors, "; "))
 	}
 
-	return response, nil
+	return &model.FileShareResult{
+		Success:  len(errors) == 0,
+		Message:  message,
+		FileList: fileStats,
+	}, nil
 }
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReclaimFiles(t *testing.T) {
+	shareDir := t.TempDir()
+	now := time.Now()
+	old := now.Add(-30 * 24 * time.Hour)
+	write := func(rel string, mtime time.Time) {
+		p := filepath.Join(shareDir, rel)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, os.WriteFile(p, []byte("data"), 0644))
+		require.NoError(t, os.Chtimes(p, mtime, mtime))
+	}
+	write("box1/exec/old.log", old)
+	write("box1/screenshot/new.png", now)
+	write("box2/artifacts/a/b/old.txt", old)
+	// Old directories with recent files are kept
+	require.NoError(t, os.Chtimes(filepath.Join(shareDir, "box1", "screenshot"), old, old))
+	s := &FileService{shareDir: shareDir}
+	cutoff := now.Add(-14 * 24 * time.Hour)
+
+	result, err := s.reclaimFiles(context.Background(), cutoff, true)
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+	assert.Len(t, result.FileList, 2)
+	assert.Contains(t, result.Message, "Would reclaim 2 files (8 bytes)")
+	assert.FileExists(t, filepath.Join(shareDir, "box1", "exec", "old.log"))
+
+	result, err = s.reclaimFiles(context.Background(), cutoff, false)
+	require.NoError(t, err)
+	assert.Len(t, result.FileList, 2)
+	assert.Contains(t, result.Message, "Reclaimed 2 files (8 bytes)")
+
+	assert.NoFileExists(t, filepath.Join(shareDir, "box1", "exec", "old.log"))
+	assert.NoDirExists(t, filepath.Join(shareDir, "box1", "exec"))
+	assert.FileExists(t, filepath.Join(shareDir, "box1", "screenshot", "new.png"))
+	assert.NoDirExists(t, filepath.Join(shareDir, "box2", "artifacts"))
+	// The share directories of boxes may be mounted, so they stay
+	assert.DirExists(t, filepath.Join(shareDir, "box2"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = s.reclaimFiles(ctx, cutoff, false)
+	assert.Error(t, err)
+}
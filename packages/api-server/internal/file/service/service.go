@@ -5,17 +5,11 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
 
 	"github.com/babelcloud/gbox/packages/api-server/config"
 	boxService "github.com/babelcloud/gbox/packages/api-server/internal/box/service"
 )
 
-const (
-	// Default reclaim interval
-	defaultFileReclaimInterval = 14 * 24 * time.Hour // 14 days
-)
-
 // FileService handles file operations for the share directory
 type FileService struct {
 	shareDir string
@@ -11,6 +11,7 @@ import (
 	"archive/tar"
 
 	"github.com/babelcloud/gbox/packages/api-server/internal/common"
+	"github.com/babelcloud/gbox/packages/api-server/internal/file/share"
 	boxModel "github.com/babelcloud/gbox/packages/api-server/pkg/box"
 	fileModel "github.com/babelcloud/gbox/packages/api-server/pkg/file"
 )
@@ -101,6 +102,11 @@ func (s *FileService) ShareFile(ctx context.Context, boxID, pathWithBoxID string
 			continue
 		}
 
+		if err := share.CheckQuota(boxID, header.Size); err != nil {
+			os.Remove(targetPath)
+			return nil, err
+		}
+
 		// Write the file content
 		_, err = io.Copy(targetFile, tarReader)
 		if err != nil {
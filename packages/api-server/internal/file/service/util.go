@@ -11,8 +11,8 @@ import (
 
 var log = logger.New()
 
-// getMimeType determines the MIME type of a file
-func getMimeType(path string, info os.FileInfo) string {
+// GetMimeType determines the MIME type of a file
+func GetMimeType(path string, info os.FileInfo) string {
 	if info.IsDir() {
 		return "application/x-directory"
 	}
@@ -45,7 +45,7 @@ func getFileList(path string) ([]model.FileStat, error) {
 				Mode:    info.Mode().String(),
 				ModTime: info.ModTime().Format("2006-01-02T15:04:05Z07:00"),
 				Type:    getFileType(info),
-				Mime:    getMimeType(path, info),
+				Mime:    GetMimeType(path, info),
 			},
 		}, nil
 	}
@@ -70,7 +70,7 @@ func getFileList(path string) ([]model.FileStat, error) {
 			Mode:    info.Mode().String(),
 			ModTime: info.ModTime().Format("2006-01-02T15:04:05Z07:00"),
 			Type:    getFileType(info),
-			Mime:    getMimeType(filepath.Join(path, info.Name()), info),
+			Mime:    GetMimeType(filepath.Join(path, info.Name()), info),
 		})
 	}
 
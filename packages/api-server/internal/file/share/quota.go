@@ -0,0 +1,102 @@
+package share
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/babelcloud/gbox/packages/api-server/config"
+)
+
+// ErrQuotaExceeded is returned when a write would grow the share directory of a box past
+// its quota
+var ErrQuotaExceeded = errors.New("share quota exceeded")
+
+// BoxDir returns the share directory of a box on the host
+func BoxDir(boxID string) string {
+	return filepath.Join(config.GetInstance().File.Share, boxID)
+}
+
+// Usage returns the bytes and number of regular files in the share directory of a box
+func Usage(boxID string) (int64, int, error) {
+	return usage(BoxDir(boxID))
+}
+
+// CheckQuota returns ErrQuotaExceeded if writing size more bytes to the share directory of
+// a box would exceed the configured quota
+func CheckQuota(boxID string, size int64) error {
+	return checkQuota(BoxDir(boxID), size, config.GetInstance().File.ShareQuota)
+}
+
+// Remaining returns how many more bytes the share directory of a box may grow by before
+// exceeding the configured quota, or -1 if no quota is configured
+func Remaining(boxID string) (int64, error) {
+	return remaining(BoxDir(boxID), config.GetInstance().File.ShareQuota)
+}
+
+// RemoveBox removes the share directory of a box with all of its files
+func RemoveBox(boxID string) error {
+	if boxID == "" || boxID == "." || boxID == ".." || strings.ContainsAny(boxID, `/\`) {
+		return fmt.Errorf("invalid box ID %q", boxID)
+	}
+	return os.RemoveAll(BoxDir(boxID))
+}
+
+func usage(dir string) (int64, int, error) {
+	var size int64
+	files := 0
+	err := filepath.WalkDir(dir, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// Boxes only get a share directory once they write to it
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		size += info.Size()
+		files++
+		return nil
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to compute share usage: %w", err)
+	}
+	return size, files, nil
+}
+
+func checkQuota(dir string, size, quota int64) error {
+	if quota <= 0 {
+		return nil
+	}
+	used, _, err := usage(dir)
+	if err != nil {
+		return err
+	}
+	if used+size > quota {
+		return fmt.Errorf("%w: %d of %d bytes used, %d more requested", ErrQuotaExceeded, used, quota, size)
+	}
+	return nil
+}
+
+func remaining(dir string, quota int64) (int64, error) {
+	if quota <= 0 {
+		return -1, nil
+	}
+	used, _, err := usage(dir)
+	if err != nil {
+		return 0, err
+	}
+	return max(quota-used, 0), nil
+}
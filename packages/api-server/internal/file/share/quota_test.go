@@ -0,0 +1,49 @@
+package share
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageAndQuota(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "screenshot"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), make([]byte, 100), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "screenshot", "b.png"), make([]byte, 50), 0644))
+	require.NoError(t, os.Symlink("/etc/passwd", filepath.Join(dir, "link")))
+
+	size, files, err := usage(dir)
+	require.NoError(t, err)
+	assert.Equal(t, int64(150), size)
+	assert.Equal(t, 2, files)
+
+	size, files, err = usage(filepath.Join(dir, "missing"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), size)
+	assert.Equal(t, 0, files)
+
+	assert.NoError(t, checkQuota(dir, 50, 200))
+	assert.ErrorIs(t, checkQuota(dir, 51, 200), ErrQuotaExceeded)
+	assert.NoError(t, checkQuota(dir, 1<<40, 0), "a zero quota is unlimited")
+	assert.NoError(t, checkQuota(filepath.Join(dir, "missing"), 200, 200))
+
+	room, err := remaining(dir, 200)
+	require.NoError(t, err)
+	assert.Equal(t, int64(50), room)
+	room, err = remaining(dir, 100)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), room, "a directory already over its quota has no room left")
+	room, err = remaining(dir, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), room)
+}
+
+func TestRemoveBoxRejectsPaths(t *testing.T) {
+	for _, id := range []string{"", ".", "..", "../other", "a/b"} {
+		assert.Error(t, RemoveBox(id), "box ID %q", id)
+	}
+}
@@ -0,0 +1,142 @@
+// Package share signs the URLs of files in the share directory, so single files can be
+// handed out for a limited time without exposing the rest of the directory, and accounts
+// for the space each box takes up in it.
+package share
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/babelcloud/gbox/packages/api-server/config"
+	"github.com/babelcloud/gbox/packages/api-server/pkg/logger"
+)
+
+const (
+	// URLPrefix is the path shared files are served under
+	URLPrefix = "/api/v1/files/shared/"
+	// MaxTTL bounds how long a signed URL is valid
+	MaxTTL = 7 * 24 * time.Hour
+)
+
+var (
+	// ErrInvalidSignature is returned when a URL is not signed or was changed after signing
+	ErrInvalidSignature = errors.New("invalid signature")
+
+	// ErrExpired is returned when a signed URL is past its expiry
+	ErrExpired = errors.New("link expired")
+)
+
+// Purposes a signature is made for, so one made for a use is not valid for another
+const (
+	// PurposeShare signs the URLs of shared files
+	PurposeShare = "share"
+	// PurposeBrowserConnect signs the tokens of browser connect URLs
+	PurposeBrowserConnect = "browser-connect"
+)
+
+var log = logger.New()
+
+// Signer signs and verifies the URLs of shared files with an HMAC key
+type Signer struct {
+	key []byte
+}
+
+// NewSigner creates a signer with the given key
+func NewSigner(key []byte) *Signer {
+	return &Signer{key: key}
+}
+
+var defaultSigner struct {
+	once   sync.Once
+	signer *Signer
+}
+
+// Default returns the signer using the configured share secret, or a random one
+func Default() *Signer {
+	defaultSigner.once.Do(func() {
+		key := []byte(config.GetInstance().File.ShareSecret)
+		if len(key) == 0 {
+			log.Warn("No share secret configured, shared file URLs will not survive a restart")
+			key = make([]byte, 32)
+			if _, err := rand.Read(key); err != nil {
+				panic(fmt.Sprintf("failed to generate share secret: %v", err))
+			}
+		}
+		defaultSigner.signer = NewSigner(key)
+	})
+	return defaultSigner.signer
+}
+
+// SignURL signs the path of a file in the share directory with the default signer and the
+// configured validity, returning the URL and its expiry
+func SignURL(p string) (string, time.Time) {
+	expires := time.Now().Add(config.GetInstance().File.ShareURLTTL)
+	return Default().Sign(p, expires, ""), expires
+}
+
+// Sign returns the URL of the file at p, relative to the share directory, valid until
+// expires. A filename makes the file download under that name.
+func (s *Signer) Sign(p string, expires time.Time, filename string) string {
+	p = cleanPath(p)
+	query := s.SignQuery(PurposeShare, p, expires, filename)
+
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return URLPrefix + strings.Join(segments, "/") + "?" + query.Encode()
+}
+
+// SignQuery returns the query parameters signing p for purpose until expires, which Verify
+// checks. Paths other than the ones of shared files are signed the same way.
+func (s *Signer) SignQuery(purpose, p string, expires time.Time, filename string) url.Values {
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	if filename != "" {
+		query.Set("filename", filename)
+	}
+	query.Set("signature", s.signature(purpose, cleanPath(p), query.Get("expires"), filename))
+	return query
+}
+
+// Verify checks the signature for purpose and the expiry in the query of a URL of p
+func (s *Signer) Verify(purpose, p string, query url.Values, now time.Time) error {
+	signature, err := base64.RawURLEncoding.DecodeString(query.Get("signature"))
+	if err != nil || len(signature) == 0 {
+		return ErrInvalidSignature
+	}
+	expected, _ := base64.RawURLEncoding.DecodeString(s.signature(purpose, cleanPath(p), query.Get("expires"), query.Get("filename")))
+	if !hmac.Equal(signature, expected) {
+		return ErrInvalidSignature
+	}
+
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if now.After(time.Unix(expires, 0)) {
+		return fmt.Errorf("%w at %s", ErrExpired, time.Unix(expires, 0).UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (s *Signer) signature(purpose, p, expires, filename string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(purpose + "\n" + p + "\n" + expires + "\n" + filename))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// cleanPath returns p relative to the share directory, without leading slash
+func cleanPath(p string) string {
+	return strings.TrimPrefix(path.Clean("/"+p), "/")
+}
@@ -0,0 +1,59 @@
+package share
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	signer := NewSigner([]byte("secret"))
+	now := time.Unix(1700000000, 0)
+
+	signed := signer.Sign("/box/screenshot/my shot.png", now.Add(time.Hour), "report.png")
+	u, err := url.Parse(signed)
+	require.NoError(t, err)
+	assert.Equal(t, "/api/v1/files/shared/box/screenshot/my%20shot.png", u.EscapedPath())
+	assert.Equal(t, "report.png", u.Query().Get("filename"))
+
+	p := strings.TrimPrefix(u.Path, URLPrefix)
+	assert.NoError(t, signer.Verify(PurposeShare, p, u.Query(), now))
+
+	err = signer.Verify(PurposeShare, p, u.Query(), now.Add(2*time.Hour))
+	assert.True(t, errors.Is(err, ErrExpired), "got %v", err)
+
+	tampered := func(key, value string) url.Values {
+		query := u.Query()
+		query.Set(key, value)
+		return query
+	}
+	assert.ErrorIs(t, signer.Verify(PurposeShare, "box/screenshot/other.png", u.Query(), now), ErrInvalidSignature)
+	assert.ErrorIs(t, signer.Verify(PurposeShare, p, tampered("expires", "1900000000"), now), ErrInvalidSignature)
+	assert.ErrorIs(t, signer.Verify(PurposeShare, p, tampered("filename", "evil.html"), now), ErrInvalidSignature)
+	assert.ErrorIs(t, signer.Verify(PurposeShare, p, tampered("signature", ""), now), ErrInvalidSignature)
+	assert.ErrorIs(t, NewSigner([]byte("other")).Verify(PurposeShare, p, u.Query(), now), ErrInvalidSignature)
+
+	// Paths are compared once cleaned
+	assert.NoError(t, signer.Verify(PurposeShare, "box/./screenshot//my shot.png", u.Query(), now))
+}
+
+func TestSignQuery(t *testing.T) {
+	signer := NewSigner([]byte("secret"))
+	now := time.Unix(1700000000, 0)
+
+	query := signer.SignQuery(PurposeBrowserConnect, "box/playwright", now.Add(time.Minute), "")
+	assert.NoError(t, signer.Verify(PurposeBrowserConnect, "box/playwright", query, now))
+	assert.ErrorIs(t, signer.Verify(PurposeBrowserConnect, "box/cdp", query, now), ErrInvalidSignature)
+	assert.ErrorIs(t, signer.Verify(PurposeBrowserConnect, "box/playwright", query, now.Add(time.Hour)), ErrExpired)
+
+	// A signature is only valid for its purpose, a shared file URL is no connect token
+	assert.ErrorIs(t, signer.Verify(PurposeShare, "box/playwright", query, now), ErrInvalidSignature)
+	u, err := url.Parse(signer.Sign("box/playwright", now.Add(time.Minute), ""))
+	require.NoError(t, err)
+	assert.ErrorIs(t, signer.Verify(PurposeBrowserConnect, "box/playwright", u.Query(), now), ErrInvalidSignature)
+}
@@ -1,5 +1,7 @@
 package model
 
+import "io"
+
 // BoxArchiveGetParams represents the request for getting an archive from a container
 type BoxArchiveGetParams struct {
 	Path string `json:"path" description:"resource in the container's filesystem to archive"`
@@ -12,10 +14,10 @@ type BoxArchiveHeadParams struct {
 
 // BoxArchiveExtractParams represents the request for extracting an archive to a container
 type BoxArchiveExtractParams struct {
-	Path                 string `json:"path" description:"path to a directory in the container to extract the archive's contents into"`
-	NoOverwriteDirNonDir bool   `json:"noOverwriteDirNonDir,omitempty" description:"if true, it will be an error if unpacking would cause an existing directory to be replaced with a non-directory and vice versa"`
-	CopyUIDGID           bool   `json:"copyUIDGID,omitempty" description:"if true, it will copy UID/GID maps to the dest file or dir"`
-	Content              []byte `json:"-" description:"the content of the archive to extract"`
+	Path                 string    `json:"path" description:"path to a directory in the container to extract the archive's contents into"`
+	NoOverwriteDirNonDir bool      `json:"noOverwriteDirNonDir,omitempty" description:"if true, it will be an error if unpacking would cause an existing directory to be replaced with a non-directory and vice versa"`
+	CopyUIDGID           bool      `json:"copyUIDGID,omitempty" description:"if true, it will copy UID/GID maps to the dest file or dir"`
+	Reader               io.Reader `json:"-" description:"the uncompressed tar archive to extract, streamed from the request"`
 }
 
 // BoxArchiveResult represents the response for getting an archive
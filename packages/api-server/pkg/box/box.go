@@ -46,38 +46,132 @@ type LinuxAndroidBoxConfigResolution struct {
 	Height int `json:"height"`
 }
 
+// BoxFile describes a file in a box; symlinks are described themselves, not their targets
 type BoxFile struct {
 	LastModified time.Time `json:"lastModified"`
 	Name         string    `json:"name"`
 	Path         string    `json:"path"`
-	Size         string    `json:"size"`
-	Type         string    `json:"type"`
+	Size         int64     `json:"size"`
+	// Type is file, directory, symlink or other
+	Type string `json:"type"`
+	// Mode is the octal permission of the file, such as "0644"
+	Mode  string `json:"mode"`
+	Owner string `json:"owner"`
+	Group string `json:"group"`
+	UID   int    `json:"uid"`
+	GID   int    `json:"gid"`
+	// LinkTarget is the target of a symlink
+	LinkTarget string `json:"linkTarget,omitempty"`
+	// Hidden reports a name starting with a dot
+	Hidden bool `json:"hidden"`
 }
 
+// File list sort keys
+const (
+	FileSortPath         = "path"
+	FileSortName         = "name"
+	FileSortSize         = "size"
+	FileSortLastModified = "lastModified"
+	FileSortType         = "type"
+)
+
 type BoxFileListParams struct {
 	// Path to the directory
 	Path string `json:"-"`
 	// Depth of the directory
 	Depth float64 `json:"-"`
+	// Sort is the key files are sorted by: path (default), name, size, lastModified or type,
+	// which lists directories first
+	Sort string `json:"-"`
+	// Desc reverses the sort order
+	Desc bool `json:"-"`
+	// Offset and Limit select a page of the sorted files, a zero Limit returns all of them
+	Offset int `json:"-"`
+	Limit  int `json:"-"`
 }
 
 type BoxFileListResult struct {
 	Data []BoxFile `json:"data"`
+	// Total is the number of files listed, over all pages
+	Total int `json:"total"`
+	// HasMore reports that files follow the returned page
+	HasMore bool `json:"hasMore"`
 }
 
+// File content encodings
+const (
+	FileEncodingUTF8   = "utf8"
+	FileEncodingBase64 = "base64"
+)
+
 type BoxFileReadParams struct {
 	Path string `json:"-"`
+	// Encoding of the returned content, utf8 (default) or base64
+	Encoding string `json:"-"`
+	// Offset and Length select a byte range, a zero Length reads to the end of the file
+	Offset int64 `json:"-"`
+	Length int64 `json:"-"`
+	// StartLine and EndLine select an inclusive 1-based line range, a zero EndLine reads to the end of the file
+	StartLine int `json:"-"`
+	EndLine   int `json:"-"`
+	// MaxSize caps the bytes read, 0 uses the server limit
+	MaxSize int64 `json:"-"`
+	// Format is raw (default) for the content as is, or auto to convert it by its type
+	Format string `json:"-"`
+	// MaxDimension downscales images in auto format so neither side exceeds it, 0 keeps the size
+	MaxDimension int `json:"-"`
+	// MaxRows caps the rows of CSV and items of JSON previews in auto format, 0 uses the default
+	MaxRows int `json:"-"`
+	// MaxPages caps the pages of documents in auto format, 0 uses the default
+	MaxPages int `json:"-"`
 }
 
 type BoxFileReadResult struct {
 	Content string `json:"content"`
+	// Encoding of Content; utf8 reads of content that is not valid UTF-8 fall back to base64
+	Encoding string `json:"encoding"`
+	MimeType string `json:"mimeType"`
+	// Size is the total size of the file in bytes
+	Size int64 `json:"size"`
+	// Truncated reports that the requested range was cut short by the size limit, or in
+	// auto format that rows or pages were left out of the preview
+	Truncated bool `json:"truncated"`
+	// Kind is what the content was converted as in auto format: text, image, document,
+	// table, json or binary
+	Kind string `json:"kind,omitempty"`
+	// Image describes the image in Content
+	Image *BoxFileImage `json:"image,omitempty"`
+	// Pages holds the text of each page of a document, also joined in Content
+	Pages []BoxFilePage `json:"pages,omitempty"`
+	// Table holds the preview of a CSV file or spreadsheet
+	Table *BoxFileTable `json:"table,omitempty"`
+	// JSON holds the preview of a JSON file
+	JSON *BoxFileJSON `json:"json,omitempty"`
 }
 
 type BoxFileWriteParams struct {
 	Path    string `json:"path"`
 	Content string `json:"content"`
+	// Encoding of Content, utf8 (default) or base64
+	Encoding string `json:"encoding,omitempty"`
+	// Append adds Content to the end of the file instead of replacing it
+	Append bool `json:"append,omitempty"`
+	// Mode is the octal permission of the file, such as "0755"; existing files keep theirs by default
+	Mode string `json:"mode,omitempty"`
+	// Owner of the file as "user" or "user:group", by name or ID; existing files keep theirs by default
+	Owner string `json:"owner,omitempty"`
+	// CreateParents creates missing parent directories, defaults to true
+	CreateParents *bool `json:"createParents,omitempty"`
+	// Overwrite replaces an existing file, defaults to true; false fails if the file exists
+	Overwrite *bool `json:"overwrite,omitempty"`
+	// IfMatch is the sha256 the file must have for the write to proceed
+	IfMatch string `json:"ifMatch,omitempty"`
 }
 
 type BoxFileWriteResult struct {
 	Message string `json:"message"`
+	// Size is the size of the file in bytes after the write
+	Size int64 `json:"size"`
+	// SHA256 is the hex encoded checksum of the file after the write
+	SHA256 string `json:"sha256"`
 }
@@ -0,0 +1,32 @@
+package model
+
+// Kinds of changes to the filesystem of a box
+const (
+	BoxChangeAdded    = "added"
+	BoxChangeModified = "modified"
+	BoxChangeDeleted  = "deleted"
+)
+
+type BoxChangesParams struct {
+	// Exclude leaves out paths matching one of these globs, along with everything under them
+	Exclude []string `json:"-"`
+	// NoDefaultExcludes also reports the paths the server excludes by default, such as /tmp
+	NoDefaultExcludes bool `json:"-"`
+}
+
+// BoxChange is a path added, modified or deleted since the box was created
+type BoxChange struct {
+	Path string `json:"path"`
+	Kind string `json:"kind"`
+}
+
+// BoxChanges lists the changes to the filesystem of a box relative to its image, sorted by
+// path. Volumes and mounted directories are not included.
+type BoxChanges struct {
+	Changes  []BoxChange `json:"changes"`
+	Added    int         `json:"added"`
+	Modified int         `json:"modified"`
+	Deleted  int         `json:"deleted"`
+	// Excluded counts the changes left out by the exclusion globs
+	Excluded int `json:"excluded"`
+}
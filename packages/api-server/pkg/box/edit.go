@@ -0,0 +1,55 @@
+package model
+
+// File edit types
+const (
+	// FileEditReplace replaces occurrences of OldText with NewText
+	FileEditReplace = "replace"
+	// FileEditReplaceLines replaces the lines from StartLine to EndLine with NewText
+	FileEditReplaceLines = "replaceLines"
+	// FileEditInsert inserts NewText before Line
+	FileEditInsert = "insert"
+	// FileEditPatch applies the unified diff in Patch
+	FileEditPatch = "patch"
+)
+
+// BoxFileEdit is a single change to a file. Line numbers are 1-based and refer to the
+// file as left by the previous edits of the same request.
+type BoxFileEdit struct {
+	Type string `json:"type"`
+	// OldText is the exact text replaced by replace edits
+	OldText string `json:"oldText,omitempty"`
+	// NewText is the replacement or inserted text
+	NewText string `json:"newText,omitempty"`
+	// ExpectedCount is the number of occurrences of OldText a replace edit expects, defaults to 1
+	ExpectedCount int `json:"expectedCount,omitempty"`
+	// ReplaceAll replaces every occurrence of OldText, however many there are
+	ReplaceAll bool `json:"replaceAll,omitempty"`
+	// StartLine and EndLine are the inclusive line range of replaceLines edits
+	StartLine int `json:"startLine,omitempty"`
+	EndLine   int `json:"endLine,omitempty"`
+	// Line is the line insert edits insert before; one past the last line appends
+	Line int `json:"line,omitempty"`
+	// Patch is the unified diff of patch edits
+	Patch string `json:"patch,omitempty"`
+}
+
+// BoxFileEditParams represents the request for editing a file in a box
+type BoxFileEditParams struct {
+	Path string `json:"path"`
+	// Edits are applied in order, and the file is only written if all of them apply
+	Edits []BoxFileEdit `json:"edits"`
+	// DryRun returns the diff without writing the file
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// BoxFileEditResult represents the result of editing a file
+type BoxFileEditResult struct {
+	// Diff is the unified diff of the changes
+	Diff string `json:"diff"`
+	// Changed reports whether the edits changed the file
+	Changed bool `json:"changed"`
+	// Size is the size of the file in bytes after the edits
+	Size int64 `json:"size"`
+	// SHA256 is the hex encoded checksum of the file after the edits
+	SHA256 string `json:"sha256"`
+}
@@ -10,10 +10,31 @@ type BoxExecParams struct {
 	WorkingDir string `json:"workingDir,omitempty"`
 	// The environment variables to run the command
 	Envs map[string]string `json:"envs,omitempty"`
+	// The user to run the command as, a name or uid[:gid]. Defaults to the box user
+	User string `json:"user,omitempty"`
+	// Data written to the command's stdin before it is closed
+	Stdin string `json:"stdin,omitempty"`
+	// Encoding of the stdin data, "text" (default) or "base64"
+	StdinEncoding string `json:"stdinEncoding,omitempty"`
+	// Files written into the box before the command runs, keyed by path.
+	// Relative paths are resolved against the working directory.
+	InputFiles map[string]string `json:"inputFiles,omitempty"`
+	// Maximum number of bytes kept of stdout and of stderr, capped by the server
+	MaxOutputBytes int64 `json:"maxOutputBytes,omitempty"`
+	// Maximum number of lines kept of stdout and of stderr
+	MaxOutputLines int `json:"maxOutputLines,omitempty"`
+	// Which part of the output to keep when it is truncated, "head" (default) or "tail"
+	OutputRetention string `json:"outputRetention,omitempty"`
+	// Whether to save the full output to the box share directory
+	SpillOutput bool `json:"spillOutput,omitempty"`
+	// Whether to measure the resources consumed by the command and report them in usage
+	ReportUsage bool `json:"reportUsage,omitempty"`
+	// Globs of files to collect when they are created or modified by the command,
+	// relative to the working directory unless absolute; "**" matches any directories
+	CollectArtifacts []string `json:"collectArtifacts,omitempty"`
 
 	// --- Stream-related fields (temporarily commented out) ---
 	// Args     []string           `json:"args,omitempty"`
-	// Stdin    bool               `json:"stdin,omitempty"`
 	// Stdout   bool               `json:"stdout,omitempty"`
 	// Stderr   bool               `json:"stderr,omitempty"`
 	// TTY      bool               `json:"tty,omitempty"`
@@ -22,19 +43,44 @@ type BoxExecParams struct {
 
 // BoxExecResult represents the response from an exec operation
 type BoxExecResult struct {
-	ExitCode int    `json:"exitCode"` // Exit code of the command
-	Stdout   string `json:"stdout"`   // Standard output from command execution
-	Stderr   string `json:"stderr"`   // Standard error from command execution
+	ExitCode int    `json:"exitCode"`           // Exit code of the command
+	Stdout   string `json:"stdout"`             // Standard output from command execution
+	Stderr   string `json:"stderr"`             // Standard error from command execution
+	TimedOut bool   `json:"timedOut,omitempty"` // Whether the command was killed because it exceeded its timeout
+
+	StdoutTruncated bool   `json:"stdoutTruncated,omitempty"` // Whether stdout was cut to the output limits
+	StderrTruncated bool   `json:"stderrTruncated,omitempty"` // Whether stderr was cut to the output limits
+	StdoutBytes     int64  `json:"stdoutBytes"`               // Total number of bytes written to stdout
+	StderrBytes     int64  `json:"stderrBytes"`               // Total number of bytes written to stderr
+	StdoutURL       string `json:"stdoutUrl,omitempty"`       // URL of the full stdout, when spilled to the share directory
+	StderrURL       string `json:"stderrUrl,omitempty"`       // URL of the full stderr, when spilled to the share directory
+
+	Usage     *BoxExecUsage `json:"usage,omitempty"`     // Resources consumed by the command, see reportUsage
+	Artifacts []BoxArtifact `json:"artifacts,omitempty"` // Collected files, see collectArtifacts
 }
 
 // BoxRunParams represents a request to run a command in a box
 type BoxRunCodeParams struct {
-	Code       string            `json:"code,omitempty"`
-	Language   string            `json:"language,omitempty"` // type of the code to run, e.g. "python3", "typescript", "bash"
-	Argv       []string          `json:"argv,omitempty"`     // arguments to run the code
-	Timeout    string            `json:"timeout,omitempty"`
-	WorkingDir string            `json:"workingDir,omitempty"`
-	Envs       map[string]string `json:"envs,omitempty"` // Environment variables for the command execution
+	Code          string            `json:"code,omitempty"`
+	Language      string            `json:"language,omitempty"` // type of the code to run, e.g. "python3", "typescript", "bash"
+	Argv          []string          `json:"argv,omitempty"`     // arguments to run the code
+	Timeout       string            `json:"timeout,omitempty"`
+	WorkingDir    string            `json:"workingDir,omitempty"`
+	Envs          map[string]string `json:"envs,omitempty"`          // Environment variables for the command execution
+	User          string            `json:"user,omitempty"`          // User to run the code as, a name or uid[:gid]
+	Stdin         string            `json:"stdin,omitempty"`         // Data written to the program's stdin
+	StdinEncoding string            `json:"stdinEncoding,omitempty"` // Encoding of stdin, "text" (default) or "base64"
+	InputFiles    map[string]string `json:"inputFiles,omitempty"`    // Files written into the box before running, keyed by path
+
+	MaxOutputBytes  int64  `json:"maxOutputBytes,omitempty"`  // Maximum number of bytes kept of stdout and of stderr, capped by the server
+	MaxOutputLines  int    `json:"maxOutputLines,omitempty"`  // Maximum number of lines kept of stdout and of stderr
+	OutputRetention string `json:"outputRetention,omitempty"` // Which part of the output to keep when truncated, "head" (default) or "tail"
+	SpillOutput     bool   `json:"spillOutput,omitempty"`     // Whether to save the full output to the box share directory
+	ReportUsage     bool   `json:"reportUsage,omitempty"`     // Whether to measure the resources consumed and report them in usage
+
+	CollectArtifacts []string `json:"collectArtifacts,omitempty"` // Globs of created or modified files to copy to the share directory
+
+	KernelID string `json:"kernelId,omitempty"` // Run python3 code in this stateful kernel, started on first use
 }
 
 // BoxRunCodeResult represents the response from a run operation
@@ -42,6 +88,36 @@ type BoxRunCodeResult struct {
 	ExitCode int    `json:"exitCode,omitempty"` // Exit code of the command
 	Stdout   string `json:"stdout,omitempty"`   // Standard output from command execution
 	Stderr   string `json:"stderr,omitempty"`   // Standard error from command execution
+	TimedOut bool   `json:"timedOut,omitempty"` // Whether the code was killed because it exceeded its timeout
+
+	StdoutTruncated bool   `json:"stdoutTruncated,omitempty"` // Whether stdout was cut to the output limits
+	StderrTruncated bool   `json:"stderrTruncated,omitempty"` // Whether stderr was cut to the output limits
+	StdoutBytes     int64  `json:"stdoutBytes"`               // Total number of bytes written to stdout
+	StderrBytes     int64  `json:"stderrBytes"`               // Total number of bytes written to stderr
+	StdoutURL       string `json:"stdoutUrl,omitempty"`       // URL of the full stdout, when spilled to the share directory
+	StderrURL       string `json:"stderrUrl,omitempty"`       // URL of the full stderr, when spilled to the share directory
+
+	Usage     *BoxExecUsage `json:"usage,omitempty"`     // Resources consumed by the command, see reportUsage
+	Artifacts []BoxArtifact `json:"artifacts,omitempty"` // Collected files, see collectArtifacts
+
+	KernelID       string             `json:"kernelId,omitempty"`       // Kernel the code ran in
+	ExecutionCount int                `json:"executionCount,omitempty"` // Execution counter of the kernel
+	Outputs        []BoxRunCodeOutput `json:"outputs,omitempty"`        // Structured outputs, only for kernel runs
+}
+
+// BoxExecUsage reports the resources consumed by a command
+type BoxExecUsage struct {
+	WallTimeMs   int64 `json:"wallTimeMs"`   // Elapsed time from start to exit
+	CPUTimeMs    int64 `json:"cpuTimeMs"`    // User plus system CPU time of the command and its children
+	PeakRSSBytes int64 `json:"peakRssBytes"` // Largest resident set size sampled among its processes
+}
+
+// BoxArtifact represents a file produced by a command and copied to the share directory
+type BoxArtifact struct {
+	Path     string `json:"path"`     // Absolute path in the box
+	Size     int64  `json:"size"`     // Size in bytes
+	MimeType string `json:"mimeType"` // Detected MIME type
+	URL      string `json:"url"`      // URL of the copy in the share directory
 }
 
 // BoxExecWSParams represents parameters for executing a command via WebSocket
@@ -52,6 +128,18 @@ type BoxExecWSParams struct {
 	WorkingDir string   `json:"workingDir,omitempty"` // Working directory inside the container
 }
 
+// Stdin encodings accepted by BoxExecParams and BoxRunCodeParams
+const (
+	StdinEncodingText   = "text"
+	StdinEncodingBase64 = "base64"
+)
+
+// Output retention modes used when exec output exceeds its limits
+const (
+	OutputRetentionHead = "head"
+	OutputRetentionTail = "tail"
+)
+
 // StreamType represents the type of stream in multiplexed output
 type StreamType byte
 
@@ -0,0 +1,130 @@
+package model
+
+import "time"
+
+// File types of BoxFile
+const (
+	FileTypeFile      = "file"
+	FileTypeDirectory = "directory"
+	FileTypeSymlink   = "symlink"
+	FileTypeOther     = "other"
+)
+
+type BoxFileStatParams struct {
+	Path string `json:"-"`
+}
+
+type BoxFileMkdirParams struct {
+	Path string `json:"path"`
+	// Parents creates missing parent directories and succeeds if the directory exists
+	Parents bool `json:"parents,omitempty"`
+	// Mode is the octal permission of the directory, such as "0755"
+	Mode string `json:"mode,omitempty"`
+}
+
+type BoxFileRemoveParams struct {
+	Path string `json:"path"`
+	// Recursive removes directories with their contents, otherwise only empty ones
+	Recursive bool `json:"recursive,omitempty"`
+}
+
+type BoxFileRemoveResult struct {
+	Message string `json:"message"`
+}
+
+type BoxFileMoveParams struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	// Overwrite replaces an existing file or empty directory at Destination
+	Overwrite bool `json:"overwrite,omitempty"`
+}
+
+type BoxFileCopyParams struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	// Recursive copies directories with their contents
+	Recursive bool `json:"recursive,omitempty"`
+	// Overwrite replaces an existing file or directory at Destination
+	Overwrite bool `json:"overwrite,omitempty"`
+}
+
+type BoxFileChmodParams struct {
+	Path string `json:"path"`
+	// Mode is the octal permission to set, such as "0644"
+	Mode string `json:"mode"`
+	// Recursive also changes the contents of directories
+	Recursive bool `json:"recursive,omitempty"`
+}
+
+type BoxFileManifestParams struct {
+	Path string `json:"path"`
+	// Exclude skips the files and directories whose name matches one of these globs, only
+	// directories for globs with a trailing slash
+	Exclude []string `json:"exclude,omitempty"`
+	// Known maps paths relative to Path to files the caller already hashed, which are not
+	// read again while their size and modification time are unchanged
+	Known map[string]BoxFileManifestKnown `json:"known,omitempty"`
+}
+
+// BoxFileManifestKnown is a file hashed by an earlier manifest
+type BoxFileManifestKnown struct {
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+	Hash         string    `json:"hash"`
+}
+
+// BoxFileManifestEntry describes a file of a manifest
+type BoxFileManifestEntry struct {
+	// Type is file, directory, symlink or other
+	Type string `json:"type"`
+	Size int64  `json:"size"`
+	// Mode is the octal permission of the file, such as "0644"
+	Mode         string    `json:"mode"`
+	LastModified time.Time `json:"lastModified"`
+	// Hash is the hex SHA-256 of the content of a regular file, empty for other files and
+	// files that cannot be read
+	Hash string `json:"hash,omitempty"`
+	// LinkTarget is the target of a symlink
+	LinkTarget string `json:"linkTarget,omitempty"`
+}
+
+// BoxFileManifest describes every file under a directory, so trees can be compared
+// without transferring them
+type BoxFileManifest struct {
+	Path string `json:"path"`
+	// Files maps the paths relative to Path to their description
+	Files map[string]BoxFileManifestEntry `json:"files"`
+}
+
+// Download methods report who fetched the content of a download
+const (
+	DownloadViaServer = "server"
+	DownloadViaBox    = "box"
+)
+
+type BoxFileDownloadParams struct {
+	// URL is the http or https URL to download
+	URL string `json:"url"`
+	// Path is the file the content is written to
+	Path string `json:"path"`
+	// Headers are sent with the request, such as Authorization
+	Headers map[string]string `json:"headers,omitempty"`
+	// MaxSize caps the bytes downloaded, defaults to and cannot exceed the configured limit
+	MaxSize int64 `json:"maxSize,omitempty"`
+	// Checksum is the SHA-256 the content must have, as hex with an optional "sha256:" prefix
+	Checksum string `json:"checksum,omitempty"`
+	// Overwrite replaces an existing file, defaults to true; false fails if the file exists
+	Overwrite *bool `json:"overwrite,omitempty"`
+}
+
+// BoxFileDownloadResult describes a file downloaded into a box
+type BoxFileDownloadResult struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	// SHA256 is the hex encoded checksum of the content
+	SHA256 string `json:"sha256"`
+	// ContentType is the type the server of the URL announced, if known
+	ContentType string `json:"contentType,omitempty"`
+	// Via is server or box, depending on which of them fetched the content
+	Via string `json:"via"`
+}
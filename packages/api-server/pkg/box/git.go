@@ -0,0 +1,143 @@
+package model
+
+// Changes of files in git statuses and diffs
+const (
+	GitChangeAdded       = "added"
+	GitChangeModified    = "modified"
+	GitChangeDeleted     = "deleted"
+	GitChangeRenamed     = "renamed"
+	GitChangeCopied      = "copied"
+	GitChangeTypeChanged = "type-changed"
+	GitChangeUnmerged    = "unmerged"
+	GitChangeUntracked   = "untracked"
+)
+
+type BoxGitCloneParams struct {
+	// URL is the repository to clone; credentials must not be embedded in it
+	URL string `json:"url"`
+	// Path is the directory to clone into, which must not exist or be empty; defaults to
+	// the name of the repository in the working directory
+	Path string `json:"path,omitempty"`
+	// Ref is a branch, tag or commit to check out, defaults to the default branch
+	Ref string `json:"ref,omitempty"`
+	// Depth creates a shallow clone with that many commits, 0 clones the full history
+	Depth int `json:"depth,omitempty"`
+	// Credential is the name of a credential configured on the server; by default the
+	// credential configured for the host of the URL is used, if any
+	Credential string `json:"credential,omitempty"`
+}
+
+// BoxGitCloneResult describes a cloned repository
+type BoxGitCloneResult struct {
+	Path string `json:"path"`
+	// Branch is the checked out branch, empty if HEAD is detached
+	Branch string `json:"branch,omitempty"`
+	// Commit is the SHA of the checked out commit, empty for empty repositories
+	Commit string `json:"commit,omitempty"`
+}
+
+type BoxGitStatusParams struct {
+	// Path is a directory of the repository, defaults to the working directory
+	Path string `json:"-"`
+}
+
+// BoxGitFileStatus is the change of a file in the index and the working tree
+type BoxGitFileStatus struct {
+	Path string `json:"path"`
+	// OrigPath is the source of a renamed or copied file
+	OrigPath string `json:"origPath,omitempty"`
+	// Staged is the change in the index, empty if there is none
+	Staged string `json:"staged,omitempty"`
+	// Unstaged is the change in the working tree, empty if there is none
+	Unstaged string `json:"unstaged,omitempty"`
+}
+
+// BoxGitStatus describes the state of a repository
+type BoxGitStatus struct {
+	// Path is the top-level directory of the repository
+	Path string `json:"path"`
+	// Branch is the checked out branch, empty if HEAD is detached
+	Branch string `json:"branch,omitempty"`
+	// Commit is the SHA of HEAD, empty before the first commit
+	Commit   string `json:"commit,omitempty"`
+	Upstream string `json:"upstream,omitempty"`
+	// Ahead and Behind count the commits that differ from the upstream
+	Ahead  int                `json:"ahead"`
+	Behind int                `json:"behind"`
+	Clean  bool               `json:"clean"`
+	Files  []BoxGitFileStatus `json:"files"`
+}
+
+type BoxGitDiffParams struct {
+	// Path is a directory of the repository, defaults to the working directory
+	Path string `json:"-"`
+	// Staged diffs the index instead of the working tree
+	Staged bool `json:"-"`
+	// Ref is the commit compared with, defaults to the index for the working tree and HEAD
+	// for the index
+	Ref string `json:"-"`
+	// Files limits the diff to these paths relative to the top-level directory
+	Files []string `json:"-"`
+	// Context is the number of unchanged lines around changes
+	Context int `json:"-"`
+	// Untracked also diffs untracked files as added, unless Staged is set
+	Untracked bool `json:"-"`
+}
+
+// BoxGitHunk is a changed region of a file
+type BoxGitHunk struct {
+	OldStart int `json:"oldStart"`
+	OldLines int `json:"oldLines"`
+	NewStart int `json:"newStart"`
+	NewLines int `json:"newLines"`
+	// Header is the text following the range, usually the enclosing function
+	Header string `json:"header,omitempty"`
+	// Lines are the lines of the hunk prefixed with " ", "+", "-" or "\"
+	Lines []string `json:"lines"`
+}
+
+// BoxGitFileDiff is the diff of a single file
+type BoxGitFileDiff struct {
+	Path string `json:"path"`
+	// OldPath is the source of a renamed or copied file
+	OldPath string `json:"oldPath,omitempty"`
+	// Change is added, modified, deleted, renamed, copied or unmerged
+	Change    string       `json:"change"`
+	Binary    bool         `json:"binary,omitempty"`
+	Additions int          `json:"additions"`
+	Deletions int          `json:"deletions"`
+	Hunks     []BoxGitHunk `json:"hunks"`
+}
+
+// BoxGitDiff is a diff of a repository
+type BoxGitDiff struct {
+	Files     []BoxGitFileDiff `json:"files"`
+	Additions int              `json:"additions"`
+	Deletions int              `json:"deletions"`
+	// Patch is the unified diff the files were parsed from, which git apply accepts
+	Patch string `json:"patch"`
+}
+
+type BoxGitCommitParams struct {
+	// Path is a directory of the repository, defaults to the working directory
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+	// Files are staged before committing, with their deletions
+	Files []string `json:"files,omitempty"`
+	// All stages every change before committing, including untracked files
+	All bool `json:"all,omitempty"`
+	// AllowEmpty commits even if nothing is staged
+	AllowEmpty bool `json:"allowEmpty,omitempty"`
+	// AuthorName and AuthorEmail default to the identity configured in the box, or gbox
+	AuthorName  string `json:"authorName,omitempty"`
+	AuthorEmail string `json:"authorEmail,omitempty"`
+}
+
+// BoxGitCommitResult describes a created commit
+type BoxGitCommitResult struct {
+	Commit string `json:"commit"`
+	// Branch is the branch the commit was added to, empty if HEAD is detached
+	Branch string `json:"branch,omitempty"`
+	// Files are the files the commit changed, with the change in Staged
+	Files []BoxGitFileStatus `json:"files"`
+}
@@ -0,0 +1,45 @@
+package model
+
+import "time"
+
+// Kernel statuses
+const (
+	KernelStatusIdle = "idle"
+	KernelStatusBusy = "busy"
+	KernelStatusDead = "dead"
+)
+
+// Types of run-code outputs, following the Jupyter message types
+const (
+	OutputTypeStream        = "stream"
+	OutputTypeDisplayData   = "display_data"
+	OutputTypeExecuteResult = "execute_result"
+	OutputTypeError         = "error"
+)
+
+// BoxKernel represents a stateful code kernel running in a box
+type BoxKernel struct {
+	ID             string    `json:"id"`
+	Language       string    `json:"language"`
+	PID            int       `json:"pid"`            // Process ID inside the box
+	User           string    `json:"user"`           // User the kernel runs as, as uid:gid
+	Status         string    `json:"status"`         // "idle", "busy" or "dead"
+	ExecutionCount int       `json:"executionCount"` // Number of runs since the kernel started
+	StartedAt      time.Time `json:"startedAt"`
+}
+
+// BoxKernelListResult represents the response from listing the kernels of a box
+type BoxKernelListResult struct {
+	Kernels []BoxKernel `json:"kernels"`
+}
+
+// BoxRunCodeOutput represents a structured output of code run in a kernel
+type BoxRunCodeOutput struct {
+	Type      string            `json:"type"`                // "stream", "display_data", "execute_result" or "error"
+	Name      string            `json:"name,omitempty"`      // Stream name, "stdout" or "stderr"
+	Text      string            `json:"text,omitempty"`      // Stream text
+	Data      map[string]string `json:"data,omitempty"`      // Content by MIME type, binary content is base64 encoded
+	EName     string            `json:"ename,omitempty"`     // Exception name
+	EValue    string            `json:"evalue,omitempty"`    // Exception value
+	Traceback []string          `json:"traceback,omitempty"` // Formatted traceback lines
+}
@@ -0,0 +1,29 @@
+package model
+
+// How a run-code language receives the code
+const (
+	CodeModeStdin = "stdin" // Piped to the interpreter, or written to a file when the caller supplies stdin
+	CodeModeFile  = "file"  // Written to a temporary file, substituted for {file} in the command
+	CodeModeArg   = "arg"   // Passed inline, substituted for {code} in the command
+)
+
+// RunCodeLanguage describes a language runtime that run-code can use
+type RunCodeLanguage struct {
+	Name      string   `json:"name"`                // Name used in the language field of run-code
+	Aliases   []string `json:"aliases,omitempty"`   // Alternative names for the language
+	Extension string   `json:"extension"`           // Extension of the temporary code file, e.g. ".py"
+	Command   []string `json:"command"`             // Command template, may contain {file} or {code}
+	Mode      string   `json:"mode"`                // How the code is passed: "stdin", "file" or "arg"
+	Requires  []string `json:"requires,omitempty"`  // Executables the box image must provide
+	Available *bool    `json:"available,omitempty"` // Whether the box provides the required executables, only set when a box is given
+}
+
+// RunCodeLanguageListParams represents a request to list run-code languages
+type RunCodeLanguageListParams struct {
+	BoxID string // Optional box whose image is checked for the required executables
+}
+
+// RunCodeLanguageListResult represents the response from listing run-code languages
+type RunCodeLanguageListResult struct {
+	Languages []RunCodeLanguage `json:"languages"`
+}
@@ -12,6 +12,8 @@ type ProgressStatus string
 const (
 	// ProgressStatusPrepare indicates that an operation is being prepared.
 	ProgressStatusPrepare ProgressStatus = "prepare"
+	// ProgressStatusDownloading indicates that content is being transferred.
+	ProgressStatusDownloading ProgressStatus = "downloading"
 	// ProgressStatusComplete indicates that an operation has completed successfully.
 	ProgressStatusComplete ProgressStatus = "complete"
 	// ProgressStatusError indicates that an error occurred during an operation.
@@ -24,6 +26,8 @@ type ProgressUpdate struct {
 	Message string         `json:"message,omitempty"` // Human-readable message describing the progress
 	Error   string         `json:"error,omitempty"`   // Error message, if an error occurred (used when Status is ProgressStatusError)
 	ImageID string         `json:"imageId,omitempty"` // Image ID, if relevant (e.g., after a successful image pull)
+	Current int64          `json:"current,omitempty"` // Bytes transferred so far, if relevant (e.g., during a download)
+	Total   int64          `json:"total,omitempty"`   // Total bytes to transfer, if known
 }
 
 // BoxCreateParams represents a request to create a box
@@ -89,7 +93,8 @@ type BoxCreateResult struct {
 
 // BoxDeleteParams represents a request to delete a box
 type BoxDeleteParams struct {
-	Force bool `json:"force,omitempty"` // Whether to force delete the box
+	Force     bool `json:"force,omitempty"`     // Whether to force delete the box
+	KeepShare bool `json:"keepShare,omitempty"` // Whether to keep the files of the box in the share directory
 }
 
 // BoxDeleteResult represents a response from deleting a box
@@ -99,7 +104,8 @@ type BoxDeleteResult struct {
 
 // BoxesDeleteParams represents a request to delete multiple boxes
 type BoxesDeleteParams struct {
-	Force bool `json:"force,omitempty"` // Whether to force delete the boxes
+	Force     bool `json:"force,omitempty"`     // Whether to force delete the boxes
+	KeepShare bool `json:"keepShare,omitempty"` // Whether to keep the files of the boxes in the share directory
 }
 
 // BoxesDeleteResult represents a response from deleting multiple boxes
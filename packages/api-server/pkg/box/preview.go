@@ -0,0 +1,49 @@
+package model
+
+// File read formats
+const (
+	FileReadFormatRaw  = "raw"
+	FileReadFormatAuto = "auto"
+)
+
+// Kinds of content read in auto format
+const (
+	FileKindText     = "text"
+	FileKindImage    = "image"
+	FileKindDocument = "document"
+	FileKindTable    = "table"
+	FileKindJSON     = "json"
+	FileKindBinary   = "binary"
+)
+
+type BoxFileImage struct {
+	// Width and Height of the image in Content
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// OriginalWidth and OriginalHeight of the image in the box
+	OriginalWidth  int `json:"originalWidth"`
+	OriginalHeight int `json:"originalHeight"`
+	// Downscaled reports that Content holds a smaller copy of the image
+	Downscaled bool `json:"downscaled"`
+}
+
+type BoxFilePage struct {
+	// Number is the 1-based number of the page in the document
+	Number int    `json:"number"`
+	Text   string `json:"text"`
+}
+
+type BoxFileTable struct {
+	// Columns are the names in the first row
+	Columns []string   `json:"columns"`
+	Rows    [][]string `json:"rows"`
+	// TotalRows is the number of rows after the first, including the ones left out
+	TotalRows int `json:"totalRows"`
+}
+
+type BoxFileJSON struct {
+	// Value is the parsed document; top-level arrays and JSON Lines keep their first items
+	Value any `json:"value"`
+	// TotalItems is the number of items of a top-level array or of JSON Lines
+	TotalItems int `json:"totalItems,omitempty"`
+}
@@ -0,0 +1,47 @@
+package model
+
+// BoxFileSearchParams represents the request for searching files in a box
+type BoxFileSearchParams struct {
+	// Path is the directory to search, defaults to the working directory
+	Path string `json:"-"`
+	// Pattern is a glob matched against file names, or against paths relative to
+	// Path if it contains a slash; "**" matches any number of directories
+	Pattern string `json:"-"`
+	// Query is a regular expression searched for in file contents
+	Query string `json:"-"`
+	// IgnoreCase makes Query case-insensitive
+	IgnoreCase bool `json:"-"`
+	// Include and Exclude are globs over paths relative to Path that select the files searched
+	Include []string `json:"-"`
+	Exclude []string `json:"-"`
+	// MaxResults bounds the number of matches returned
+	MaxResults int `json:"-"`
+	// ContextLines is the number of lines returned before and after each content match
+	ContextLines int `json:"-"`
+	// NoIgnore also searches files excluded by .gitignore, .git and node_modules
+	NoIgnore bool `json:"-"`
+}
+
+// BoxFileSearchMatch is a file matching a search; content matches also report the line
+type BoxFileSearchMatch struct {
+	Path string `json:"path"`
+	// Line is the 1-based number of the matching line
+	Line int `json:"line,omitempty"`
+	// Column is the 1-based byte offset of the match in the line
+	Column int `json:"column,omitempty"`
+	// Text is the matching line without its line ending
+	Text   string   `json:"text,omitempty"`
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+}
+
+// BoxFileSearchResult represents the result of a file search
+type BoxFileSearchResult struct {
+	Matches []BoxFileSearchMatch `json:"matches"`
+	// FilesSearched is the number of files whose name or content was searched
+	FilesSearched int `json:"filesSearched"`
+	// Truncated reports that the search stopped at the maximum number of results
+	Truncated bool `json:"truncated"`
+	// Skipped lists the files selected for a content search that were too large to search
+	Skipped []string `json:"skipped,omitempty"`
+}
@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// File watch event types
+const (
+	FileEventCreate = "create"
+	FileEventModify = "modify"
+	FileEventDelete = "delete"
+	FileEventRename = "rename"
+)
+
+// BoxFileWatchParams represents the request for watching a directory in a box
+type BoxFileWatchParams struct {
+	// Path is the directory to watch, defaults to the working directory
+	Path string `json:"-"`
+	// Recursive also watches the subdirectories of Path
+	Recursive bool `json:"-"`
+	// Debounce is how long events are collected and coalesced before they are sent
+	Debounce time.Duration `json:"-"`
+}
+
+// BoxFileEvent is a change to a file in a watched directory
+type BoxFileEvent struct {
+	// Type is create, modify, delete or rename
+	Type string `json:"type"`
+	Path string `json:"path"`
+	// OldPath is the previous path of a renamed file
+	OldPath string    `json:"oldPath,omitempty"`
+	IsDir   bool      `json:"isDir"`
+	Time    time.Time `json:"time"`
+}
@@ -1,5 +1,11 @@
 package model
 
+import (
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+)
+
 // --- Types and Constants ---
 
 // PageActionType defines the type of action to execute on a page.
@@ -29,6 +35,13 @@ const (
 	ActionSnapshotCapture        PageActionType = "snapshot.capture"
 	ActionSnapshotTakeScreenshot PageActionType = "snapshot.takeScreenshot"
 
+	ActionNavigate    PageActionType = "navigate"
+	ActionBack        PageActionType = "back"
+	ActionForward     PageActionType = "forward"
+	ActionReload      PageActionType = "reload"
+	ActionWaitFor     PageActionType = "waitFor"
+	ActionSetViewport PageActionType = "setViewport"
+
 	// --- Mouse Buttons ---
 	MouseButtonLeft    MouseButtonType = "left"
 	MouseButtonRight   MouseButtonType = "right"
@@ -204,11 +217,169 @@ type VisionErrorResult struct {
 	Error   string `json:"error"`   // Error message describing the failure
 }
 
-// --- Snapshot Mode Action Parameter Structs (Placeholders) ---
-// TODO: Define structs for Snapshot action parameters when implemented.
+// --- Snapshot Mode Action Parameter Structs ---
+// Snapshot actions target elements by the refs returned by snapshot.capture. A ref stays the
+// same for an element across captures, until the page navigates to another document.
+
+// SnapshotCaptureParams corresponds to the props for the snapshot.capture action.
+type SnapshotCaptureParams struct {
+	// Ref limits the snapshot to the element with this ref and its descendants. Optional.
+	Ref string `json:"ref,omitempty"`
+}
+
+// SnapshotClickParams corresponds to the props for the snapshot.click action.
+type SnapshotClickParams struct {
+	// Ref identifies the element to click.
+	Ref string `json:"ref"` // Required
+	// Button specifies the mouse button. Defaults to "left".
+	Button MouseButtonType `json:"button,omitempty"`
+	// DoubleClick double clicks the element instead.
+	DoubleClick bool `json:"doubleClick,omitempty"`
+}
+
+// SnapshotHoverParams corresponds to the props for the snapshot.hover action.
+type SnapshotHoverParams struct {
+	// Ref identifies the element to hover over.
+	Ref string `json:"ref"` // Required
+}
+
+// SnapshotDragParams corresponds to the props for the snapshot.drag action.
+type SnapshotDragParams struct {
+	// StartRef identifies the element to drag.
+	StartRef string `json:"startRef"` // Required
+	// EndRef identifies the element to drop onto.
+	EndRef string `json:"endRef"` // Required
+}
+
+// SnapshotTypeParams corresponds to the props for the snapshot.type action.
+type SnapshotTypeParams struct {
+	// Ref identifies the editable element to type into.
+	Ref string `json:"ref"` // Required
+	// Text replaces the content of the element.
+	Text string `json:"text"` // Required
+	// Submit presses Enter after typing.
+	Submit bool `json:"submit,omitempty"`
+	// Slowly types one character at a time, triggering key handlers, instead of filling the element at once.
+	Slowly bool `json:"slowly,omitempty"`
+}
+
+// SnapshotSelectOptionParams corresponds to the props for the snapshot.selectOption action.
+type SnapshotSelectOptionParams struct {
+	// Ref identifies the select element.
+	Ref string `json:"ref"` // Required
+	// Values are the values or labels of the options to select; several for multi-selects.
+	Values []string `json:"values"` // Required
+}
+
+// SnapshotTakeScreenshotParams corresponds to the props for the snapshot.takeScreenshot action.
+type SnapshotTakeScreenshotParams struct {
+	// Ref limits the screenshot to the element with this ref. Defaults to the viewport.
+	Ref string `json:"ref,omitempty"`
+	// Specifies the screenshot type, e.g., "png" or "jpeg". Defaults to "png".
+	Type *string `json:"type,omitempty"`
+	// Output format ('url' or 'base64'). Defaults to 'base64'.
+	OutputFormat *string `json:"output_format,omitempty"`
+}
+
+// --- Snapshot Mode Action Result Structs ---
+
+// SnapshotCaptureResult represents the result of a successful snapshot.capture action.
+type SnapshotCaptureResult struct {
+	Success bool `json:"success"` // Always true for this type
+	// Snapshot is the accessibility tree of the page as YAML, in the format of Playwright ARIA
+	// snapshots, with the ref of each element that actions can target, e.g.:
+	//   - button "Submit" [ref=k7qe3]
+	Snapshot string `json:"snapshot"`
+	URL      string `json:"url"`
+	Title    string `json:"title"`
+}
+
+// SnapshotClickResult represents the result of a successful snapshot.click action.
+type SnapshotClickResult struct {
+	Success bool `json:"success"` // Always true for this type
+}
 
-// --- Snapshot Mode Action Result Structs (Placeholders) ---
-// TODO: Define structs for Snapshot action results when implemented.
+// SnapshotHoverResult represents the result of a successful snapshot.hover action.
+type SnapshotHoverResult struct {
+	Success bool `json:"success"` // Always true for this type
+}
+
+// SnapshotDragResult represents the result of a successful snapshot.drag action.
+type SnapshotDragResult struct {
+	Success bool `json:"success"` // Always true for this type
+}
+
+// SnapshotTypeResult represents the result of a successful snapshot.type action.
+type SnapshotTypeResult struct {
+	Success bool `json:"success"` // Always true for this type
+}
+
+// SnapshotSelectOptionResult represents the result of a successful snapshot.selectOption action.
+type SnapshotSelectOptionResult struct {
+	Success bool `json:"success"` // Always true for this type
+	// Selected are the values of the options selected afterwards.
+	Selected []string `json:"selected"`
+}
+
+// SnapshotTakeScreenshotResult represents the result of a successful snapshot.takeScreenshot action.
+type SnapshotTakeScreenshotResult struct {
+	Success       bool   `json:"success"`                  // Always true for this type
+	URL           string `json:"url,omitempty"`            // URL if output_format is "url"
+	Base64Content string `json:"base64_content,omitempty"` // Base64 encoded content if output_format is "base64"
+}
+
+// --- Navigation Action Parameter Structs ---
+
+// NavigateParams corresponds to the props for the navigate action.
+type NavigateParams struct {
+	URL string `json:"url"` // Required
+	// WaitUntil is the event the navigation waits for: "load" (default), "domcontentloaded",
+	// "networkidle" or "commit".
+	WaitUntil playwright.WaitUntilState `json:"wait_until,omitempty"`
+	Timeout   int                       `json:"timeout,omitempty"` // Timeout in milliseconds
+}
+
+// HistoryParams corresponds to the props for the back, forward and reload actions.
+type HistoryParams struct {
+	// WaitUntil is the event the navigation waits for, as for NavigateParams.
+	WaitUntil playwright.WaitUntilState `json:"wait_until,omitempty"`
+	Timeout   int                       `json:"timeout,omitempty"` // Timeout in milliseconds
+}
+
+// WaitForParams corresponds to the props for the waitFor action. At least one condition is
+// required; the conditions given are waited for in the order URL, load state, selector, text.
+type WaitForParams struct {
+	// Selector waits for an element matching this selector to reach State.
+	Selector string `json:"selector,omitempty"`
+	// State is the state Selector and Text wait for: "visible" (default), "hidden",
+	// "attached" or "detached".
+	State string `json:"state,omitempty"`
+	// Text waits for an element containing this text to reach State.
+	Text string `json:"text,omitempty"`
+	// URL waits for the page URL to match this glob pattern, e.g. "**/checkout".
+	URL string `json:"url,omitempty"`
+	// LoadState waits for the page to reach this load state: "load", "domcontentloaded" or
+	// "networkidle".
+	LoadState string `json:"load_state,omitempty"`
+	// Timeout bounds the wait for all the conditions, in milliseconds. Defaults to 30 seconds.
+	Timeout int `json:"timeout,omitempty"`
+}
+
+// SetViewportParams corresponds to the props for the setViewport action.
+type SetViewportParams struct {
+	Width  int `json:"width"`  // Required, in pixels
+	Height int `json:"height"` // Required, in pixels
+}
+
+// --- Navigation Action Result Structs ---
+
+// NavigationResult represents the result of a successful navigation action, with the page
+// URL and title afterwards.
+type NavigationResult struct {
+	Success bool   `json:"success"` // Always true for this type
+	URL     string `json:"url"`
+	Title   string `json:"title"`
+}
 
 // --- CDP Connection Result Structs ---
 
@@ -220,6 +391,12 @@ type ConnectURLParams struct {
 // ConnectURLResult represents the response from the GET /boxes/{id}/browser/connect-url endpoint.
 // This matches the V1BoxBrowserConnectURLResponse from the SDK.
 type ConnectURLResult struct {
-	// CDP URL for connecting to the browser via Chrome DevTools Protocol
+	// CDP URL for connecting to the browser via Chrome DevTools Protocol, empty if the box
+	// browser exposes no CDP endpoint
 	CdpURL string `json:"cdpUrl"`
+	// URL for connecting to the browser with Playwright, e.g. chromium.connect(url)
+	URL string `json:"url"`
+	// ExpiresAt is when the URLs stop accepting new connections, absent if they do not expire.
+	// Established connections are kept.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
 }
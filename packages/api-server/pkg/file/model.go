@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 // FileType represents the type of a file
 type FileType string
 
@@ -43,3 +45,33 @@ type FileShareResult struct {
 	Message  string     `json:"message"`
 	FileList []FileStat `json:"fileList"`
 }
+
+// FileShareParams represents a request to publish a file of a box under a signed URL
+type FileShareParams struct {
+	// Path to the file in the box, relative paths are resolved against the working directory
+	Path string `json:"path"`
+	// ExpiresIn is how long the URL is valid, such as "1h"; defaults to the server setting
+	ExpiresIn string `json:"expiresIn,omitempty"`
+	// Filename makes the file download under this name instead of displaying inline
+	Filename string `json:"filename,omitempty"`
+}
+
+// FileShareURL represents a signed URL of a published file
+type FileShareURL struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// Path to the file in the box
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+}
+
+// FileShareUsage represents the space a box takes up in the share directory
+type FileShareUsage struct {
+	BoxID string `json:"boxId"`
+	// Size is the total size of the files in bytes
+	Size  int64 `json:"size"`
+	Files int   `json:"files"`
+	// Quota is the maximum size in bytes, 0 if unlimited
+	Quota int64 `json:"quota"`
+}
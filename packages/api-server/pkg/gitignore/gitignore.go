@@ -0,0 +1,177 @@
+// Package gitignore matches paths against the patterns of .gitignore files, so the CLI
+// and the server leave out the same files.
+package gitignore
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// rule is a pattern of a .gitignore file
+type rule struct {
+	// base is the directory of the .gitignore file relative to the root, "" for the root
+	base string
+	re   *regexp.Regexp
+	// anchored rules match the path relative to base, others match the name at any depth
+	anchored bool
+	dirOnly  bool
+	negate   bool
+	pattern  string
+}
+
+// Matcher decides which paths relative to a root are ignored, following the rules of
+// .gitignore files: the last matching rule wins, and files below an ignored directory
+// cannot be included again. Rules of deeper directories must be added after the rules of
+// their parents.
+type Matcher struct {
+	rules []rule
+}
+
+// AddPatterns adds the patterns of a .gitignore file in the directory base, relative to
+// the root
+func (m *Matcher) AddPatterns(base string, patterns []string) {
+	if base == "." {
+		base = ""
+	}
+	for _, line := range patterns {
+		line = strings.TrimRight(line, "\r")
+		// Trailing spaces are ignored unless escaped
+		if !strings.HasSuffix(line, `\ `) {
+			line = strings.TrimRight(line, " ")
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		r := rule{base: base}
+		if strings.HasPrefix(line, "!") {
+			r.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		r.anchored = strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		if line == "" {
+			continue
+		}
+
+		re, err := regexp.Compile("^" + globToRegexp(line) + "$")
+		if err != nil {
+			continue
+		}
+		r.re = re
+		r.pattern = line
+		m.rules = append(m.rules, r)
+	}
+}
+
+// AddFile adds the patterns of the content of a .gitignore file in the directory base
+func (m *Matcher) AddFile(base string, content []byte) {
+	m.AddPatterns(base, strings.Split(string(content), "\n"))
+}
+
+// Ignored reports whether a path relative to the root is ignored, by itself or by being
+// in an ignored directory
+func (m *Matcher) Ignored(rel string, isDir bool) bool {
+	for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+		if m.match(dir, true) {
+			return true
+		}
+	}
+	return m.match(rel, isDir)
+}
+
+func (m *Matcher) match(rel string, isDir bool) bool {
+	ignored := false
+	for _, r := range m.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		target := rel
+		if r.base != "" {
+			if !strings.HasPrefix(rel, r.base+"/") {
+				continue
+			}
+			target = strings.TrimPrefix(rel, r.base+"/")
+		}
+		if !r.anchored {
+			target = path.Base(target)
+		}
+		if r.re.MatchString(target) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// PrunableNames returns the patterns find can prune while it lists the files of the root:
+// names that are ignored at any depth, with a trailing slash for directories. Pruned
+// files are only ignored files, so none are returned when any rule includes files again.
+func (m *Matcher) PrunableNames() []string {
+	var names []string
+	for _, r := range m.rules {
+		if r.negate {
+			return nil
+		}
+	}
+	for _, r := range m.rules {
+		// Character classes and escapes may differ between the matchers
+		if r.base != "" || r.anchored || strings.ContainsAny(r.pattern, `[\`) {
+			continue
+		}
+		name := r.pattern
+		if r.dirOnly {
+			name += "/"
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// globToRegexp converts a .gitignore glob to a regular expression, where "**" matches
+// any number of directories
+func globToRegexp(glob string) string {
+	var re strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			re.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		case c == '\\' && i+1 < len(glob):
+			i++
+			re.WriteString(regexp.QuoteMeta(string(glob[i])))
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				re.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return re.String()
+}
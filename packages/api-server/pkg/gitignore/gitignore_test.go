@@ -0,0 +1,56 @@
+package gitignore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatcher(t *testing.T) {
+	m := &Matcher{}
+	m.AddPatterns("", []string{
+		"# comment",
+		".git/",
+		"*.log",
+		"!keep.log",
+		"/build",
+		"docs/**/*.tmp",
+		"cache/",
+	})
+	m.AddFile("web", []byte("dist\r\n/local.txt\n"))
+
+	tests := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"main.go", false, false},
+		{".git", true, true},
+		{".git/config", false, true},
+		{"app.log", false, true},
+		{"sub/app.log", false, true},
+		{"keep.log", false, false},
+		{"build", true, true},
+		{"build/out", false, true},
+		{"sub/build", true, false},
+		{"docs/a/b/x.tmp", false, true},
+		{"docs/x.tmp", false, true},
+		{"x.tmp", false, false},
+		{"cache", false, false},
+		{"cache/x", false, true},
+		{"web/dist/app.js", false, true},
+		{"dist/app.js", false, false},
+		{"web/local.txt", false, true},
+		{"web/sub/local.txt", false, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.ignored, m.Ignored(tt.path, tt.isDir), tt.path)
+	}
+
+	// Names can only be pruned when no rule includes files again
+	assert.Nil(t, m.PrunableNames())
+	m = &Matcher{}
+	m.AddPatterns(".", []string{".git/", "*.log", "/build", "[ab].txt"})
+	m.AddPatterns("web", []string{"dist"})
+	assert.Equal(t, []string{".git/", "*.log"}, m.PrunableNames())
+}
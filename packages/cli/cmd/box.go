@@ -14,7 +14,9 @@ func NewBoxCommand() *cobra.Command {
   gbox box create                                                      # Create a new box
   gbox box delete 550e8400-e29b-41d4-a716-446655440000                 # Delete a specific box
   gbox box exec 550e8400-e29b-41d4-a716-446655440000 -- ls             # Execute a command in a box
-  gbox box cp ./local_file 550e8400-e29b-41d4-a716-446655440000:/work  # Copy a local file to a box`,
+  gbox box cp ./local_file 550e8400-e29b-41d4-a716-446655440000:/work  # Copy a local file to a box
+  gbox box sync ./project 550e8400-e29b-41d4-a716-446655440000:/work   # Sync a local directory with a box
+  gbox box diff 550e8400-e29b-41d4-a716-446655440000                   # Show the files changed in a box`,
 	}
 
 	// Add all box-related subcommands
@@ -28,6 +30,8 @@ func NewBoxCommand() *cobra.Command {
 		NewBoxStopCommand(),
 		NewBoxReclaimCommand(),
 		NewBoxCpCommand(),
+		NewBoxSyncCommand(),
+		NewBoxDiffCommand(),
 		NewBoxImageCommand(),
 	)
 
@@ -1,9 +1,11 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -56,6 +58,24 @@ func getAbsolutePath(path string) string {
 	return filepath.Join(absDir, filepath.Base(path))
 }
 
+// archiveURL returns the archive endpoint URL for a box path
+func archiveURL(apiURL string, boxPath *BoxPath) string {
+	query := url.Values{"path": {boxPath.Path}}
+	return fmt.Sprintf("%s/boxes/%s/archive?%s", apiURL, boxPath.BoxID, query.Encode())
+}
+
+// archiveStatusError builds an error from a failed archive response, including the server's message
+func archiveStatusError(action string, resp *http.Response) error {
+	var errorData struct {
+		Message string `json:"message"`
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if err := json.Unmarshal(body, &errorData); err == nil && errorData.Message != "" {
+		return fmt.Errorf("%s: %s (HTTP status code: %d)", action, errorData.Message, resp.StatusCode)
+	}
+	return fmt.Errorf("%s, HTTP status code: %d", action, resp.StatusCode)
+}
+
 // BoxCpOptions holds command options and parameters
 type BoxCpOptions struct {
 	Source      string
@@ -137,7 +157,7 @@ func copyFromBoxToLocal(src, dst, apiURL string, debug func(string)) error {
 }
 
 func copyFromBoxToStdout(boxPath *BoxPath, apiURL string, debug func(string)) error {
-	requestURL := fmt.Sprintf("%s/boxes/%s/archive?path=%s", apiURL, boxPath.BoxID, boxPath.Path)
+	requestURL := archiveURL(apiURL, boxPath)
 	debug(fmt.Sprintf("Sending GET request to: %s", requestURL))
 
 	resp, err := http.Get(requestURL)
@@ -149,7 +169,7 @@ func copyFromBoxToStdout(boxPath *BoxPath, apiURL string, debug func(string)) er
 	debug(fmt.Sprintf("HTTP response status code: %d", resp.StatusCode))
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to download from box, HTTP status code: %d", resp.StatusCode)
+		return archiveStatusError("failed to download from box", resp)
 	}
 
 	_, err = io.Copy(os.Stdout, resp.Body)
@@ -161,11 +181,21 @@ func copyFromBoxToStdout(boxPath *BoxPath, apiURL string, debug func(string)) er
 }
 
 func copyFromBoxToFile(boxPath *BoxPath, dst, apiURL string, debug func(string)) error {
+	// A trailing separator or an existing directory means copying into that directory
+	intoDir := strings.HasSuffix(dst, string(os.PathSeparator))
+
 	// Convert local path to absolute path
 	dst = getAbsolutePath(dst)
+	if info, statErr := os.Stat(dst); statErr == nil && info.IsDir() {
+		intoDir = true
+	}
 
 	// Create destination directory if it doesn't exist
-	err := os.MkdirAll(filepath.Dir(dst), 0755)
+	createDir := filepath.Dir(dst)
+	if intoDir {
+		createDir = dst
+	}
+	err := os.MkdirAll(createDir, 0755)
 	if err != nil {
 		return fmt.Errorf("failed to create destination directory: %v", err)
 	}
@@ -178,7 +208,7 @@ func copyFromBoxToFile(boxPath *BoxPath, dst, apiURL string, debug func(string))
 	tempFilePath := tempFile.Name()
 	defer os.Remove(tempFilePath)
 
-	requestURL := fmt.Sprintf("%s/boxes/%s/archive?path=%s", apiURL, boxPath.BoxID, boxPath.Path)
+	requestURL := archiveURL(apiURL, boxPath)
 	debug(fmt.Sprintf("Sending GET request to: %s", requestURL))
 
 	resp, err := http.Get(requestURL)
@@ -190,10 +220,7 @@ func copyFromBoxToFile(boxPath *BoxPath, dst, apiURL string, debug func(string))
 	debug(fmt.Sprintf("HTTP response status code: %d", resp.StatusCode))
 
 	if resp.StatusCode != http.StatusOK {
-		// It's helpful to read the body even on error for more details
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		debug(fmt.Sprintf("Error response body: %s", string(bodyBytes)))
-		return fmt.Errorf("failed to download from box, HTTP status code: %d", resp.StatusCode)
+		return archiveStatusError("failed to download from box", resp)
 	}
 
 	bytesCopied, copyErr := io.Copy(tempFile, resp.Body)
@@ -216,6 +243,11 @@ func copyFromBoxToFile(boxPath *BoxPath, dst, apiURL string, debug func(string))
 	dstDir := filepath.Dir(dst)
 	srcBaseName := filepath.Base(boxPath.Path)
 	dstBaseName := filepath.Base(dst)
+	if intoDir {
+		dstDir = dst
+		dst = filepath.Join(dstDir, srcBaseName)
+		dstBaseName = srcBaseName
+	}
 
 	// Try to extract as gzip tar
 	cmd := exec.Command("tar", "-xzf", tempFilePath, "-C", dstDir)
@@ -280,7 +312,7 @@ func copyFromLocalToBox(src, dst, apiURL string, debug func(string)) error {
 }
 
 func copyFromStdinToBox(boxPath *BoxPath, apiURL string, debug func(string)) error {
-	requestURL := fmt.Sprintf("%s/boxes/%s/archive?path=%s", apiURL, boxPath.BoxID, boxPath.Path)
+	requestURL := archiveURL(apiURL, boxPath)
 	debug(fmt.Sprintf("Sending PUT request to: %s", requestURL))
 
 	req, err := http.NewRequest("PUT", requestURL, os.Stdin)
@@ -298,7 +330,7 @@ func copyFromStdinToBox(boxPath *BoxPath, apiURL string, debug func(string)) err
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to upload to box, HTTP status code: %d", resp.StatusCode)
+		return archiveStatusError("failed to upload to box", resp)
 	}
 
 	fmt.Fprintf(os.Stderr, "Copied from stdin to box %s:%s\n", boxPath.BoxID, boxPath.Path)
@@ -344,7 +376,7 @@ func copyFromFileToBox(src string, boxPath *BoxPath, apiURL string, _ func(strin
 	}
 	defer file.Close()
 
-	requestURL := fmt.Sprintf("%s/boxes/%s/archive?path=%s", apiURL, boxPath.BoxID, boxPath.Path)
+	requestURL := archiveURL(apiURL, boxPath)
 
 	req, err := http.NewRequest("PUT", requestURL, file)
 	if err != nil {
@@ -362,7 +394,7 @@ func copyFromFileToBox(src string, boxPath *BoxPath, apiURL string, _ func(strin
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to upload to box, HTTP status code: %d", resp.StatusCode)
+		return archiveStatusError("failed to upload to box", resp)
 	}
 
 	fmt.Fprintf(os.Stderr, "Copied from %s to box %s:%s\n", src, boxPath.BoxID, boxPath.Path)
@@ -18,6 +18,7 @@ type BoxDeleteOptions struct {
 	OutputFormat string
 	DeleteAll    bool
 	Force        bool
+	KeepShare    bool
 }
 
 type BoxListResponse struct {
@@ -36,6 +37,7 @@ func NewBoxDeleteCommand() *cobra.Command {
 		Example: `  gbox box delete 550e8400-e29b-41d4-a716-446655440000
   gbox box delete --all --force
   gbox box delete --all
+  gbox box delete 550e8400-e29b-41d4-a716-446655440000 --keep-share
   gbox box delete 550e8400-e29b-41d4-a716-446655440000 --output json`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return runDelete(opts, args)
@@ -47,6 +49,7 @@ func NewBoxDeleteCommand() *cobra.Command {
 	flags.StringVar(&opts.OutputFormat, "output", "text", "Output format (json or text)")
 	flags.BoolVar(&opts.DeleteAll, "all", false, "Delete all boxes")
 	flags.BoolVar(&opts.Force, "force", false, "Force deletion without confirmation")
+	flags.BoolVar(&opts.KeepShare, "keep-share", false, "Keep the files of the box in the share directory")
 
 	cmd.RegisterFlagCompletionFunc("output", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		return []string{"json", "text"}, cobra.ShellCompDirectiveNoFileComp
@@ -137,7 +140,7 @@ func deleteAllBoxes(opts *BoxDeleteOptions) error {
 
 	success := true
 	for _, box := range response.Boxes {
-		if err := performBoxDeletion(box.ID); err != nil {
+		if err := performBoxDeletion(box.ID, opts.KeepShare); err != nil {
 			fmt.Printf("Error: Failed to delete box %s: %v\n", box.ID, err)
 			success = false
 		}
@@ -166,7 +169,7 @@ func deleteBox(boxIDPrefix string, opts *BoxDeleteOptions) error {
 		return fmt.Errorf("failed to resolve box ID: %w", err)
 	}
 
-	if err := performBoxDeletion(resolvedBoxID); err != nil {
+	if err := performBoxDeletion(resolvedBoxID, opts.KeepShare); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 		return nil
 	}
@@ -179,11 +182,16 @@ func deleteBox(boxIDPrefix string, opts *BoxDeleteOptions) error {
 	return nil
 }
 
-func performBoxDeletion(boxID string) error {
+func performBoxDeletion(boxID string, keepShare bool) error {
 	apiBase := config.GetAPIURL()
 	apiURL := fmt.Sprintf("%s/api/v1/boxes/%s", strings.TrimSuffix(apiBase, "/"), boxID)
 
-	req, err := http.NewRequest("DELETE", apiURL, strings.NewReader(`{"force":true}`))
+	requestBody, err := json.Marshal(map[string]bool{"force": true, "keepShare": keepShare})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request body: %v", err)
+	}
+
+	req, err := http.NewRequest("DELETE", apiURL, bytes.NewReader(requestBody))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %v", err)
 	}
@@ -54,6 +54,7 @@ func TestDeleteSingleBox(t *testing.T) {
 			assert.NoError(t, err, "Failed to unmarshal body for delete")
 			// In performBoxDeletion, force is hardcoded to true in the request body.
 			assert.Equal(t, true, req["force"], "Request body for delete should have force:true")
+			assert.Equal(t, false, req["keepShare"], "Share files are removed unless --keep-share is given")
 
 			// Return success response for the delete call
 			w.Header().Set("Content-Type", "application/json")
@@ -461,4 +462,5 @@ func TestDeleteHelp(t *testing.T) {
 	assert.Contains(t, output, "--output")
 	assert.Contains(t, output, "--all")
 	assert.Contains(t, output, "--force")
+	assert.Contains(t, output, "--keep-share")
 }
@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+	"github.com/babelcloud/gbox/packages/cli/config"
+	"github.com/spf13/cobra"
+)
+
+type BoxDiffOptions struct {
+	OutputFormat      string
+	Exclude           []string
+	NoDefaultExcludes bool
+	Export            string
+}
+
+func NewBoxDiffCommand() *cobra.Command {
+	opts := &BoxDiffOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "diff <box-id>",
+		Short: "Show the files changed in a box since it was created",
+		Long: `Show the paths added (A), modified (M) and deleted (D) in a box since it was
+created, relative to its image. Temporary files and caches are left out by default.
+Volumes and mounted directories are not included.
+
+With --export, the added and modified files are also written to a tar archive with
+paths relative to /.`,
+		Example: `  gbox box diff 550e8400-e29b-41d4-a716-446655440000                          # List the changed paths
+  gbox box diff 550e8400-e29b-41d4-a716-446655440000 --exclude /var/log       # Also leave out /var/log
+  gbox box diff 550e8400-e29b-41d4-a716-446655440000 --export changes.tar     # Also export the changed files
+  gbox box diff 550e8400-e29b-41d4-a716-446655440000 --export - | tar -t      # Export the changed files to stdout`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDiff(args[0], opts)
+		},
+		ValidArgsFunction: completeBoxIDs,
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&opts.OutputFormat, "output", "text", "Output format (json or text)")
+	flags.StringArrayVar(&opts.Exclude, "exclude", nil, "Leave out paths matching this glob and everything under them (can be specified multiple times)")
+	flags.BoolVar(&opts.NoDefaultExcludes, "no-default-excludes", false, "Also show the temporary files and caches left out by default")
+	flags.StringVar(&opts.Export, "export", "", "Write the added and modified files to this tar archive, - for stdout")
+
+	cmd.RegisterFlagCompletionFunc("output", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"json", "text"}, cobra.ShellCompDirectiveNoFileComp
+	})
+
+	return cmd
+}
+
+func runDiff(boxIDPrefix string, opts *BoxDiffOptions) error {
+	resolvedBoxID, _, err := ResolveBoxIDPrefix(boxIDPrefix)
+	if err != nil {
+		return fmt.Errorf("failed to resolve box ID: %w", err)
+	}
+
+	query := url.Values{}
+	for _, glob := range opts.Exclude {
+		query.Add("exclude", glob)
+	}
+	if opts.NoDefaultExcludes {
+		query.Set("noDefaultExcludes", "true")
+	}
+	apiURL := fmt.Sprintf("%s/api/v1/boxes/%s/changes", strings.TrimSuffix(config.GetAPIURL(), "/"), resolvedBoxID)
+
+	// The archive takes stdout on its own
+	if opts.Export == "-" {
+		return exportChanges(apiURL, query, resolvedBoxID, os.Stdout)
+	}
+
+	changes, body, err := getChanges(apiURL, query, resolvedBoxID)
+	if err != nil {
+		return err
+	}
+	if opts.OutputFormat == "json" {
+		fmt.Println(string(body))
+	} else {
+		printChanges(os.Stdout, changes)
+	}
+
+	if opts.Export == "" {
+		return nil
+	}
+	file, err := os.Create(opts.Export)
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %v", err)
+	}
+	if err := exportChanges(apiURL, query, resolvedBoxID, file); err != nil {
+		file.Close()
+		os.Remove(opts.Export)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d changed paths to %s\n", changes.Added+changes.Modified, opts.Export)
+	return nil
+}
+
+// getChanges fetches the changes of a box, returning the raw response body too
+func getChanges(apiURL string, query url.Values, boxID string) (*model.BoxChanges, []byte, error) {
+	requestURL := apiURL + "?" + query.Encode()
+	if os.Getenv("DEBUG") == "true" {
+		fmt.Fprintf(os.Stderr, "Request URL: %s\n", requestURL)
+	}
+
+	resp, err := http.Get(requestURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("API call failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil, fmt.Errorf("box %s not found", boxID)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, archiveStatusError("failed to get changes of box", resp)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read response: %v", err)
+	}
+	var changes model.BoxChanges
+	if err := json.Unmarshal(body, &changes); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse changes: %v", err)
+	}
+	return &changes, body, nil
+}
+
+// exportChanges writes the archive of the added and modified files of a box to w
+func exportChanges(apiURL string, query url.Values, boxID string, w io.Writer) error {
+	exportQuery := url.Values{"format": {"tar"}}
+	for key, values := range query {
+		exportQuery[key] = values
+	}
+	requestURL := apiURL + "?" + exportQuery.Encode()
+	if os.Getenv("DEBUG") == "true" {
+		fmt.Fprintf(os.Stderr, "Request URL: %s\n", requestURL)
+	}
+
+	resp, err := http.Get(requestURL)
+	if err != nil {
+		return fmt.Errorf("API call failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("box %s not found", boxID)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return archiveStatusError("failed to export changes of box", resp)
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("failed to write archive: %v", err)
+	}
+	return nil
+}
+
+// printChanges prints a change per line, prefixed with A, M or D like git status
+func printChanges(w io.Writer, changes *model.BoxChanges) {
+	if len(changes.Changes) == 0 {
+		fmt.Fprintln(w, "No changes")
+		return
+	}
+	for _, change := range changes.Changes {
+		kind := "M"
+		switch change.Kind {
+		case model.BoxChangeAdded:
+			kind = "A"
+		case model.BoxChangeDeleted:
+			kind = "D"
+		}
+		fmt.Fprintf(w, "%s %s\n", kind, change.Path)
+	}
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+)
+
+func TestBoxDiff(t *testing.T) {
+	changes := model.BoxChanges{
+		Changes: []model.BoxChange{
+			{Path: "/etc/motd", Kind: model.BoxChangeDeleted},
+			{Path: "/var/gbox/main.py", Kind: model.BoxChangeAdded},
+			{Path: "/var/gbox/setup.cfg", Kind: model.BoxChangeModified},
+		},
+		Added:    1,
+		Modified: 1,
+		Deleted:  1,
+	}
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/boxes":
+			fmt.Fprintln(w, `{"boxes":[{"id":"test-box-id"}]}`)
+		case "/api/v1/boxes/test-box-id/changes":
+			queries = append(queries, r.URL.RawQuery)
+			if r.URL.Query().Get("format") != "tar" {
+				json.NewEncoder(w).Encode(changes)
+				return
+			}
+			tw := tar.NewWriter(w)
+			tw.WriteHeader(&tar.Header{Name: "var/gbox/main.py", Mode: 0644, Size: 5})
+			tw.Write([]byte("print"))
+			tw.Close()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("API_ENDPOINT", server.URL)
+
+	archive := filepath.Join(t.TempDir(), "changes.tar")
+	output := captureDiffOutput(t, "test-box-id", "--exclude", "/var/log", "--no-default-excludes", "--export", archive)
+	assert.Equal(t, "D /etc/motd\nA /var/gbox/main.py\nM /var/gbox/setup.cfg\n", output)
+	assert.Equal(t, []string{
+		"exclude=%2Fvar%2Flog&noDefaultExcludes=true",
+		"exclude=%2Fvar%2Flog&format=tar&noDefaultExcludes=true",
+	}, queries)
+
+	file, err := os.Open(archive)
+	require.NoError(t, err)
+	defer file.Close()
+	header, err := tar.NewReader(file).Next()
+	require.NoError(t, err)
+	assert.Equal(t, "var/gbox/main.py", header.Name)
+
+	changes = model.BoxChanges{Changes: []model.BoxChange{}}
+	assert.Equal(t, "No changes\n", captureDiffOutput(t, "test-box-id"))
+}
+
+// captureDiffOutput runs the diff command and returns what it printed to stdout
+func captureDiffOutput(t *testing.T, args ...string) string {
+	oldStdout := os.Stdout
+	defer func() { os.Stdout = oldStdout }()
+	rPipe, wPipe, err := os.Pipe()
+	require.NoError(t, err)
+	os.Stdout = wPipe
+
+	cmd := NewBoxDiffCommand()
+	cmd.SetArgs(args)
+	err = cmd.Execute()
+	wPipe.Close()
+	var buf bytes.Buffer
+	io.Copy(&buf, rPipe)
+	require.NoError(t, err)
+	return buf.String()
+}
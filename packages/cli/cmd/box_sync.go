@@ -0,0 +1,919 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+	"github.com/babelcloud/gbox/packages/api-server/pkg/gitignore"
+	"github.com/babelcloud/gbox/packages/cli/config"
+	"github.com/spf13/cobra"
+)
+
+// Sync directions
+const (
+	syncBoth = "both"
+	syncPush = "push"
+	syncPull = "pull"
+)
+
+// Conflict policies, applied to files changed on both sides since the last sync
+const (
+	conflictSkip   = "skip"
+	conflictLocal  = "local"
+	conflictRemote = "remote"
+	conflictNewer  = "newer"
+)
+
+// errSyncNotFound is returned when a file of the box is gone
+var errSyncNotFound = errors.New("not found")
+
+// Sync actions
+const (
+	actionPush         = "push"
+	actionPull         = "pull"
+	actionDeleteLocal  = "delete local"
+	actionDeleteRemote = "delete remote"
+	actionConflict     = "conflict"
+)
+
+type BoxSyncOptions struct {
+	Direction   string
+	Conflict    string
+	Watch       bool
+	Interval    time.Duration
+	Exclude     []string
+	NoGitignore bool
+	DryRun      bool
+}
+
+func NewBoxSyncCommand() *cobra.Command {
+	opts := &BoxSyncOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "sync <local-dir> <box-id>:<path>",
+		Short: "Synchronize a local directory with a directory in a box",
+		Long: `Synchronize a local directory with a directory in a box in both directions.
+
+Only files whose content changed are transferred, compared by their SHA-256 hash.
+Changes since the last sync are told apart from changes on the other side by the
+state kept in ~/.gbox/sync, so deletions are synced too. Files changed on both sides
+are conflicts, resolved by --conflict. Files matched by .gitignore files and .git
+directories are left out.`,
+		Example: `  gbox box sync ./project 550e8400-e29b-41d4-a716-446655440000:/workspace
+  gbox box sync ./project 550e8400-e29b-41d4-a716-446655440000:/workspace --watch
+  gbox box sync ./project 550e8400-e29b-41d4-a716-446655440000:/workspace --direction push --conflict local
+  gbox box sync ./results 550e8400-e29b-41d4-a716-446655440000:/workspace/out --direction pull --dry-run`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSync(opts, args[0], args[1])
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&opts.Direction, "direction", syncBoth, "Direction of the sync (both, push or pull)")
+	flags.StringVar(&opts.Conflict, "conflict", conflictSkip, "How to resolve files changed on both sides (skip, local, remote or newer)")
+	flags.BoolVarP(&opts.Watch, "watch", "w", false, "Keep syncing changes until interrupted")
+	flags.DurationVar(&opts.Interval, "interval", 2*time.Second, "How often local files are checked for changes in watch mode")
+	flags.StringArrayVar(&opts.Exclude, "exclude", nil, "Leave out files matching this .gitignore pattern (can be specified multiple times)")
+	flags.BoolVar(&opts.NoGitignore, "no-gitignore", false, "Also sync files matched by .gitignore files")
+	flags.BoolVar(&opts.DryRun, "dry-run", false, "Only print what would be synced")
+
+	cmd.RegisterFlagCompletionFunc("direction", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{syncBoth, syncPush, syncPull}, cobra.ShellCompDirectiveNoFileComp
+	})
+	cmd.RegisterFlagCompletionFunc("conflict", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{conflictSkip, conflictLocal, conflictRemote, conflictNewer}, cobra.ShellCompDirectiveNoFileComp
+	})
+
+	return cmd
+}
+
+// syncEntry describes a file on one side of a sync
+type syncEntry struct {
+	// Key identifies the content: the hash of a file or the target of a symlink
+	Key        string
+	Size       int64
+	ModTime    time.Time
+	Mode       os.FileMode
+	LinkTarget string
+}
+
+// cachedHash is the hash of a file, valid while its size and mtime are unchanged
+type cachedHash struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"modTime"`
+	Hash    string `json:"hash"`
+}
+
+// syncState is what a sync remembers between runs
+type syncState struct {
+	// Synced maps the paths synced last time to the key both sides had
+	Synced map[string]string `json:"synced"`
+	// Hashes caches the hashes of local files
+	Hashes map[string]cachedHash `json:"hashes"`
+	// RemoteHashes caches the hashes of the files of the box, which it does not read
+	// again while they are unchanged
+	RemoteHashes map[string]cachedHash `json:"remoteHashes"`
+}
+
+// syncAction is a step of a sync
+type syncAction struct {
+	Kind string
+	Path string
+	// Key is what both sides have after the action
+	Key string
+	// Resolution is the conflict policy that chose the action, if any
+	Resolution string
+}
+
+// boxSync syncs a local directory with a directory in a box
+type boxSync struct {
+	opts       *BoxSyncOptions
+	apiURL     string
+	boxID      string
+	localRoot  string
+	remoteRoot string
+	statePath  string
+	state      *syncState
+	ignore     *gitignore.Matcher
+	out        io.Writer
+}
+
+func runSync(opts *BoxSyncOptions, local, remote string) error {
+	switch opts.Direction {
+	case syncBoth, syncPush, syncPull:
+	default:
+		return fmt.Errorf("invalid direction %q, must be one of both, push or pull", opts.Direction)
+	}
+	switch opts.Conflict {
+	case conflictSkip, conflictLocal, conflictRemote, conflictNewer:
+	default:
+		return fmt.Errorf("invalid conflict policy %q, must be one of skip, local, remote or newer", opts.Conflict)
+	}
+	if opts.Watch && opts.Interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+
+	boxPath, err := parseBoxPath(remote)
+	if err != nil {
+		return err
+	}
+	resolvedBoxID, _, err := ResolveBoxIDPrefix(boxPath.BoxID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve box ID: %w", err)
+	}
+	localRoot, err := filepath.Abs(local)
+	if err != nil {
+		return fmt.Errorf("failed to resolve local path: %v", err)
+	}
+	if info, err := os.Stat(localRoot); err == nil && !info.IsDir() {
+		return fmt.Errorf("local path %s is not a directory", localRoot)
+	}
+
+	s := &boxSync{
+		opts:       opts,
+		apiURL:     fmt.Sprintf("%s/api/v1", strings.TrimSuffix(config.GetAPIURL(), "/")),
+		boxID:      resolvedBoxID,
+		localRoot:  localRoot,
+		remoteRoot: path.Clean(boxPath.Path),
+		out:        os.Stdout,
+	}
+	if err := s.loadState(); err != nil {
+		return err
+	}
+
+	if !opts.Watch {
+		return s.run()
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return s.watch(ctx)
+}
+
+// loadState reads the state of the previous sync between the same directories
+func (s *boxSync) loadState() error {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get home directory: %v", err)
+	}
+	id := sha256.Sum256([]byte(s.localRoot + "\n" + s.boxID + ":" + s.remoteRoot))
+	s.statePath = filepath.Join(homeDir, ".gbox", "sync", hex.EncodeToString(id[:8])+".json")
+	s.state = &syncState{Synced: map[string]string{}, Hashes: map[string]cachedHash{}, RemoteHashes: map[string]cachedHash{}}
+
+	data, err := os.ReadFile(s.statePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read sync state: %v", err)
+	}
+	if err := json.Unmarshal(data, s.state); err != nil {
+		return fmt.Errorf("failed to parse sync state %s: %v", s.statePath, err)
+	}
+	if s.state.Synced == nil {
+		s.state.Synced = map[string]string{}
+	}
+	if s.state.Hashes == nil {
+		s.state.Hashes = map[string]cachedHash{}
+	}
+	if s.state.RemoteHashes == nil {
+		s.state.RemoteHashes = map[string]cachedHash{}
+	}
+	return nil
+}
+
+func (s *boxSync) saveState() error {
+	data, err := json.Marshal(s.state)
+	if err != nil {
+		return fmt.Errorf("failed to encode sync state: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.statePath), 0755); err != nil {
+		return fmt.Errorf("failed to create sync state directory: %v", err)
+	}
+	if err := os.WriteFile(s.statePath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write sync state: %v", err)
+	}
+	return nil
+}
+
+// run syncs the directories once
+func (s *boxSync) run() error {
+	local, err := s.localManifest()
+	if err != nil {
+		return err
+	}
+	remote, unreadable, err := s.remoteManifest()
+	if err != nil {
+		return err
+	}
+	// Files that cannot be read in the box are left alone rather than taken as deleted
+	synced := make(map[string]string, len(s.state.Synced))
+	for p, key := range s.state.Synced {
+		synced[p] = key
+	}
+	for _, p := range unreadable {
+		fmt.Fprintf(s.out, "skip %s: cannot be read in the box\n", p)
+		delete(local, p)
+		delete(synced, p)
+	}
+
+	actions := planSync(local, remote, synced, s.opts.Direction, s.opts.Conflict)
+	if len(actions) == 0 {
+		// Changes made by the sync itself are reported back while watching
+		if !s.opts.Watch {
+			fmt.Fprintln(s.out, "Already in sync")
+		}
+		return nil
+	}
+	for _, action := range actions {
+		if action.Kind == actionConflict {
+			fmt.Fprintf(s.out, "conflict %s: changed on both sides, skipped\n", action.Path)
+		} else if action.Resolution != "" {
+			fmt.Fprintf(s.out, "%s %s (conflict resolved with --conflict %s)\n", action.Kind, action.Path, s.opts.Conflict)
+		} else {
+			fmt.Fprintf(s.out, "%s %s\n", action.Kind, action.Path)
+		}
+	}
+	if s.opts.DryRun {
+		return nil
+	}
+
+	failed := s.apply(actions, local, remote, unreadable)
+	if err := s.saveState(); err != nil {
+		return err
+	}
+
+	counts := map[string]int{}
+	for _, action := range actions {
+		counts[action.Kind]++
+	}
+	fmt.Fprintf(s.out, "Synced %s with box %s:%s: %d pushed, %d pulled, %d deleted, %d conflicts\n",
+		s.localRoot, s.boxID, s.remoteRoot, counts[actionPush], counts[actionPull],
+		counts[actionDeleteLocal]+counts[actionDeleteRemote], counts[actionConflict])
+	if failed > 0 {
+		return fmt.Errorf("failed to sync %d files", failed)
+	}
+	return nil
+}
+
+// planSync compares both sides with the keys of the last sync. A file changed on one
+// side only is copied to the other, or deleted there if it was deleted. Files changed
+// on both sides are conflicts, resolved by the policy.
+func planSync(local, remote map[string]syncEntry, synced map[string]string, direction, policy string) []syncAction {
+	paths := map[string]bool{}
+	for p := range local {
+		paths[p] = true
+	}
+	for p := range remote {
+		paths[p] = true
+	}
+	for p := range synced {
+		paths[p] = true
+	}
+
+	var actions []syncAction
+	for p := range paths {
+		l, r, base := local[p].Key, remote[p].Key, synced[p]
+		var action syncAction
+		switch {
+		case l == r:
+			continue
+		case l == base:
+			action = remoteChange(p, r)
+		case r == base:
+			action = localChange(p, l)
+		default:
+			action = syncAction{Kind: actionConflict, Path: p}
+			switch policy {
+			case conflictLocal:
+				action = localChange(p, l)
+			case conflictRemote:
+				action = remoteChange(p, r)
+			case conflictNewer:
+				// A deleted file is older than one changed on the other side
+				if r == "" || (l != "" && local[p].ModTime.After(remote[p].ModTime)) {
+					action = localChange(p, l)
+				} else {
+					action = remoteChange(p, r)
+				}
+			}
+			if action.Kind != actionConflict {
+				action.Resolution = policy
+			}
+		}
+
+		switch action.Kind {
+		case actionPush, actionDeleteRemote:
+			if direction == syncPull {
+				continue
+			}
+		case actionPull, actionDeleteLocal:
+			if direction == syncPush {
+				continue
+			}
+		}
+		actions = append(actions, action)
+	}
+
+	sort.Slice(actions, func(i, j int) bool { return actions[i].Path < actions[j].Path })
+	return actions
+}
+
+// localChange is the action that brings a local change to the box
+func localChange(p, key string) syncAction {
+	if key == "" {
+		return syncAction{Kind: actionDeleteRemote, Path: p}
+	}
+	return syncAction{Kind: actionPush, Path: p, Key: key}
+}
+
+// remoteChange is the action that brings a change in the box to the local directory
+func remoteChange(p, key string) syncAction {
+	if key == "" {
+		return syncAction{Kind: actionDeleteLocal, Path: p}
+	}
+	return syncAction{Kind: actionPull, Path: p, Key: key}
+}
+
+// apply carries out the actions and records the synced files, returning how many failed
+func (s *boxSync) apply(actions []syncAction, local, remote map[string]syncEntry, unreadable []string) int {
+	failed := 0
+	fail := func(action syncAction, err error) {
+		fmt.Fprintf(os.Stderr, "Error: failed to %s %s: %v\n", action.Kind, action.Path, err)
+		failed++
+	}
+	done := func(action syncAction) {
+		if action.Key == "" {
+			delete(s.state.Synced, action.Path)
+		} else {
+			s.state.Synced[action.Path] = action.Key
+		}
+	}
+
+	// Files that are the same on both sides are in sync as well
+	for p, entry := range local {
+		if remote[p].Key == entry.Key {
+			s.state.Synced[p] = entry.Key
+		}
+	}
+	keep := map[string]bool{}
+	for _, p := range unreadable {
+		keep[p] = true
+	}
+	for p := range s.state.Synced {
+		if _, ok := local[p]; !ok && !keep[p] {
+			if _, ok := remote[p]; !ok {
+				delete(s.state.Synced, p)
+			}
+		}
+	}
+
+	var pushes []syncAction
+	for _, action := range actions {
+		switch action.Kind {
+		case actionPush:
+			pushes = append(pushes, action)
+		case actionPull:
+			if err := s.pull(action.Path, remote[action.Path]); err != nil {
+				fail(action, err)
+				continue
+			}
+			done(action)
+		case actionDeleteLocal:
+			if err := s.deleteLocal(action.Path); err != nil {
+				fail(action, err)
+				continue
+			}
+			done(action)
+		case actionDeleteRemote:
+			if err := s.deleteRemote(action.Path); err != nil {
+				fail(action, err)
+				continue
+			}
+			done(action)
+		}
+	}
+
+	if len(pushes) > 0 {
+		if err := s.push(pushes, local); err != nil {
+			for _, action := range pushes {
+				fail(action, err)
+			}
+		} else {
+			for _, action := range pushes {
+				done(action)
+			}
+		}
+	}
+	return failed
+}
+
+// newIgnore returns the rules files are left out by, with those of the .gitignore file of
+// the root directory
+func (s *boxSync) newIgnore() (*gitignore.Matcher, error) {
+	ignore := &gitignore.Matcher{}
+	ignore.AddPatterns("", []string{".git/"})
+	ignore.AddPatterns("", s.opts.Exclude)
+	if !s.opts.NoGitignore {
+		if err := loadGitignore(ignore, s.localRoot, ""); err != nil {
+			return nil, fmt.Errorf("failed to read .gitignore: %v", err)
+		}
+	}
+	return ignore, nil
+}
+
+// localManifest describes the files of the local directory, hashing only those changed
+// since they were last hashed
+func (s *boxSync) localManifest() (map[string]syncEntry, error) {
+	ignore, err := s.newIgnore()
+	if err != nil {
+		return nil, err
+	}
+	s.ignore = ignore
+
+	files := map[string]syncEntry{}
+	hashes := map[string]cachedHash{}
+	if _, err := os.Stat(s.localRoot); os.IsNotExist(err) {
+		s.state.Hashes = hashes
+		return files, nil
+	}
+
+	err = filepath.WalkDir(s.localRoot, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == s.localRoot {
+			return nil
+		}
+		rel, err := filepath.Rel(s.localRoot, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if entry.IsDir() {
+			if s.ignore.Ignored(rel, true) {
+				return filepath.SkipDir
+			}
+			if !s.opts.NoGitignore {
+				return loadGitignore(s.ignore, p, rel)
+			}
+			return nil
+		}
+		if s.ignore.Ignored(rel, false) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			files[rel] = syncEntry{Key: "symlink:" + target, ModTime: info.ModTime(), LinkTarget: target}
+		case info.Mode().IsRegular():
+			cached, ok := s.state.Hashes[rel]
+			if !ok || cached.Size != info.Size() || cached.ModTime != info.ModTime().UnixNano() {
+				hash, err := hashFile(p)
+				if err != nil {
+					return err
+				}
+				cached = cachedHash{Size: info.Size(), ModTime: info.ModTime().UnixNano(), Hash: hash}
+			}
+			hashes[rel] = cached
+			files[rel] = syncEntry{Key: cached.Hash, Size: info.Size(), ModTime: info.ModTime(), Mode: info.Mode().Perm()}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %v", s.localRoot, err)
+	}
+	s.state.Hashes = hashes
+	return files, nil
+}
+
+func hashFile(p string) (string, error) {
+	file, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// remoteManifest describes the files of the directory in the box, which may not exist
+// yet. It also returns the files the box cannot hash, which are left alone.
+func (s *boxSync) remoteManifest() (map[string]syncEntry, []string, error) {
+	params := model.BoxFileManifestParams{
+		Path:    s.remoteRoot,
+		Exclude: s.ignore.PrunableNames(),
+		Known:   make(map[string]model.BoxFileManifestKnown, len(s.state.RemoteHashes)),
+	}
+	for p, cached := range s.state.RemoteHashes {
+		params.Known[p] = model.BoxFileManifestKnown{Size: cached.Size, LastModified: time.Unix(0, cached.ModTime), Hash: cached.Hash}
+	}
+	body, err := json.Marshal(params)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode request: %v", err)
+	}
+
+	resp, err := http.Post(fmt.Sprintf("%s/boxes/%s/fs/manifest", s.apiURL, s.boxID), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get files of box: %v", err)
+	}
+	defer resp.Body.Close()
+
+	files := map[string]syncEntry{}
+	if resp.StatusCode == http.StatusNotFound {
+		var errorData struct {
+			Code string `json:"code"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&errorData) == nil && errorData.Code == "PathNotFound" {
+			return files, nil, nil
+		}
+		return nil, nil, fmt.Errorf("box %s not found", s.boxID)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, archiveStatusError("failed to get files of box", resp)
+	}
+
+	var manifest model.BoxFileManifest
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse file manifest: %v", err)
+	}
+
+	// The box reports mtimes in seconds, so only the hashes of files that were not modified
+	// around the time they were hashed stay valid while the mtime is unchanged
+	var hashedBefore time.Time
+	if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+		hashedBefore = date.Add(-2 * time.Second)
+	}
+
+	var unreadable []string
+	hashes := map[string]cachedHash{}
+	for p, file := range manifest.Files {
+		if s.ignore.Ignored(p, file.Type == model.FileTypeDirectory) {
+			continue
+		}
+		if file.Hash != "" && file.LastModified.Before(hashedBefore) {
+			hashes[p] = cachedHash{Size: file.Size, ModTime: file.LastModified.UnixNano(), Hash: file.Hash}
+		}
+		entry := syncEntry{Size: file.Size, ModTime: file.LastModified, LinkTarget: file.LinkTarget}
+		switch file.Type {
+		case model.FileTypeFile:
+			if file.Hash == "" {
+				unreadable = append(unreadable, p)
+				continue
+			}
+			entry.Key = file.Hash
+		case model.FileTypeSymlink:
+			entry.Key = "symlink:" + file.LinkTarget
+		default:
+			continue
+		}
+		files[p] = entry
+	}
+	s.state.RemoteHashes = hashes
+	sort.Strings(unreadable)
+	return files, unreadable, nil
+}
+
+// push uploads local files to the box as a single archive, streamed while it is written
+func (s *boxSync) push(actions []syncAction, local map[string]syncEntry) error {
+	if err := s.postFileOperation("mkdir", model.BoxFileMkdirParams{Path: s.remoteRoot, Parents: true}); err != nil {
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(s.writePushArchive(pw, actions, local))
+	}()
+	defer pr.Close()
+
+	req, err := http.NewRequest("PUT", archiveURL(s.apiURL, &BoxPath{BoxID: s.boxID, Path: s.remoteRoot}), pr)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-tar")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload to box: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return archiveStatusError("failed to upload to box", resp)
+	}
+	return nil
+}
+
+// writePushArchive writes the local files of actions to w as a tar archive
+func (s *boxSync) writePushArchive(w io.Writer, actions []syncAction, local map[string]syncEntry) error {
+	tw := tar.NewWriter(w)
+	for _, action := range actions {
+		entry := local[action.Path]
+		localPath := filepath.Join(s.localRoot, filepath.FromSlash(action.Path))
+		if entry.LinkTarget != "" {
+			if err := tw.WriteHeader(&tar.Header{
+				Typeflag: tar.TypeSymlink,
+				Name:     action.Path,
+				Linkname: entry.LinkTarget,
+				Mode:     0777,
+				ModTime:  entry.ModTime,
+			}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		file, err := os.Open(localPath)
+		if err != nil {
+			return err
+		}
+		err = tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     action.Path,
+			Size:     entry.Size,
+			Mode:     int64(entry.Mode),
+			ModTime:  entry.ModTime,
+		})
+		if err == nil {
+			_, err = io.CopyN(tw, file, entry.Size)
+		}
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("failed to archive %s: %v", action.Path, err)
+		}
+	}
+	return tw.Close()
+}
+
+// pull downloads a file from the box, replacing the local one at once
+func (s *boxSync) pull(rel string, entry syncEntry) error {
+	resp, err := http.Get(archiveURL(s.apiURL, &BoxPath{BoxID: s.boxID, Path: path.Join(s.remoteRoot, rel)}))
+	if err != nil {
+		return fmt.Errorf("failed to download from box: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return archiveStatusError("failed to download from box", resp)
+	}
+
+	tr := tar.NewReader(resp.Body)
+	header, err := tr.Next()
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %v", err)
+	}
+
+	localPath := filepath.Join(s.localRoot, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return err
+	}
+
+	switch header.Typeflag {
+	case tar.TypeSymlink:
+		if err := os.Remove(localPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return os.Symlink(header.Linkname, localPath)
+	case tar.TypeReg:
+	default:
+		return fmt.Errorf("not a regular file")
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(localPath), ".gbox-sync-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, tr); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), os.FileMode(header.Mode).Perm()); err != nil {
+		return err
+	}
+	if err := os.Chtimes(tmp.Name(), header.ModTime, header.ModTime); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), localPath); err != nil {
+		return err
+	}
+
+	// The content is known, so it need not be hashed again
+	if info, err := os.Stat(localPath); err == nil {
+		s.state.Hashes[rel] = cachedHash{Size: info.Size(), ModTime: info.ModTime().UnixNano(), Hash: entry.Key}
+	}
+	return nil
+}
+
+// deleteLocal removes a local file and the directories it leaves empty
+func (s *boxSync) deleteLocal(rel string) error {
+	localPath := filepath.Join(s.localRoot, filepath.FromSlash(rel))
+	if err := os.Remove(localPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	delete(s.state.Hashes, rel)
+	for dir := filepath.Dir(localPath); dir != s.localRoot && strings.HasPrefix(dir, s.localRoot); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// deleteRemote removes a file in the box
+func (s *boxSync) deleteRemote(rel string) error {
+	err := s.postFileOperation("remove", model.BoxFileRemoveParams{Path: path.Join(s.remoteRoot, rel)})
+	if errors.Is(err, errSyncNotFound) {
+		return nil
+	}
+	return err
+}
+
+// postFileOperation posts a request to a filesystem endpoint of the box
+func (s *boxSync) postFileOperation(operation string, params any) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request body: %v", err)
+	}
+	requestURL := fmt.Sprintf("%s/boxes/%s/fs/%s", s.apiURL, s.boxID, operation)
+	resp, err := http.Post(requestURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to %s in box: %v", operation, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err := archiveStatusError(fmt.Sprintf("failed to %s in box", operation), resp)
+		if resp.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("%w: %v", errSyncNotFound, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// watch syncs once, then again whenever local files change or the box reports changes
+func (s *boxSync) watch(ctx context.Context) error {
+	if err := s.run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	fmt.Fprintf(s.out, "Watching for changes, press Ctrl+C to stop\n")
+
+	remoteChanges := make(chan struct{}, 1)
+	if s.opts.Direction != syncPush {
+		go s.watchRemote(ctx, remoteChanges)
+	}
+	ticker := time.NewTicker(s.opts.Interval)
+	defer ticker.Stop()
+
+	signature := s.localSignature()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if s.opts.Direction == syncPull {
+				continue
+			}
+			if current := s.localSignature(); current == signature {
+				continue
+			}
+		case <-remoteChanges:
+		}
+
+		if err := s.run(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		signature = s.localSignature()
+	}
+}
+
+// localSignature sums up the paths, sizes and mtimes of the local files, which is cheap
+// enough to poll
+func (s *boxSync) localSignature() string {
+	hash := sha256.New()
+	filepath.WalkDir(s.localRoot, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil || p == s.localRoot {
+			return nil
+		}
+		rel, _ := filepath.Rel(s.localRoot, p)
+		rel = filepath.ToSlash(rel)
+		if s.ignore != nil && s.ignore.Ignored(rel, entry.IsDir()) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info, err := entry.Info(); err == nil {
+			fmt.Fprintf(hash, "%s\x00%d\x00%d\x00", rel, info.Size(), info.ModTime().UnixNano())
+		}
+		return nil
+	})
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// watchRemote follows the change stream of the directory in the box, reconnecting
+// after failures, and signals changes on the channel
+func (s *boxSync) watchRemote(ctx context.Context, changes chan<- struct{}) {
+	query := url.Values{"path": {s.remoteRoot}, "recursive": {"true"}}
+	requestURL := fmt.Sprintf("%s/boxes/%s/fs/watch?%s", s.apiURL, s.boxID, query.Encode())
+
+	for ctx.Err() == nil {
+		req, err := http.NewRequestWithContext(ctx, "GET", requestURL, nil)
+		if err != nil {
+			return
+		}
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			if resp.StatusCode == http.StatusOK {
+				scanner := bufio.NewScanner(resp.Body)
+				for scanner.Scan() {
+					if strings.TrimSpace(scanner.Text()) == "" {
+						continue
+					}
+					select {
+					case changes <- struct{}{}:
+					default:
+					}
+				}
+			}
+			resp.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(s.opts.Interval):
+		}
+	}
+}
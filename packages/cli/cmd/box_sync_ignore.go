@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/babelcloud/gbox/packages/api-server/pkg/gitignore"
+)
+
+// loadGitignore adds the patterns of the .gitignore file in the directory dir, which is
+// base relative to the sync root, if there is one
+func loadGitignore(ignore *gitignore.Matcher, dir, base string) error {
+	content, err := os.ReadFile(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	ignore.AddFile(base, content)
+	return nil
+}
@@ -0,0 +1,247 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	model "github.com/babelcloud/gbox/packages/api-server/pkg/box"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanSync(t *testing.T) {
+	old, recent := time.Unix(1700000000, 0), time.Unix(1800000000, 0)
+	entry := func(key string, modTime time.Time) syncEntry {
+		return syncEntry{Key: key, ModTime: modTime}
+	}
+	local := map[string]syncEntry{
+		"same":          entry("a", old),
+		"local-changed": entry("b2", recent),
+		"local-new":     entry("c", recent),
+		"remote-del":    entry("d", old),
+		"both":          entry("e-local", recent),
+		"both-del":      entry("f-local", old),
+	}
+	remote := map[string]syncEntry{
+		"same":          entry("a", old),
+		"local-changed": entry("b", old),
+		"remote-new":    entry("g", recent),
+		"local-del":     entry("h", old),
+		"both":          entry("e-remote", old),
+	}
+	synced := map[string]string{
+		"same":          "a",
+		"local-changed": "b",
+		"remote-del":    "d",
+		"local-del":     "h",
+		"both":          "e",
+		"both-del":      "f",
+	}
+
+	kinds := func(actions []syncAction) map[string]string {
+		result := map[string]string{}
+		for _, action := range actions {
+			result[action.Path] = action.Kind
+		}
+		return result
+	}
+
+	assert.Equal(t, map[string]string{
+		"both":          actionConflict,
+		"both-del":      actionConflict,
+		"local-changed": actionPush,
+		"local-del":     actionDeleteRemote,
+		"local-new":     actionPush,
+		"remote-del":    actionDeleteLocal,
+		"remote-new":    actionPull,
+	}, kinds(planSync(local, remote, synced, syncBoth, conflictSkip)))
+
+	actions := kinds(planSync(local, remote, synced, syncBoth, conflictRemote))
+	assert.Equal(t, actionPull, actions["both"])
+	assert.Equal(t, actionDeleteLocal, actions["both-del"])
+
+	actions = kinds(planSync(local, remote, synced, syncBoth, conflictNewer))
+	assert.Equal(t, actionPush, actions["both"])
+	assert.Equal(t, actionPush, actions["both-del"], "a deleted file loses against a changed one")
+
+	assert.Equal(t, map[string]string{
+		"both":          actionPush,
+		"both-del":      actionPush,
+		"local-changed": actionPush,
+		"local-del":     actionDeleteRemote,
+		"local-new":     actionPush,
+	}, kinds(planSync(local, remote, synced, syncPush, conflictLocal)))
+
+	// Without a previous sync, files on both sides that differ are conflicts
+	assert.Equal(t, map[string]string{
+		"both":          actionConflict,
+		"local-changed": actionConflict,
+		"local-del":     actionPull,
+		"local-new":     actionPush,
+		"remote-del":    actionPush,
+		"both-del":      actionPush,
+		"remote-new":    actionPull,
+	}, kinds(planSync(local, remote, map[string]string{}, syncBoth, conflictSkip)))
+}
+
+// newSyncTestServer emulates the manifest, filesystem and archive endpoints of a box whose
+// filesystem is rooted at root
+func newSyncTestServer(t *testing.T, root string) *httptest.Server {
+	archiveServer := newArchiveTestServer(t, root)
+	t.Cleanup(archiveServer.Close)
+	archiveURL, err := url.Parse(archiveServer.URL)
+	require.NoError(t, err)
+	proxy := httputil.NewSingleHostReverseProxy(archiveURL)
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/boxes/box-id/archive":
+			proxy.ServeHTTP(w, r)
+
+		case "/api/v1/boxes/box-id/fs/manifest":
+			var params model.BoxFileManifestParams
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&params))
+			dir := filepath.Join(root, filepath.FromSlash(params.Path))
+			if _, err := os.Stat(dir); err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"code":"PathNotFound","message":"no such directory"}`))
+				return
+			}
+			manifest := model.BoxFileManifest{Path: params.Path, Files: map[string]model.BoxFileManifestEntry{}}
+			filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+				if err != nil || p == dir {
+					return err
+				}
+				rel, _ := filepath.Rel(dir, p)
+				rel = filepath.ToSlash(rel)
+				entry := model.BoxFileManifestEntry{Type: model.FileTypeDirectory, LastModified: info.ModTime()}
+				if info.Mode().IsRegular() {
+					entry = model.BoxFileManifestEntry{Type: model.FileTypeFile, Size: info.Size(), LastModified: info.ModTime()}
+					if known, ok := params.Known[rel]; ok && known.Size == entry.Size && known.LastModified.Equal(entry.LastModified) {
+						entry.Hash = known.Hash
+					} else {
+						content, err := os.ReadFile(p)
+						require.NoError(t, err)
+						sum := sha256.Sum256(content)
+						entry.Hash = hex.EncodeToString(sum[:])
+					}
+				}
+				manifest.Files[rel] = entry
+				return nil
+			})
+			json.NewEncoder(w).Encode(manifest)
+
+		case "/api/v1/boxes/box-id/fs/mkdir":
+			var params model.BoxFileMkdirParams
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&params))
+			require.NoError(t, os.MkdirAll(filepath.Join(root, filepath.FromSlash(params.Path)), 0755))
+			w.Write([]byte(`{}`))
+
+		case "/api/v1/boxes/box-id/fs/remove":
+			var params model.BoxFileRemoveParams
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&params))
+			if err := os.Remove(filepath.Join(root, filepath.FromSlash(params.Path))); err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"code":"PathNotFound","message":"no such file"}`))
+				return
+			}
+			w.Write([]byte(`{"message":"removed"}`))
+
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestBoxSync(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	boxRoot := t.TempDir()
+	server := newSyncTestServer(t, boxRoot)
+	defer server.Close()
+
+	localRoot := t.TempDir()
+	remoteDir := filepath.Join(boxRoot, "work")
+	write := func(p, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0644))
+	}
+	read := func(p string) string {
+		content, err := os.ReadFile(p)
+		require.NoError(t, err)
+		return string(content)
+	}
+	write(filepath.Join(localRoot, ".gitignore"), "*.log\n")
+	write(filepath.Join(localRoot, "src", "main.go"), "package main")
+	write(filepath.Join(localRoot, "debug.log"), "ignored")
+	write(filepath.Join(remoteDir, "out", "result.txt"), "42")
+
+	var out bytes.Buffer
+	newSync := func(opts *BoxSyncOptions) *boxSync {
+		s := &boxSync{
+			opts:       opts,
+			apiURL:     server.URL + "/api/v1",
+			boxID:      "box-id",
+			localRoot:  localRoot,
+			remoteRoot: "/work",
+			out:        &out,
+		}
+		require.NoError(t, s.loadState())
+		return s
+	}
+	defaults := &BoxSyncOptions{Direction: syncBoth, Conflict: conflictSkip}
+
+	// The first sync copies files missing on either side
+	require.NoError(t, newSync(defaults).run())
+	assert.Equal(t, "package main", read(filepath.Join(remoteDir, "src", "main.go")))
+	assert.Equal(t, "42", read(filepath.Join(localRoot, "out", "result.txt")))
+	assert.NoFileExists(t, filepath.Join(remoteDir, "debug.log"))
+	assert.Contains(t, out.String(), "2 pushed, 1 pulled, 0 deleted")
+
+	// The hashes of box files modified long enough ago are sent back so the box does not
+	// read them again
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(remoteDir, "src", "main.go"), past, past))
+	out.Reset()
+	s := newSync(defaults)
+	require.NoError(t, s.run())
+	assert.Equal(t, "Already in sync\n", out.String())
+	assert.Contains(t, s.state.RemoteHashes, "src/main.go")
+	assert.NotContains(t, s.state.RemoteHashes, "out/result.txt", "modified while it was hashed")
+
+	// Changes on one side only are synced, deletions included
+	write(filepath.Join(remoteDir, "out", "result.txt"), "43")
+	require.NoError(t, os.Remove(filepath.Join(localRoot, "src", "main.go")))
+	out.Reset()
+	require.NoError(t, newSync(defaults).run())
+	assert.Equal(t, "43", read(filepath.Join(localRoot, "out", "result.txt")))
+	assert.NoFileExists(t, filepath.Join(remoteDir, "src", "main.go"))
+	assert.Contains(t, out.String(), "delete remote src/main.go")
+
+	// Files changed on both sides are left alone unless a policy resolves them
+	write(filepath.Join(remoteDir, "out", "result.txt"), "remote")
+	write(filepath.Join(localRoot, "out", "result.txt"), "local")
+	out.Reset()
+	require.NoError(t, newSync(defaults).run())
+	assert.Contains(t, out.String(), "conflict out/result.txt")
+	assert.Equal(t, "remote", read(filepath.Join(remoteDir, "out", "result.txt")))
+
+	out.Reset()
+	require.NoError(t, newSync(&BoxSyncOptions{Direction: syncBoth, Conflict: conflictLocal, DryRun: true}).run())
+	assert.True(t, strings.HasPrefix(out.String(), "push out/result.txt"), out.String())
+	assert.Equal(t, "remote", read(filepath.Join(remoteDir, "out", "result.txt")))
+
+	require.NoError(t, newSync(&BoxSyncOptions{Direction: syncBoth, Conflict: conflictLocal}).run())
+	assert.Equal(t, "local", read(filepath.Join(remoteDir, "out", "result.txt")))
+}